@@ -0,0 +1,255 @@
+// Command cshared builds Hide as a C shared library so other languages can link it instead of running the
+// command line. Build it with
+//
+//	go build -buildmode=c-shared -o libhide.so github.com/andresmejia3/hide/cshared
+//
+// which also writes libhide.h. Every function returns one of the HIDE_* codes. Buffers and strings returned
+// through out parameters are allocated with malloc and must be released with hide_free.
+package main
+
+/*
+#include <stdlib.h>
+#include <stdint.h>
+
+// HIDE_ABI_VERSION is bumped whenever a function, struct or code changes. Version 2 added
+// HIDE_ERR_CORRUPT_HEADER and HIDE_ERR_UNSUPPORTED_VERSION. A code a caller doesn't know should be treated as
+// HIDE_ERR_OTHER.
+#define HIDE_ABI_VERSION 2
+
+#define HIDE_OK 0
+#define HIDE_ERR_CAPACITY_EXCEEDED 1
+#define HIDE_ERR_NOT_STEGO_IMAGE 2
+#define HIDE_ERR_WRONG_PASSPHRASE 3
+#define HIDE_ERR_CORRUPT_PAYLOAD 4
+#define HIDE_ERR_UNSUPPORTED_FORMAT 5
+#define HIDE_ERR_OTHER 6
+#define HIDE_ERR_CORRUPT_HEADER 7
+#define HIDE_ERR_UNSUPPORTED_VERSION 8
+
+// hide_options selects how a message is concealed or revealed. Zero values and NULL strings select the
+// defaults: 1 bit per channel, 3 channels, the lsb strategy and the linear traversal. An unknown strategy or
+// traversal fails with HIDE_ERR_OTHER.
+typedef struct {
+	const char *passphrase;
+	int bits_per_channel;
+	int channels;
+	const char *strategy;
+	const char *traversal;
+	int hide_header;
+} hide_options;
+
+// hide_header_info describes the header of a stego image
+typedef struct {
+	int bits_per_channel;
+	int channels;
+	int strategy_id;
+	uint64_t message_size;
+} hide_header_info;
+*/
+import "C"
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"image"
+	"image/png"
+	"math"
+	"unsafe"
+)
+
+// errTooLarge is returned for a buffer larger than C.GoBytes can copy
+var errTooLarge = errors.New("buffer is larger than 2 GiB")
+
+func main() {}
+
+//export hide_abi_version
+func hide_abi_version() C.int {
+	return C.HIDE_ABI_VERSION
+}
+
+// hide_conceal hides message in the cover image and returns the stego image as PNG bytes through out
+//
+//export hide_conceal
+func hide_conceal(cover *C.uchar, coverLen C.size_t, message *C.uchar, messageLen C.size_t,
+	options *C.hide_options, out **C.uchar, outLen *C.size_t, errOut **C.char) C.int {
+
+	opts, err := makeOptions(options)
+	if err != nil {
+		return failure(err, errOut)
+	}
+
+	img, err := decodeImage(cover, coverLen)
+	if err != nil {
+		return failure(err, errOut)
+	}
+
+	payload, err := goBytes(message, messageLen)
+	if err != nil {
+		return failure(err, errOut)
+	}
+
+	outputImage, err := stego.ConcealImage(img, bytes.NewReader(payload), opts...)
+	if err != nil {
+		return failure(err, errOut)
+	}
+
+	var output bytes.Buffer
+	if err := png.Encode(&output, outputImage); err != nil {
+		return failure(err, errOut)
+	}
+
+	*out = (*C.uchar)(C.CBytes(output.Bytes()))
+	*outLen = C.size_t(output.Len())
+	return C.HIDE_OK
+}
+
+// hide_reveal extracts the message hidden in the image and returns it through out
+//
+//export hide_reveal
+func hide_reveal(data *C.uchar, dataLen C.size_t, options *C.hide_options, out **C.uchar, outLen *C.size_t,
+	errOut **C.char) C.int {
+
+	opts, err := makeOptions(options)
+	if err != nil {
+		return failure(err, errOut)
+	}
+
+	img, err := decodeImage(data, dataLen)
+	if err != nil {
+		return failure(err, errOut)
+	}
+
+	var message bytes.Buffer
+	if _, err := stego.RevealImage(img, &message, opts...); err != nil {
+		return failure(err, errOut)
+	}
+
+	*out = (*C.uchar)(C.CBytes(message.Bytes()))
+	*outLen = C.size_t(message.Len())
+	return C.HIDE_OK
+}
+
+// hide_info decodes the header of the image into info. Only the passphrase of options is used.
+//
+//export hide_info
+func hide_info(data *C.uchar, dataLen C.size_t, options *C.hide_options, info *C.hide_header_info,
+	errOut **C.char) C.int {
+
+	opts, err := makeOptions(options)
+	if err != nil {
+		return failure(err, errOut)
+	}
+
+	img, err := decodeImage(data, dataLen)
+	if err != nil {
+		return failure(err, errOut)
+	}
+
+	header, err := stego.DecodeHeader(img, opts...)
+	if err != nil {
+		return failure(err, errOut)
+	}
+
+	info.bits_per_channel = C.int(header.NumBitsPerChannel)
+	info.channels = C.int(header.NumChannels)
+	info.strategy_id = C.int(header.Strategy.HeaderID())
+	info.message_size = C.uint64_t(header.NumMessageBits / 8)
+	return C.HIDE_OK
+}
+
+// hide_free releases a buffer or string returned by the library
+//
+//export hide_free
+func hide_free(ptr unsafe.Pointer) {
+	C.free(ptr)
+}
+
+// makeOptions adapts hide_options to Options. A NULL pointer selects the defaults, while an unknown strategy or
+// traversal is an error rather than silently replaced by the default.
+func makeOptions(options *C.hide_options) ([]stego.Option, error) {
+	var opts []stego.Option
+
+	if options == nil {
+		return opts, nil
+	}
+
+	passphrase := ""
+	if options.passphrase != nil {
+		passphrase = C.GoString(options.passphrase)
+		opts = append(opts, stego.WithPassphrase(passphrase))
+	}
+
+	if options.bits_per_channel != 0 {
+		opts = append(opts, stego.WithBitsPerChannel(int(options.bits_per_channel)))
+	}
+
+	if options.channels != 0 {
+		opts = append(opts, stego.WithChannels(int(options.channels)))
+	}
+
+	if options.strategy != nil {
+		name := C.GoString(options.strategy)
+		strategy, ok := stego.LookupStrategy(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown strategy %q", name)
+		}
+		opts = append(opts, stego.WithStrategy(strategy))
+	}
+
+	if options.traversal != nil {
+		name := C.GoString(options.traversal)
+		traversal, ok := stego.LookupTraversal(name, passphrase)
+		if !ok {
+			return nil, fmt.Errorf("unknown traversal %q", name)
+		}
+		opts = append(opts, stego.WithTraversal(traversal))
+	}
+
+	return append(opts, stego.WithHiddenHeader(options.hide_header != 0)), nil
+}
+
+func decodeImage(data *C.uchar, dataLen C.size_t) (image.Image, error) {
+	b, err := goBytes(data, dataLen)
+	if err != nil {
+		return nil, err
+	}
+	return stego.DecodeImage(bytes.NewReader(b))
+}
+
+// goBytes copies a buffer passed by the caller into Go memory. C.GoBytes takes the length as a C int, so a
+// larger buffer is refused instead of being truncated.
+func goBytes(data *C.uchar, dataLen C.size_t) ([]byte, error) {
+	if dataLen > math.MaxInt32 {
+		return nil, errTooLarge
+	}
+	return C.GoBytes(unsafe.Pointer(data), C.int(dataLen)), nil
+}
+
+// failure stores the message of err in errOut, if it isn't NULL, and returns the code for err
+func failure(err error, errOut **C.char) C.int {
+	if errOut != nil {
+		*errOut = C.CString(err.Error())
+	}
+
+	switch {
+	case errors.Is(err, stego.ErrCapacityExceeded):
+		return C.HIDE_ERR_CAPACITY_EXCEEDED
+	case errors.Is(err, stego.ErrNotStegoImage):
+		return C.HIDE_ERR_NOT_STEGO_IMAGE
+	case errors.Is(err, stego.ErrWrongPassphrase), errors.Is(err, stego.ErrPassphraseRequired),
+		errors.Is(err, stego.ErrPrivateKeyRequired), errors.Is(err, stego.ErrNotEncrypted):
+		return C.HIDE_ERR_WRONG_PASSPHRASE
+	case errors.Is(err, stego.ErrCorruptPayload):
+		return C.HIDE_ERR_CORRUPT_PAYLOAD
+	case errors.Is(err, stego.ErrUnsupportedFormat):
+		return C.HIDE_ERR_UNSUPPORTED_FORMAT
+	case errors.Is(err, stego.ErrCorruptHeader):
+		return C.HIDE_ERR_CORRUPT_HEADER
+	case errors.Is(err, stego.ErrUnsupportedVersion):
+		return C.HIDE_ERR_UNSUPPORTED_VERSION
+	default:
+		return C.HIDE_ERR_OTHER
+	}
+}
@@ -0,0 +1,162 @@
+package analysis
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sync"
+)
+
+// calibrationCrop is how many rows and columns are cropped off the image to estimate the cover, which puts the
+// 8x8 grid of blocks as far as it can be from the one the image was compressed on
+const calibrationCrop = 4
+
+// calibrationModes are the low frequency DCT modes the embedding rate is estimated from, as (row, column)
+// frequencies. They hold the most nonzero coefficients, so they give the steadiest estimate.
+var calibrationModes = [][2]int{{0, 1}, {1, 0}, {1, 1}}
+
+// maxQuantizationStep bounds the quantization steps looked for in the low frequency modes
+const maxQuantizationStep = 32
+
+// quantizationTolerance is how far a coefficient can be from a multiple of a step and still count as on it
+const quantizationTolerance = 0.75
+
+// minQuantizationExcess is how many more of the coefficients than chance must be on the multiples of a step for
+// it to count as the quantization step of a mode
+const minQuantizationExcess = 0.3
+
+// Calibration runs the calibration attack of Fridrich, Goljan and Hogea on the DCT coefficients of the
+// luminance. Cropping 4 rows and columns off a decompressed JPEG and compressing it again with the same
+// quantization gives coefficients whose histogram is close to that of the cover, since the crop moves the grid
+// of blocks away from the one embedding changed. Embedding that shrinks coefficients towards 0, like F5, leaves
+// more zeros and fewer ones in the image than in that estimate, and the score is the fraction of coefficients
+// that were changed, estimated from the difference. The quantization step of each mode is worked out from the
+// coefficients themselves, and is 1 for an image that never was a JPEG, for which the estimate compares the
+// image with a shifted copy of itself and stays close to 0.
+func Calibration(img *image.NRGBA) TestResult {
+	bounds := img.Bounds()
+	cropped := img.SubImage(image.Rect(bounds.Min.X+calibrationCrop, bounds.Min.Y+calibrationCrop,
+		bounds.Max.X, bounds.Max.Y)).(*image.NRGBA)
+
+	values := modeCoefficients(img)
+	calibrated := modeCoefficients(cropped)
+
+	details := map[string]float64{}
+	score := 0.0
+	numModes := 0
+
+	for i, mode := range calibrationModes {
+		step := quantizationStep(values[i])
+		rate, ok := shrinkageRate(quantizedHistogram(values[i], step), quantizedHistogram(calibrated[i], step))
+		if !ok {
+			continue
+		}
+
+		name := fmt.Sprintf("(%d,%d)", mode[0], mode[1])
+		details["rate "+name] = rate
+		details["step "+name] = float64(step)
+		score += rate
+		numModes++
+	}
+
+	if numModes > 0 {
+		score /= float64(numModes)
+	}
+
+	return TestResult{Name: "calibration", Score: math.Max(0, math.Min(1, score)), Details: details}
+}
+
+// modeCoefficients returns the coefficients of every calibration mode in every whole 8x8 block of img
+func modeCoefficients(img *image.NRGBA) [][]float64 {
+	numBlockRows := img.Bounds().Dy() / dctBlockSize
+
+	var lock sync.Mutex
+	values := make([][]float64, len(calibrationModes))
+
+	forEachRowRange(numBlockRows, func(first int, end int) {
+		partial := make([][]float64, len(calibrationModes))
+
+		forEachDCTBlock(img, first, end, func(coefficients *[dctBlockSize][dctBlockSize]float64) {
+			for i, mode := range calibrationModes {
+				partial[i] = append(partial[i], coefficients[mode[0]][mode[1]])
+			}
+		})
+
+		lock.Lock()
+		for i := range values {
+			values[i] = append(values[i], partial[i]...)
+		}
+		lock.Unlock()
+	})
+
+	return values
+}
+
+// quantizationStep returns the quantization step of a mode of a decompressed JPEG from its coefficients values,
+// as the step that the most coefficients are close to a multiple of, beyond the fraction that would be close by
+// chance. It's 1 when no step stands out, as for an image that was never compressed. Coefficients close to 0 are
+// left out, since they are close to a multiple of any step.
+func quantizationStep(values []float64) int {
+	best, bestExcess := 1, minQuantizationExcess
+
+	for step := 2; step <= maxQuantizationStep; step++ {
+		near, count := 0, 0
+
+		for _, value := range values {
+			if math.Abs(value) < 1.5 {
+				continue
+			}
+			count++
+
+			// Decompressing rounds every pixel, which moves coefficients by a fraction of a unit
+			multiple := value / float64(step)
+			if math.Abs(multiple-math.Round(multiple))*float64(step) <= quantizationTolerance {
+				near++
+			}
+		}
+
+		if count == 0 {
+			return 1
+		}
+
+		chance := math.Min(1, 2*quantizationTolerance/float64(step))
+		if excess := float64(near)/float64(count) - chance; excess > bestExcess {
+			best, bestExcess = step, excess
+		}
+	}
+
+	return best
+}
+
+// quantizedHistogram returns the fraction of values that quantize to 0, 1 and 2 in absolute value with step
+func quantizedHistogram(values []float64, step int) [3]float64 {
+	var histogram [3]float64
+	if len(values) == 0 {
+		return histogram
+	}
+
+	for _, value := range values {
+		quantized := int(math.Abs(math.Round(value / float64(step))))
+		if quantized < len(histogram) {
+			histogram[quantized]++
+		}
+	}
+
+	for i := range histogram {
+		histogram[i] /= float64(len(values))
+	}
+	return histogram
+}
+
+// shrinkageRate estimates the fraction of nonzero coefficients that embedding shrank by one, from the
+// histogram of the image and the calibrated histogram of its cover, by least squares. It reports false when
+// the calibrated histogram has nothing to estimate from.
+func shrinkageRate(histogram [3]float64, calibrated [3]float64) (float64, bool) {
+	slope := calibrated[2] - calibrated[1]
+	denominator := calibrated[1]*calibrated[1] + slope*slope
+	if denominator == 0 {
+		return 0, false
+	}
+
+	return (calibrated[1]*(histogram[0]-calibrated[0]) + (histogram[1]-calibrated[1])*slope) / denominator, true
+}
@@ -0,0 +1,152 @@
+package analysis
+
+import (
+	"image"
+	"math"
+)
+
+// ChiSquare runs the chi-square attack of Westfeld and Pfitzmann. Replacing least significant bits evens out
+// the number of times each pair of values 2k and 2k+1 occurs, so a histogram whose pairs are close to equal
+// has probably been embedded in. The score is the probability that the pairs are equal.
+func ChiSquare(img *image.NRGBA) TestResult {
+	details := map[string]float64{}
+	score := 0.0
+
+	for c, name := range channelNames {
+		var histogram [256]int
+		for _, value := range channel(img, c) {
+			histogram[value]++
+		}
+
+		p := pairsOfValuesProbability(histogram[:])
+		details[name] = p
+		score += p
+	}
+
+	return TestResult{Name: "chi-square", Score: score / float64(len(channelNames)), Details: details}
+}
+
+// pairsOfValuesProbability returns the probability that the counts of every pair of values 2k and 2k+1 in
+// histogram come from the same distribution
+func pairsOfValuesProbability(histogram []int) float64 {
+	chiSquare := 0.0
+	degrees := -1
+
+	for k := 0; k+1 < len(histogram); k += 2 {
+		expected := float64(histogram[k]+histogram[k+1]) / 2
+
+		// Pairs that barely occur would dominate the statistic
+		if expected < 5 {
+			continue
+		}
+
+		diff := float64(histogram[k]) - expected
+		chiSquare += diff * diff / expected
+		degrees++
+	}
+
+	if degrees < 1 {
+		return 0
+	}
+
+	return 1 - regularizedGammaP(float64(degrees)/2, chiSquare/2)
+}
+
+// regularizedGammaP is the regularized lower incomplete gamma function P(a, x), which gives the chi-square
+// distribution function as P(k/2, x/2)
+func regularizedGammaP(a float64, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+
+	lgamma, _ := math.Lgamma(a)
+	prefix := math.Exp(-x + a*math.Log(x) - lgamma)
+
+	if x < a+1 {
+		// Series expansion
+		sum := 1 / a
+		term := sum
+		for n := 1.0; n < 1000; n++ {
+			term *= x / (a + n)
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*1e-14 {
+				break
+			}
+		}
+		return sum * prefix
+	}
+
+	// Continued fraction for Q(a, x), evaluated with the modified Lentz method
+	const tiny = 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for n := 1.0; n < 1000; n++ {
+		an := -n * (n - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-14 {
+			break
+		}
+	}
+
+	return 1 - prefix*h
+}
+
+// CurvePoint is the chi-square probability of embedding over the first Fraction of the pixels of an image
+type CurvePoint struct {
+	Fraction    float64
+	Probability float64
+}
+
+// ChiSquareCurve runs the chi-square attack on growing runs of pixels, row by row from the top left corner,
+// and returns the probability of embedding after each of numPoints equal steps. A message embedded along the
+// rows, like one concealed with the linear traversal, shows up as probabilities close to 1 that drop once the
+// run goes past its end, so the curve also tells roughly how long the message is.
+func ChiSquareCurve(img image.Image, numPoints int) []CurvePoint {
+	pixels := toNRGBA(img)
+	bounds := pixels.Bounds()
+	numPixels := bounds.Dx() * bounds.Dy()
+
+	if numPoints < 1 || numPixels == 0 {
+		return nil
+	}
+
+	var histograms [3][256]int
+	curve := make([]CurvePoint, 0, numPoints)
+	next := 0
+
+	for point := 1; point <= numPoints; point++ {
+		end := numPixels * point / numPoints
+
+		for ; next < end; next++ {
+			pixel := pixels.Pix[pixels.PixOffset(bounds.Min.X+next%bounds.Dx(), bounds.Min.Y+next/bounds.Dx()):]
+			for c := range histograms {
+				histograms[c][pixel[c]]++
+			}
+		}
+
+		probability := 0.0
+		for c := range histograms {
+			probability += pairsOfValuesProbability(histograms[c][:])
+		}
+
+		curve = append(curve, CurvePoint{
+			Fraction:    float64(end) / float64(numPixels),
+			Probability: probability / float64(len(histograms)),
+		})
+	}
+
+	return curve
+}
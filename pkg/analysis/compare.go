@@ -0,0 +1,274 @@
+package analysis
+
+import (
+	"errors"
+	"image"
+	"math"
+)
+
+// ChannelDistortion is how much one channel changed between a cover and a stego image. PSNR is in decibels, and
+// is infinite when the channel didn't change at all. KLDivergence and ChiSquareDistance compare the histograms
+// of the channel instead of its pixels, which is what simple detectors look at: embedding can leave the MSE
+// tiny while still flattening the histogram. ModifiedValues is the number of pixels whose value in the channel
+// changed, and MaxDifference and MeanDifference are the largest and mean absolute change over every pixel.
+// WPSNR is the PSNR with every change weighed by how visible it is where it was made, see weightedPSNR.
+type ChannelDistortion struct {
+	Name              string
+	MSE               float64
+	PSNR              float64
+	WPSNR             float64
+	KLDivergence      float64
+	ChiSquareDistance float64
+	ModifiedValues    int
+	MaxDifference     int
+	MeanDifference    float64
+}
+
+// Comparison is how much a stego image differs from its cover, over all the channels compared and for each of
+// them, so that a strategy that changes one channel far more than the others stands out. The histogram
+// measures over all the channels are the mean of those of each channel. ModifiedPixels is the number of pixels
+// with at least one compared channel changed, out of NumPixels, and ModifiedValues the number of channel values
+// changed over all of them. Changes is the smallest rectangle of the stego image holding every modified pixel,
+// and is empty when none was. SSIM is the structural similarity of the luminance of the images.
+type Comparison struct {
+	MSE               float64
+	PSNR              float64
+	WPSNR             float64
+	SSIM              float64
+	KLDivergence      float64
+	ChiSquareDistance float64
+	NumPixels         int
+	ModifiedPixels    int
+	ModifiedValues    int
+	MaxDifference     int
+	MeanDifference    float64
+	Changes           image.Rectangle
+	Channels          []ChannelDistortion
+}
+
+// Compare measures how much stego differs from cover, which must be the same size. The RGB channels are always
+// compared, and alpha is compared as well with includeAlpha, since changes to it don't show in the colors.
+func Compare(cover image.Image, stego image.Image, includeAlpha bool) (Comparison, error) {
+	if cover.Bounds().Size() != stego.Bounds().Size() {
+		return Comparison{}, errors.New("the images are not the same size")
+	}
+
+	coverPixels := toNRGBA(cover)
+	stegoPixels := toNRGBA(stego)
+
+	names := channelNames
+	if includeAlpha {
+		names = append(names[:len(names):len(names)], "A")
+	}
+
+	bounds := stegoPixels.Bounds()
+	comparison := Comparison{NumPixels: bounds.Dx() * bounds.Dy()}
+	modified := make([]bool, comparison.NumPixels)
+	total, weightedTotal := 0.0, 0.0
+
+	for c, name := range names {
+		coverValues, stegoValues := channel(coverPixels, c), channel(stegoPixels, c)
+		coverHistogram, stegoHistogram := histogram(coverValues), histogram(stegoValues)
+
+		mse := meanSquaredError(coverValues, stegoValues)
+		weightedMSE := weightedMeanSquaredError(coverValues, stegoValues, bounds.Dx(), bounds.Dy())
+		distortion := ChannelDistortion{
+			Name:              name,
+			MSE:               mse,
+			PSNR:              psnr(mse),
+			WPSNR:             psnr(weightedMSE),
+			KLDivergence:      klDivergence(coverHistogram, stegoHistogram),
+			ChiSquareDistance: chiSquareDistance(coverHistogram[:], stegoHistogram[:]),
+		}
+		distortion.ModifiedValues, distortion.MaxDifference, distortion.MeanDifference =
+			differences(coverValues, stegoValues, modified)
+
+		comparison.Channels = append(comparison.Channels, distortion)
+		total += mse
+		weightedTotal += weightedMSE
+		comparison.KLDivergence += distortion.KLDivergence / float64(len(names))
+		comparison.ChiSquareDistance += distortion.ChiSquareDistance / float64(len(names))
+		comparison.ModifiedValues += distortion.ModifiedValues
+		comparison.MeanDifference += distortion.MeanDifference / float64(len(names))
+		if distortion.MaxDifference > comparison.MaxDifference {
+			comparison.MaxDifference = distortion.MaxDifference
+		}
+	}
+
+	for i, changed := range modified {
+		if !changed {
+			continue
+		}
+
+		comparison.ModifiedPixels++
+		x, y := bounds.Min.X+i%bounds.Dx(), bounds.Min.Y+i/bounds.Dx()
+		comparison.Changes = comparison.Changes.Union(image.Rect(x, y, x+1, y+1))
+	}
+
+	comparison.MSE = total / float64(len(names))
+	comparison.PSNR = psnr(comparison.MSE)
+	comparison.WPSNR = psnr(weightedTotal / float64(len(names)))
+	comparison.SSIM, _ = SSIM(coverPixels, stegoPixels)
+	return comparison, nil
+}
+
+// differences returns the number of values of a and b that differ, and the largest and mean absolute difference
+// between them. The values are those of one channel in the same order as modified, whose pixel is marked for
+// every value that differs.
+func differences(a []uint8, b []uint8, modified []bool) (int, int, float64) {
+	count, largest, sum := 0, 0, 0
+
+	for i := range a {
+		diff := int(a[i]) - int(b[i])
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff == 0 {
+			continue
+		}
+
+		count++
+		sum += diff
+		modified[i] = true
+		if diff > largest {
+			largest = diff
+		}
+	}
+
+	if len(a) == 0 {
+		return 0, 0, 0
+	}
+	return count, largest, float64(sum) / float64(len(a))
+}
+
+// histogram returns the number of times each value occurs in values
+func histogram(values []uint8) [256]int {
+	var counts [256]int
+	for _, value := range values {
+		counts[value]++
+	}
+	return counts
+}
+
+// klDivergence returns the Kullback-Leibler divergence in bits of the stego histogram from the cover histogram.
+// Every count is raised by one first, so that a value missing from one of the histograms doesn't make it
+// infinite.
+func klDivergence(cover [256]int, stego [256]int) float64 {
+	coverTotal, stegoTotal := 0.0, 0.0
+	for i := range cover {
+		coverTotal += float64(cover[i] + 1)
+		stegoTotal += float64(stego[i] + 1)
+	}
+
+	divergence := 0.0
+	for i := range cover {
+		p := float64(cover[i]+1) / coverTotal
+		q := float64(stego[i]+1) / stegoTotal
+		divergence += p * math.Log2(p/q)
+	}
+
+	return math.Max(0, divergence)
+}
+
+// chiSquareDistance returns the chi-square distance between the cover and stego histograms once they're
+// normalized, which is 0 for the same histogram and 1 for histograms with no value in common
+func chiSquareDistance(cover []int, stego []int) float64 {
+	coverTotal, stegoTotal := 0, 0
+	for i := range cover {
+		coverTotal += cover[i]
+		stegoTotal += stego[i]
+	}
+
+	if coverTotal == 0 || stegoTotal == 0 {
+		return 0
+	}
+
+	distance := 0.0
+	for i := range cover {
+		p := float64(cover[i]) / float64(coverTotal)
+		q := float64(stego[i]) / float64(stegoTotal)
+		if p+q > 0 {
+			distance += (p - q) * (p - q) / (p + q)
+		}
+	}
+
+	return distance / 2
+}
+
+// meanSquaredError returns the mean of the squared differences between the values of a and b
+func meanSquaredError(a []uint8, b []uint8) float64 {
+	if len(a) == 0 {
+		return 0
+	}
+
+	sum := 0.0
+	for i := range a {
+		diff := float64(a[i]) - float64(b[i])
+		sum += diff * diff
+	}
+
+	return sum / float64(len(a))
+}
+
+// nvfStrength sets how much the noise visibility function of weightedMeanSquaredError lowers the weight of
+// changes in busy areas, as the variance that halves the weight in the busiest area of an image
+const nvfStrength = 75
+
+// weightedMeanSquaredError returns the mean squared error of the stego values b against the cover values a, both
+// given as rows of width values, with every difference weighed by the noise visibility function of Voloshynovskiy
+// et al. at its pixel: 1 / (1 + theta * variance), where variance is that of the cover in the 3x3 window around
+// it, and theta is nvfStrength over the largest such variance. Changes to flat areas keep their full weight,
+// while those hidden among the texture and edges of busy areas count for less, the way they show to the eye.
+func weightedMeanSquaredError(a []uint8, b []uint8, width int, height int) float64 {
+	if len(a) == 0 {
+		return 0
+	}
+
+	variances := make([]float64, len(a))
+	maxVariance := 0.0
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			sum, sumSquares, count := 0.0, 0.0, 0.0
+			for ny := y - 1; ny <= y+1; ny++ {
+				for nx := x - 1; nx <= x+1; nx++ {
+					if nx < 0 || nx >= width || ny < 0 || ny >= height {
+						continue
+					}
+					value := float64(a[ny*width+nx])
+					sum += value
+					sumSquares += value * value
+					count++
+				}
+			}
+
+			mean := sum / count
+			variance := sumSquares/count - mean*mean
+			variances[y*width+x] = variance
+			if variance > maxVariance {
+				maxVariance = variance
+			}
+		}
+	}
+
+	theta := 0.0
+	if maxVariance > 0 {
+		theta = nvfStrength / maxVariance
+	}
+
+	sum := 0.0
+	for i := range a {
+		diff := (float64(a[i]) - float64(b[i])) / (1 + theta*variances[i])
+		sum += diff * diff
+	}
+
+	return sum / float64(len(a))
+}
+
+// psnr returns the peak signal to noise ratio in decibels of 8-bit values with a mean squared error of mse
+func psnr(mse float64) float64 {
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
@@ -0,0 +1,135 @@
+package analysis
+
+import (
+	"image"
+	"math"
+	"sync"
+)
+
+// dctBlockSize is the size of the blocks the luminance is transformed in, matching JPEG
+const dctBlockSize = 8
+
+// dctRange bounds the rounded coefficients that are counted. Larger coefficients are rare enough to ignore.
+const dctRange = 256
+
+// DCTHistogram runs the chi-square attack on the rounded AC coefficients of the 8x8 block DCT of the luminance.
+// Embedding in the least significant bits of coefficients evens out the number of times each pair of values
+// 2k and 2k+1 occurs, as it does for pixel values. The coefficients 0 and 1 are left out, because most
+// embedding schemes skip them. The score is the probability that the pairs are equal.
+func DCTHistogram(img *image.NRGBA) TestResult {
+	histogram, count := dctHistogram(img)
+	p := pairsOfValuesProbability(histogram)
+
+	return TestResult{
+		Name:    "dct histogram",
+		Score:   p,
+		Details: map[string]float64{"p": p, "coefficients": float64(count)},
+	}
+}
+
+// dctHistogram returns the number of times every rounded AC coefficient from -dctRange up to dctRange occurs in
+// img, at the index of the coefficient plus dctRange, and the number counted. 0 and 1 aren't counted.
+func dctHistogram(img *image.NRGBA) ([]int, int) {
+	numBlockRows := img.Bounds().Dy() / dctBlockSize
+
+	// Every range of block rows is counted into its own histogram, and the histograms are added up after
+	var lock sync.Mutex
+	histogram := make([]int, 2*dctRange)
+	count := 0
+
+	forEachRowRange(numBlockRows, func(first int, end int) {
+		partial := make([]int, 2*dctRange)
+		partialCount := 0
+
+		forEachDCTBlock(img, first, end, func(coefficients *[dctBlockSize][dctBlockSize]float64) {
+			for u := 0; u < dctBlockSize; u++ {
+				for v := 0; v < dctBlockSize; v++ {
+					if u == 0 && v == 0 {
+						continue
+					}
+
+					value := int(math.Round(coefficients[u][v]))
+					if value == 0 || value == 1 || value < -dctRange || value >= dctRange {
+						continue
+					}
+
+					partial[value+dctRange]++
+					partialCount++
+				}
+			}
+		})
+
+		lock.Lock()
+		for i, n := range partial {
+			histogram[i] += n
+		}
+		count += partialCount
+		lock.Unlock()
+	})
+
+	return histogram, count
+}
+
+// dctBasis holds the cosine of every sample x for every frequency u, already scaled to make the DCT
+// orthonormal, so that a transform only multiplies and adds
+var dctBasis = makeDCTBasis()
+
+// forEachDCTBlock calls f with the DCT of the luminance of every whole 8x8 block of img in the rows of blocks
+// from first up to end
+func forEachDCTBlock(img *image.NRGBA, first int, end int, f func(*[dctBlockSize][dctBlockSize]float64)) {
+	bounds := img.Bounds()
+
+	var block, rows, coefficients [dctBlockSize][dctBlockSize]float64
+
+	for by := bounds.Min.Y + first*dctBlockSize; by < bounds.Min.Y+end*dctBlockSize; by += dctBlockSize {
+		for bx := bounds.Min.X; bx+dctBlockSize <= bounds.Max.X; bx += dctBlockSize {
+			for y := 0; y < dctBlockSize; y++ {
+				for x := 0; x < dctBlockSize; x++ {
+					pixel := img.Pix[img.PixOffset(bx+x, by+y):]
+					block[y][x] = 0.299*float64(pixel[0]) + 0.587*float64(pixel[1]) + 0.114*float64(pixel[2]) - 128
+				}
+			}
+
+			// The 2D DCT is a 1D DCT of every row followed by a 1D DCT of every column
+			for y := 0; y < dctBlockSize; y++ {
+				for u := 0; u < dctBlockSize; u++ {
+					sum := 0.0
+					for x := 0; x < dctBlockSize; x++ {
+						sum += block[y][x] * dctBasis[x][u]
+					}
+					rows[y][u] = sum
+				}
+			}
+
+			for u := 0; u < dctBlockSize; u++ {
+				for v := 0; v < dctBlockSize; v++ {
+					sum := 0.0
+					for y := 0; y < dctBlockSize; y++ {
+						sum += rows[y][u] * dctBasis[y][v]
+					}
+					coefficients[v][u] = sum
+				}
+			}
+
+			f(&coefficients)
+		}
+	}
+}
+
+// makeDCTBasis returns the scaled cosines of the DCT. The scale makes the DCT orthonormal.
+func makeDCTBasis() [dctBlockSize][dctBlockSize]float64 {
+	var basis [dctBlockSize][dctBlockSize]float64
+
+	for u := 0; u < dctBlockSize; u++ {
+		scale := math.Sqrt(2.0 / dctBlockSize)
+		if u == 0 {
+			scale = math.Sqrt(1.0 / dctBlockSize)
+		}
+
+		for x := 0; x < dctBlockSize; x++ {
+			basis[x][u] = scale * math.Cos(float64(2*x+1)*float64(u)*math.Pi/(2*dctBlockSize))
+		}
+	}
+
+	return basis
+}
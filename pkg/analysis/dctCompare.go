@@ -0,0 +1,111 @@
+package analysis
+
+import (
+	"errors"
+	"image"
+	"math"
+	"sort"
+)
+
+// minDCTPairCount is the fewest coefficients a pair must have in the cover for its balance to be compared,
+// since the balance of a rare pair is mostly chance
+const minDCTPairCount = 10
+
+// DCTPair is how often the rounded DCT coefficients Low and Low+1 occur in a cover and its stego image. The
+// imbalance of a pair is the difference between its two counts over their sum, which embedding in the least
+// significant bits of coefficients pulls towards 0.
+type DCTPair struct {
+	Low            int
+	CoverCounts    [2]int
+	StegoCounts    [2]int
+	CoverImbalance float64
+	StegoImbalance float64
+}
+
+// DCTComparison compares the histograms of the rounded AC coefficients of the 8x8 block DCT of the luminance of
+// a cover and its stego image. CoverP and StegoP are the probabilities the chi-square attack gives of each
+// holding a message, CoverImbalance and StegoImbalance the imbalance over every pair of values 2k and 2k+1, and
+// ChiSquareDistance the distance between the histograms. Pairs holds every pair common enough to compare,
+// those whose imbalance dropped the most first, weighed by how common they are, since a rare pair's imbalance
+// moves a lot by chance.
+type DCTComparison struct {
+	Coefficients      int
+	CoverP            float64
+	StegoP            float64
+	CoverImbalance    float64
+	StegoImbalance    float64
+	ChiSquareDistance float64
+	Pairs             []DCTPair
+}
+
+// CompareDCT compares the DCT coefficient histograms of cover and stego, which must be the same size, to show
+// how well embedding kept the frequency domain statistics of the cover. The pairs of values artifact that the
+// chi-square attack looks for shows as pairs whose imbalance drops from cover to stego.
+func CompareDCT(cover image.Image, stego image.Image) (DCTComparison, error) {
+	if cover.Bounds().Size() != stego.Bounds().Size() {
+		return DCTComparison{}, errors.New("the images are not the same size")
+	}
+
+	coverHistogram, count := dctHistogram(toNRGBA(cover))
+	stegoHistogram, _ := dctHistogram(toNRGBA(stego))
+
+	comparison := DCTComparison{
+		Coefficients:      count,
+		CoverP:            pairsOfValuesProbability(coverHistogram),
+		StegoP:            pairsOfValuesProbability(stegoHistogram),
+		CoverImbalance:    pairsImbalance(coverHistogram),
+		StegoImbalance:    pairsImbalance(stegoHistogram),
+		ChiSquareDistance: chiSquareDistance(coverHistogram, stegoHistogram),
+	}
+
+	// dctRange is even, so every even index holds an even coefficient
+	for i := 0; i+1 < len(coverHistogram); i += 2 {
+		coverCounts := [2]int{coverHistogram[i], coverHistogram[i+1]}
+		if coverCounts[0]+coverCounts[1] < minDCTPairCount {
+			continue
+		}
+
+		stegoCounts := [2]int{stegoHistogram[i], stegoHistogram[i+1]}
+		comparison.Pairs = append(comparison.Pairs, DCTPair{
+			Low:            i - dctRange,
+			CoverCounts:    coverCounts,
+			StegoCounts:    stegoCounts,
+			CoverImbalance: imbalance(coverCounts[0], coverCounts[1]),
+			StegoImbalance: imbalance(stegoCounts[0], stegoCounts[1]),
+		})
+	}
+
+	sort.SliceStable(comparison.Pairs, func(i int, j int) bool {
+		return comparison.Pairs[i].evened() > comparison.Pairs[j].evened()
+	})
+
+	return comparison, nil
+}
+
+// evened returns how far the imbalance of the pair dropped, weighed by the number of times it occurs in the cover
+func (self DCTPair) evened() float64 {
+	return (self.CoverImbalance - self.StegoImbalance) * float64(self.CoverCounts[0]+self.CoverCounts[1])
+}
+
+// pairsImbalance returns the imbalance over every pair of values 2k and 2k+1 of histogram, given with an even
+// value at every even index
+func pairsImbalance(histogram []int) float64 {
+	diff, total := 0, 0
+	for i := 0; i+1 < len(histogram); i += 2 {
+		diff += int(math.Abs(float64(histogram[i] - histogram[i+1])))
+		total += histogram[i] + histogram[i+1]
+	}
+
+	if total == 0 {
+		return 0
+	}
+	return float64(diff) / float64(total)
+}
+
+// imbalance returns the difference between the counts a and b of a pair over their sum
+func imbalance(a int, b int) float64 {
+	if a+b == 0 {
+		return 0
+	}
+	return math.Abs(float64(a-b)) / float64(a+b)
+}
@@ -0,0 +1,129 @@
+// Package analysis looks for signs of hidden messages in images without knowing the original cover
+package analysis
+
+import (
+	"image"
+	"image/color"
+	"runtime"
+	"sync"
+)
+
+// TestResult is the outcome of a single statistical test. Score is between 0, nothing suspicious, and 1,
+// almost certainly holds a message, and Details holds the values the score was derived from.
+type TestResult struct {
+	Name    string
+	Score   float64
+	Details map[string]float64
+}
+
+// Report combines the results of every test into a suspicion score between 0 and 1
+type Report struct {
+	Score float64
+	Tests []TestResult
+}
+
+// Detect runs every blind statistical test on img. The tests only read the pixels, so they run at the same time.
+// No model is run, since the bundled one doesn't carry over to real photographs.
+func Detect(img image.Image) Report {
+	return DetectWithModel(img, nil)
+}
+
+// DetectWithModel runs every blind test on img like Detect, and model along with them unless it's nil
+func DetectWithModel(img image.Image, model *Model) Report {
+	pixels := toNRGBA(img)
+
+	runs := []func(*image.NRGBA) TestResult{ChiSquare, SamplePairs, DCTHistogram, Calibration}
+	if model != nil {
+		runs = append(runs, model.Test)
+	}
+
+	tests := make([]TestResult, len(runs))
+	var group sync.WaitGroup
+
+	for i, run := range runs {
+		group.Add(1)
+		go func(i int, run func(*image.NRGBA) TestResult) {
+			defer group.Done()
+			tests[i] = run(pixels)
+		}(i, run)
+	}
+
+	group.Wait()
+
+	score := 0.0
+	for _, test := range tests {
+		score += test.Score
+	}
+
+	return Report{Score: score / float64(len(tests)), Tests: tests}
+}
+
+// channelNames are the color channels the tests run on. Alpha is left out because it is usually constant.
+var channelNames = []string{"R", "G", "B"}
+
+// toNRGBA returns img as an *image.NRGBA, converting it only if it isn't one already. The rows are converted
+// by several goroutines, and the opaque pixels of an RGBA image, which is what most PNGs decode to, are copied
+// as they are.
+func toNRGBA(img image.Image) *image.NRGBA {
+	if pixels, ok := img.(*image.NRGBA); ok {
+		return pixels
+	}
+
+	bounds := img.Bounds()
+	pixels := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	rgba, isRGBA := img.(*image.RGBA)
+
+	forEachRowRange(bounds.Dy(), func(first int, end int) {
+		for y := first; y < end; y++ {
+			for x := 0; x < bounds.Dx(); x++ {
+				if isRGBA {
+					src := rgba.Pix[rgba.PixOffset(bounds.Min.X+x, bounds.Min.Y+y):]
+					if src[3] == 0xff {
+						copy(pixels.Pix[pixels.PixOffset(x, y):], src[:4])
+						continue
+					}
+				}
+
+				pixels.Set(x, y, color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)))
+			}
+		}
+	})
+
+	return pixels
+}
+
+// forEachRowRange splits the rows from 0 to height into a range for every CPU and calls fn for each of them on
+// its own goroutine, returning once every call has
+func forEachRowRange(height int, fn func(first int, end int)) {
+	workers := runtime.NumCPU()
+	if workers > height {
+		workers = height
+	}
+
+	var group sync.WaitGroup
+
+	for worker := 0; worker < workers; worker++ {
+		group.Add(1)
+		go func(first int, end int) {
+			defer group.Done()
+			fn(first, end)
+		}(worker*height/workers, (worker+1)*height/workers)
+	}
+
+	group.Wait()
+}
+
+// channel returns the values of channel c of every pixel, row by row
+func channel(img *image.NRGBA, c int) []uint8 {
+	bounds := img.Bounds()
+	values := make([]uint8, 0, bounds.Dx()*bounds.Dy())
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(bounds.Min.X, y):img.PixOffset(bounds.Max.X, y)]
+		for x := c; x < len(row); x += 4 {
+			values = append(values, row[x])
+		}
+	}
+
+	return values
+}
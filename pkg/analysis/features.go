@@ -0,0 +1,209 @@
+package analysis
+
+import (
+	"image"
+)
+
+// spamT truncates the differences between neighboring values SPAM features are computed from to -spamT..spamT,
+// and spamBins is the number of values that leaves
+const (
+	spamT    = 2
+	spamBins = 2*spamT + 1
+)
+
+// srmT truncates the quantized residuals SRM features are computed from to -srmT..srmT, srmBins is the number of
+// values that leaves, and srmPairT truncates the pairs of neighboring residuals the co-occurrence is counted over
+const (
+	srmT     = 2
+	srmBins  = 2*srmT + 1
+	srmPairT = 1
+)
+
+// NumFeatures is the number of features Features extracts: the transition probabilities of the differences along
+// the rows and columns and along the diagonals, the histograms of three residuals and the co-occurrence of
+// neighboring residuals of the last one
+const NumFeatures = 2*spamBins*spamBins + len(srmResiduals)*srmBins + (2*srmPairT+1)*(2*srmPairT+1)
+
+// spamStraight and spamDiagonal are the directions the SPAM features are averaged over
+var (
+	spamStraight = [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	spamDiagonal = [][2]int{{1, 1}, {-1, -1}, {1, -1}, {-1, 1}}
+)
+
+// srmResidual is a high pass filter an SRM residual is computed with, as the weights of the neighbors of a value
+// at their offsets, and the step the residual is quantized with
+type srmResidual struct {
+	offsets [][2]int
+	weights []int
+	step    int
+}
+
+// srmResiduals are the residuals of the SRM features: the second and third order residuals along the rows, and
+// the 3x3 KB residual that the co-occurrence is counted over
+var srmResiduals = [...]srmResidual{
+	{offsets: [][2]int{{-1, 0}, {0, 0}, {1, 0}}, weights: []int{1, -2, 1}, step: 2},
+	{offsets: [][2]int{{-1, 0}, {0, 0}, {1, 0}, {2, 0}}, weights: []int{-1, 3, -3, 1}, step: 3},
+	{
+		offsets: [][2]int{{-1, -1}, {0, -1}, {1, -1}, {-1, 0}, {0, 0}, {1, 0}, {-1, 1}, {0, 1}, {1, 1}},
+		weights: []int{-1, 2, -1, 2, -4, 2, -1, 2, -1},
+		step:    4,
+	},
+}
+
+// Features returns the NumFeatures steganalysis features of img, averaged over its RGB channels. They're a
+// reduced form of the SPAM features of Pevny, Bas and Fridrich, with first order transitions of differences
+// truncated to -2..2, and of the spatial rich model of Fridrich and Kodovsky, with histograms of three
+// quantized residuals instead of the full set of co-occurrences. Embedding adds noise that is independent of
+// the image, which flattens both away from the strong correlations between neighboring values of covers.
+func Features(img image.Image) []float64 {
+	pixels := toNRGBA(img)
+	bounds := pixels.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	features := make([]float64, NumFeatures)
+	for c := range channelNames {
+		values := channel(pixels, c)
+
+		var channelFeatures []float64
+		channelFeatures = append(channelFeatures, spamFeatures(values, width, height, spamStraight)...)
+		channelFeatures = append(channelFeatures, spamFeatures(values, width, height, spamDiagonal)...)
+		channelFeatures = append(channelFeatures, srmFeatures(values, width, height)...)
+
+		for i, feature := range channelFeatures {
+			features[i] += feature / float64(len(channelNames))
+		}
+	}
+
+	return features
+}
+
+// spamFeatures returns the probabilities of every difference between a value and its next neighbor given the
+// difference between the neighbor and the one after it, averaged over directions. The values are given as rows
+// of width values.
+func spamFeatures(values []uint8, width int, height int, directions [][2]int) []float64 {
+	features := make([]float64, spamBins*spamBins)
+
+	for _, direction := range directions {
+		var counts [spamBins][spamBins]int
+		dx, dy := direction[0], direction[1]
+
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				x2, y2 := x+2*dx, y+2*dy
+				if x2 < 0 || x2 >= width || y2 < 0 || y2 >= height {
+					continue
+				}
+
+				a := int(values[y*width+x])
+				b := int(values[(y+dy)*width+x+dx])
+				c := int(values[y2*width+x2])
+				counts[truncate(a-b, spamT)+spamT][truncate(b-c, spamT)+spamT]++
+			}
+		}
+
+		for from := range counts {
+			total := 0
+			for _, n := range counts[from] {
+				total += n
+			}
+			if total == 0 {
+				continue
+			}
+
+			for to, n := range counts[from] {
+				features[from*spamBins+to] += float64(n) / float64(total) / float64(len(directions))
+			}
+		}
+	}
+
+	return features
+}
+
+// srmFeatures returns the histogram of every quantized and truncated residual of srmResiduals, followed by the
+// co-occurrence of horizontally neighboring values of the last one. The values are given as rows of width values.
+func srmFeatures(values []uint8, width int, height int) []float64 {
+	var features []float64
+	var last []int
+
+	for _, residual := range srmResiduals {
+		quantized := make([]int, width*height)
+		histogram := make([]float64, srmBins)
+		count := 0
+
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				sum, inside := 0, true
+				for i, offset := range residual.offsets {
+					nx, ny := x+offset[0], y+offset[1]
+					if nx < 0 || nx >= width || ny < 0 || ny >= height {
+						inside = false
+						break
+					}
+					sum += residual.weights[i] * int(values[ny*width+nx])
+				}
+
+				if !inside {
+					quantized[y*width+x] = srmT + 1
+					continue
+				}
+
+				value := truncate(roundDivide(sum, residual.step), srmT)
+				quantized[y*width+x] = value
+				histogram[value+srmT]++
+				count++
+			}
+		}
+
+		for i := range histogram {
+			if count > 0 {
+				histogram[i] /= float64(count)
+			}
+		}
+
+		features = append(features, histogram...)
+		last = quantized
+	}
+
+	const pairBins = 2*srmPairT + 1
+	cooccurrence := make([]float64, pairBins*pairBins)
+	count := 0
+
+	for y := 0; y < height; y++ {
+		for x := 0; x+1 < width; x++ {
+			a, b := last[y*width+x], last[y*width+x+1]
+			if a > srmT || b > srmT {
+				continue
+			}
+
+			cooccurrence[(truncate(a, srmPairT)+srmPairT)*pairBins+truncate(b, srmPairT)+srmPairT]++
+			count++
+		}
+	}
+
+	for i := range cooccurrence {
+		if count > 0 {
+			cooccurrence[i] /= float64(count)
+		}
+	}
+
+	return append(features, cooccurrence...)
+}
+
+// truncate returns value clamped to -limit..limit
+func truncate(value int, limit int) int {
+	if value < -limit {
+		return -limit
+	}
+	if value > limit {
+		return limit
+	}
+	return value
+}
+
+// roundDivide returns value divided by step, rounded to the nearest integer with halves away from 0
+func roundDivide(value int, step int) int {
+	if value < 0 {
+		return -((-value + step/2) / step)
+	}
+	return (value + step/2) / step
+}
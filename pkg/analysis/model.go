@@ -0,0 +1,142 @@
+package analysis
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"io"
+	"math"
+)
+
+// Model is a logistic regression over the Features of an image, which gives the probability that the image
+// holds a message. Every feature is standardized with its Mean and Scale before it's weighed, so that the
+// Weights of features with very different ranges can be compared and learned at the same rate.
+type Model struct {
+	Bias    float64   `json:"bias"`
+	Weights []float64 `json:"weights"`
+	Mean    []float64 `json:"mean"`
+	Scale   []float64 `json:"scale"`
+}
+
+// ErrInvalidModel is returned by LoadModel for weights that don't fit the features
+var ErrInvalidModel = errors.New("model doesn't have a weight, mean and scale for every feature")
+
+// DefaultModel returns the model bundled with Hide. It was only fitted to synthetic covers and can score a
+// natural image with a message below its cover, so Detect leaves it out and it's only run when asked for with
+// DetectWithModel.
+func DefaultModel() *Model {
+	model := bundledModel
+	return &model
+}
+
+// LoadModel reads a model written as JSON, as Model.Save writes it, to use instead of the bundled one
+func LoadModel(reader io.Reader) (*Model, error) {
+	model := &Model{}
+	if err := json.NewDecoder(reader).Decode(model); err != nil {
+		return nil, err
+	}
+
+	if len(model.Weights) != NumFeatures || len(model.Mean) != NumFeatures || len(model.Scale) != NumFeatures {
+		return nil, ErrInvalidModel
+	}
+
+	for _, scale := range model.Scale {
+		if scale <= 0 {
+			return nil, ErrInvalidModel
+		}
+	}
+
+	return model, nil
+}
+
+// Save writes the model as JSON for LoadModel
+func (self *Model) Save(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(self)
+}
+
+// Score returns the probability the model gives that an image with the features holds a message
+func (self *Model) Score(features []float64) float64 {
+	z := self.Bias
+	for i, feature := range features {
+		z += self.Weights[i] * (feature - self.Mean[i]) / self.Scale[i]
+	}
+	return 1 / (1 + math.Exp(-z))
+}
+
+// Test runs the model on img as one of the tests of DetectWithModel
+func (self *Model) Test(img *image.NRGBA) TestResult {
+	score := self.Score(Features(img))
+	return TestResult{Name: "model", Score: score, Details: map[string]float64{"p": score}}
+}
+
+// trainingRate, trainingPenalty and trainingIterations are the step, the L2 penalty on the weights and the number
+// of steps of the gradient descent TrainModel fits a model with
+const (
+	trainingRate       = 0.5
+	trainingPenalty    = 1e-3
+	trainingIterations = 2000
+)
+
+// TrainModel fits a model to the features of covers and of images holding a message, for LoadModel to use
+// instead of the bundled one, by gradient descent on the penalized log loss. Images that look like those Hide
+// will be run on give a far better model than the bundled one.
+func TrainModel(covers [][]float64, stegos [][]float64) (*Model, error) {
+	if len(covers) == 0 || len(stegos) == 0 {
+		return nil, errors.New("training needs both covers and images holding a message")
+	}
+
+	samples := append(append([][]float64{}, covers...), stegos...)
+	for _, sample := range samples {
+		if len(sample) != NumFeatures {
+			return nil, errors.New("training sample doesn't have every feature")
+		}
+	}
+
+	model := &Model{
+		Weights: make([]float64, NumFeatures),
+		Mean:    make([]float64, NumFeatures),
+		Scale:   make([]float64, NumFeatures),
+	}
+
+	for i := 0; i < NumFeatures; i++ {
+		for _, sample := range samples {
+			model.Mean[i] += sample[i] / float64(len(samples))
+		}
+		for _, sample := range samples {
+			model.Scale[i] += (sample[i] - model.Mean[i]) * (sample[i] - model.Mean[i]) / float64(len(samples))
+		}
+
+		// A feature that never changes is left with a weight of 0
+		model.Scale[i] = math.Max(math.Sqrt(model.Scale[i]), 1e-9)
+	}
+
+	gradient := make([]float64, NumFeatures)
+	for iteration := 0; iteration < trainingIterations; iteration++ {
+		biasGradient := 0.0
+		for i := range gradient {
+			gradient[i] = trainingPenalty * model.Weights[i]
+		}
+
+		for s, sample := range samples {
+			label := 0.0
+			if s >= len(covers) {
+				label = 1
+			}
+
+			err := (model.Score(sample) - label) / float64(len(samples))
+			biasGradient += err
+			for i, feature := range sample {
+				gradient[i] += err * (feature - model.Mean[i]) / model.Scale[i]
+			}
+		}
+
+		model.Bias -= trainingRate * biasGradient
+		for i := range gradient {
+			model.Weights[i] -= trainingRate * gradient[i]
+		}
+	}
+
+	return model, nil
+}
@@ -0,0 +1,97 @@
+package analysis
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// montageGap is the width in pixels of the gap between the panels of a montage
+const montageGap = 4
+
+// montageBackground is the color of the gaps between the panels of a montage
+var montageBackground = color.NRGBA{R: 0x40, G: 0x40, B: 0x40, A: 0xff}
+
+// Montage returns cover and stego side by side, followed by their difference with every channel multiplied by
+// amplify so that changes of a unit or two show, and a heatmap of the total change of every pixel, scaled to
+// the largest, going from black through blue and red to yellow. It's one image that shows at a glance where
+// and how much embedding changed the cover. The images must be the same size, and are shown opaque.
+func Montage(cover image.Image, stego image.Image, amplify int) (*image.NRGBA, error) {
+	if cover.Bounds().Size() != stego.Bounds().Size() {
+		return nil, errors.New("the images are not the same size")
+	}
+	if amplify < 1 {
+		return nil, errors.New("amplification must be at least 1")
+	}
+
+	coverPixels, stegoPixels := toNRGBA(cover), toNRGBA(stego)
+	width, height := cover.Bounds().Dx(), cover.Bounds().Dy()
+
+	montage := image.NewNRGBA(image.Rect(0, 0, 4*width+3*montageGap, height))
+	draw.Draw(montage, montage.Bounds(), image.NewUniform(montageBackground), image.Point{}, draw.Src)
+
+	diffs := make([]int, width*height)
+	maxDiff := 0
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			a := coverPixels.Pix[coverPixels.PixOffset(coverPixels.Rect.Min.X+x, coverPixels.Rect.Min.Y+y):]
+			b := stegoPixels.Pix[stegoPixels.PixOffset(stegoPixels.Rect.Min.X+x, stegoPixels.Rect.Min.Y+y):]
+
+			var amplified [3]uint8
+			total := 0
+			for c := 0; c < 4; c++ {
+				diff := int(a[c]) - int(b[c])
+				if diff < 0 {
+					diff = -diff
+				}
+				total += diff
+				if c < 3 && diff*amplify > 255 {
+					amplified[c] = 255
+				} else if c < 3 {
+					amplified[c] = uint8(diff * amplify)
+				}
+			}
+
+			diffs[y*width+x] = total
+			if total > maxDiff {
+				maxDiff = total
+			}
+
+			montage.SetNRGBA(x, y, color.NRGBA{R: a[0], G: a[1], B: a[2], A: 0xff})
+			montage.SetNRGBA(width+montageGap+x, y, color.NRGBA{R: b[0], G: b[1], B: b[2], A: 0xff})
+			montage.SetNRGBA(2*(width+montageGap)+x, y,
+				color.NRGBA{R: amplified[0], G: amplified[1], B: amplified[2], A: 0xff})
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			level := 0.0
+			if maxDiff > 0 {
+				level = float64(diffs[y*width+x]) / float64(maxDiff)
+			}
+			montage.SetNRGBA(3*(width+montageGap)+x, y, heatColor(level))
+		}
+	}
+
+	return montage, nil
+}
+
+// heatColor returns the color of level, from 0 to 1, on a ramp from black through blue and red to yellow
+func heatColor(level float64) color.NRGBA {
+	switch {
+	case level <= 0:
+		return color.NRGBA{A: 0xff}
+	case level < 1.0/3:
+		return color.NRGBA{B: uint8(255 * level * 3), A: 0xff}
+	case level < 2.0/3:
+		t := (level - 1.0/3) * 3
+		return color.NRGBA{R: uint8(255 * t), B: uint8(255 * (1 - t)), A: 0xff}
+	default:
+		t := (math.Min(level, 1) - 2.0/3) * 3
+		return color.NRGBA{R: 0xff, G: uint8(255 * t), A: 0xff}
+	}
+}
@@ -0,0 +1,22 @@
+package analysis
+
+import "image"
+
+// BitPlane returns bit of channel c of every pixel of img as a black and white image, with white where the bit
+// is set. Channels are numbered R, G, B, A from 0 and bits from the least significant.
+func BitPlane(img image.Image, c int, bit uint) *image.Gray {
+	pixels := toNRGBA(img)
+	bounds := pixels.Bounds()
+	plane := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+
+	for y := 0; y < bounds.Dy(); y++ {
+		row := pixels.Pix[pixels.PixOffset(bounds.Min.X, bounds.Min.Y+y):]
+		for x := 0; x < bounds.Dx(); x++ {
+			if row[4*x+c]>>bit&1 == 1 {
+				plane.Pix[plane.PixOffset(x, y)] = 255
+			}
+		}
+	}
+
+	return plane
+}
@@ -0,0 +1,162 @@
+package analysis
+
+import (
+	"image"
+	"math"
+)
+
+// ChannelQuality is what BlindQuality finds in one channel. NoiseSigma is the standard deviation of the noise in
+// values, estimated from the residual left by a high pass filter that cancels out smooth gradients. The rest
+// test the least significant bit plane, read row by row: LSBOnes is the fraction of bits that are 1, MonobitP
+// and RunsP are the probabilities of a random plane giving a count of ones and a number of runs as far from
+// what's expected, and NeighborAgreement is the fraction of horizontally adjacent bits that are the same.
+type ChannelQuality struct {
+	Name              string
+	NoiseSigma        float64
+	LSBOnes           float64
+	MonobitP          float64
+	RunsP             float64
+	NeighborAgreement float64
+}
+
+// Quality is what BlindQuality finds in an image, over all its RGB channels and for each of them. NoiseSigma is
+// the mean of that of the channels. Blockiness is the mean difference between neighboring luminance values
+// across the edges of the 8x8 blocks over that within them, which is close to 1 unless the image was compressed
+// as blocks, like a JPEG.
+type Quality struct {
+	NoiseSigma float64
+	Blockiness float64
+	Channels   []ChannelQuality
+}
+
+// BlindQuality measures the noise, the randomness of the least significant bits and the block artifacts of img
+// on its own, for when the cover is gone and Compare can't be used. Embedding raises the noise a little, and
+// fills the least significant bits with random looking bits, whose neighbors agree half the time where the
+// smooth areas of a cover agree more often. Neither is proof of a message, since noisy covers look the same.
+func BlindQuality(img image.Image) Quality {
+	pixels := toNRGBA(img)
+	bounds := pixels.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	quality := Quality{Blockiness: blockiness(pixels)}
+
+	for c, name := range channelNames {
+		values := channel(pixels, c)
+
+		channelQuality := ChannelQuality{Name: name, NoiseSigma: noiseSigma(values, width, height)}
+		channelQuality.LSBOnes, channelQuality.MonobitP, channelQuality.RunsP, channelQuality.NeighborAgreement =
+			lsbRandomness(values, width)
+
+		quality.Channels = append(quality.Channels, channelQuality)
+		quality.NoiseSigma += channelQuality.NoiseSigma / float64(len(channelNames))
+	}
+
+	return quality
+}
+
+// noiseSigma estimates the standard deviation of the noise of values, given as rows of width values, with the
+// method of Immerkaer, which filters out everything but the noise with a 3x3 Laplacian difference
+func noiseSigma(values []uint8, width int, height int) float64 {
+	if width < 3 || height < 3 {
+		return 0
+	}
+
+	sum := 0.0
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			at := func(dx int, dy int) int {
+				return int(values[(y+dy)*width+x+dx])
+			}
+
+			residual := at(-1, -1) - 2*at(0, -1) + at(1, -1) -
+				2*at(-1, 0) + 4*at(0, 0) - 2*at(1, 0) +
+				at(-1, 1) - 2*at(0, 1) + at(1, 1)
+			sum += math.Abs(float64(residual))
+		}
+	}
+
+	return math.Sqrt(math.Pi/2) * sum / (6 * float64(width-2) * float64(height-2))
+}
+
+// lsbRandomness returns the fraction of least significant bits of values that are 1, the probabilities of the
+// monobit and runs tests for them read in order, and the fraction of horizontally adjacent bits that agree,
+// with the values given as rows of width values
+func lsbRandomness(values []uint8, width int) (float64, float64, float64, float64) {
+	n := len(values)
+	if n < 2 {
+		return 0, 0, 0, 0
+	}
+
+	ones, runs, agree, pairs := 0, 1, 0, 0
+	for i, value := range values {
+		bit := value & 1
+		ones += int(bit)
+
+		if i > 0 && bit != values[i-1]&1 {
+			runs++
+		}
+
+		if i%width != 0 {
+			pairs++
+			if bit == values[i-1]&1 {
+				agree++
+			}
+		}
+	}
+
+	zeros := n - ones
+	monobitP := math.Erfc(math.Abs(float64(ones-zeros)) / math.Sqrt(float64(n)) / math.Sqrt2)
+
+	// Wald-Wolfowitz runs test, with the number of runs approximately normal around its mean
+	runsP := 0.0
+	product := 2 * float64(ones) * float64(zeros)
+	variance := product * (product - float64(n)) / (float64(n) * float64(n) * float64(n-1))
+	if variance > 0 {
+		mean := product/float64(n) + 1
+		runsP = math.Erfc(math.Abs(float64(runs)-mean) / math.Sqrt(variance) / math.Sqrt2)
+	}
+
+	agreement := 0.0
+	if pairs > 0 {
+		agreement = float64(agree) / float64(pairs)
+	}
+
+	return float64(ones) / float64(n), monobitP, runsP, agreement
+}
+
+// blockiness returns the mean absolute difference between neighboring luminance values across the edges of the
+// 8x8 blocks of img over the mean within the blocks, along the rows and the columns
+func blockiness(img *image.NRGBA) float64 {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	values := luminance(img)
+
+	var edge, inside float64
+	var numEdge, numInside int
+
+	add := func(position int, diff float64) {
+		if position%dctBlockSize == dctBlockSize-1 {
+			edge += math.Abs(diff)
+			numEdge++
+		} else {
+			inside += math.Abs(diff)
+			numInside++
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x+1 < width {
+				add(x, values[y*width+x]-values[y*width+x+1])
+			}
+			if y+1 < height {
+				add(y, values[y*width+x]-values[(y+1)*width+x])
+			}
+		}
+	}
+
+	if numEdge == 0 || numInside == 0 || inside == 0 {
+		return 1
+	}
+	return (edge / float64(numEdge)) / (inside / float64(numInside))
+}
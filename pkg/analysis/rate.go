@@ -0,0 +1,130 @@
+package analysis
+
+import (
+	"image"
+	"math"
+)
+
+// rateConfidence is the confidence of the interval EstimateRate gives, and rateZ the number of standard errors
+// either side of the estimate it spans
+const (
+	rateConfidence = 0.95
+	rateZ          = 1.96
+)
+
+// maxRateStrips bounds the number of strips of rows the embedding rate is estimated over, and minStripRows is
+// the fewest rows a strip can have for sample pair analysis to say anything about it
+const (
+	maxRateStrips = 16
+	minStripRows  = 8
+)
+
+// rateCurvePoints is the number of points of the chi-square curve a message embedded along the rows is found
+// from, and sequentialProbability the probability the curve must keep up to the end of the message. Replaced
+// bits keep it at nearly 1, while the start of a cover with a ragged histogram can reach 0.9 by chance.
+const (
+	rateCurvePoints       = 20
+	sequentialProbability = 0.99
+)
+
+// RateEstimate is an estimate of how many bits of message each pixel of an image holds, in the least significant
+// bits of its RGB channels, so at most 3. The rate is between Low and High with probability Confidence.
+// SamplePairs is the rate sample pair analysis estimates for the whole image, and Sequential the rate of a
+// message the chi-square attack finds embedded along the rows from the top left corner, or 0 if it finds none.
+type RateEstimate struct {
+	BitsPerPixel float64
+	Low          float64
+	High         float64
+	Confidence   float64
+	SamplePairs  float64
+	Sequential   float64
+}
+
+// EstimateRate combines the blind tests into an estimate of how many bits of message each pixel of img holds,
+// for when there's no cover to compare it with. Sample pair analysis is run on strips of rows, whose spread
+// gives the confidence interval, and the chi-square curve finds how far a message embedded along the rows goes.
+// When it finds one, the estimate is the mean of both and the interval covers them. Both tests look for
+// replaced least significant bits, so the rate of lsb-matching, or of more than one bit per channel, is
+// underestimated.
+func EstimateRate(img image.Image) RateEstimate {
+	pixels := toNRGBA(img)
+	bounds := pixels.Bounds()
+	maxRate := float64(len(channelNames))
+
+	estimate := RateEstimate{Confidence: rateConfidence, SamplePairs: samplePairsBitsPerPixel(pixels)}
+	estimate.BitsPerPixel = estimate.SamplePairs
+	estimate.Low, estimate.High = 0, maxRate
+
+	numStrips := bounds.Dy() / minStripRows
+	if numStrips > maxRateStrips {
+		numStrips = maxRateStrips
+	}
+
+	// The strips are independent samples of the rate, so their standard error bounds that of the whole image
+	if numStrips >= 2 {
+		rates := make([]float64, numStrips)
+		forEachRowRange(numStrips, func(first int, end int) {
+			for strip := first; strip < end; strip++ {
+				top := bounds.Min.Y + strip*bounds.Dy()/numStrips
+				bottom := bounds.Min.Y + (strip+1)*bounds.Dy()/numStrips
+				rates[strip] = samplePairsBitsPerPixel(pixels.SubImage(
+					image.Rect(bounds.Min.X, top, bounds.Max.X, bottom)).(*image.NRGBA))
+			}
+		})
+
+		margin := rateZ * standardDeviation(rates) / math.Sqrt(float64(numStrips))
+		estimate.Low = math.Max(0, estimate.SamplePairs-margin)
+		estimate.High = math.Min(maxRate, estimate.SamplePairs+margin)
+	}
+
+	estimate.Sequential = sequentialFraction(ChiSquareCurve(pixels, rateCurvePoints)) * maxRate
+	if estimate.Sequential > 0 {
+		estimate.BitsPerPixel = (estimate.SamplePairs + estimate.Sequential) / 2
+		estimate.Low = math.Min(estimate.Low, estimate.Sequential)
+		estimate.High = math.Max(estimate.High, estimate.Sequential)
+	}
+
+	return estimate
+}
+
+// samplePairsBitsPerPixel returns the rate sample pair analysis estimates for img, over all its RGB channels
+func samplePairsBitsPerPixel(img *image.NRGBA) float64 {
+	rate := 0.0
+	for c := range channelNames {
+		rate += samplePairsRate(channel(img, c), img.Bounds().Dx())
+	}
+	return rate
+}
+
+// sequentialFraction returns the fraction of the pixels a message embedded along the rows covers, going by the
+// chi-square curve, which stays close to 1 up to its end. It's 0 if the curve doesn't start out close to 1.
+func sequentialFraction(curve []CurvePoint) float64 {
+	fraction := 0.0
+	for _, point := range curve {
+		if point.Probability < sequentialProbability {
+			break
+		}
+		fraction = point.Fraction
+	}
+	return fraction
+}
+
+// standardDeviation returns the sample standard deviation of values
+func standardDeviation(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+
+	mean := 0.0
+	for _, value := range values {
+		mean += value
+	}
+	mean /= float64(len(values))
+
+	sum := 0.0
+	for _, value := range values {
+		sum += (value - mean) * (value - mean)
+	}
+
+	return math.Sqrt(sum / float64(len(values)-1))
+}
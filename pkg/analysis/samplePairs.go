@@ -0,0 +1,81 @@
+package analysis
+
+import (
+	"image"
+	"math"
+)
+
+// SamplePairs runs the sample pair analysis of Dumitrescu, Wu and Wang, which estimates the fraction of pixels
+// whose least significant bits were replaced from how horizontally adjacent values relate to each other. The
+// score is the estimated embedding rate.
+func SamplePairs(img *image.NRGBA) TestResult {
+	details := map[string]float64{}
+	score := 0.0
+	width := img.Bounds().Dx()
+
+	for c, name := range channelNames {
+		rate := samplePairsRate(channel(img, c), width)
+		details[name] = rate
+		score += rate
+	}
+
+	return TestResult{Name: "sample pairs", Score: score / float64(len(channelNames)), Details: details}
+}
+
+// samplePairsRate estimates the embedding rate of a channel given as rows of width values
+func samplePairsRate(values []uint8, width int) float64 {
+	var x, y, z, w, p float64
+
+	for i := 0; i+1 < len(values); i++ {
+		if (i+1)%width == 0 {
+			continue
+		}
+
+		u, v := int(values[i]), int(values[i+1])
+
+		if u>>1 == v>>1 && u&1 != v&1 {
+			w++
+		}
+
+		if u == v {
+			z++
+		}
+
+		if (v&1 == 0 && u < v) || (v&1 == 1 && u > v) {
+			x++
+		}
+
+		if (v&1 == 0 && u > v) || (v&1 == 1 && u < v) {
+			y++
+		}
+
+		p++
+	}
+
+	if p == 0 {
+		return 0
+	}
+
+	// The embedding rate is the root of ar^2 + br + c = 0 closest to 0
+	a := (w + z) / 2
+	b := 2*x - p
+	c := y - x
+
+	var rate float64
+	if a == 0 {
+		if b == 0 {
+			return 0
+		}
+		rate = -c / b
+	} else if discriminant := b*b - 4*a*c; discriminant < 0 {
+		// Close to full embedding the roots turn complex, and their real part is the best estimate
+		rate = -b / (2 * a)
+	} else {
+		rate = (-b - math.Sqrt(discriminant)) / (2 * a)
+		if other := (-b + math.Sqrt(discriminant)) / (2 * a); math.Abs(other) < math.Abs(rate) {
+			rate = other
+		}
+	}
+
+	return math.Max(0, math.Min(1, rate))
+}
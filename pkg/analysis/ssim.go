@@ -0,0 +1,98 @@
+package analysis
+
+import (
+	"errors"
+	"image"
+)
+
+// ssimWindow is the size of the square windows SSIM is computed over, and ssimStride how far apart they are
+const (
+	ssimWindow = 8
+	ssimStride = 4
+)
+
+// ssimC1 and ssimC2 keep the SSIM of flat windows stable, as (0.01 * 255)^2 and (0.03 * 255)^2
+const (
+	ssimC1 = 6.5025
+	ssimC2 = 58.5225
+)
+
+// SSIM returns the structural similarity of Wang et al. between the luminance of cover and stego, which must be
+// the same size. It's the mean over 8x8 windows 4 pixels apart of how much their means, contrasts and structure
+// agree, and is 1 for identical images. Unlike PSNR it ignores changes that keep the structure of a window.
+func SSIM(cover image.Image, stego image.Image) (float64, error) {
+	if cover.Bounds().Size() != stego.Bounds().Size() {
+		return 0, errors.New("the images are not the same size")
+	}
+
+	coverLuminance := luminance(toNRGBA(cover))
+	stegoLuminance := luminance(toNRGBA(stego))
+	width, height := cover.Bounds().Dx(), cover.Bounds().Dy()
+
+	// Images smaller than a window are compared as a single window
+	window := ssimWindow
+	if width < window || height < window {
+		window = width
+		if height < window {
+			window = height
+		}
+	}
+	if window == 0 {
+		return 1, nil
+	}
+
+	sum := 0.0
+	count := 0
+
+	for y := 0; y+window <= height; y += ssimStride {
+		for x := 0; x+window <= width; x += ssimStride {
+			var meanA, meanB float64
+			for wy := y; wy < y+window; wy++ {
+				for wx := x; wx < x+window; wx++ {
+					meanA += coverLuminance[wy*width+wx]
+					meanB += stegoLuminance[wy*width+wx]
+				}
+			}
+			n := float64(window * window)
+			meanA /= n
+			meanB /= n
+
+			var varianceA, varianceB, covariance float64
+			for wy := y; wy < y+window; wy++ {
+				for wx := x; wx < x+window; wx++ {
+					a := coverLuminance[wy*width+wx] - meanA
+					b := stegoLuminance[wy*width+wx] - meanB
+					varianceA += a * a
+					varianceB += b * b
+					covariance += a * b
+				}
+			}
+			if n > 1 {
+				varianceA /= n - 1
+				varianceB /= n - 1
+				covariance /= n - 1
+			}
+
+			sum += (2*meanA*meanB + ssimC1) * (2*covariance + ssimC2) /
+				((meanA*meanA + meanB*meanB + ssimC1) * (varianceA + varianceB + ssimC2))
+			count++
+		}
+	}
+
+	return sum / float64(count), nil
+}
+
+// luminance returns the luminance of every pixel of img, row by row
+func luminance(img *image.NRGBA) []float64 {
+	bounds := img.Bounds()
+	values := make([]float64, 0, bounds.Dx()*bounds.Dy())
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixel := img.Pix[img.PixOffset(x, y):]
+			values = append(values, 0.299*float64(pixel[0])+0.587*float64(pixel[1])+0.114*float64(pixel[2]))
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,267 @@
+package stego
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"image"
+	"io"
+	"io/ioutil"
+)
+
+// An appended payload starts at the first whole pixel after the payload in front of it, following the same
+// traversal, so it never touches the pixels of the payloads that were there before. Each appended payload starts
+// with its own length and tag, written like the header's, which is all that's needed to find the next one.
+
+// numPayloadHeaderBits is the number of bits in front of a payload appended to an image
+const numPayloadHeaderBits = lengthSize + headerTagSize
+
+// findPayload returns the stepper positioned at the start of payload index of img, where payload 0 is the
+// message written along with the header, and the number of bits in that payload
+func findPayload(img image.Image, header Header, key *secret, traversal TraversalFactory, index int) (*ImageStepper, int, error) {
+	width := img.Bounds().Max.X
+	height := img.Bounds().Max.Y
+	numAvailable := header.numBitsAvailable(width, height)
+
+	stepper := header.messageStepper(width, height, key, traversal)
+	payloadBits := header.NumMessageBits
+
+	for i := 0; i < index; i++ {
+		if err := stepper.skipBits(payloadBits); err != nil {
+			return nil, 0, err
+		}
+		if err := stepper.alignToPixel(); err != nil {
+			return nil, 0, err
+		}
+
+		if numAvailable-stepper.numBitsWritten < numPayloadHeaderBits {
+			return nil, 0, ErrNotStegoImage
+		}
+
+		length, err := readBits(img, stepper, header.Strategy, lengthSize)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		tag, err := readBits(img, stepper, header.Strategy, headerTagSize)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		payloadHeader := header
+		payloadHeader.NumMessageBits = length
+
+		if subtle.ConstantTimeEq(int32(tag), int32(payloadHeader.tag(key))) == 0 {
+			return nil, 0, ErrNotStegoImage
+		}
+
+		if length < 0 || length > numAvailable-stepper.numBitsWritten {
+			return nil, 0, ErrCorruptPayload
+		}
+
+		payloadBits = length
+	}
+
+	return stepper, payloadBits, nil
+}
+
+// findFreeCapacity reads the header of img and returns it along with a stepper positioned where the next
+// payload would be appended and the index that payload would have
+func findFreeCapacity(img image.Image, key *secret, options Options) (Header, *ImageStepper, int, error) {
+	traversal := options.Traversal
+	header, err := readHeader(img, key, options)
+	if err != nil {
+		return Header{}, nil, 0, err
+	}
+
+	// Find the first payload after the last one in the image
+	index := 1
+	for ; ; index++ {
+		if _, _, err := findPayload(img, header, key, traversal, index); err == ErrNotStegoImage {
+			break
+		} else if err != nil {
+			return Header{}, nil, 0, err
+		}
+	}
+
+	stepper, numBits, err := findPayload(img, header, key, traversal, index-1)
+	if err != nil {
+		return Header{}, nil, 0, err
+	}
+
+	if err := stepper.skipBits(numBits); err != nil {
+		return Header{}, nil, 0, err
+	}
+	if err := stepper.alignToPixel(); err != nil {
+		return Header{}, nil, 0, err
+	}
+
+	return header, stepper, index, nil
+}
+
+// numAppendableBits returns the number of bits left for a payload appended at the stepper's position
+func numAppendableBits(img image.Image, header Header, stepper *ImageStepper) int {
+	width := img.Bounds().Max.X
+	height := img.Bounds().Max.Y
+	numAvailable := header.numBitsAvailable(width, height)
+
+	numBits := numAvailable - stepper.numBitsWritten - numPayloadHeaderBits
+	if numBits < 0 {
+		return 0
+	}
+	return numBits
+}
+
+// PlanAppend works out how a message of messageSize bytes would be appended to img by AppendImage, without
+// touching any pixels. The plan's header pixels are those of the header of img.
+func PlanAppend(img image.Image, messageSize int, opts ...Option) (Plan, error) {
+	options := makeOptions(opts)
+
+	key, err := newSecret(options.Passphrase, options.Secure)
+	if err != nil {
+		return Plan{}, err
+	}
+	defer key.destroy()
+
+	header, stepper, _, err := findFreeCapacity(img, key, options)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	width := img.Bounds().Max.X
+	height := img.Bounds().Max.Y
+
+	plan := Plan{
+		HeaderPixels: messageStartPixel(width, height, header.NumBitsPerChannel, header.NumChannels),
+		CapacityBits: numAppendableBits(img, header, stepper),
+		MessageBytes: messageSize,
+	}
+
+	return plan, plan.complete(options, header)
+}
+
+// AppendImage conceals everything read from message in the capacity left over by the payloads already in img,
+// without touching their pixels, and returns a copy of img with the new payload. The header is read with opts,
+// which must hold the passphrase and traversal the image was concealed with. The new payload uses the same
+// bits, channels, strategy and codec as the header, and is encrypted with the same passphrase. The level of
+// WithCodec is used when its codec is the one of the header. Reveal it with WithPayload.
+func AppendImage(img image.Image, message io.Reader, opts ...Option) (*image.NRGBA, int, error) {
+	options := makeOptions(opts)
+
+	key, err := newSecret(options.Passphrase, options.Secure)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer key.destroy()
+
+	header, stepper, index, err := findFreeCapacity(img, key, options)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	messageBytes, err := ioutil.ReadAll(message)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { zeroBytes(messageBytes) }()
+
+	if options.Metadata != nil {
+		prefix, err := options.Metadata.encode()
+		if err != nil {
+			return nil, 0, err
+		}
+		withPrefix := append(prefix, messageBytes...)
+		zeroBytes(messageBytes)
+		messageBytes = withPrefix
+	}
+
+	if header.Codec != CodecNone {
+		level := 0
+		if options.Codec == header.Codec {
+			level = options.CodecLevel
+		}
+
+		compressed, err := compress(messageBytes, header.Codec, level)
+		if err != nil {
+			return nil, 0, err
+		}
+		zeroBytes(messageBytes)
+		messageBytes = compressed
+	}
+
+	if header.trailerSize() > 0 {
+		messageBytes = appendChecksum(messageBytes)
+	}
+
+	if key != nil {
+		encrypted, err := encrypt(messageBytes, key, options.Random)
+		if err != nil {
+			return nil, 0, err
+		}
+		zeroBytes(messageBytes)
+		messageBytes = encrypted
+	}
+
+	if len(messageBytes)*8 > numAppendableBits(img, header, stepper) {
+		return nil, 0, ErrCapacityExceeded
+	}
+
+	outputImage, err := copyImage(options.Context, img, options.Progress)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rng, err := newRand(options.Random)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	payloadHeader := header
+	payloadHeader.NumMessageBits = len(messageBytes) * 8
+
+	if err := writeBits(outputImage, stepper, header.Strategy, rng, payloadHeader.NumMessageBits, lengthSize); err != nil {
+		return nil, 0, err
+	}
+
+	if err := writeBits(outputImage, stepper, header.Strategy, rng, payloadHeader.tag(key), headerTagSize); err != nil {
+		return nil, 0, err
+	}
+
+	options.Progress.OnStart("appending", len(messageBytes))
+
+	for i := 0; i < len(messageBytes); i += options.chunkSize() {
+		if err := options.Context.Err(); err != nil {
+			return nil, 0, err
+		}
+		options.Progress.OnProgress(i)
+
+		chunk := messageBytes[i:]
+		if len(chunk) > options.chunkSize() {
+			chunk = chunk[:options.chunkSize()]
+		}
+
+		if err := writeBytes(outputImage, stepper, header.Strategy, rng, chunk, options.Workers); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	options.Progress.OnDone()
+	options.Logger.Println("Appended payload", index)
+
+	return outputImage, index, nil
+}
+
+// Append conceals message in the capacity left over by the payloads in the image at imagePath and saves the
+// result as a PNG to outputPath. It returns the index the payload is revealed with.
+func Append(imagePath string, message []byte, outputPath string, opts ...Option) (int, error) {
+	img, err := LoadImage(imagePath)
+	if err != nil {
+		return 0, err
+	}
+
+	outputImage, index, err := AppendImage(img, bytes.NewReader(message), opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	return index, SaveImage(outputPath, outputImage, opts...)
+}
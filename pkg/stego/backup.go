@@ -0,0 +1,196 @@
+package stego
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"image"
+	"sort"
+)
+
+// The header is also written to numHeaderBackups backup copies further into the image, so that
+// the message can still be revealed when the header in the top left corner is cropped off or painted over. Each
+// copy holds the layout and every field of the header, written to the least significant bit of the red, green
+// and blue channels of a run of pixels whatever the layout of the message, so that it can be read on its own.
+// The pixels of the copies are left out of the message.
+const (
+	numHeaderBackups   = 2
+	backupLayoutSize   = 8
+	backupBitsPerPixel = 3
+
+	// headerBackupPixels is the number of pixels each backup copy of the header takes up
+	headerBackupPixels = (backupLayoutSize + numHeaderBits + backupBitsPerPixel - 1) / backupBitsPerPixel
+)
+
+// headerBackups returns the first pixel of each backup copy of the header, in order. The image is
+// split into slots the size of a copy, counted back from its last pixel and stopping short of the pixels any
+// header could take up. Without a key, the copies are in the bottom right corner and in the middle of the image.
+// With a key, the slots are chosen with it, so the copies can only be found with the passphrase.
+func headerBackups(width int, height int, key *secret) []int {
+	// A header takes up the most pixels with a single bit of a single channel per pixel
+	size := headerBackupPixels
+	numSlots := (width*height - 2 - numHeaderBits) / size
+	if numSlots <= 0 {
+		return nil
+	}
+
+	slots := []int{0, numSlots / 2}
+	if key != nil {
+		mac := hmac.New(sha256.New, key.key)
+		mac.Write([]byte("header backups"))
+		sum := mac.Sum(nil)
+
+		slots[0] = int(binary.BigEndian.Uint32(sum[:4]) % uint32(numSlots))
+		if numSlots > 1 {
+			slots[1] = (slots[0] + 1 + int(binary.BigEndian.Uint32(sum[4:8])%uint32(numSlots-1))) % numSlots
+		}
+		zeroBytes(sum)
+	}
+
+	if numSlots < numHeaderBackups {
+		slots = slots[:numSlots]
+	}
+
+	starts := make([]int, len(slots))
+	for i, slot := range slots {
+		starts[i] = width*height - (slot+1)*size
+	}
+	sort.Ints(starts)
+	return starts
+}
+
+// reservedTraversal visits the pixels of another traversal, except those that hold a backup copy of the header
+type reservedTraversal struct {
+	traversal Traversal
+	starts    []int
+	size      int
+}
+
+func (self *reservedTraversal) Next() (int, bool) {
+	for {
+		index, ok := self.traversal.Next()
+		if !ok || !self.reserved(index) {
+			return index, ok
+		}
+	}
+}
+
+// reserved reports whether the pixel at index holds a backup copy of the header
+func (self *reservedTraversal) reserved(index int) bool {
+	for _, start := range self.starts {
+		if index >= start && index < start+self.size {
+			return true
+		}
+	}
+	return false
+}
+
+// backupBits returns the bits of a backup copy of the header, with every field masked by mask
+func (self Header) backupBits(width int, height int, key *secret, mask headerMask) []int {
+	var bits []int
+	appendBits := func(value int, numBits int) {
+		for i := 0; i < numBits; i++ {
+			bits = append(bits, getBit(value, i))
+		}
+	}
+
+	appendBits(self.NumBitsPerChannel^mask.numBitsPerChannel, 4)
+	appendBits(self.NumChannels^mask.numChannels, 4)
+	appendBits(headerMagic^mask.magic, headerMagicSize)
+	appendBits(self.Version^mask.version, headerVersionSize)
+	appendBits(int(self.Encryption)^mask.encryption, encryptionSize)
+	appendBits(int(self.Codec)^mask.codec, codecSize)
+	appendBits(self.Strategy.HeaderID()^mask.strategyID, strategyIDSize)
+	appendBits(self.NumMessageBits^mask.length, lengthSize)
+	appendBits(self.tag(key)^mask.tag, headerTagSize)
+	return bits
+}
+
+// encodeBackups writes the backup copies of the header of a width by height image into the pixels of img, which
+// may only hold some of the rows of the image. The pixels of a copy outside of img are left for the band they
+// are in.
+func (self Header) encodeBackups(img *image.NRGBA, width int, height int, key *secret, hidden bool) {
+	mask := headerMask{}
+	if hidden {
+		mask = makeHeaderMask(key)
+	}
+
+	bits := self.backupBits(width, height, key, mask)
+	bounds := img.Bounds()
+
+	for _, start := range headerBackups(width, height, key) {
+		for i, bit := range bits {
+			index := start + i/backupBitsPerPixel
+			point := image.Point{X: index % width, Y: index / width}
+			if !point.In(bounds) {
+				continue
+			}
+
+			pixel := getPixel(img, point.X, point.Y)
+			if bit == 0 {
+				pixel[i%backupBitsPerPixel] = clearBitUint8(pixel[i%backupBitsPerPixel], 0)
+			} else {
+				pixel[i%backupBitsPerPixel] = setBitUint8(pixel[i%backupBitsPerPixel], 0)
+			}
+		}
+	}
+}
+
+// decodeBackupHeader reads the header of img from the first of its backup copies that can be authenticated
+func decodeBackupHeader(img image.Image, key *secret) (Header, error) {
+	masks := []headerMask{{}}
+	if key != nil {
+		masks = append(masks, makeHeaderMask(key))
+	}
+
+	width := img.Bounds().Max.X
+	height := img.Bounds().Max.Y
+
+	for _, start := range headerBackups(width, height, key) {
+		for _, mask := range masks {
+			if header, err := decodeBackupWithMask(img, key, mask, start); err == nil {
+				header.FromBackup = true
+				return header, nil
+			}
+		}
+	}
+
+	return Header{}, ErrNotStegoImage
+}
+
+// decodeBackupWithMask reads the backup copy of the header that starts at the pixel start, with every field
+// unmasked by mask
+func decodeBackupWithMask(img image.Image, key *secret, mask headerMask, start int) (Header, error) {
+	width := img.Bounds().Max.X
+	height := img.Bounds().Max.Y
+
+	stepper := makeImageStepper(1, width, height, backupBitsPerPixel, 0)
+	stepper.startTraversal(LinearTraversal()(width, height, start))
+
+	numBitsPerChannel, err := readBits(img, stepper, lsbStrategy{}, 4)
+	if err != nil {
+		return Header{}, err
+	}
+	numChannels, err := readBits(img, stepper, lsbStrategy{}, 4)
+	if err != nil {
+		return Header{}, err
+	}
+	numBitsPerChannel ^= mask.numBitsPerChannel
+	numChannels ^= mask.numChannels
+
+	if numBitsPerChannel < 1 || numBitsPerChannel > 8 || numChannels < 1 || numChannels > 4 {
+		return Header{}, ErrNotStegoImage
+	}
+
+	magic, err := readBits(img, stepper, lsbStrategy{}, headerMagicSize)
+	if err != nil || magic^mask.magic != headerMagic {
+		return Header{}, ErrNotStegoImage
+	}
+
+	version, err := readBits(img, stepper, lsbStrategy{}, headerVersionSize)
+	if err != nil || version^mask.version != headerVersion {
+		return Header{}, ErrNotStegoImage
+	}
+
+	return decodeHeaderFields(img, key, mask, numBitsPerChannel, numChannels, stepper)
+}
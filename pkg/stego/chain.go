@@ -0,0 +1,45 @@
+package stego
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+)
+
+// The shards of a payload can also be chained, with the metadata of every shard but the last pointing to the
+// image that holds the next one, so that the images can be published one at a time and the payload followed
+// from the first. The chain is made from the last image to the first, since each link holds the checksum of
+// the image it points to.
+
+// Link points from an image of a chain to the next one, by the SHA-256 of its file and a Hint at its name
+type Link struct {
+	SHA256 string `json:"sha256"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// NewLink returns a Link to the image read from r, with hint at its name
+func NewLink(r io.Reader, hint string) (Link, error) {
+	sum, err := fileChecksum(r)
+	if err != nil {
+		return Link{}, err
+	}
+	return Link{SHA256: sum, Hint: hint}, nil
+}
+
+// Matches reports whether the image read from r is the one the link points to
+func (self Link) Matches(r io.Reader) (bool, error) {
+	sum, err := fileChecksum(r)
+	if err != nil {
+		return false, err
+	}
+	return sum == self.SHA256, nil
+}
+
+// fileChecksum returns the SHA-256 of everything read from r in hex
+func fileChecksum(r io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
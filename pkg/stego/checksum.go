@@ -0,0 +1,82 @@
+package stego
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"hash"
+	"io"
+)
+
+// Every payload ends with a trailer holding the SHA-256 of everything in front of
+// it, the metadata included. An encrypted payload seals the trailer along with the message. Reading the whole
+// payload and finding that its checksum matches confirms that nothing in it was lost, rather than only that
+// nothing failed to decode.
+
+// checksumSize is the size of the trailer at the end of a payload
+const checksumSize = sha256.Size
+
+// trailerSize returns the size of the trailer at the end of the payloads of an image with the header, which is
+// 0 for the first format
+func (self Header) trailerSize() int {
+	if self.Version == FormatV1 {
+		return 0
+	}
+	return checksumSize
+}
+
+// appendChecksum returns message with its trailer appended
+func appendChecksum(message []byte) []byte {
+	sum := sha256.Sum256(message)
+	return appendSensitive(message, sum[:])
+}
+
+// splitChecksum checks the trailer at the end of payload and returns the message in front of it
+func splitChecksum(payload []byte) ([]byte, error) {
+	if len(payload) < checksumSize {
+		return nil, ErrCorruptPayload
+	}
+
+	message := payload[:len(payload)-checksumSize]
+	sum := sha256.Sum256(message)
+
+	if subtle.ConstantTimeCompare(sum[:], payload[len(message):]) == 0 {
+		return nil, ErrCorruptPayload
+	}
+	return message, nil
+}
+
+// checksumWriter passes a payload on to w without its trailer, which it holds back until Close checks it
+// against the rest of the payload
+type checksumWriter struct {
+	w        io.Writer
+	checksum hash.Hash
+	held     []byte
+}
+
+func newChecksumWriter(w io.Writer) *checksumWriter {
+	return &checksumWriter{w: w, checksum: sha256.New()}
+}
+
+func (self *checksumWriter) Write(p []byte) (int, error) {
+	self.held = append(self.held, p...)
+	if len(self.held) <= checksumSize {
+		return len(p), nil
+	}
+
+	pass := self.held[:len(self.held)-checksumSize]
+	self.checksum.Write(pass)
+	if _, err := self.w.Write(pass); err != nil {
+		return 0, err
+	}
+
+	self.held = append(self.held[:0], self.held[len(pass):]...)
+	return len(p), nil
+}
+
+// Close returns ErrCorruptPayload unless the trailer matches what was passed on
+func (self *checksumWriter) Close() error {
+	if len(self.held) < checksumSize || subtle.ConstantTimeCompare(self.checksum.Sum(nil), self.held) == 0 {
+		return ErrCorruptPayload
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package stego
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// codecSize is the number of bits used to store how the message is compressed
+const codecSize = 8
+
+// maxDecompressedSize is the most a message is allowed to grow to when it's decompressed. The checksum only
+// covers the compressed message, so without a limit a small crafted image could inflate to gigabytes.
+const maxDecompressedSize = 1 << 28
+
+// Codec is how a message is compressed before it is concealed, which the header records so that reveal can
+// decompress it. A compressed message takes up less of the image, but it has to be read as a whole to be
+// revealed, like an encrypted one.
+type Codec int
+
+const (
+	// CodecNone means the message isn't compressed
+	CodecNone Codec = 0
+
+	// CodecDeflate means the message is compressed with DEFLATE, at a level from 1 for the fastest to 9 for the
+	// smallest
+	CodecDeflate Codec = 1
+)
+
+// codecNames are the names of the codecs, in the order of their IDs
+var codecNames = []string{"none", "deflate"}
+
+// LookupCodec returns the codec called name
+func LookupCodec(name string) (Codec, bool) {
+	for id, codecName := range codecNames {
+		if codecName == name {
+			return Codec(id), true
+		}
+	}
+	return CodecNone, false
+}
+
+// CodecNames returns the names of the codecs a message can be compressed with
+func CodecNames() []string {
+	return append([]string(nil), codecNames...)
+}
+
+func (self Codec) String() string {
+	if self < 0 || int(self) >= len(codecNames) {
+		return "unknown"
+	}
+	return codecNames[self]
+}
+
+// ValidateLevel returns an error unless level is a compression level of codec. Level 0 picks the default level
+// of the codec.
+func (self Codec) ValidateLevel(level int) error {
+	switch self {
+	case CodecNone:
+		if level != 0 {
+			return errors.New("a compression level requires a codec")
+		}
+	case CodecDeflate:
+		if level < 0 || level > flate.BestCompression {
+			return errors.New("deflate compression level must be between 1 and 9")
+		}
+	default:
+		return errors.New("unknown codec")
+	}
+	return nil
+}
+
+// CompressedSize returns the size of message once it's compressed with codec at level, which is what decides
+// whether it fits in an image
+func CompressedSize(message []byte, codec Codec, level int) (int, error) {
+	compressed, err := compress(message, codec, level)
+	if err != nil {
+		return 0, err
+	}
+
+	defer zeroBytes(compressed)
+	return len(compressed), nil
+}
+
+// compress returns data compressed with codec at level, leaving data as it is
+func compress(data []byte, codec Codec, level int) ([]byte, error) {
+	if err := codec.ValidateLevel(level); err != nil {
+		return nil, err
+	}
+
+	if codec == CodecNone {
+		return append([]byte(nil), data...), nil
+	}
+
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+
+	var compressed bytes.Buffer
+	writer, err := flate.NewWriter(&compressed, level)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return compressed.Bytes(), nil
+}
+
+// decompress returns data decompressed with codec. When data can't be decompressed, or it decompresses to more
+// than maxDecompressedSize, whatever came out of it before the damage or the limit is returned along with
+// ErrCorruptPayload.
+func decompress(data []byte, codec Codec) ([]byte, error) {
+	switch codec {
+	case CodecNone:
+		return append([]byte(nil), data...), nil
+	case CodecDeflate:
+	default:
+		return nil, ErrCorruptPayload
+	}
+
+	reader := flate.NewReader(bytes.NewReader(data))
+	defer reader.Close()
+
+	decompressed, err := ioutil.ReadAll(io.LimitReader(reader, maxDecompressedSize+1))
+	if err != nil {
+		return decompressed, ErrCorruptPayload
+	}
+	if len(decompressed) > maxDecompressedSize {
+		zeroBytes(decompressed[maxDecompressedSize:])
+		return decompressed[:maxDecompressedSize], ErrCorruptPayload
+	}
+	return decompressed, nil
+}
@@ -0,0 +1,8 @@
+// Package stego conceals messages in the pixels of images and reveals them again.
+//
+// Independent calls to Conceal, Reveal, ConcealImage, RevealImage, NewEncoder, NewDecoder, DecodeHeader, and
+// PlanConceal are safe to run in parallel. Each call keeps its own state, and strategies that make random
+// choices are given a generator that belongs to that call and is keyed from crypto/rand, never the global
+// math/rand source. A Logger or Progress shared between calls that run in parallel must itself be safe for
+// concurrent use, and a single Encoder or Decoder must only be used by one goroutine at a time.
+package stego
@@ -0,0 +1,148 @@
+package stego
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"image"
+)
+
+// ErrNoMetadata is returned when the metadata of a message that has none is edited
+var ErrNoMetadata = errors.New("the message has no metadata")
+
+// EditMetadata returns a copy of img with the metadata of its message changed by edit, without moving the
+// message. An error returned by edit is returned as is. The metadata must still fit in the space it had, which
+// includes the padding it was written with. The bits of an unencrypted message are left as they are and only the
+// metadata and the checksum behind the message are written again. An encrypted message is sealed as a whole, so
+// it is encrypted again under a new nonce and written to the same bits. The metadata of a compressed message
+// can't be edited. The payload to edit is chosen with WithPayload.
+func EditMetadata(img image.Image, edit func(*Metadata) error, opts ...Option) (*image.NRGBA, error) {
+	options := makeOptions(opts)
+
+	key, err := newSecret(options.Passphrase, options.Secure)
+	if err != nil {
+		return nil, err
+	}
+	defer key.destroy()
+
+	header, err := readHeader(img, key, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// The metadata of a compressed message is compressed along with it, so it can't be written again on its own
+	if header.Codec != CodecNone {
+		return nil, errors.New("the metadata of a compressed message can't be edited")
+	}
+
+	stepper, numBits, err := findPayload(img, header, key, options.Traversal, options.Payload)
+	if err != nil {
+		return nil, err
+	}
+	startBits := stepper.numBitsWritten
+
+	messageBytes := make([]byte, numBits/8)
+	for i := range messageBytes {
+		messageByte, err := readBits(img, stepper, header.Strategy, 8)
+		if err != nil {
+			return nil, err
+		}
+		messageBytes[i] = uint8(messageByte)
+	}
+
+	plaintext := messageBytes
+	if key != nil {
+		if plaintext, err = decrypt(messageBytes, key); err != nil {
+			return nil, err
+		}
+		defer zeroBytes(plaintext)
+	}
+
+	trailer := header.trailerSize()
+	if len(plaintext) < trailer {
+		return nil, ErrCorruptPayload
+	}
+	messageSize := len(plaintext) - trailer
+
+	prefixSize := len(metadataMagic) + 4
+	if messageSize < prefixSize || !bytes.Equal(plaintext[:len(metadataMagic)], metadataMagic) {
+		return nil, ErrNoMetadata
+	}
+
+	size := int(binary.BigEndian.Uint32(plaintext[len(metadataMagic):prefixSize]))
+	if size > maxMetadataSize || size > messageSize-prefixSize {
+		return nil, ErrCorruptPayload
+	}
+
+	metadata := Metadata{}
+	if err := json.Unmarshal(plaintext[prefixSize:prefixSize+size], &metadata); err != nil {
+		return nil, ErrCorruptPayload
+	}
+	if err := metadata.validateDecoded(messageSize - prefixSize - size); err != nil {
+		return nil, err
+	}
+
+	if err := edit(&metadata); err != nil {
+		return nil, err
+	}
+
+	prefix, err := metadata.encodeSized(nil, size)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the metadata and the checksum of an unencrypted message are written again
+	copy(plaintext, prefix)
+	if trailer > 0 {
+		sum := sha256.Sum256(plaintext[:messageSize])
+		copy(plaintext[messageSize:], sum[:])
+	}
+
+	written := prefix
+	if key != nil {
+		if written, err = encrypt(plaintext, key, options.Random); err != nil {
+			return nil, err
+		}
+	}
+
+	outputImage, err := copyImage(options.Context, img, options.Progress)
+	if err != nil {
+		return nil, err
+	}
+
+	rng, err := newRand(options.Random)
+	if err != nil {
+		return nil, err
+	}
+
+	width := img.Bounds().Max.X
+	height := img.Bounds().Max.Y
+	stepper = header.messageStepper(width, height, key, options.Traversal)
+
+	if err := stepper.skipBits(startBits); err != nil {
+		return nil, err
+	}
+
+	for _, messageByte := range written {
+		if err := writeBits(outputImage, stepper, header.Strategy, rng, int(messageByte), 8); err != nil {
+			return nil, err
+		}
+	}
+
+	if key == nil && trailer > 0 {
+		if err := stepper.skipBits((messageSize - len(prefix)) * 8); err != nil {
+			return nil, err
+		}
+
+		for _, sumByte := range plaintext[messageSize:] {
+			if err := writeBits(outputImage, stepper, header.Strategy, rng, int(sumByte), 8); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	options.Logger.Println("Wrote", len(written), "bytes of the message again")
+	return outputImage, nil
+}
@@ -0,0 +1,91 @@
+package stego
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+)
+
+// encryptionOverhead is the number of bytes encrypt adds to a message, which is the 12 byte GCM nonce and the
+// 16 byte authentication tag
+const encryptionOverhead = 12 + 16
+
+func createHash(key string) []byte {
+	keyBytes := []byte(key)
+	defer zeroBytes(keyBytes)
+
+	hasher := md5.New()
+	hasher.Write(keyBytes)
+	sum := hasher.Sum(nil)
+	defer zeroBytes(sum)
+
+	hash := make([]byte, hex.EncodedLen(len(sum)))
+	hex.Encode(hash, sum)
+	return hash
+}
+
+func encrypt(data []byte, key *secret, random io.Reader) ([]byte, error) {
+	block, err := aes.NewCipher(key.key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(random, nonce); err != nil {
+		return nil, err
+	}
+	ciphertext := gcm.Seal(nonce, nonce, data, nil)
+	return ciphertext, nil
+}
+
+// decryptUnauthenticated decrypts data in place like decrypt, but without checking its authentication tag. GCM
+// encrypts with AES in counter mode, so a bit that was flipped in the ciphertext only flips the same bit of the
+// plaintext, and the rest of a damaged message can still be read.
+func decryptUnauthenticated(data []byte, key *secret) ([]byte, error) {
+	block, err := aes.NewCipher(key.key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := 12
+	if len(data) < encryptionOverhead {
+		return nil, ErrCorruptPayload
+	}
+
+	// The message is encrypted from the counter block that follows the one the tag is encrypted with
+	counter := make([]byte, aes.BlockSize)
+	copy(counter, data[:nonceSize])
+	counter[aes.BlockSize-1] = 2
+
+	ciphertext := data[nonceSize : len(data)-(encryptionOverhead-nonceSize)]
+	cipher.NewCTR(block, counter).XORKeyStream(ciphertext, ciphertext)
+	return ciphertext, nil
+}
+
+// decrypt opens data in place, so the plaintext it returns shares data's memory and data is overwritten whether
+// or not it can be opened
+func decrypt(data []byte, key *secret) ([]byte, error) {
+	block, err := aes.NewCipher(key.key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonceSize := gcm.NonceSize()
+	if len(data) < nonceSize {
+		return nil, ErrCorruptPayload
+	}
+	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
+	plaintext, err := gcm.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrCorruptPayload
+	}
+	return plaintext, nil
+}
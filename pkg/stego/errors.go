@@ -0,0 +1,44 @@
+package stego
+
+import "errors"
+
+var (
+	// ErrCapacityExceeded is returned when a message doesn't fit in the image
+	ErrCapacityExceeded = errors.New("image is not large enough to hide a message")
+
+	// ErrNotStegoImage is returned when an image doesn't have a valid header
+	ErrNotStegoImage = errors.New("image does not contain a hidden message")
+
+	// ErrCorruptHeader is returned when an image has a header whose tag doesn't match, which means it's been
+	// damaged or it needs a passphrase to be read
+	ErrCorruptHeader = errors.New("image has a hidden message but its header is corrupted or needs a passphrase")
+
+	// ErrUnsupportedVersion is returned when an image has a header of a later version than HeaderVersion
+	ErrUnsupportedVersion = errors.New("image was produced by a newer hide, upgrade to reveal it")
+
+	// ErrWrongPassphrase is returned when the header can't be authenticated with the given passphrase
+	ErrWrongPassphrase = errors.New("header authentication failed, the passphrase is wrong or the image is corrupted")
+
+	// ErrPassphraseRequired is returned when an image whose header says its message is encrypted with a
+	// passphrase is revealed without one
+	ErrPassphraseRequired = errors.New("image holds a message encrypted with a passphrase, reveal it with the passphrase")
+
+	// ErrPrivateKeyRequired is returned when an image whose header says its message is encrypted to a public key
+	// is revealed without the private key
+	ErrPrivateKeyRequired = errors.New("image holds a message encrypted to a public key, reveal it with the private key")
+
+	// ErrNotEncrypted is returned when an image whose message isn't encrypted is revealed with a passphrase
+	ErrNotEncrypted = errors.New("image holds a message that isn't encrypted, reveal it without a passphrase")
+
+	// ErrCorruptPayload is returned when the header is valid but the message can't be read or decrypted
+	ErrCorruptPayload = errors.New("hidden message is corrupted")
+
+	// ErrExpired is returned when the metadata of a message says it expired before it was revealed
+	ErrExpired = errors.New("hidden message has expired")
+
+	// ErrUnsupportedFormat is returned when an image can't be decoded
+	ErrUnsupportedFormat = errors.New("image format is not supported")
+
+	// ErrNotTileable is returned when an image can't be processed a band of rows at a time
+	ErrNotTileable = errors.New("only 8-bit non-interlaced PNGs can be processed in tiles")
+)
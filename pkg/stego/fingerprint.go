@@ -0,0 +1,198 @@
+package stego
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"image"
+	"math"
+	"sort"
+)
+
+// Copies of an image given to different recipients can be fingerprinted, so that a copy that leaks can be traced
+// back to the recipient it was given to. The fingerprint of a recipient is a pattern of +1 and -1, one per pixel,
+// keyed with a fingerprint key and the name of the recipient, which is added to the red, green and blue of every
+// pixel times the strength. It sits above the bits a message is concealed in, so concealing the same message in
+// every copy afterwards leaves it in place. Tracing correlates the pattern of every recipient with the fine
+// detail of a copy, or with how it differs from the cover when that's given, so it survives noise, small changes
+// of brightness and mild compression, but not cropping, scaling or rotation. Without the key the patterns can't
+// be made, so recipients can't strip or forge them even though they can reveal the message.
+
+// DefaultFingerprintStrength is the strength fingerprints are added with unless another is given
+const DefaultFingerprintStrength = 2
+
+// maxFingerprintStrength is the most a fingerprint can change a channel of a pixel by
+const maxFingerprintStrength = 16
+
+// FingerprintMatch is how strongly the fingerprint of Recipient was found in an image. Score is how many standard
+// deviations the correlation is from that of an image without the fingerprint, so a score above 6 is next to
+// impossible by chance.
+type FingerprintMatch struct {
+	Recipient string  `json:"recipient"`
+	Score     float64 `json:"score"`
+}
+
+// fingerprintPattern returns the signs of the fingerprint of recipient for an image of size pixels, as 0 for -1
+// and 1 for +1, packed 8 to a byte
+func fingerprintPattern(key []byte, recipient string, size int) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("fingerprint\x00" + recipient))
+	seed := mac.Sum(nil)
+	defer zeroBytes(seed)
+
+	pattern := make([]byte, 0, (size+7)/8+sha256.Size)
+	var counter [8]byte
+	for block := uint64(0); len(pattern)*8 < size; block++ {
+		binary.BigEndian.PutUint64(counter[:], block)
+		mac := hmac.New(sha256.New, seed)
+		mac.Write(counter[:])
+		pattern = mac.Sum(pattern)
+	}
+	return pattern
+}
+
+// fingerprintSign returns the sign of the fingerprint at pixel i of pattern
+func fingerprintSign(pattern []byte, i int) int {
+	if pattern[i/8]>>uint(7-i%8)&1 == 1 {
+		return 1
+	}
+	return -1
+}
+
+// Fingerprint returns a copy of img with the fingerprint of recipient, keyed with key, added to it with strength,
+// which is between 1 and 16. Channels are clamped to 0 and 255, so the fingerprint is weaker where the image
+// is saturated. Only the context and progress are taken from opts.
+func Fingerprint(img image.Image, key string, recipient string, strength int, opts ...Option) (*image.NRGBA,
+	error) {
+
+	options := makeOptions(opts)
+
+	if key == "" {
+		return nil, errors.New("a fingerprint key is required")
+	}
+	if strength < 1 || strength > maxFingerprintStrength {
+		return nil, errors.New("fingerprint strength must be between 1 and 16")
+	}
+
+	outputImage, err := copyImage(options.Context, img, options.Progress)
+	if err != nil {
+		return nil, err
+	}
+	bounds := outputImage.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	hash := createHash(key)
+	pattern := fingerprintPattern(hash, recipient, width*height)
+	zeroBytes(hash)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			delta := strength * fingerprintSign(pattern, y*width+x)
+			offset := outputImage.PixOffset(bounds.Min.X+x, bounds.Min.Y+y)
+			for channel := 0; channel < 3; channel++ {
+				value := int(outputImage.Pix[offset+channel]) + delta
+				if value < 0 {
+					value = 0
+				} else if value > 255 {
+					value = 255
+				}
+				outputImage.Pix[offset+channel] = uint8(value)
+			}
+		}
+	}
+
+	return outputImage, nil
+}
+
+// TraceFingerprint scores how strongly the fingerprint of each of recipients, keyed with key, is found in img,
+// and returns the matches from the strongest to the weakest. With a cover, which must be the size of img, the
+// fingerprints are looked for in how img differs from it, which finds them far more reliably than in img alone.
+// Only the context and progress are taken from opts.
+func TraceFingerprint(img image.Image, cover image.Image, key string, recipients []string,
+	opts ...Option) ([]FingerprintMatch, error) {
+
+	options := makeOptions(opts)
+
+	if key == "" {
+		return nil, errors.New("a fingerprint key is required")
+	}
+	if cover != nil && (cover.Bounds().Dx() != img.Bounds().Dx() || cover.Bounds().Dy() != img.Bounds().Dy()) {
+		return nil, errors.New("the cover and the image must be the same size")
+	}
+
+	residual, err := fingerprintResidual(img, cover, options)
+	if err != nil {
+		return nil, err
+	}
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	energy := 0.0
+	for _, value := range residual {
+		energy += float64(value) * float64(value)
+	}
+
+	hash := createHash(key)
+	defer zeroBytes(hash)
+
+	matches := make([]FingerprintMatch, 0, len(recipients))
+	for _, recipient := range recipients {
+		pattern := fingerprintPattern(hash, recipient, width*height)
+
+		correlation := 0.0
+		for i, value := range residual {
+			correlation += float64(value * fingerprintSign(pattern, i))
+		}
+
+		score := 0.0
+		if energy > 0 {
+			score = correlation / math.Sqrt(energy)
+		}
+		matches = append(matches, FingerprintMatch{Recipient: recipient, Score: score})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	return matches, nil
+}
+
+// fingerprintResidual returns, for every pixel of img, the sum of its red, green and blue less that of the cover,
+// or without a cover less the average of its four neighbours, which removes most of the image and keeps the
+// fingerprint. Pixels on the edge have no residual without a cover.
+func fingerprintResidual(img image.Image, cover image.Image, options Options) ([]int, error) {
+	pixels, err := copyImage(options.Context, img, options.Progress)
+	if err != nil {
+		return nil, err
+	}
+	bounds := pixels.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	brightness := func(pixels *image.NRGBA, x int, y int) int {
+		offset := pixels.PixOffset(pixels.Bounds().Min.X+x, pixels.Bounds().Min.Y+y)
+		return int(pixels.Pix[offset]) + int(pixels.Pix[offset+1]) + int(pixels.Pix[offset+2])
+	}
+
+	residual := make([]int, width*height)
+
+	if cover != nil {
+		coverPixels, err := copyImage(options.Context, cover, options.Progress)
+		if err != nil {
+			return nil, err
+		}
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				residual[y*width+x] = brightness(pixels, x, y) - brightness(coverPixels, x, y)
+			}
+		}
+		return residual, nil
+	}
+
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			residual[y*width+x] = 4*brightness(pixels, x, y) - brightness(pixels, x-1, y) -
+				brightness(pixels, x+1, y) - brightness(pixels, x, y-1) - brightness(pixels, x, y+1)
+		}
+	}
+	return residual, nil
+}
@@ -0,0 +1,41 @@
+package stego
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// fixtureMessage is the message concealed in every fixture image
+const fixtureMessage = "Hide fixture message"
+
+// TestRevealReleasedFormats reveals images written by earlier releases, so that a change to how the header or
+// message is read can't break them. Each fixture was concealed in the same 48x48 cover with the default options
+// of its release:
+//
+//	legacy.png  5deef3a, the first format
+func TestRevealReleasedFormats(t *testing.T) {
+	fixtures := []struct {
+		name    string
+		version int
+		opts    []Option
+	}{
+		{"legacy", FormatV1, []Option{WithFormat(FormatV1)}},
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			message, result, err := Reveal(filepath.Join("testdata", fixture.name+".png"), fixture.opts...)
+			if err != nil {
+				t.Fatalf("reveal: %v", err)
+			}
+
+			if string(message) != fixtureMessage {
+				t.Errorf("revealed %q, want %q", message, fixtureMessage)
+			}
+
+			if result.Header.Version != fixture.version {
+				t.Errorf("header version is %d, want %d", result.Header.Version, fixture.version)
+			}
+		})
+	}
+}
@@ -0,0 +1,563 @@
+package stego
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"math"
+	"math/rand"
+)
+
+// headerTagSize is the number of bits used to store the tag that authenticates the header
+const headerTagSize = 32
+
+// The header starts with headerMagic and the version of the format right after the first two pixels. The magic
+// tells an image without a header apart from one whose header is damaged, and the version lets the format change
+// without older releases misreading what newer ones write. The first format has neither, so it can only be read
+// with decodeLegacy.
+const (
+	headerMagic       = 0x4869
+	headerMagicSize   = 16
+	headerVersionSize = 8
+
+	// headerVersion is the version of the header written when concealing, which is FormatV2. The first format
+	// counts as version 1.
+	headerVersion = FormatV2
+)
+
+// HeaderVersion is the version of the header written when concealing. A header of a later version fails with
+// ErrUnsupportedVersion.
+const HeaderVersion = headerVersion
+
+// lengthSize is the number of bits used to store the length of a payload. Unlike the first format, whose length
+// takes up numBitsToEncodeNumMessageBits bits, it doesn't depend on the size of the image, so it can't fall short
+// of the capacity of an image with many bits per channel.
+const lengthSize = 64
+
+// numHeaderBits is the number of bits the header takes up after the first two pixels
+const numHeaderBits = headerMagicSize + headerVersionSize + encryptionSize + codecSize + strategyIDSize + lengthSize + headerTagSize
+
+// encryptionSize is the number of bits used to store how the message is encrypted
+const encryptionSize = 8
+
+// Encryption is how the message of an image is encrypted, which the header records so that reveal can say what
+// it needs to read the message
+type Encryption int
+
+const (
+	// EncryptionNone means the message isn't encrypted
+	EncryptionNone Encryption = 0
+
+	// EncryptionPassphrase means the message is sealed with AES-GCM under a key derived from a passphrase
+	EncryptionPassphrase Encryption = 1
+
+	// EncryptionPublicKey means the message is encrypted to the public key of the recipient
+	EncryptionPublicKey Encryption = 2
+)
+
+// encryptionOf returns how a message is encrypted with key
+func encryptionOf(key *secret) Encryption {
+	if key == nil {
+		return EncryptionNone
+	}
+	return EncryptionPassphrase
+}
+
+func (self Encryption) String() string {
+	switch self {
+	case EncryptionNone:
+		return "none"
+	case EncryptionPassphrase:
+		return "passphrase"
+	case EncryptionPublicKey:
+		return "public key"
+	default:
+		return "unknown"
+	}
+}
+
+// Header holds the values that are written in front of the message so that it can later be revealed. Use
+// DecodeHeader to inspect the header of an image.
+type Header struct {
+	// Version is the version of the format, which decides where the message starts. Encode writes the current
+	// version when it's 0.
+	Version           int
+	NumBitsPerChannel int
+	NumChannels       int
+	Strategy          Strategy
+	NumMessageBits    int
+
+	// Encryption is how the message is encrypted. The first format doesn't record it, so its headers leave it
+	// as EncryptionNone whether or not their message is encrypted.
+	Encryption Encryption
+
+	// Codec is how every payload of the image is compressed
+	Codec Codec
+
+	// FromBackup reports whether the header was read from one of its backup copies because the one in the top
+	// left corner is damaged
+	FromBackup bool
+
+	// Headerless reports whether the header was left out of the image and given to reveal with WithParams
+	Headerless bool
+}
+
+// headerMask is XORed with every header field when the header is hidden. An image with a hidden header
+// shows nothing but noise in its header pixels to anyone who doesn't know the passphrase.
+type headerMask struct {
+	magic             int
+	version           int
+	encryption        int
+	codec             int
+	numBitsPerChannel int
+	numChannels       int
+	strategyID        int
+	length            int
+	tag               int
+}
+
+// makeHeaderMask derives the header mask from the key
+func makeHeaderMask(key *secret) headerMask {
+	mac := hmac.New(sha256.New, key.key)
+	mac.Write([]byte("header mask"))
+	sum := mac.Sum(nil)
+	defer zeroBytes(sum)
+
+	return headerMask{
+		numBitsPerChannel: int(sum[0] & 0xF),
+		numChannels:       int(sum[1] & 0xF),
+		strategyID:        int(sum[2]),
+		tag:               int(binary.BigEndian.Uint32(sum[7:11])),
+		magic:             int(binary.BigEndian.Uint16(sum[11:13])),
+		version:           int(sum[13]),
+		encryption:        int(sum[14]),
+		length:            int(binary.BigEndian.Uint64(sum[15:23])),
+		codec:             int(sum[23]),
+	}
+}
+
+// numBitsToEncodeNumMessageBits tells us how many bits to read from the image so we can decode the bits required
+// for the hidden message. We let numBitsToEncodeNumMessageBits be equal to the number of bits required to encode
+// the total number of bits in the image since the number of bits to encode a message cannot exceed the number
+// of bits to encode the number of bits in the entire image. This provides a fixed number of bits for each image
+// that can be calculated when concealing and revealing a message from an image.
+func numBitsToEncodeNumMessageBits(width int, height int) int {
+	totalBitsInImage := numBitsAvailable(width, height, 4, 8)
+	return int(math.Floor(math.Log2(float64(totalBitsInImage))))
+}
+
+// messageStartPixel returns the index of the first pixel after the header. The message is written to the pixels
+// from there onwards in the order decided by the traversal.
+func messageStartPixel(width int, height int, numBitsPerChannel int, numChannels int) int {
+	stepper := makeImageStepper(numBitsPerChannel, width, height, numChannels, 0)
+	stepper.skipPixel()
+	stepper.skipPixel()
+
+	for i := 0; i < numHeaderBits; i++ {
+		stepper.step()
+	}
+
+	return stepper.nextUnusedPixel()
+}
+
+// makeMessageStepper returns a stepper that visits the pixels after the header in the order decided by
+// traversal, skipping the backup copies of the header placed with key
+func makeMessageStepper(width int, height int, numBitsPerChannel int, numChannels int, key *secret, totalBitsToBeWritten int, traversal TraversalFactory) *ImageStepper {
+	first := messageStartPixel(width, height, numBitsPerChannel, numChannels)
+	stepper := makeImageStepper(numBitsPerChannel, width, height, numChannels, totalBitsToBeWritten)
+
+	pixels := traversal(width, height, first)
+	if starts := headerBackups(width, height, key); len(starts) > 0 {
+		pixels = &reservedTraversal{traversal: pixels, starts: starts, size: headerBackupPixels}
+	}
+
+	stepper.startTraversal(pixels)
+	return stepper
+}
+
+// numMessageBitsAvailable returns the number of message bits strategy can hide in the pixels after the header,
+// leaving out the backup copies of the header
+func numMessageBitsAvailable(width int, height int, numBitsPerChannel int, numChannels int, strategy Strategy) int {
+	first := messageStartPixel(width, height, numBitsPerChannel, numChannels)
+	numPixels := width*height - first - len(headerBackups(width, height, nil))*headerBackupPixels
+	return strategy.Capacity(numPixels, numChannels, numBitsPerChannel)
+}
+
+// bytes serializes the header fields so they can be authenticated by tag
+func (self Header) bytes() []byte {
+	bytes := make([]byte, 14)
+	bytes[0] = uint8(self.NumBitsPerChannel)
+	bytes[1] = uint8(self.NumChannels)
+	bytes[2] = uint8(self.Strategy.HeaderID())
+	binary.BigEndian.PutUint64(bytes[3:], uint64(self.NumMessageBits))
+	bytes[11] = uint8(self.Version)
+	bytes[12] = uint8(self.Encryption)
+	bytes[13] = uint8(self.Codec)
+	return bytes
+}
+
+// tag computes the tag that is written right after the header. If a passphrase is provided, the tag is a
+// truncated HMAC-SHA256 keyed by the key derived from the passphrase. Otherwise a CRC32 is used so that a
+// corrupted header is still detected before the message is read.
+func (self Header) tag(key *secret) int {
+	if key == nil {
+		return int(crc32.ChecksumIEEE(self.bytes()))
+	}
+
+	mac := hmac.New(sha256.New, key.key)
+	mac.Write(self.bytes())
+	return int(binary.BigEndian.Uint32(mac.Sum(nil)))
+}
+
+// Encode writes the header into img. With WithHiddenHeader, every header field is masked with a mask derived
+// from the passphrase.
+func (self Header) Encode(img *image.NRGBA, opts ...Option) error {
+	options := makeOptions(opts)
+
+	if self.Version == 0 {
+		self.Version = headerVersion
+	}
+
+	key, err := newSecret(options.Passphrase, options.Secure)
+	if err != nil {
+		return err
+	}
+	defer key.destroy()
+
+	return self.encode(img, key, options.HideHeader)
+}
+
+// DecodeHeader reads and authenticates the header of img. If the header can't be authenticated, the fields
+// that were read are returned along with the error. ErrNotStegoImage means there's no header at all, while
+// ErrCorruptHeader and ErrUnsupportedVersion mean there is one but it can't be read.
+func DecodeHeader(img image.Image, opts ...Option) (Header, error) {
+	options := makeOptions(opts)
+
+	key, err := newSecret(options.Passphrase, options.Secure)
+	if err != nil {
+		return Header{}, err
+	}
+	defer key.destroy()
+
+	return decodeHeader(img, key)
+}
+
+// encode writes the header and its backup copies into outputImage. If hidden is true, every header field is
+// masked with a mask derived from the key.
+func (self Header) encode(outputImage *image.NRGBA, key *secret, hidden bool) error {
+	if err := self.encodePrimary(outputImage, key, hidden); err != nil {
+		return err
+	}
+
+	self.encodeBackups(outputImage, outputImage.Bounds().Max.X, outputImage.Bounds().Max.Y, key, hidden)
+	return nil
+}
+
+// encodePrimary writes the header into the top left corner of outputImage, without its backup copies
+func (self Header) encodePrimary(outputImage *image.NRGBA, key *secret, hidden bool) error {
+	width := outputImage.Bounds().Max.X
+	height := outputImage.Bounds().Max.Y
+	pixels := outputImage.Pix
+	mask := headerMask{}
+
+	if hidden {
+		mask = makeHeaderMask(key)
+	}
+
+	// Encode how many bits are used per channel
+	// Since we only need to encode the numbers 1 to 8, we can use take least significant bit
+	// from each of the first pixel's RGBA channels and use them to represent 1 to 8 since
+	// 2^4 can represent numbers from 0 to 15
+
+	for i := 0; i < 4; i++ {
+		if getBit(self.NumBitsPerChannel^mask.numBitsPerChannel, i) == 0 {
+			pixels[i] = clearBitUint8(pixels[i], 0)
+		} else {
+			pixels[i] = setBitUint8(pixels[i], 0)
+		}
+	}
+
+	// Encode how many channels the encoding will use in the second pixel. Since we can only
+	// have 1 to 4 channels as options, we can use the same technique as encoding the number
+	// of bits used per channel (The block of code above)
+
+	for i := 4; i < 8; i++ {
+		if getBit(self.NumChannels^mask.numChannels, i-4) == 0 {
+			pixels[i] = clearBitUint8(pixels[i], 0)
+		} else {
+			pixels[i] = setBitUint8(pixels[i], 0)
+		}
+	}
+
+	stepper := makeImageStepper(self.NumBitsPerChannel, width, height, self.NumChannels, self.NumMessageBits)
+	stepper.skipPixel()
+	stepper.skipPixel()
+
+	// The rest of the header is always written with LSB replacement since the strategy isn't known until the
+	// header has been read
+	if err := writeBits(outputImage, stepper, lsbStrategy{}, nil, headerMagic^mask.magic, headerMagicSize); err != nil {
+		return err
+	}
+	if err := writeBits(outputImage, stepper, lsbStrategy{}, nil, self.Version^mask.version, headerVersionSize); err != nil {
+		return err
+	}
+
+	if err := writeBits(outputImage, stepper, lsbStrategy{}, nil, int(self.Encryption)^mask.encryption, encryptionSize); err != nil {
+		return err
+	}
+
+	if err := writeBits(outputImage, stepper, lsbStrategy{}, nil, int(self.Codec)^mask.codec, codecSize); err != nil {
+		return err
+	}
+
+	strategyID := self.Strategy.HeaderID() ^ mask.strategyID
+
+	if err := writeBits(outputImage, stepper, lsbStrategy{}, nil, strategyID, strategyIDSize); err != nil {
+		return err
+	}
+
+	// Encode number of bits that will be written to the image
+	if err := writeBits(outputImage, stepper, lsbStrategy{}, nil, self.NumMessageBits^mask.length, lengthSize); err != nil {
+		return err
+	}
+
+	// Encode the header tag so that reveal can detect a tampered or corrupted header before reading the message
+	if err := writeBits(outputImage, stepper, lsbStrategy{}, nil, self.tag(key)^mask.tag, headerTagSize); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// decodeHeader reads and authenticates the header of img. When the header in the top left corner can't be read,
+// it is read from its backup copies, and if none of them can be read either, the error of the header in the
+// corner is returned.
+func decodeHeader(img image.Image, key *secret) (Header, error) {
+	header, err := decodePrimaryHeader(img, key)
+	if err == nil {
+		return header, nil
+	}
+
+	if backup, backupErr := decodeBackupHeader(img, key); backupErr == nil {
+		return backup, nil
+	}
+
+	return header, err
+}
+
+// decodePrimaryHeader reads and authenticates the header in the top left corner of img. If a key is provided and
+// the header can't be read as is, it is read again as a hidden header. When neither reading finds a header, the
+// error of the one that found the magic is returned, since it says what is wrong with the header that's there.
+func decodePrimaryHeader(img image.Image, key *secret) (Header, error) {
+	header, found, err := decodeHeaderWithMask(img, key, headerMask{})
+
+	if err != nil && key != nil {
+		hiddenHeader, hiddenFound, hiddenErr := decodeHeaderWithMask(img, key, makeHeaderMask(key))
+		if hiddenErr == nil || (hiddenFound && !found) {
+			return hiddenHeader, hiddenErr
+		}
+	}
+
+	return header, err
+}
+
+// readLayout reads the number of bits per channel and the number of channels from the least significant bits of
+// the 4 channels of the first two pixels
+func readLayout(img image.Image) (int, int) {
+	var channels [4]uint8
+	numBitsPerChannel := 0
+	numChannels := 0
+
+	// Extract numBitsPerChannel from the least significant bits of the 4 channels in the first pixel
+	channels = pixelChannels(img, 0, 0)
+
+	for i := 0; i < 4; i++ {
+		if getBitUint8(channels[i], 0) == 0 {
+			numBitsPerChannel = clearBit(numBitsPerChannel, i)
+		} else {
+			numBitsPerChannel = setBit(numBitsPerChannel, i)
+		}
+	}
+
+	// Extract numChannels from the least significant bits of the 4 channels in the second pixel
+	// Since we're guaranteed to have at least two pixels (Because conceal() requires and exports
+	// an image with at least 2 pixels, we need to make sure two grab the correct second pixel at
+	// point (0, 1) or (1, 0)
+
+	if (image.Point{X: 1, Y: 0}.In(img.Bounds())) {
+		channels = pixelChannels(img, 1, 0)
+	} else {
+		channels = pixelChannels(img, 0, 1)
+	}
+
+	for i := 0; i < 4; i++ {
+		if getBitUint8(channels[i], 0) == 0 {
+			numChannels = clearBit(numChannels, i)
+		} else {
+			numChannels = setBit(numChannels, i)
+		}
+	}
+
+	return numBitsPerChannel, numChannels
+}
+
+// decodeHeaderWithMask reads the header of img with every field unmasked by mask, and reports whether the
+// magic was found
+func decodeHeaderWithMask(img image.Image, key *secret, mask headerMask) (Header, bool, error) {
+	numBitsPerChannel, numChannels := readLayout(img)
+	numBitsPerChannel ^= mask.numBitsPerChannel
+	numChannels ^= mask.numChannels
+
+	if numBitsPerChannel < 1 || numBitsPerChannel > 8 || numChannels < 1 || numChannels > 4 {
+		return Header{NumBitsPerChannel: numBitsPerChannel, NumChannels: numChannels}, false, ErrNotStegoImage
+	}
+
+	width := img.Bounds().Max.X
+	height := img.Bounds().Max.Y
+
+	stepper := makeImageStepper(numBitsPerChannel, width, height, numChannels, 0)
+	stepper.skipPixel()
+	stepper.skipPixel()
+
+	magic, err := readBits(img, stepper, lsbStrategy{}, headerMagicSize)
+	if err != nil || magic^mask.magic != headerMagic {
+		return Header{NumBitsPerChannel: numBitsPerChannel, NumChannels: numChannels}, false, ErrNotStegoImage
+	}
+
+	version, err := readBits(img, stepper, lsbStrategy{}, headerVersionSize)
+	if err != nil {
+		return Header{}, true, err
+	}
+	version ^= mask.version
+
+	if version > headerVersion {
+		return Header{Version: version}, true, ErrUnsupportedVersion
+	}
+	if version < headerVersion {
+		return Header{Version: version}, true, ErrCorruptHeader
+	}
+
+	header, err := decodeHeaderFields(img, key, mask, numBitsPerChannel, numChannels, stepper)
+
+	// A header with the magic was written by Hide, so a tag that doesn't match means it's been damaged, unless
+	// the passphrase that keys the tag is wrong. A hidden header can only show the magic to the right passphrase.
+	if err == ErrNotStegoImage || (err == ErrWrongPassphrase && mask != (headerMask{})) {
+		err = ErrCorruptHeader
+	}
+
+	return header, true, err
+}
+
+// decodeHeaderFields reads the fields of the header that come after its magic and version from stepper, given
+// the layout of the header
+func decodeHeaderFields(img image.Image, key *secret, mask headerMask, numBitsPerChannel int, numChannels int, stepper *ImageStepper) (Header, error) {
+	header := Header{Version: headerVersion, NumBitsPerChannel: numBitsPerChannel, NumChannels: numChannels}
+	width := img.Bounds().Max.X
+	height := img.Bounds().Max.Y
+
+	encryption, err := readBits(img, stepper, lsbStrategy{}, encryptionSize)
+	if err != nil {
+		return header, err
+	}
+
+	header.Encryption = Encryption(encryption ^ mask.encryption)
+	if header.Encryption > EncryptionPublicKey {
+		return header, ErrNotStegoImage
+	}
+
+	codec, err := readBits(img, stepper, lsbStrategy{}, codecSize)
+	if err != nil {
+		return header, err
+	}
+
+	header.Codec = Codec(codec ^ mask.codec)
+	if header.Codec > CodecDeflate {
+		return header, ErrNotStegoImage
+	}
+
+	strategyID, err := readBits(img, stepper, lsbStrategy{}, strategyIDSize)
+	if err != nil {
+		return header, err
+	}
+
+	strategy, ok := strategyByHeaderID(strategyID ^ mask.strategyID)
+	if !ok {
+		return header, ErrNotStegoImage
+	}
+	header.Strategy = strategy
+
+	numMessageBits, err := readBits(img, stepper, lsbStrategy{}, lengthSize)
+	if err != nil {
+		return header, err
+	}
+
+	header.NumMessageBits = numMessageBits ^ mask.length
+
+	tag, err := readBits(img, stepper, lsbStrategy{}, headerTagSize)
+	if err != nil {
+		return header, err
+	}
+
+	// The tag is compared in constant time so its value can't be recovered by timing repeated attempts. When
+	// it doesn't match, the encryption field tells a missing or needless passphrase apart from a wrong one.
+	if subtle.ConstantTimeEq(int32(tag^mask.tag), int32(header.tag(key))) == 0 {
+		switch {
+		case key == nil && header.Encryption == EncryptionPassphrase:
+			return header, ErrPassphraseRequired
+		case key == nil && header.Encryption == EncryptionPublicKey:
+			return header, ErrPrivateKeyRequired
+		case key == nil:
+			return header, ErrNotStegoImage
+		case header.Encryption == EncryptionNone &&
+			subtle.ConstantTimeEq(int32(tag^mask.tag), int32(header.tag(nil))) == 1:
+			return header, ErrNotEncrypted
+		default:
+			return header, ErrWrongPassphrase
+		}
+	}
+
+	if header.NumMessageBits < 0 || header.NumMessageBits > numMessageBitsAvailable(width, height, header.NumBitsPerChannel, header.NumChannels, strategy) {
+		return header, ErrCorruptPayload
+	}
+
+	return header, nil
+}
+
+// writeBits embeds the numBits least significant bits of value into outputImage with strategy, starting at the
+// stepper's current position
+func writeBits(outputImage *image.NRGBA, stepper *ImageStepper, strategy Strategy, rng *rand.Rand, value int, numBits int) error {
+	for i := 0; i < numBits; i++ {
+		pixel := getPixel(outputImage, stepper.x, stepper.y)
+		pixel[stepper.channel] = strategy.Embed(pixel[stepper.channel], stepper.bitIndexOffset, getBit(value, i), rng)
+
+		if err := stepper.step(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readBits extracts numBits bits from img with strategy, starting at the stepper's current position
+func readBits(img image.Image, stepper *ImageStepper, strategy Strategy, numBits int) (int, error) {
+	value := 0
+
+	for i := 0; i < numBits; i++ {
+		channels := pixelChannels(img, stepper.x, stepper.y)
+
+		if strategy.Extract(channels[stepper.channel], stepper.bitIndexOffset) == 0 {
+			value = clearBit(value, i)
+		} else {
+			value = setBit(value, i)
+		}
+
+		if err := stepper.step(); err != nil {
+			return 0, err
+		}
+	}
+
+	return value, nil
+}
@@ -0,0 +1,156 @@
+package stego
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// A headerless image holds nothing but the message, starting at its first pixel, with no header and no backup
+// copies of it. Everything reveal needs to find the message is instead given to the receiver separately as a
+// params string, so no pixel of the image is written the same way every time.
+
+// Params returns the fields of the header as the params string a headerless image is revealed with
+func (self Header) Params() string {
+	return fmt.Sprintf("v=%d,bits=%d,channels=%d,strategy=%s,encryption=%s,codec=%s,length=%d",
+		self.Version, self.NumBitsPerChannel, self.NumChannels, self.Strategy.Name(), encryptionParam(self.Encryption),
+		self.Codec, self.NumMessageBits)
+}
+
+// ParseParams returns the header described by params, which Header.Params returns, for WithParams
+func ParseParams(params string) (Header, error) {
+	header := Header{Headerless: true}
+	found := map[string]bool{}
+
+	for _, field := range strings.Split(params, ",") {
+		parts := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(parts) != 2 {
+			return Header{}, fmt.Errorf("params field %q is not written as name=value", field)
+		}
+
+		name, value := parts[0], parts[1]
+		if found[name] {
+			return Header{}, fmt.Errorf("params field %s is given more than once", name)
+		}
+		found[name] = true
+
+		var err error
+		var ok bool
+
+		switch name {
+		case "v":
+			header.Version, err = strconv.Atoi(value)
+		case "bits":
+			header.NumBitsPerChannel, err = strconv.Atoi(value)
+		case "channels":
+			header.NumChannels, err = strconv.Atoi(value)
+		case "length":
+			header.NumMessageBits, err = strconv.Atoi(value)
+		case "strategy":
+			if header.Strategy, ok = LookupStrategy(value); !ok {
+				err = errors.New("unknown strategy")
+			}
+		case "encryption":
+			if header.Encryption, ok = lookupEncryptionParam(value); !ok {
+				err = errors.New("unknown encryption")
+			}
+		case "codec":
+			if header.Codec, ok = LookupCodec(value); !ok {
+				err = errors.New("unknown codec")
+			}
+		default:
+			err = errors.New("unknown field")
+		}
+
+		if err != nil {
+			return Header{}, fmt.Errorf("params field %s: %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"v", "bits", "channels", "strategy", "encryption", "codec", "length"} {
+		if !found[name] {
+			return Header{}, fmt.Errorf("params field %s is missing", name)
+		}
+	}
+
+	if header.Version > headerVersion {
+		return Header{}, ErrUnsupportedVersion
+	}
+
+	if header.Version < headerVersion || header.NumBitsPerChannel < 1 || header.NumBitsPerChannel > 8 ||
+		header.NumChannels < 1 || header.NumChannels > 4 || header.NumMessageBits < 0 {
+		return Header{}, errors.New("params don't describe a headerless image")
+	}
+
+	return header, nil
+}
+
+// encryptionParam returns the name of encryption in params, which can't hold spaces
+func encryptionParam(encryption Encryption) string {
+	return strings.Replace(encryption.String(), " ", "-", -1)
+}
+
+// lookupEncryptionParam returns the encryption called name in params
+func lookupEncryptionParam(name string) (Encryption, bool) {
+	for _, encryption := range []Encryption{EncryptionNone, EncryptionPassphrase, EncryptionPublicKey} {
+		if encryptionParam(encryption) == name {
+			return encryption, true
+		}
+	}
+	return EncryptionNone, false
+}
+
+// messageStepper returns a stepper at the start of the first payload of a width by height image with the
+// header, which is the first pixel of a headerless image
+func (self Header) messageStepper(width int, height int, key *secret, traversal TraversalFactory) *ImageStepper {
+	if !self.Headerless {
+		return makeMessageStepper(width, height, self.NumBitsPerChannel, self.NumChannels, key, 0, traversal)
+	}
+
+	stepper := makeImageStepper(self.NumBitsPerChannel, width, height, self.NumChannels, 0)
+	stepper.startTraversal(traversal(width, height, 0))
+	return stepper
+}
+
+// numBitsAvailable returns the number of message bits the strategy of the header can hide in a width by height
+// image with the header, which is every pixel of a headerless image
+func (self Header) numBitsAvailable(width int, height int) int {
+	if !self.Headerless {
+		return numMessageBitsAvailable(width, height, self.NumBitsPerChannel, self.NumChannels, self.Strategy)
+	}
+	return self.Strategy.Capacity(width*height, self.NumChannels, self.NumBitsPerChannel)
+}
+
+// readHeader returns the header given with WithParams, or else the header decoded from img
+func readHeader(img image.Image, key *secret, options Options) (Header, error) {
+	if options.Params != nil {
+		return paramsHeader(img, key, *options.Params)
+	}
+	return decodeHeader(img, key)
+}
+
+// paramsHeader returns the header given with WithParams, once it's been checked against img and key. There's no
+// tag to authenticate, so wrong params are only noticed once the message fails to decrypt or match its checksum.
+func paramsHeader(img image.Image, key *secret, params Header) (Header, error) {
+	params.Headerless = true
+	if params.Strategy == nil || params.Version != headerVersion {
+		return Header{}, errors.New("params don't describe a headerless image")
+	}
+
+	switch {
+	case key == nil && params.Encryption == EncryptionPassphrase:
+		return Header{}, ErrPassphraseRequired
+	case key == nil && params.Encryption == EncryptionPublicKey:
+		return Header{}, ErrPrivateKeyRequired
+	case key != nil && params.Encryption == EncryptionNone:
+		return Header{}, ErrNotEncrypted
+	}
+
+	if params.NumMessageBits > params.numBitsAvailable(img.Bounds().Max.X, img.Bounds().Max.Y) {
+		return Header{}, ErrCorruptPayload
+	}
+
+	return params, nil
+}
@@ -0,0 +1,155 @@
+package stego
+
+import "errors"
+
+type ImageStepper struct {
+	x                      int
+	y                      int
+	channel                int
+	numBitsWritten         int
+	bitIndexOffset         int
+	numBitsToUsePerChannel int
+	width                  int
+	height                 int
+	channelSize            int
+	totalBitsToBeWritten   int
+	traversal              Traversal
+}
+
+func makeImageStepper(numBitsToUsePerChannel int, width int, height int, channelSize int, totalBitsToBeWritten int) *ImageStepper {
+	return &ImageStepper{
+		x:                      0,
+		y:                      0,
+		channel:                0,
+		numBitsWritten:         0,
+		bitIndexOffset:         0,
+		numBitsToUsePerChannel: numBitsToUsePerChannel,
+		width:                  width,
+		height:                 height,
+		channelSize:            channelSize,
+		totalBitsToBeWritten:   totalBitsToBeWritten,
+	}
+}
+
+func (self *ImageStepper) step() error {
+	self.numBitsWritten++
+	self.bitIndexOffset++
+
+	if self.bitIndexOffset >= self.numBitsToUsePerChannel {
+		self.bitIndexOffset = 0
+		self.channel++
+	}
+
+	if self.channel >= self.channelSize {
+		self.channel = 0
+		self.nextPixel()
+	}
+
+	if self.y >= self.height && self.numBitsWritten < self.totalBitsToBeWritten {
+		return errors.New("more steps taken than pixels in the image")
+	}
+
+	return nil
+}
+
+// skipBits moves the stepper numBits bits forward without visiting them. Whole pixels are skipped at once, so
+// only the traversal is advanced for them.
+func (self *ImageStepper) skipBits(numBits int) error {
+	for ; numBits > 0 && (self.channel > 0 || self.bitIndexOffset > 0); numBits-- {
+		if err := self.step(); err != nil {
+			return err
+		}
+	}
+
+	bitsPerPixel := self.numBitsToUsePerChannel * self.channelSize
+	for ; numBits >= bitsPerPixel; numBits -= bitsPerPixel {
+		self.numBitsWritten += bitsPerPixel
+		self.nextPixel()
+	}
+
+	for ; numBits > 0; numBits-- {
+		if err := self.step(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// alignToPixel moves the stepper to the start of the next pixel unless it's already at the start of one
+func (self *ImageStepper) alignToPixel() error {
+	for self.channel > 0 || self.bitIndexOffset > 0 {
+		if err := self.step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// atPixelStart reports whether the stepper is at the first bit of a pixel
+func (self *ImageStepper) atPixelStart() bool {
+	return self.channel == 0 && self.bitIndexOffset == 0
+}
+
+// takePixels moves the stepper numPixels whole pixels forward and returns the index of each of them in the
+// order they were visited. The stepper must be at the start of a pixel.
+func (self *ImageStepper) takePixels(numPixels int) ([]int, error) {
+	pixels := make([]int, numPixels)
+	bitsPerPixel := self.numBitsToUsePerChannel * self.channelSize
+
+	for i := range pixels {
+		if self.y >= self.height {
+			return nil, errors.New("more steps taken than pixels in the image")
+		}
+
+		pixels[i] = self.y*self.width + self.x
+		self.numBitsWritten += bitsPerPixel
+		self.nextPixel()
+	}
+
+	return pixels, nil
+}
+
+func (self *ImageStepper) skipPixel() {
+	self.numBitsWritten += 4
+	self.nextPixel()
+}
+
+// startTraversal moves the stepper to the first pixel of traversal, which decides every pixel visited after it
+func (self *ImageStepper) startTraversal(traversal Traversal) {
+	self.traversal = traversal
+	self.channel = 0
+	self.bitIndexOffset = 0
+	self.nextPixel()
+}
+
+// nextUnusedPixel returns the index of the first pixel that the stepper hasn't written to
+func (self *ImageStepper) nextUnusedPixel() int {
+	index := self.y*self.width + self.x
+
+	if self.channel > 0 || self.bitIndexOffset > 0 {
+		index++
+	}
+
+	return index
+}
+
+func (self *ImageStepper) nextPixel() {
+	if self.traversal == nil {
+		self.x++
+
+		if self.x >= self.width {
+			self.x = 0
+			self.y++
+		}
+		return
+	}
+
+	if index, ok := self.traversal.Next(); ok {
+		self.x = index % self.width
+		self.y = index / self.width
+	} else {
+		self.x = 0
+		self.y = self.height
+	}
+}
@@ -0,0 +1,69 @@
+package stego
+
+import "image"
+
+const (
+	// FormatAuto reads the current format, and falls back to the first format when a passphrase decrypts it
+	FormatAuto = 0
+
+	// FormatV1 is the format written by the first version of Hide
+	FormatV1 = 1
+
+	// FormatV2 is the current format, whose header starts with a magic and its version and is authenticated by
+	// a tag
+	FormatV2 = 2
+)
+
+// decodeLegacy reads a message concealed by the first version of Hide. It wrote the number of bits per channel
+// and channels in the first two pixels like the current header, followed right away by the length of the message
+// and the message itself, with LSB replacement in linear order and without a strategy or tag. Nothing
+// authenticates an unencrypted message, so any image with a plausible length is read. The whole message is read,
+// and decrypted if key is provided.
+func decodeLegacy(img image.Image, key *secret) (Header, []byte, error) {
+	width := img.Bounds().Max.X
+	height := img.Bounds().Max.Y
+	header := Header{Version: FormatV1, Strategy: lsbStrategy{}}
+
+	header.NumBitsPerChannel, header.NumChannels = readLayout(img)
+
+	if header.NumBitsPerChannel < 1 || header.NumBitsPerChannel > 8 || header.NumChannels < 1 || header.NumChannels > 4 {
+		return header, nil, ErrNotStegoImage
+	}
+
+	stepper := makeImageStepper(header.NumBitsPerChannel, width, height, header.NumChannels, 0)
+	stepper.skipPixel()
+	stepper.skipPixel()
+
+	numLengthBits := numBitsToEncodeNumMessageBits(width, height)
+	numMessageBits, err := readBits(img, stepper, lsbStrategy{}, numLengthBits)
+	if err != nil {
+		return header, nil, err
+	}
+	header.NumMessageBits = numMessageBits
+
+	numAvailable := numBitsAvailable(width-2, height, header.NumChannels, header.NumBitsPerChannel) - numLengthBits
+	if numMessageBits == 0 || numMessageBits%8 != 0 || numMessageBits > numAvailable {
+		return header, nil, ErrNotStegoImage
+	}
+
+	messageBytes := make([]byte, numMessageBits/8)
+
+	for i := range messageBytes {
+		messageByte, err := readBits(img, stepper, lsbStrategy{}, 8)
+		if err != nil {
+			return header, nil, err
+		}
+		messageBytes[i] = uint8(messageByte)
+	}
+
+	if key == nil {
+		return header, messageBytes, nil
+	}
+	plaintext, err := decrypt(messageBytes, key)
+	if err != nil {
+		zeroBytes(messageBytes)
+		return header, nil, err
+	}
+
+	return header, plaintext, nil
+}
@@ -0,0 +1,11 @@
+package stego
+
+// Logger receives a line describing each step of Conceal and Reveal. A *log.Logger satisfies it.
+type Logger interface {
+	Println(v ...interface{})
+}
+
+// noLogger is the Logger used when none is given, so the library stays silent
+type noLogger struct{}
+
+func (noLogger) Println(v ...interface{}) {}
@@ -0,0 +1,184 @@
+package stego
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"time"
+)
+
+// metadataMagic starts every message that is prefixed with metadata. A message without it is revealed as is.
+var metadataMagic = []byte("HIDEMETA")
+
+// maxMetadataSize bounds the encoded metadata so that a corrupted length can't make reveal allocate too much
+const maxMetadataSize = 1 << 16
+
+// metadataPadding is the least room left after the JSON of the metadata, which is padded with spaces to a
+// multiple of it. The room lets the metadata be edited later without moving the message behind it.
+const metadataPadding = 64
+
+// Metadata describes a file concealed as the message so that it can be restored under its original name, type,
+// permissions and modification time, along with who concealed it, when, a free-form comment and when it expires.
+// ID tells concealed messages apart, so a revealed message can be matched with the records of the image it came
+// from. It is written in front of the message, so it is encrypted along with it. A message that packages several
+// files lists them in Entries, and the files follow each other in the message in that order. A message that is
+// one shard of a payload split across several images says which in Shard, and the rest describes the payload.
+// One that is a share of a payload split with SplitSecret only says which in Share, since the metadata of the
+// payload is shared along with it. One of several identical copies of a message says so in Mirror. A shard that
+// is part of a chain points to the image holding the next shard in Next.
+type Metadata struct {
+	ID       string     `json:"id,omitempty"`
+	Name     string     `json:"name,omitempty"`
+	Type     string     `json:"type,omitempty"`
+	Mode     uint32     `json:"mode,omitempty"`
+	Modified *time.Time `json:"modified,omitempty"`
+	Author   string     `json:"author,omitempty"`
+	Comment  string     `json:"comment,omitempty"`
+	Created  *time.Time `json:"created,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	Entries  []Entry    `json:"entries,omitempty"`
+	Shard    *Shard     `json:"shard,omitempty"`
+	Share    *Share     `json:"share,omitempty"`
+	Mirror   *Mirror    `json:"mirror,omitempty"`
+	Next     *Link      `json:"next,omitempty"`
+}
+
+// Entry describes one of the files packaged in a message. Mode holds the permission bits of the file, and is 0
+// along with a nil Modified when they weren't recorded.
+type Entry struct {
+	Name     string     `json:"name"`
+	Type     string     `json:"type,omitempty"`
+	Size     int        `json:"size"`
+	Mode     uint32     `json:"mode,omitempty"`
+	Modified *time.Time `json:"modified,omitempty"`
+}
+
+// FileName returns the name the file should be restored under. Only the last element of Name is used, so the
+// metadata can't write outside of the directory it's restored to. Without a name, fallback is used along with
+// an extension for Type.
+func (self Metadata) FileName(fallback string) string {
+	return fileName(self.Name, self.Type, fallback)
+}
+
+// FileName returns the name the entry should be extracted under, the same way as Metadata.FileName
+func (self Entry) FileName(fallback string) string {
+	return fileName(self.Name, self.Type, fallback)
+}
+
+// Lookup returns the entry called name and its offset in the message
+func (self Metadata) Lookup(name string) (Entry, int, bool) {
+	offset := 0
+
+	for _, entry := range self.Entries {
+		if entry.Name == name {
+			return entry, offset, true
+		}
+		offset += entry.Size
+	}
+
+	return Entry{}, 0, false
+}
+
+// Validate returns ErrCorruptPayload unless the sizes of the entries are positive and add up to size, the size of
+// the message behind the metadata. The entries of a shard describe the whole payload rather than the shard, so a
+// negative size only checks that no entry is negative.
+func (self Metadata) Validate(size int) error {
+	total := 0
+
+	for _, entry := range self.Entries {
+		if entry.Size < 0 || (size >= 0 && entry.Size > size-total) {
+			return ErrCorruptPayload
+		}
+		total += entry.Size
+	}
+
+	if size >= 0 && len(self.Entries) > 0 && total != size {
+		return ErrCorruptPayload
+	}
+	return nil
+}
+
+// validateDecoded validates metadata just decoded from a message of size bytes, which for a shard isn't the
+// size the entries describe
+func (self Metadata) validateDecoded(size int) error {
+	if self.Shard != nil {
+		size = -1
+	}
+	return self.Validate(size)
+}
+
+// NewID returns a random (version 4) UUID read from random for Metadata.ID
+func NewID(random io.Reader) (string, error) {
+	id := make([]byte, 16)
+	if _, err := io.ReadFull(random, id); err != nil {
+		return "", err
+	}
+
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16]), nil
+}
+
+// Expired reports whether the message expired before now. A message without an expiry never expires.
+func (self Metadata) Expired(now time.Time) bool {
+	return self.Expires != nil && now.After(*self.Expires)
+}
+
+func fileName(name string, fileType string, fallback string) string {
+	base := filepath.Base(name)
+
+	if name != "" && base != "." && base != ".." && base != string(filepath.Separator) {
+		return base
+	}
+
+	if extensions, err := mime.ExtensionsByType(fileType); err == nil && len(extensions) > 0 {
+		return fallback + extensions[0]
+	}
+
+	return fallback
+}
+
+// encode returns the metadata as it's written in front of the message: the magic, the length of the metadata
+// and the metadata as JSON, padded to a multiple of metadataPadding with at least metadataPadding spaces
+func (self Metadata) encode() ([]byte, error) {
+	data, err := json.Marshal(self)
+	if err != nil {
+		return nil, err
+	}
+
+	return self.encodeSized(data, (len(data)+2*metadataPadding-1)/metadataPadding*metadataPadding)
+}
+
+// encodeSized is like encode but pads the JSON to exactly size bytes, failing if it's larger than that
+func (self Metadata) encodeSized(data []byte, size int) ([]byte, error) {
+	if data == nil {
+		var err error
+		if data, err = json.Marshal(self); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(data) > size {
+		return nil, fmt.Errorf("metadata needs %d bytes but only %d are available", len(data), size)
+	}
+
+	if size > maxMetadataSize {
+		return nil, errors.New("metadata is too large")
+	}
+
+	prefix := make([]byte, len(metadataMagic)+4, len(metadataMagic)+4+size)
+	copy(prefix, metadataMagic)
+	binary.BigEndian.PutUint32(prefix[len(metadataMagic):], uint32(size))
+
+	prefix = append(prefix, data...)
+	for len(prefix) < cap(prefix) {
+		prefix = append(prefix, ' ')
+	}
+
+	return prefix, nil
+}
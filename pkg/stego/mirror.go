@@ -0,0 +1,131 @@
+package stego
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// A payload can also be mirrored, with the same message concealed in several images so that it can be recovered
+// even when some of them were damaged. Each copy is revealed for whatever it still holds, and the copies vote on
+// every chunk of the message.
+
+// Mirror says that a message is one of Copies identical copies of set, and gives the Size and SHA256 of the
+// message so that the result of the vote can be checked
+type Mirror struct {
+	Set    string `json:"set"`
+	Copies int    `json:"copies"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// mirrorChunkSize is the size of the chunks the copies of a mirrored message vote on
+const mirrorChunkSize = 16
+
+// MirrorVote is how the copies of a mirrored message agreed. Copies is the number of copies that took part,
+// Chunks the number of chunks of the message, Repaired the number of them the copies didn't all agree on but
+// most did, and Unresolved the number of them no value had a majority of.
+type MirrorVote struct {
+	Copies     int
+	Chunks     int
+	Repaired   int
+	Unresolved int
+}
+
+// NewMirror returns the Mirror of count copies of message in set
+func NewMirror(set string, count int, message []byte) Mirror {
+	sum := sha256.Sum256(message)
+	return Mirror{Set: set, Copies: count, Size: len(message), SHA256: hex.EncodeToString(sum[:])}
+}
+
+// VoteMirrors recovers a mirrored message from the copies revealed from its images, given along with the Mirror
+// read with each, which may be damaged too. Copies of the set and size most of them agree on vote on every chunk
+// of the message, and a chunk too short or missing from a copy doesn't count. It returns ErrMixedShards when no
+// set has a majority, and ErrCorruptPayload when the result doesn't match the checksum, along with the vote.
+func VoteMirrors(mirrors []Mirror, copies [][]byte) ([]byte, MirrorVote, error) {
+	if len(mirrors) == 0 || len(mirrors) != len(copies) {
+		return nil, MirrorVote{}, ErrMissingShards
+	}
+
+	counts := map[Mirror]int{}
+	best := mirrors[0]
+	for _, mirror := range mirrors {
+		counts[mirror]++
+		if counts[mirror] > counts[best] {
+			best = mirror
+		}
+	}
+	if 2*counts[best] <= len(mirrors) && len(mirrors) > 1 {
+		return nil, MirrorVote{}, ErrMixedShards
+	}
+
+	var voters [][]byte
+	for i, mirror := range mirrors {
+		if mirror == best {
+			voters = append(voters, copies[i])
+		}
+	}
+
+	vote := MirrorVote{Copies: len(voters), Chunks: (best.Size + mirrorChunkSize - 1) / mirrorChunkSize}
+	message := make([]byte, 0, best.Size)
+
+	for chunk := 0; chunk < vote.Chunks; chunk++ {
+		start := chunk * mirrorChunkSize
+		end := start + mirrorChunkSize
+		if end > best.Size {
+			end = best.Size
+		}
+
+		var candidates [][]byte
+		var votes []int
+		total := 0
+
+		for _, voter := range voters {
+			if len(voter) < end {
+				continue
+			}
+			total++
+
+			found := false
+			for c, candidate := range candidates {
+				if bytes.Equal(candidate, voter[start:end]) {
+					votes[c]++
+					found = true
+					break
+				}
+			}
+			if !found {
+				candidates = append(candidates, voter[start:end])
+				votes = append(votes, 1)
+			}
+		}
+
+		if total == 0 {
+			vote.Unresolved++
+			message = append(message, make([]byte, end-start)...)
+			continue
+		}
+
+		winner := 0
+		for c := range candidates {
+			if votes[c] > votes[winner] {
+				winner = c
+			}
+		}
+
+		if 2*votes[winner] <= total && len(candidates) > 1 {
+			vote.Unresolved++
+		} else if len(candidates) > 1 || total < len(voters) {
+			vote.Repaired++
+		}
+		message = append(message, candidates[winner]...)
+	}
+
+	sum := sha256.Sum256(message)
+	if hex.EncodeToString(sum[:]) != best.SHA256 {
+		zeroBytes(message)
+		return nil, vote, ErrCorruptPayload
+	}
+
+	return message, vote, nil
+}
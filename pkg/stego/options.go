@@ -0,0 +1,325 @@
+package stego
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"errors"
+	"image/png"
+	"io"
+)
+
+// Options configures Conceal and Reveal. Each field is described by the With* function that sets it. The fields
+// can be set one at a time with those functions, or all at once by building Options and passing it with
+// WithOptions. A field left at its zero value falls back to a sensible default: no encryption, LSB replacement
+// of 1 bit per channel, the 3 RGB channels, and a linear traversal.
+type Options struct {
+	Context           context.Context
+	Passphrase        string
+	KeyPath           string
+	NumBitsPerChannel int
+	NumChannels       int
+	Strategy          Strategy
+	Traversal         TraversalFactory
+	HideHeader        bool
+	Headerless        *Header
+	Params            *Header
+	Metadata          *Metadata
+	Payload           int
+	Format            int
+	BestEffort        bool
+	IgnoreExpiry      bool
+	Secure            bool
+	Workers           int
+	Compression       png.CompressionLevel
+	Codec             Codec
+	CodecLevel        int
+	Random            io.Reader
+	Logger            Logger
+	Progress          Progress
+}
+
+// Option sets a field of Options
+type Option func(*Options)
+
+// WithOptions sets every field to its value in options, replacing what the options before it set. Options
+// after it can still change single fields.
+func WithOptions(options Options) Option {
+	return func(target *Options) {
+		*target = options
+	}
+}
+
+// NewOptions returns the Options that opts make, with the defaults filled in for the fields they leave unset
+func NewOptions(opts ...Option) Options {
+	return makeOptions(opts)
+}
+
+// WithContext lets ctx cancel the operation or limit how long it may take
+func WithContext(ctx context.Context) Option {
+	return func(options *Options) {
+		options.Context = ctx
+	}
+}
+
+// WithPassphrase encrypts the message with a key derived from passphrase
+func WithPassphrase(passphrase string) Option {
+	return func(options *Options) {
+		options.Passphrase = passphrase
+	}
+}
+
+// WithKeyPath encrypts the message with the public key or decrypts it with the private key at path
+func WithKeyPath(path string) Option {
+	return func(options *Options) {
+		options.KeyPath = path
+	}
+}
+
+// WithBitsPerChannel sets how many of the least significant bits of each channel value are used, from 1 to 8
+func WithBitsPerChannel(numBitsPerChannel int) Option {
+	return func(options *Options) {
+		options.NumBitsPerChannel = numBitsPerChannel
+	}
+}
+
+// WithChannels sets how many of the RGBA channels are used, from 1 to 4
+func WithChannels(numChannels int) Option {
+	return func(options *Options) {
+		options.NumChannels = numChannels
+	}
+}
+
+// WithStrategy sets how message bits are embedded into channel values
+func WithStrategy(strategy Strategy) Option {
+	return func(options *Options) {
+		options.Strategy = strategy
+	}
+}
+
+// WithTraversal sets the order in which the pixels holding the message are visited. Reveal must be given the
+// same traversal that was used to conceal the message.
+func WithTraversal(traversal TraversalFactory) Option {
+	return func(options *Options) {
+		options.Traversal = traversal
+	}
+}
+
+// WithHiddenHeader masks the header with the passphrase so the image doesn't reveal that it holds a message
+func WithHiddenHeader(hidden bool) Option {
+	return func(options *Options) {
+		options.HideHeader = hidden
+	}
+}
+
+// WithHeaderless leaves the header and its backup copies out of the image and starts the message at its first
+// pixel. Once the message is concealed, the header that would have been written is stored in params, and the
+// receiver reveals the image with WithParams and the string from params.Params, which has to be shared
+// separately. With the linear traversal the message still starts in the top left corner, so a keyed traversal
+// should be used to spread it over the image.
+func WithHeaderless(params *Header) Option {
+	return func(options *Options) {
+		options.Headerless = params
+	}
+}
+
+// WithParams reveals a headerless image with the header parsed from its params by ParseParams, instead of
+// reading the header from the image
+func WithParams(params Header) Option {
+	return func(options *Options) {
+		options.Params = &params
+	}
+}
+
+// WithMetadata writes metadata in front of the message, which Reveal takes off again and returns in the result
+func WithMetadata(metadata Metadata) Option {
+	return func(options *Options) {
+		options.Metadata = &metadata
+	}
+}
+
+// WithPayload sets which payload of the image is revealed. Payload 0 is the message written along with the
+// header, and the payloads added with Append follow from 1 onwards.
+func WithPayload(index int) Option {
+	return func(options *Options) {
+		options.Payload = index
+	}
+}
+
+// WithFormat sets the format Reveal expects the image to be in, one of FormatAuto, FormatV1 or FormatV2
+func WithFormat(format int) Option {
+	return func(options *Options) {
+		options.Format = format
+	}
+}
+
+// WithBestEffort makes Reveal write out whatever it can recover of a damaged message instead of failing, and
+// report what may be wrong with it in RevealResult.Damage. A header with the magic but a tag that doesn't match
+// is used as it is, a message that fails authentication is decrypted without it, and a message that doesn't
+// match its checksum is revealed anyway.
+func WithBestEffort(bestEffort bool) Option {
+	return func(options *Options) {
+		options.BestEffort = bestEffort
+	}
+}
+
+// WithIgnoreExpiry reveals a message whose metadata says it has expired, which otherwise fails with ErrExpired
+// once the metadata has been read. The metadata itself can always be read.
+func WithIgnoreExpiry(ignore bool) Option {
+	return func(options *Options) {
+		options.IgnoreExpiry = ignore
+	}
+}
+
+// WithSecureMode locks key material in memory so it is never swapped to disk
+func WithSecureMode(secure bool) Option {
+	return func(options *Options) {
+		options.Secure = secure
+	}
+}
+
+// WithWorkers spreads embedding and extracting the message over workers goroutines. The image is the same
+// whatever the number of workers, apart from the random choices of strategies like lsb-matching.
+func WithWorkers(workers int) Option {
+	return func(options *Options) {
+		options.Workers = workers
+	}
+}
+
+// WithCompression sets how hard the images that are saved are compressed. png.BestSpeed saves large images
+// several times faster, and png.BestCompression makes them smaller to share.
+func WithCompression(level png.CompressionLevel) Option {
+	return func(options *Options) {
+		options.Compression = level
+	}
+}
+
+// WithCodec compresses the message with codec at level before it's concealed, so that a message that wouldn't
+// fit otherwise might. Level 0 picks the default level of the codec. Reveal reads the codec from the header, and
+// payloads appended later are compressed with the same codec.
+func WithCodec(codec Codec, level int) Option {
+	return func(options *Options) {
+		options.Codec = codec
+		options.CodecLevel = level
+	}
+}
+
+// WithRandom reads every random choice made while concealing from random instead of crypto/rand: the nonce the
+// message is encrypted with, the choices of strategies like lsb-matching and the noise written by WipeImage.
+// Given the same message, image, options and number of workers, a random that reads the same bytes makes the
+// same image, which is meant for tests and reproducible builds. Anyone who knows what random reads can tell the
+// message apart from noise, and reusing it with the same passphrase reuses the nonce, so it should never be
+// predictable for images that are shared.
+func WithRandom(random io.Reader) Option {
+	return func(options *Options) {
+		options.Random = random
+	}
+}
+
+// WithProgress reports the progress of each phase of work to progress. A nil progress reports nothing.
+func WithProgress(progress Progress) Option {
+	return func(options *Options) {
+		options.Progress = progress
+	}
+}
+
+// WithLogger logs a line describing each step to logger
+func WithLogger(logger Logger) Option {
+	return func(options *Options) {
+		options.Logger = logger
+	}
+}
+
+func makeOptions(opts []Option) Options {
+	options := Options{}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if options.Context == nil {
+		options.Context = context.Background()
+	}
+
+	if options.Logger == nil {
+		options.Logger = noLogger{}
+	}
+
+	if options.Progress == nil {
+		options.Progress = noProgress{}
+	}
+
+	if options.NumBitsPerChannel == 0 {
+		options.NumBitsPerChannel = 1
+	}
+
+	if options.NumChannels == 0 {
+		options.NumChannels = 3
+	}
+
+	if options.Strategy == nil {
+		options.Strategy = lsbStrategy{}
+	}
+
+	if options.Traversal == nil {
+		options.Traversal = LinearTraversal()
+	}
+
+	if options.Workers < 1 {
+		options.Workers = 1
+	}
+
+	if options.Random == nil {
+		options.Random = cryptorand.Reader
+	}
+
+	return options
+}
+
+// chunkSize returns the number of message bytes embedded or extracted between checks for cancellation, which
+// grows with the number of workers so that each of them is given enough to do
+func (self Options) chunkSize() int {
+	return cancelCheckInterval * self.Workers
+}
+
+// header returns the header of a message of numMessageBits concealed with the options
+func (self Options) header(numMessageBits int) Header {
+	encryption := EncryptionNone
+	if self.Passphrase != "" {
+		encryption = EncryptionPassphrase
+	}
+
+	return Header{
+		Version:           headerVersion,
+		NumBitsPerChannel: self.NumBitsPerChannel,
+		NumChannels:       self.NumChannels,
+		Strategy:          self.Strategy,
+		NumMessageBits:    numMessageBits,
+		Encryption:        encryption,
+		Codec:             self.Codec,
+		Headerless:        self.Headerless != nil,
+	}
+}
+
+func (self Options) validate() error {
+	if self.Passphrase != "" && self.KeyPath != "" {
+		return errors.New("passphrase and key-path cannot both be provided")
+	}
+
+	if self.HideHeader && self.Passphrase == "" {
+		return errors.New("hide-header requires a passphrase")
+	}
+
+	if self.HideHeader && self.Headerless != nil {
+		return errors.New("hide-header cannot be used without a header")
+	}
+
+	if self.NumBitsPerChannel < 1 || self.NumBitsPerChannel > 8 {
+		return errors.New("number of bits to use per channel must be between 1 and 8")
+	}
+
+	if self.NumChannels < 1 || self.NumChannels > 4 {
+		return errors.New("channels argument can only be 1, 2, 3, or 4")
+	}
+
+	return self.Codec.ValidateLevel(self.CodecLevel)
+}
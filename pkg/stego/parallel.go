@@ -0,0 +1,162 @@
+package stego
+
+import (
+	"image"
+	"math/rand"
+	"sync"
+)
+
+// Embedding and extracting visit the bits of the message one at a time, which leaves every core but one idle on
+// a large cover. Instead, the whole pixels a run of bytes falls on are taken from the traversal up front and
+// split into contiguous spans, one per worker. The spans only depend on the traversal
+// and the number of workers, and the bits land on exactly the pixels they would have landed on one at a time,
+// so the format doesn't change.
+
+// writeBytes embeds data with strategy starting at the stepper's position, spreading the whole pixels it falls
+// on over workers goroutines. No two workers write to the same pixel, and each has its own random number
+// generator keyed from rng since rng can't be shared. Even a single worker goes through the pixels this way, since each pixel
+// is then looked up once rather than once for every bit.
+func writeBytes(outputImage *image.NRGBA, stepper *ImageStepper, strategy Strategy, rng *rand.Rand, data []byte, workers int) error {
+	numBits := len(data) * 8
+	bit := 0
+
+	// The bits in front of the first whole pixel are embedded one at a time
+	for ; bit < numBits && !stepper.atPixelStart(); bit++ {
+		if err := writeBits(outputImage, stepper, strategy, rng, dataBit(data, bit), 1); err != nil {
+			return err
+		}
+	}
+
+	numBitsPerChannel := stepper.numBitsToUsePerChannel
+	bitsPerPixel := numBitsPerChannel * stepper.channelSize
+	width := outputImage.Bounds().Dx()
+
+	pixels, err := stepper.takePixels((numBits - bit) / bitsPerPixel)
+	if err != nil {
+		return err
+	}
+
+	rngs := make([]*rand.Rand, workers)
+	for i := range rngs {
+		if rngs[i], err = newRand(rng); err != nil {
+			return err
+		}
+	}
+
+	start := bit
+
+	forEachSpan(len(pixels), workers, func(worker int, first int, end int) {
+		for i := first; i < end; i++ {
+			pixel := getPixel(outputImage, pixels[i]%width, pixels[i]/width)
+
+			for offset := 0; offset < bitsPerPixel; offset++ {
+				channel := offset / numBitsPerChannel
+				value := dataBit(data, start+i*bitsPerPixel+offset)
+				pixel[channel] = strategy.Embed(pixel[channel], offset%numBitsPerChannel, value, rngs[worker])
+			}
+		}
+	})
+
+	// The bits after the last whole pixel are embedded one at a time
+	for bit = start + len(pixels)*bitsPerPixel; bit < numBits; bit++ {
+		if err := writeBits(outputImage, stepper, strategy, rng, dataBit(data, bit), 1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readBytes extracts len(p) bytes with strategy into p starting at the stepper's position, spreading the whole
+// pixels they fall on over workers goroutines. The bytes of p are split between the workers rather than the
+// pixels, so that no two workers write to the same byte. Even a single worker goes through the pixels this
+// way, since each pixel is then read once rather than once for every bit.
+func readBytes(img image.Image, stepper *ImageStepper, strategy Strategy, p []byte, workers int) error {
+	for i := range p {
+		p[i] = 0
+	}
+
+	numBits := len(p) * 8
+	bit := 0
+
+	// The bits in front of the first whole pixel are extracted one at a time
+	for ; bit < numBits && !stepper.atPixelStart(); bit++ {
+		value, err := readBits(img, stepper, strategy, 1)
+		if err != nil {
+			return err
+		}
+		p[bit/8] |= uint8(value) << uint(bit%8)
+	}
+
+	numBitsPerChannel := stepper.numBitsToUsePerChannel
+	bitsPerPixel := numBitsPerChannel * stepper.channelSize
+	width := img.Bounds().Dx()
+
+	pixels, err := stepper.takePixels((numBits - bit) / bitsPerPixel)
+	if err != nil {
+		return err
+	}
+
+	start := bit
+	end := start + len(pixels)*bitsPerPixel
+
+	forEachSpan(len(p), workers, func(worker int, first int, last int) {
+		var channels [4]uint8
+		pixelIndex := -1
+
+		for bit := first * 8; bit < last*8; bit++ {
+			if bit < start || bit >= end {
+				continue
+			}
+
+			offset := bit - start
+			if offset/bitsPerPixel != pixelIndex {
+				pixelIndex = offset / bitsPerPixel
+				channels = pixelChannels(img, pixels[pixelIndex]%width, pixels[pixelIndex]/width)
+			}
+
+			channel := offset % bitsPerPixel / numBitsPerChannel
+			value := strategy.Extract(channels[channel], offset%numBitsPerChannel)
+			p[bit/8] |= uint8(value) << uint(bit%8)
+		}
+	})
+
+	// The bits after the last whole pixel are extracted one at a time
+	for bit = end; bit < numBits; bit++ {
+		value, err := readBits(img, stepper, strategy, 1)
+		if err != nil {
+			return err
+		}
+		p[bit/8] |= uint8(value) << uint(bit%8)
+	}
+
+	return nil
+}
+
+// forEachSpan splits the range from 0 to n into at most workers contiguous spans of about the same size and
+// calls fn for each of them on its own goroutine, returning once every call has
+func forEachSpan(n int, workers int, fn func(worker int, first int, end int)) {
+	var group sync.WaitGroup
+	size := (n + workers - 1) / workers
+
+	for worker := 0; worker < workers && worker*size < n; worker++ {
+		first := worker * size
+		end := first + size
+		if end > n {
+			end = n
+		}
+
+		group.Add(1)
+		go func(worker int, first int, end int) {
+			defer group.Done()
+			fn(worker, first, end)
+		}(worker, first, end)
+	}
+
+	group.Wait()
+}
+
+// dataBit returns bit i of data, counting from the least significant bit of its first byte
+func dataBit(data []byte, i int) int {
+	return getBit(int(data[i/8]), i%8)
+}
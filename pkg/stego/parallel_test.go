@@ -0,0 +1,96 @@
+package stego
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math/rand"
+	"testing"
+)
+
+// noiseImage returns a width by height opaque image of random pixels, the same for every call with the same seed
+func noiseImage(width int, height int, seed int64) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	rand.New(rand.NewSource(seed)).Read(img.Pix)
+
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+
+	return img
+}
+
+// randomMessage returns size random bytes, the same for every call with the same seed
+func randomMessage(size int, seed int64) []byte {
+	message := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(message)
+	return message
+}
+
+// TestWorkersMatchSingleWorker conceals the same message with one worker and with several, and checks that the
+// images are identical and that either number of workers reveals the message again. The cases put the split
+// between workers where it's easy to get wrong: pixels that don't divide between the workers, bytes that
+// straddle pixels, a partial last pixel and more workers than rows or than bytes.
+func TestWorkersMatchSingleWorker(t *testing.T) {
+	cases := []struct {
+		width, height     int
+		numBitsPerChannel int
+		numChannels       int
+		size              int
+		workers           int
+		passphrase        string
+	}{
+		{64, 3, 3, 3, 41, 8, ""},
+		{37, 29, 1, 3, 101, 3, ""},
+		{37, 29, 2, 4, 257, 7, ""},
+		{50, 50, 3, 1, 333, 64, ""},
+		{50, 50, 8, 4, 1000, 5, ""},
+		{41, 43, 1, 3, 3, 16, ""},
+		{37, 29, 3, 3, 99, 6, "passphrase"},
+	}
+
+	for _, testCase := range cases {
+		name := fmt.Sprintf("%dx%d %d bits %d channels %d bytes %d workers", testCase.width, testCase.height,
+			testCase.numBitsPerChannel, testCase.numChannels, testCase.size, testCase.workers)
+
+		t.Run(name, func(t *testing.T) {
+			cover := noiseImage(testCase.width, testCase.height, 1)
+			message := randomMessage(testCase.size, 2)
+
+			opts := func(workers int) []Option {
+				return []Option{
+					WithBitsPerChannel(testCase.numBitsPerChannel),
+					WithChannels(testCase.numChannels),
+					WithPassphrase(testCase.passphrase),
+					WithRandom(DeterministicRandom([]byte("parallel"))),
+					WithWorkers(workers),
+				}
+			}
+
+			single, err := ConcealImage(cover, bytes.NewReader(message), opts(1)...)
+			if err != nil {
+				t.Fatalf("conceal with 1 worker: %v", err)
+			}
+
+			parallel, err := ConcealImage(cover, bytes.NewReader(message), opts(testCase.workers)...)
+			if err != nil {
+				t.Fatalf("conceal with %d workers: %v", testCase.workers, err)
+			}
+
+			if !bytes.Equal(single.Pix, parallel.Pix) {
+				t.Fatalf("images concealed with 1 and %d workers differ", testCase.workers)
+			}
+
+			for _, workers := range []int{1, testCase.workers} {
+				var revealed bytes.Buffer
+				if _, err := RevealImage(parallel, &revealed, opts(workers)...); err != nil {
+					t.Fatalf("reveal with %d workers: %v", workers, err)
+				}
+
+				if !bytes.Equal(revealed.Bytes(), message) {
+					t.Errorf("message revealed with %d workers differs from the concealed message", workers)
+				}
+			}
+		})
+	}
+}
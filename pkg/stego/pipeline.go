@@ -0,0 +1,97 @@
+package stego
+
+import "io"
+
+// Concealing reads the message and then embeds it, and revealing extracts the message and then writes it out,
+// one chunk after another. copyPipelined runs the two stages on their own goroutines instead, so that reading
+// a message from a slow source like a pipe or a socket overlaps with embedding it, and extracting overlaps with
+// writing the message out and hashing it.
+
+// pipelineChunkSize is the size of the chunks passed from one stage to the next
+const pipelineChunkSize = 1 << 16
+
+// pipelineDepth is how many chunks the first stage may get ahead of the second
+const pipelineDepth = 2
+
+// pipelineChunk is a chunk read by the first stage along with the error the read ended with
+type pipelineChunk struct {
+	data []byte
+	err  error
+}
+
+// copyPipelined copies r to w like io.Copy, reading the next chunks from r on another goroutine while the
+// current one is written to w. Only pipelineDepth+1 chunks are ever allocated, and they're zeroed once written
+// since they may hold the message. r is no longer read from once copyPipelined has returned.
+func copyPipelined(w io.Writer, r io.Reader) (int64, error) {
+	free := make(chan []byte, pipelineDepth+1)
+	for i := 0; i < cap(free); i++ {
+		free <- make([]byte, pipelineChunkSize)
+	}
+
+	chunks := make(chan pipelineChunk, pipelineDepth)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(finished)
+		defer close(chunks)
+
+		for {
+			var buffer []byte
+			select {
+			case buffer = <-free:
+			case <-done:
+				return
+			}
+
+			n, err := io.ReadFull(r, buffer)
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+
+			select {
+			case chunks <- pipelineChunk{data: buffer[:n], err: err}:
+			case <-done:
+				return
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// The reading goroutine is waited for so that nothing reads from r once the copy is over
+	defer func() {
+		close(done)
+		<-finished
+	}()
+
+	var written int64
+
+	for chunk := range chunks {
+		if len(chunk.data) > 0 {
+			n, err := w.Write(chunk.data)
+			written += int64(n)
+			zeroBytes(chunk.data)
+
+			if err == nil && n < len(chunk.data) {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
+				return written, err
+			}
+		}
+
+		if chunk.err == io.EOF {
+			return written, nil
+		}
+		if chunk.err != nil {
+			return written, chunk.err
+		}
+
+		free <- chunk.data[:cap(chunk.data)]
+	}
+
+	return written, nil
+}
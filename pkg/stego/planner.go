@@ -0,0 +1,85 @@
+package stego
+
+// Plan describes exactly how a message would be concealed in an image
+type Plan struct {
+	// HeaderPixels is the number of pixels taken up by the header, including the padding up to the first pixel
+	// of the message, which is 0 for a headerless image
+	HeaderPixels int
+
+	// CapacityBits is the number of bits available for the message after the header
+	CapacityBits int
+
+	// OverheadBytes is the number of bytes added to the message, such as the nonce and tag of the encryption,
+	// the metadata and the checksum
+	OverheadBytes int
+
+	// MaxMessageBytes is the largest message that fits
+	MaxMessageBytes int
+
+	// MessageBytes is the size of the message the plan was made for
+	MessageBytes int
+
+	// EmbeddedBytes is the number of bytes that will be written after the header
+	EmbeddedBytes int
+}
+
+// Fits reports whether the message fits in the image
+func (self Plan) Fits() bool {
+	return self.MessageBytes <= self.MaxMessageBytes
+}
+
+// Margin returns the number of bytes left over once the message is concealed, which is negative if the message
+// doesn't fit
+func (self Plan) Margin() int {
+	return self.MaxMessageBytes - self.MessageBytes
+}
+
+// PlanConceal works out how a message of messageSize bytes would be concealed in a width by height image with
+// the given options, without touching any pixels. A message compressed with WithCodec is planned with the size
+// CompressedSize returns for it.
+func PlanConceal(width int, height int, messageSize int, opts ...Option) (Plan, error) {
+	options := makeOptions(opts)
+
+	if err := options.validate(); err != nil {
+		return Plan{}, err
+	}
+
+	header := options.header(0)
+	plan := Plan{
+		CapacityBits: header.numBitsAvailable(width, height),
+		MessageBytes: messageSize,
+	}
+
+	if !header.Headerless {
+		plan.HeaderPixels = messageStartPixel(width, height, options.NumBitsPerChannel, options.NumChannels)
+	}
+
+	return plan, plan.complete(options, header)
+}
+
+// complete adds the overhead of options to a plan whose capacity and message size are set, and works out the
+// rest from them. The payload is written for an image with header.
+func (self *Plan) complete(options Options, header Header) error {
+	self.OverheadBytes = header.trailerSize()
+
+	if options.Passphrase != "" {
+		self.OverheadBytes += encryptionOverhead
+	}
+
+	if options.Metadata != nil {
+		prefix, err := options.Metadata.encode()
+		if err != nil {
+			return err
+		}
+		self.OverheadBytes += len(prefix)
+	}
+
+	self.EmbeddedBytes = self.MessageBytes + self.OverheadBytes
+	self.MaxMessageBytes = self.CapacityBits/8 - self.OverheadBytes
+
+	if self.MaxMessageBytes < 0 {
+		self.MaxMessageBytes = 0
+	}
+
+	return nil
+}
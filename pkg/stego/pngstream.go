@@ -0,0 +1,548 @@
+package stego
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+)
+
+// The tiled functions can't hand a whole image to image/png, so they read and write PNGs a row at a time with
+// the reader and writer below. Only what Hide needs is supported: 8-bit, non-interlaced images, which is what
+// image/png writes and what most covers are.
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// PNG color types
+const (
+	pngGray      = 0
+	pngRGB       = 2
+	pngPaletted  = 3
+	pngGrayAlpha = 4
+	pngRGBA      = 6
+)
+
+// pngRowReader decodes the rows of a PNG one at a time as NRGBA
+type pngRowReader struct {
+	r           *bufio.Reader
+	width       int
+	height      int
+	colorType   int
+	palette     [][4]uint8
+	transparent []uint8
+	data        io.ReadCloser
+	idat        *idatReader
+	current     []byte
+	previous    []byte
+	row         int
+}
+
+// newPNGRowReader reads the chunks in front of the image data of the PNG read from r
+func newPNGRowReader(r io.Reader) (*pngRowReader, error) {
+	self := &pngRowReader{r: bufio.NewReader(r)}
+
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(self.r, signature); err != nil || string(signature) != string(pngSignature) {
+		return nil, ErrUnsupportedFormat
+	}
+
+	for {
+		length, chunkType, err := readChunkHeader(self.r)
+		if err != nil {
+			return nil, err
+		}
+
+		if chunkType == "IDAT" {
+			self.idat = &idatReader{r: self.r, remaining: length, crc: crc32.NewIEEE()}
+			self.idat.crc.Write([]byte(chunkType))
+			break
+		}
+
+		// Only the chunks needed to decode the rows are kept, and the others are skipped
+		keep := chunkType == "IHDR" || chunkType == "PLTE" || chunkType == "tRNS"
+
+		data, err := readChunkData(self.r, chunkType, length, keep)
+		if err != nil {
+			return nil, err
+		}
+
+		switch chunkType {
+		case "IHDR":
+			if err := self.parseHeader(data); err != nil {
+				return nil, err
+			}
+		case "PLTE":
+			self.palette = make([][4]uint8, len(data)/3)
+			for i := range self.palette {
+				self.palette[i] = [4]uint8{data[3*i], data[3*i+1], data[3*i+2], 0xff}
+			}
+		case "tRNS":
+			self.transparent = data
+		case "IEND":
+			return nil, ErrUnsupportedFormat
+		}
+	}
+
+	if self.width == 0 || self.height == 0 {
+		return nil, ErrUnsupportedFormat
+	}
+
+	if self.colorType == pngPaletted {
+		for i := 0; i < len(self.transparent) && i < len(self.palette); i++ {
+			self.palette[i][3] = self.transparent[i]
+		}
+	}
+
+	data, err := zlib.NewReader(self.idat)
+	if err != nil {
+		return nil, err
+	}
+	self.data = data
+
+	stride := 1 + self.width*self.bytesPerPixel()
+	self.current = make([]byte, stride)
+	self.previous = make([]byte, stride)
+
+	return self, nil
+}
+
+func (self *pngRowReader) parseHeader(data []byte) error {
+	if len(data) != 13 {
+		return ErrUnsupportedFormat
+	}
+
+	self.width = int(binary.BigEndian.Uint32(data[0:4]))
+	self.height = int(binary.BigEndian.Uint32(data[4:8]))
+	self.colorType = int(data[9])
+	bitDepth, interlace := data[8], data[12]
+
+	if bitDepth != 8 || interlace != 0 || self.width <= 0 || self.height <= 0 {
+		return ErrNotTileable
+	}
+
+	switch self.colorType {
+	case pngGray, pngRGB, pngPaletted, pngGrayAlpha, pngRGBA:
+		return nil
+	default:
+		return ErrNotTileable
+	}
+}
+
+func (self *pngRowReader) bytesPerPixel() int {
+	switch self.colorType {
+	case pngRGB:
+		return 3
+	case pngGrayAlpha:
+		return 2
+	case pngRGBA:
+		return 4
+	default:
+		return 1
+	}
+}
+
+// readRow decodes the next row into row, which holds the 4 NRGBA channels of every pixel of the row
+func (self *pngRowReader) readRow(row []uint8) error {
+	if self.row >= self.height {
+		return io.EOF
+	}
+	self.row++
+
+	self.previous, self.current = self.current, self.previous
+	if _, err := io.ReadFull(self.data, self.current); err != nil {
+		return ErrCorruptPayload
+	}
+
+	if err := unfilterRow(self.current, self.previous, self.bytesPerPixel()); err != nil {
+		return err
+	}
+
+	pixels := self.current[1:]
+
+	for x := 0; x < self.width; x++ {
+		out := row[4*x : 4*x+4]
+
+		switch self.colorType {
+		case pngGray:
+			gray := pixels[x]
+			out[0], out[1], out[2], out[3] = gray, gray, gray, 0xff
+			if len(self.transparent) == 2 && self.transparent[1] == gray {
+				out[3] = 0
+			}
+
+		case pngRGB:
+			out[0], out[1], out[2], out[3] = pixels[3*x], pixels[3*x+1], pixels[3*x+2], 0xff
+			if len(self.transparent) == 6 && self.transparent[1] == out[0] && self.transparent[3] == out[1] && self.transparent[5] == out[2] {
+				out[3] = 0
+			}
+
+		case pngPaletted:
+			// Indices past the end of the palette are opaque black, as image/png decodes them
+			color := [4]uint8{0, 0, 0, 0xff}
+			if index := int(pixels[x]); index < len(self.palette) {
+				color = self.palette[index]
+			}
+			out[0], out[1], out[2], out[3] = color[0], color[1], color[2], color[3]
+
+		case pngGrayAlpha:
+			gray := pixels[2*x]
+			out[0], out[1], out[2], out[3] = gray, gray, gray, pixels[2*x+1]
+
+		case pngRGBA:
+			copy(out, pixels[4*x:4*x+4])
+		}
+	}
+
+	return nil
+}
+
+// idatReader reads the image data spread over consecutive IDAT chunks, checking the CRC of each of them
+type idatReader struct {
+	r         *bufio.Reader
+	remaining int
+	crc       hash.Hash32
+	done      bool
+}
+
+func (self *idatReader) Read(p []byte) (int, error) {
+	for self.remaining == 0 {
+		if self.done {
+			return 0, io.EOF
+		}
+
+		if err := checkChunkCRC(self.r, self.crc); err != nil {
+			return 0, err
+		}
+
+		length, chunkType, err := readChunkHeader(self.r)
+		if err != nil {
+			return 0, err
+		}
+		if chunkType != "IDAT" {
+			self.done = true
+			return 0, io.EOF
+		}
+
+		self.remaining = length
+		self.crc.Reset()
+		self.crc.Write([]byte(chunkType))
+	}
+
+	if len(p) > self.remaining {
+		p = p[:self.remaining]
+	}
+
+	n, err := self.r.Read(p)
+	self.crc.Write(p[:n])
+	self.remaining -= n
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func readChunkHeader(r io.Reader) (int, string, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, "", ErrUnsupportedFormat
+	}
+
+	length := binary.BigEndian.Uint32(header[:4])
+	if length > 1<<31-1 {
+		return 0, "", ErrUnsupportedFormat
+	}
+
+	return int(length), string(header[4:]), nil
+}
+
+// readChunkData reads the data of a chunk that isn't image data and checks its CRC. The data is only returned
+// if keep is true.
+func readChunkData(r io.Reader, chunkType string, length int, keep bool) ([]byte, error) {
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunkType))
+
+	if !keep {
+		if _, err := io.CopyN(crc, r, int64(length)); err != nil {
+			return nil, ErrUnsupportedFormat
+		}
+		return nil, checkChunkCRC(r, crc)
+	}
+
+	// The chunks that are kept are small, so a larger one is corrupt
+	if length > 1<<16 {
+		return nil, ErrUnsupportedFormat
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	crc.Write(data)
+
+	return data, checkChunkCRC(r, crc)
+}
+
+func checkChunkCRC(r io.Reader, crc hash.Hash32) error {
+	sum := make([]byte, 4)
+	if _, err := io.ReadFull(r, sum); err != nil {
+		return ErrUnsupportedFormat
+	}
+
+	if binary.BigEndian.Uint32(sum) != crc.Sum32() {
+		return ErrCorruptPayload
+	}
+	return nil
+}
+
+// unfilterRow reverses the filter of row, whose first byte names the filter, using the previous unfiltered row
+func unfilterRow(row []byte, previous []byte, bytesPerPixel int) error {
+	filter := row[0]
+	current, prior := row[1:], previous[1:]
+
+	switch filter {
+	case 0:
+	case 1:
+		for i := bytesPerPixel; i < len(current); i++ {
+			current[i] += current[i-bytesPerPixel]
+		}
+	case 2:
+		for i := range current {
+			current[i] += prior[i]
+		}
+	case 3:
+		for i := range current {
+			left := 0
+			if i >= bytesPerPixel {
+				left = int(current[i-bytesPerPixel])
+			}
+			current[i] += uint8((left + int(prior[i])) / 2)
+		}
+	case 4:
+		for i := range current {
+			var left, upLeft uint8
+			if i >= bytesPerPixel {
+				left, upLeft = current[i-bytesPerPixel], prior[i-bytesPerPixel]
+			}
+			current[i] += paeth(left, prior[i], upLeft)
+		}
+	default:
+		return ErrCorruptPayload
+	}
+
+	row[0] = 0
+	return nil
+}
+
+func paeth(a uint8, b uint8, c uint8) uint8 {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+
+	if pa <= pb && pa <= pc {
+		return a
+	} else if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// pngRowWriter encodes an 8-bit RGBA PNG a row at a time
+type pngRowWriter struct {
+	w        *bufio.Writer
+	idat     *idatWriter
+	data     *zlib.Writer
+	previous []byte
+	current  []byte
+	filtered [5][]byte
+}
+
+// newPNGRowWriter writes the chunks in front of the image data of a width by height PNG to w. The image data is
+// compressed at level, like image/png does.
+func newPNGRowWriter(w io.Writer, width int, height int, level png.CompressionLevel) (*pngRowWriter, error) {
+	self := &pngRowWriter{w: bufio.NewWriter(w)}
+
+	if _, err := self.w.Write(pngSignature); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 13)
+	binary.BigEndian.PutUint32(header[0:4], uint32(width))
+	binary.BigEndian.PutUint32(header[4:8], uint32(height))
+	header[8] = 8
+	header[9] = pngRGBA
+
+	if err := writeChunk(self.w, "IHDR", header); err != nil {
+		return nil, err
+	}
+
+	self.idat = &idatWriter{w: self.w}
+	data, err := zlib.NewWriterLevel(self.idat, zlibLevel(level))
+	if err != nil {
+		return nil, err
+	}
+	self.data = data
+
+	stride := 1 + 4*width
+	self.previous = make([]byte, stride)
+	self.current = make([]byte, stride)
+	for i := range self.filtered {
+		self.filtered[i] = make([]byte, stride)
+	}
+
+	return self, nil
+}
+
+// writeRow encodes row, which holds the 4 NRGBA channels of every pixel of the row. Every filter is tried and
+// the one whose output has the smallest sum of absolute values is kept, as image/png does.
+func (self *pngRowWriter) writeRow(row []uint8) error {
+	self.previous, self.current = self.current, self.previous
+	copy(self.current[1:], row)
+
+	best := 0
+	bestSum := -1
+
+	for filter := range self.filtered {
+		filtered := self.filtered[filter]
+		filterRow(filtered, self.current, self.previous, filter)
+
+		sum := 0
+		for _, value := range filtered[1:] {
+			sum += abs(int(int8(value)))
+		}
+
+		if bestSum == -1 || sum < bestSum {
+			best, bestSum = filter, sum
+		}
+	}
+
+	_, err := self.data.Write(self.filtered[best])
+	return err
+}
+
+// Close finishes the image data and writes the end of the PNG
+func (self *pngRowWriter) Close() error {
+	if err := self.data.Close(); err != nil {
+		return err
+	}
+
+	if err := self.idat.flush(); err != nil {
+		return err
+	}
+
+	if err := writeChunk(self.w, "IEND", nil); err != nil {
+		return err
+	}
+
+	return self.w.Flush()
+}
+
+// filterRow writes current filtered with filter to filtered, using the previous row
+func filterRow(filtered []byte, current []byte, previous []byte, filter int) {
+	const bytesPerPixel = 4
+	filtered[0] = uint8(filter)
+
+	for i := 1; i < len(current); i++ {
+		var left, upLeft uint8
+		if i > bytesPerPixel {
+			left, upLeft = current[i-bytesPerPixel], previous[i-bytesPerPixel]
+		}
+
+		switch filter {
+		case 0:
+			filtered[i] = current[i]
+		case 1:
+			filtered[i] = current[i] - left
+		case 2:
+			filtered[i] = current[i] - previous[i]
+		case 3:
+			filtered[i] = current[i] - uint8((int(left)+int(previous[i]))/2)
+		case 4:
+			filtered[i] = current[i] - paeth(left, previous[i], upLeft)
+		}
+	}
+}
+
+// idatWriter splits the compressed image data into IDAT chunks
+type idatWriter struct {
+	w      io.Writer
+	buffer []byte
+}
+
+// idatChunkSize is the size of the IDAT chunks written
+const idatChunkSize = 1 << 16
+
+func (self *idatWriter) Write(p []byte) (int, error) {
+	self.buffer = append(self.buffer, p...)
+
+	for len(self.buffer) >= idatChunkSize {
+		if err := writeChunk(self.w, "IDAT", self.buffer[:idatChunkSize]); err != nil {
+			return 0, err
+		}
+		self.buffer = self.buffer[:copy(self.buffer, self.buffer[idatChunkSize:])]
+	}
+
+	return len(p), nil
+}
+
+func (self *idatWriter) flush() error {
+	if len(self.buffer) == 0 {
+		return nil
+	}
+
+	err := writeChunk(self.w, "IDAT", self.buffer)
+	self.buffer = self.buffer[:0]
+	return err
+}
+
+func writeChunk(w io.Writer, chunkType string, data []byte) error {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], chunkType)
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+
+	sum := make([]byte, 4)
+	binary.BigEndian.PutUint32(sum, crc.Sum32())
+
+	for _, part := range [][]byte{header, data, sum} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newBand returns an image for the rows from y0 up to y1 of an image of the given width, which the steppers
+// address with the coordinates of the whole image
+func newBand(width int, y0 int, y1 int) *image.NRGBA {
+	return image.NewNRGBA(image.Rect(0, y0, width, y1))
+}
+
+// zlibLevel returns the zlib level image/png compresses with at level
+func zlibLevel(level png.CompressionLevel) int {
+	switch level {
+	case png.NoCompression:
+		return zlib.NoCompression
+	case png.BestSpeed:
+		return zlib.BestSpeed
+	case png.BestCompression:
+		return zlib.BestCompression
+	default:
+		return zlib.DefaultCompression
+	}
+}
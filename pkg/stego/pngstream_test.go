@@ -0,0 +1,173 @@
+package stego
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"testing"
+)
+
+// toNRGBA returns img drawn onto an NRGBA image of the same size
+func toNRGBA(img image.Image) *image.NRGBA {
+	nrgba := image.NewNRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return nrgba
+}
+
+// TestPNGRowReaderMatchesImagePNG reads PNGs of every color type image/png writes a row at a time, and checks
+// that the rows match what image/png decodes
+func TestPNGRowReaderMatchesImagePNG(t *testing.T) {
+	noise := noiseImage(37, 23, 3)
+
+	translucent := noiseImage(37, 23, 4)
+	for i := 3; i < len(translucent.Pix); i += 8 {
+		translucent.Pix[i] = uint8(i)
+	}
+
+	gray := image.NewGray(noise.Bounds())
+	draw.Draw(gray, gray.Bounds(), noise, image.Point{}, draw.Src)
+
+	// image/png only writes 8-bit paletted images for palettes of more than 16 colors
+	palette := color.Palette{color.NRGBA{0, 0, 0, 0}, color.NRGBA{255, 0, 0, 128}}
+	for len(palette) < 20 {
+		palette = append(palette, color.Gray{Y: uint8(len(palette) * 12)})
+	}
+	paletted := image.NewPaletted(noise.Bounds(), palette)
+	for i := range paletted.Pix {
+		paletted.Pix[i] = noise.Pix[i] % uint8(len(palette))
+	}
+
+	images := map[string]image.Image{
+		"rgb":      noise,
+		"rgba":     translucent,
+		"gray":     gray,
+		"paletted": paletted,
+	}
+
+	for name, img := range images {
+		t.Run(name, func(t *testing.T) {
+			var encoded bytes.Buffer
+			if err := png.Encode(&encoded, img); err != nil {
+				t.Fatal(err)
+			}
+
+			decoded, err := png.Decode(bytes.NewReader(encoded.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := toNRGBA(decoded)
+
+			reader, err := newPNGRowReader(bytes.NewReader(encoded.Bytes()))
+			if err != nil {
+				t.Fatalf("newPNGRowReader: %v", err)
+			}
+
+			row := make([]uint8, want.Stride)
+			for y := 0; y < want.Rect.Dy(); y++ {
+				if err := reader.readRow(row); err != nil {
+					t.Fatalf("row %d: %v", y, err)
+				}
+
+				if !bytes.Equal(row, want.Pix[y*want.Stride:(y+1)*want.Stride]) {
+					t.Fatalf("row %d differs from image/png", y)
+				}
+			}
+		})
+	}
+}
+
+// TestPNGRowWriterMatchesImagePNG writes an image a row at a time, and checks that image/png decodes it back
+// to the same pixels
+func TestPNGRowWriterMatchesImagePNG(t *testing.T) {
+	img := noiseImage(41, 29, 5)
+
+	// Smooth rows make filters other than none the smallest
+	for y := 10; y < 20; y++ {
+		for i := y * img.Stride; i < (y+1)*img.Stride; i++ {
+			img.Pix[i] = uint8(i % 7)
+		}
+	}
+
+	for _, level := range []png.CompressionLevel{png.DefaultCompression, png.NoCompression, png.BestSpeed} {
+		t.Run(fmt.Sprint(level), func(t *testing.T) {
+			var encoded bytes.Buffer
+			writer, err := newPNGRowWriter(&encoded, img.Rect.Dx(), img.Rect.Dy(), level)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for y := 0; y < img.Rect.Dy(); y++ {
+				if err := writer.writeRow(img.Pix[y*img.Stride : (y+1)*img.Stride]); err != nil {
+					t.Fatalf("row %d: %v", y, err)
+				}
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			decoded, err := png.Decode(&encoded)
+			if err != nil {
+				t.Fatalf("image/png can't decode the image: %v", err)
+			}
+
+			if !bytes.Equal(toNRGBA(decoded).Pix, img.Pix) {
+				t.Error("decoded image differs from the rows written")
+			}
+		})
+	}
+}
+
+// TestConcealTiledMatchesConcealImage conceals the same message in tiles and in memory, and checks that both
+// give the same image. The cover is tall enough to be split into several bands, so the backup copies of the
+// header are written to a later band than the header.
+func TestConcealTiledMatchesConcealImage(t *testing.T) {
+	width, height := 1024, 1500
+	if bandHeight(width, height) >= height {
+		t.Fatalf("the cover fits in a single band")
+	}
+
+	cover := noiseImage(width, height, 6)
+	var encodedCover bytes.Buffer
+	if err := png.Encode(&encodedCover, cover); err != nil {
+		t.Fatal(err)
+	}
+
+	message := randomMessage(5000, 7)
+
+	cases := map[string][]Option{
+		"plain":         {WithBitsPerChannel(2)},
+		"passphrase":    {WithPassphrase("passphrase"), WithChannels(4)},
+		"hidden header": {WithPassphrase("passphrase"), WithHiddenHeader(true), WithBitsPerChannel(3)},
+	}
+
+	for name, opts := range cases {
+		t.Run(name, func(t *testing.T) {
+			// Each conceal reads the same random bytes
+			withRandom := func() []Option {
+				return append(append([]Option(nil), opts...), WithRandom(DeterministicRandom([]byte("tiled"))))
+			}
+
+			want, err := ConcealImage(cover, bytes.NewReader(message), withRandom()...)
+			if err != nil {
+				t.Fatalf("conceal in memory: %v", err)
+			}
+
+			var tiled bytes.Buffer
+			if err := ConcealTiled(bytes.NewReader(encodedCover.Bytes()), &tiled, bytes.NewReader(message), withRandom()...); err != nil {
+				t.Fatalf("conceal in tiles: %v", err)
+			}
+
+			got, err := png.Decode(&tiled)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(toNRGBA(got).Pix, want.Pix) {
+				t.Error("image concealed in tiles differs from the one concealed in memory")
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package stego
+
+// Progress receives updates while Conceal and Reveal run. Each phase of work starts with OnStart, reports how
+// much of it is done through OnProgress, and ends with OnDone. total is -1 when it isn't known up front, such
+// as while a message is still being streamed into an Encoder.
+type Progress interface {
+	OnStart(phase string, total int)
+	OnProgress(done int)
+	OnDone()
+}
+
+// noProgress is the Progress used when none is given
+type noProgress struct{}
+
+func (noProgress) OnStart(phase string, total int) {}
+
+func (noProgress) OnProgress(done int) {}
+
+func (noProgress) OnDone() {}
@@ -0,0 +1,86 @@
+package stego
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"math/rand"
+)
+
+// Strategies like lsb-matching make a random choice for every bit they change. Seeding a math/rand source for
+// every worker and chunk is slow, and its output can be predicted from a few of its values, so the generators
+// handed to strategies instead read the keystream of AES-CTR under a key from crypto/rand, a batch at a time. The
+// key is read from the random of WithRandom, so a deterministic random makes every choice the same.
+
+// randBatchSize is the number of bytes of keystream generated at once
+const randBatchSize = 4096
+
+// ctrSource is a rand.Source64 that reads AES-CTR keystream in batches
+type ctrSource struct {
+	stream cipher.Stream
+	batch  []byte
+	offset int
+}
+
+// newRand returns a random number generator keyed from random for strategies that make random choices
+func newRand(random io.Reader) (*rand.Rand, error) {
+	seed := make([]byte, 32)
+	defer zeroBytes(seed)
+
+	if _, err := io.ReadFull(random, seed); err != nil {
+		return nil, err
+	}
+
+	return newCTRRand(seed)
+}
+
+// DeterministicRandom returns a random for WithRandom that reads the same bytes every time it's made from the
+// same seed
+func DeterministicRandom(seed []byte) io.Reader {
+	sum := sha256.Sum256(seed)
+	defer zeroBytes(sum[:])
+
+	// The key is 16 bytes, which AES always accepts
+	random, _ := newCTRRand(sum[:])
+	return random
+}
+
+// newCTRRand returns a random number generator that reads the keystream of AES-CTR, keyed with the first 16
+// bytes of seed and started at the counter in the next 16
+func newCTRRand(seed []byte) (*rand.Rand, error) {
+	block, err := aes.NewCipher(seed[:16])
+	if err != nil {
+		return nil, err
+	}
+
+	source := &ctrSource{
+		stream: cipher.NewCTR(block, seed[16:]),
+		batch:  make([]byte, randBatchSize),
+		offset: randBatchSize,
+	}
+
+	return rand.New(source), nil
+}
+
+func (self *ctrSource) Uint64() uint64 {
+	if self.offset == len(self.batch) {
+		for i := range self.batch {
+			self.batch[i] = 0
+		}
+		self.stream.XORKeyStream(self.batch, self.batch)
+		self.offset = 0
+	}
+
+	value := binary.LittleEndian.Uint64(self.batch[self.offset:])
+	self.offset += 8
+	return value
+}
+
+func (self *ctrSource) Int63() int64 {
+	return int64(self.Uint64() >> 1)
+}
+
+// Seed does nothing, since the source is keyed when it's made and can't be made to repeat itself
+func (self *ctrSource) Seed(int64) {}
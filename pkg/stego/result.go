@@ -0,0 +1,36 @@
+package stego
+
+import (
+	"crypto/sha256"
+	"time"
+)
+
+// RevealResult describes a revealed message, so callers can report what was extracted without parsing the
+// header again
+type RevealResult struct {
+	Header    Header
+	Encrypted bool
+	Metadata  *Metadata
+	Size      int
+	Checksum  [sha256.Size]byte
+	Duration  time.Duration
+
+	// Verified is true when the message matched the checksum stored with it
+	Verified bool
+
+	// Damage lists the parts of a message revealed with WithBestEffort that may not be what was concealed
+	Damage []Damage
+}
+
+// Damage is a range of bytes of a revealed message that may not be what was concealed, and why. The range
+// starts at Start and ends before End.
+type Damage struct {
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Reason string `json:"reason"`
+}
+
+// Strategy returns the name of the strategy the message was concealed with
+func (self RevealResult) Strategy() string {
+	return self.Header.Strategy.Name()
+}
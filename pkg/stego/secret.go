@@ -0,0 +1,61 @@
+package stego
+
+// secret holds the key derived from a passphrase. The key is wiped by destroy, and in secure mode it is also
+// locked in memory so it is never written to swap. Passphrases themselves arrive as Go strings, which can't be
+// wiped, so they should be dropped as soon as the secret has been created.
+type secret struct {
+	key    []byte
+	locked bool
+}
+
+// newSecret derives a secret from the passphrase. A nil secret is returned if the passphrase is empty.
+func newSecret(passphrase string, secure bool) (*secret, error) {
+	if passphrase == "" {
+		return nil, nil
+	}
+
+	self := &secret{key: createHash(passphrase)}
+
+	if secure {
+		if err := lockMemory(self.key); err != nil {
+			zeroBytes(self.key)
+			return nil, err
+		}
+		self.locked = true
+	}
+
+	return self, nil
+}
+
+// destroy wipes the key and unlocks its memory. It is safe to call on a nil secret.
+func (self *secret) destroy() {
+	if self == nil {
+		return
+	}
+
+	zeroBytes(self.key)
+
+	if self.locked {
+		unlockMemory(self.key)
+		self.locked = false
+	}
+}
+
+// zeroBytes overwrites every byte of b with 0
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// appendSensitive appends p to b like append, but wipes b if it has to be moved to a larger array
+func appendSensitive(b []byte, p []byte) []byte {
+	if len(b)+len(p) <= cap(b) {
+		return append(b, p...)
+	}
+
+	grown := make([]byte, len(b), 2*cap(b)+len(p))
+	copy(grown, b)
+	zeroBytes(b)
+	return append(grown, p...)
+}
@@ -0,0 +1,12 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package stego
+
+import "errors"
+
+func lockMemory(b []byte) error {
+	return errors.New("secure mode is not supported on this platform")
+}
+
+func unlockMemory(b []byte) {}
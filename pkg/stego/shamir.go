@@ -0,0 +1,201 @@
+package stego
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A payload can also be split with the secret sharing scheme of Shamir, into shares concealed in several images
+// such that any threshold of them give the payload back and fewer give away nothing about it. Every byte of the
+// payload is the constant term of its own random polynomial of degree threshold - 1 over GF(2^8), and each share
+// holds the values of the polynomials at its own X. The file metadata of the payload and its checksum are shared
+// along with it, so an image only says which share it holds.
+
+// Share says which share of a payload split with SplitSecret a message is. Set tells the shares of one payload
+// apart from those of another, X is the point the share was taken at, and Threshold is how many of the Count
+// shares it takes to recover the payload.
+type Share struct {
+	Set       string `json:"set"`
+	X         int    `json:"x"`
+	Threshold int    `json:"threshold"`
+	Count     int    `json:"count"`
+}
+
+// maxShares is the most shares a payload can be split into, one for every nonzero element of GF(2^8)
+const maxShares = 255
+
+// ErrTooFewShares is returned when fewer shares than the threshold are combined
+var ErrTooFewShares = errors.New("too few shares to recover the message")
+
+// gfExp and gfLog are the powers of the generator 3 of GF(2^8), with the polynomial of AES, and their logarithms
+var gfExp, gfLog = gfTables()
+
+func gfTables() ([512]uint8, [256]int) {
+	var exp [512]uint8
+	var log [256]int
+
+	value := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = uint8(value)
+		log[value] = i
+
+		// Multiplying by 3 is multiplying by 2, reduced by the polynomial, and adding the value
+		doubled := value << 1
+		if doubled&0x100 != 0 {
+			doubled ^= 0x11b
+		}
+		value ^= doubled
+	}
+
+	// The powers repeat, so products of two logarithms don't have to be reduced
+	for i := 255; i < len(exp); i++ {
+		exp[i] = exp[i-255]
+	}
+
+	return exp, log
+}
+
+// gfMultiply returns the product of a and b in GF(2^8)
+func gfMultiply(a uint8, b uint8) uint8 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+gfLog[b]]
+}
+
+// gfDivide returns a divided by b in GF(2^8), where b isn't 0
+func gfDivide(a uint8, b uint8) uint8 {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+255-gfLog[b]]
+}
+
+// SplitSecret splits message, along with its metadata if it has any, into count shares of set such that any
+// threshold of them recover it with CombineShares, and returns the Share and the content of each. The random
+// coefficients of the polynomials are read from WithRandom.
+func SplitSecret(set string, message []byte, metadata *Metadata, threshold int, count int,
+	opts ...Option) ([]Share, [][]byte, error) {
+
+	options := makeOptions(opts)
+
+	if threshold < 1 || threshold > count {
+		return nil, nil, errors.New("threshold must be between 1 and the number of shares")
+	}
+	if count > maxShares {
+		return nil, nil, fmt.Errorf("a message can be split into at most %d shares", maxShares)
+	}
+
+	var secret []byte
+	if metadata != nil {
+		prefix, err := metadata.encode()
+		if err != nil {
+			return nil, nil, err
+		}
+		secret = prefix
+	}
+	secret = appendChecksum(appendSensitive(secret, message))
+	defer zeroBytes(secret)
+
+	coefficients := make([]byte, (threshold-1)*len(secret))
+	if _, err := io.ReadFull(options.Random, coefficients); err != nil {
+		return nil, nil, err
+	}
+	defer zeroBytes(coefficients)
+
+	shares := make([]Share, count)
+	contents := make([][]byte, count)
+
+	for i := range shares {
+		x := uint8(i + 1)
+		shares[i] = Share{Set: set, X: int(x), Threshold: threshold, Count: count}
+		contents[i] = make([]byte, len(secret))
+
+		// Horner's rule, from the coefficient of the highest degree down to the secret itself
+		for j, value := range secret {
+			y := uint8(0)
+			for degree := threshold - 1; degree >= 1; degree-- {
+				y = gfMultiply(y, x) ^ coefficients[(degree-1)*len(secret)+j]
+			}
+			contents[i][j] = gfMultiply(y, x) ^ value
+		}
+	}
+
+	return shares, contents, nil
+}
+
+// CombineShares recovers the message and its metadata from shares made by SplitSecret, given in any order along
+// with their contents. It returns ErrMixedShards for shares of different sets, ErrTooFewShares for fewer than
+// the threshold, ErrCorruptPayload when the recovered message doesn't match its checksum, and ErrExpired for a
+// message whose metadata says it has expired unless WithIgnoreExpiry is given.
+func CombineShares(shares []Share, contents [][]byte, opts ...Option) ([]byte, *Metadata, error) {
+	options := makeOptions(opts)
+
+	if len(shares) == 0 || len(shares) != len(contents) {
+		return nil, nil, ErrTooFewShares
+	}
+
+	first := shares[0]
+	seen := map[int]bool{}
+	var xs []uint8
+	var points [][]byte
+
+	for i, share := range shares {
+		if share.Set != first.Set || share.Threshold != first.Threshold || share.Count != first.Count ||
+			len(contents[i]) != len(contents[0]) {
+			return nil, nil, ErrMixedShards
+		}
+		if share.X < 1 || share.X > maxShares {
+			return nil, nil, ErrCorruptPayload
+		}
+
+		// A share given twice adds nothing
+		if seen[share.X] || len(xs) == first.Threshold {
+			continue
+		}
+		seen[share.X] = true
+		xs = append(xs, uint8(share.X))
+		points = append(points, contents[i])
+	}
+
+	if len(xs) < first.Threshold {
+		return nil, nil, fmt.Errorf("%d of the %d shares needed were given: %w", len(xs), first.Threshold,
+			ErrTooFewShares)
+	}
+
+	// Lagrange interpolation at 0, where the weight of every share is the product of x_m / (x_m - x_j) over the
+	// other shares, and subtraction is addition in GF(2^8)
+	weights := make([]uint8, len(xs))
+	for j, xj := range xs {
+		weights[j] = 1
+		for m, xm := range xs {
+			if m != j {
+				weights[j] = gfMultiply(weights[j], gfDivide(xm, xm^xj))
+			}
+		}
+	}
+
+	secret := make([]byte, len(points[0]))
+	for i := range secret {
+		value := uint8(0)
+		for j, point := range points {
+			value ^= gfMultiply(weights[j], point[i])
+		}
+		secret[i] = value
+	}
+	defer zeroBytes(secret)
+
+	if len(secret) < checksumSize {
+		return nil, nil, ErrCorruptPayload
+	}
+	payload := secret[:len(secret)-checksumSize]
+	sum := sha256.Sum256(payload)
+	if subtle.ConstantTimeCompare(sum[:], secret[len(secret)-checksumSize:]) != 1 {
+		return nil, nil, ErrCorruptPayload
+	}
+
+	return splitMetadata(payload, options.IgnoreExpiry)
+}
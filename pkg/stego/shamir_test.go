@@ -0,0 +1,141 @@
+package stego
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// TestCombineSharesSubsets splits a message and combines every subset of its shares, in both orders. Every
+// subset of at least the threshold must give the message back, and every smaller one ErrTooFewShares.
+func TestCombineSharesSubsets(t *testing.T) {
+	message := randomMessage(100, 8)
+
+	cases := []struct{ threshold, count int }{
+		{1, 1},
+		{1, 3},
+		{2, 2},
+		{2, 3},
+		{3, 5},
+		{5, 5},
+		{4, 7},
+	}
+
+	for _, testCase := range cases {
+		t.Run(fmt.Sprintf("%d of %d", testCase.threshold, testCase.count), func(t *testing.T) {
+			shares, contents, err := SplitSecret("set", message, nil, testCase.threshold, testCase.count,
+				WithRandom(DeterministicRandom([]byte("shamir"))))
+			if err != nil {
+				t.Fatalf("split: %v", err)
+			}
+
+			if len(shares) != testCase.count || len(contents) != testCase.count {
+				t.Fatalf("split into %d shares, want %d", len(shares), testCase.count)
+			}
+
+			for subset := 1; subset < 1<<uint(testCase.count); subset++ {
+				var subsetShares []Share
+				var subsetContents [][]byte
+				for i := 0; i < testCase.count; i++ {
+					if subset&(1<<uint(i)) != 0 {
+						subsetShares = append(subsetShares, shares[i])
+						subsetContents = append(subsetContents, contents[i])
+					}
+				}
+
+				for _, reversed := range []bool{false, true} {
+					if reversed {
+						for i, j := 0, len(subsetShares)-1; i < j; i, j = i+1, j-1 {
+							subsetShares[i], subsetShares[j] = subsetShares[j], subsetShares[i]
+							subsetContents[i], subsetContents[j] = subsetContents[j], subsetContents[i]
+						}
+					}
+
+					combined, _, err := CombineShares(subsetShares, subsetContents)
+
+					if len(subsetShares) < testCase.threshold {
+						if !errors.Is(err, ErrTooFewShares) {
+							t.Errorf("subset %b returned %v, want %v", subset, err, ErrTooFewShares)
+						}
+						continue
+					}
+
+					if err != nil {
+						t.Errorf("subset %b: %v", subset, err)
+					} else if !bytes.Equal(combined, message) {
+						t.Errorf("subset %b recovered a different message", subset)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestCombineSharesMetadata checks that the metadata of a message is recovered along with it
+func TestCombineSharesMetadata(t *testing.T) {
+	message := []byte("shared notes")
+
+	shares, contents, err := SplitSecret("set", message, &Metadata{Name: "notes.txt"}, 2, 3)
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+
+	combined, metadata, err := CombineShares(shares[1:], contents[1:])
+	if err != nil {
+		t.Fatalf("combine: %v", err)
+	}
+
+	if !bytes.Equal(combined, message) {
+		t.Errorf("recovered %q, want %q", combined, message)
+	}
+	if metadata == nil || metadata.Name != "notes.txt" {
+		t.Errorf("recovered metadata %+v, want the name notes.txt", metadata)
+	}
+}
+
+// TestCombineSharesErrors checks the shares CombineShares refuses
+func TestCombineSharesErrors(t *testing.T) {
+	shares, contents, err := SplitSecret("set", []byte("message"), nil, 2, 3)
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+
+	otherShares, otherContents, err := SplitSecret("other", []byte("message"), nil, 2, 3)
+	if err != nil {
+		t.Fatalf("split: %v", err)
+	}
+
+	damaged := append([]byte(nil), contents[1]...)
+	damaged[0] ^= 1
+
+	cases := []struct {
+		name     string
+		shares   []Share
+		contents [][]byte
+		want     error
+	}{
+		{"none", nil, nil, ErrTooFewShares},
+		{"one", shares[:1], contents[:1], ErrTooFewShares},
+		{"the same share twice", []Share{shares[0], shares[0]}, [][]byte{contents[0], contents[0]}, ErrTooFewShares},
+		{"different sets", []Share{shares[0], otherShares[1]}, [][]byte{contents[0], otherContents[1]}, ErrMixedShards},
+		{"damaged", shares[:2], [][]byte{contents[0], damaged}, ErrCorruptPayload},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if _, _, err := CombineShares(testCase.shares, testCase.contents); !errors.Is(err, testCase.want) {
+				t.Errorf("combine returned %v, want %v", err, testCase.want)
+			}
+		})
+	}
+}
+
+// TestSplitSecretThreshold checks that a message can't be split with a threshold the shares can't meet
+func TestSplitSecretThreshold(t *testing.T) {
+	for _, testCase := range []struct{ threshold, count int }{{0, 3}, {4, 3}, {2, maxShares + 1}} {
+		if _, _, err := SplitSecret("set", []byte("message"), nil, testCase.threshold, testCase.count); err == nil {
+			t.Errorf("split %d of %d succeeded", testCase.threshold, testCase.count)
+		}
+	}
+}
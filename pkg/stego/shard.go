@@ -0,0 +1,116 @@
+package stego
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// A payload too large for a single image can be split into shards concealed in several images, each as a
+// message of its own with the file metadata of the whole payload and a Shard saying where it goes. The shards
+// can then be revealed in any order and joined back together.
+
+// Shard says which part of a payload split across several images a message is. Set tells the shards of one
+// payload apart from those of another, Index is the position of the shard among the Count shards of the set,
+// and Size and SHA256 are those of the whole payload, so that the joined payload can be checked.
+type Shard struct {
+	Set    string `json:"set"`
+	Index  int    `json:"index"`
+	Count  int    `json:"count"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+var (
+	// ErrMissingShards is returned when shards are joined without every shard of their set
+	ErrMissingShards = errors.New("not every shard of the payload was given")
+
+	// ErrMixedShards is returned when shards of different payloads are joined
+	ErrMixedShards = errors.New("the shards belong to different payloads")
+)
+
+// NewShards returns the Shard of every part of message once it's split into count shards of set
+func NewShards(set string, count int, message []byte) []Shard {
+	sum := sha256.Sum256(message)
+
+	shards := make([]Shard, count)
+	for i := range shards {
+		shards[i] = Shard{Set: set, Index: i, Count: count, Size: len(message), SHA256: hex.EncodeToString(sum[:])}
+	}
+
+	return shards
+}
+
+// SplitShards splits message into shards that fill the capacities in bytes in order, leaving out capacities that
+// aren't needed, and returns ErrCapacityExceeded if they can't hold all of it. The shards share the memory of
+// message.
+func SplitShards(message []byte, capacities []int) ([][]byte, error) {
+	var shards [][]byte
+	offset := 0
+
+	for _, capacity := range capacities {
+		if offset == len(message) {
+			break
+		}
+		if capacity <= 0 {
+			continue
+		}
+
+		end := offset + capacity
+		if end > len(message) {
+			end = len(message)
+		}
+		shards = append(shards, message[offset:end])
+		offset = end
+	}
+
+	if offset < len(message) || len(shards) == 0 {
+		return nil, ErrCapacityExceeded
+	}
+
+	return shards, nil
+}
+
+// JoinShards puts the parts revealed from the shards of a payload back in order and returns the payload, given
+// in any order along with the Shard stored with each. It returns ErrMixedShards for shards of different sets,
+// ErrMissingShards unless every shard of the set is there, and ErrCorruptPayload for a payload that doesn't
+// match the size and checksum of the one that was split.
+func JoinShards(shards []Shard, parts [][]byte) ([]byte, error) {
+	if len(shards) == 0 || len(shards) != len(parts) {
+		return nil, ErrMissingShards
+	}
+
+	first := shards[0]
+	ordered := make([][]byte, first.Count)
+
+	for i, shard := range shards {
+		if shard.Set != first.Set || shard.Count != first.Count || shard.Size != first.Size ||
+			shard.SHA256 != first.SHA256 {
+			return nil, ErrMixedShards
+		}
+		if shard.Index < 0 || shard.Index >= shard.Count {
+			return nil, ErrCorruptPayload
+		}
+		if ordered[shard.Index] != nil {
+			return nil, fmt.Errorf("shard %d of %d was given more than once", shard.Index+1, shard.Count)
+		}
+		ordered[shard.Index] = parts[i]
+	}
+
+	payload := make([]byte, 0, first.Size)
+	for _, part := range ordered {
+		if part == nil {
+			return nil, ErrMissingShards
+		}
+		payload = append(payload, part...)
+	}
+
+	sum := sha256.Sum256(payload)
+	if len(payload) != first.Size || hex.EncodeToString(sum[:]) != first.SHA256 {
+		zeroBytes(payload)
+		return nil, ErrCorruptPayload
+	}
+
+	return payload, nil
+}
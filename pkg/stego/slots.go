@@ -0,0 +1,316 @@
+package stego
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"image"
+	"math/rand"
+)
+
+// An image can hold several slots, each revealed with a passphrase of its own, so that different recipients
+// get different messages out of the same image. The pixels are dealt out to the slots in turn, so slot i holds
+// every pixel whose index is i modulo the number of slots, and no two slots share a pixel. A slot is visited in
+// an order keyed with its passphrase, and holds the length of its message masked with the passphrase followed by
+// the message encrypted with it. Everything else, including the slots that aren't used, is filled with random
+// bits. There's no header, so a passphrase only shows the slot it opens: the rest of the image looks the same
+// whether it holds other messages or not.
+
+// slotLengthBits is the number of bits the masked length of a slot's payload takes up
+const slotLengthBits = 32
+
+// maxSlots is the most slots an image can be split into
+const maxSlots = 64
+
+// Slot is a message concealed in one slot of an image, along with its metadata if it has any, and the
+// passphrase that reveals it
+type Slot struct {
+	Passphrase string
+	Message    []byte
+	Metadata   *Metadata
+}
+
+// slotRegion is the pixels of one slot of an image, in the order keyed with its passphrase
+type slotRegion struct {
+	traversal   Traversal
+	index       int
+	numSlots    int
+	numChannels int
+	numBits     int
+	channel     int
+	bit         int
+	pixel       int
+	done        bool
+}
+
+func newSlotRegion(width int, height int, numSlots int, index int, key *secret, options Options) *slotRegion {
+	size := (width*height - index + numSlots - 1) / numSlots
+
+	region := &slotRegion{
+		index:       index,
+		numSlots:    numSlots,
+		numChannels: options.NumChannels,
+		numBits:     options.NumBitsPerChannel,
+	}
+
+	if key != nil {
+		seed := slotKey(key, "slot traversal")
+		region.traversal = KeyedTraversal(seed)(size, 1, 0)
+		zeroBytes(seed)
+	} else {
+		region.traversal = LinearTraversal()(size, 1, 0)
+	}
+
+	region.advance()
+	return region
+}
+
+// advance moves on to the next pixel of the region
+func (self *slotRegion) advance() {
+	position, ok := self.traversal.Next()
+	self.pixel = position*self.numSlots + self.index
+	self.done = !ok
+}
+
+// next returns the pixel, channel and bit index the next bit of the slot goes to, and false once it's full
+func (self *slotRegion) next() (int, int, int, bool) {
+	if self.done {
+		return 0, 0, 0, false
+	}
+
+	pixel, channel, bit := self.pixel, self.channel, self.bit
+
+	self.bit++
+	if self.bit == self.numBits {
+		self.bit = 0
+		self.channel++
+	}
+	if self.channel == self.numChannels {
+		self.channel = 0
+		self.advance()
+	}
+
+	return pixel, channel, bit, true
+}
+
+// slotKey returns a key for purpose derived from the key of a slot's passphrase
+func slotKey(key *secret, purpose string) []byte {
+	mac := hmac.New(sha256.New, key.key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// slotLengthMask returns what the length of a slot's payload is masked with
+func slotLengthMask(key *secret) uint32 {
+	sum := slotKey(key, "slot length")
+	defer zeroBytes(sum)
+	return binary.BigEndian.Uint32(sum)
+}
+
+// SlotCapacity returns the most bytes of message every slot of a width by height image split into numSlots
+// slots can hold with the options, before the metadata of the message
+func SlotCapacity(width int, height int, numSlots int, opts ...Option) int {
+	options := makeOptions(opts)
+	if numSlots < 1 {
+		return 0
+	}
+
+	// The last slot has the fewest pixels
+	size := width * height / numSlots
+	capacity := (size*options.NumChannels*options.NumBitsPerChannel-slotLengthBits)/8 - encryptionOverhead
+	if capacity < 0 {
+		return 0
+	}
+	return capacity
+}
+
+// ConcealSlots conceals each of slots in a slot of a copy of img split into numSlots slots, in the order they're
+// given, and fills the rest of the image with random bits. Every slot needs a passphrase of its own. The bits
+// per channel, channels, strategy and random are taken from opts, and reveal needs the same bits, channels and
+// number of slots.
+func ConcealSlots(img image.Image, numSlots int, slots []Slot, opts ...Option) (*image.NRGBA, error) {
+	options := makeOptions(opts)
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	if numSlots < 1 || numSlots > maxSlots || len(slots) > numSlots {
+		return nil, errors.New("there must be at least as many slots as messages, and at most 64")
+	}
+
+	outputImage, err := copyImage(options.Context, img, options.Progress)
+	if err != nil {
+		return nil, err
+	}
+	width, height := outputImage.Bounds().Dx(), outputImage.Bounds().Dy()
+
+	rng, err := newRand(options.Random)
+	if err != nil {
+		return nil, err
+	}
+
+	passphrases := map[string]bool{}
+	for i := 0; i < numSlots; i++ {
+		var payload []byte
+		var key *secret
+
+		if i < len(slots) {
+			if slots[i].Passphrase == "" || passphrases[slots[i].Passphrase] {
+				return nil, errors.New("every slot needs a passphrase of its own")
+			}
+			passphrases[slots[i].Passphrase] = true
+
+			if key, err = newSecret(slots[i].Passphrase, options.Secure); err != nil {
+				return nil, err
+			}
+			payload, err = slotPayload(slots[i], key, options)
+			if err != nil {
+				key.destroy()
+				return nil, err
+			}
+		}
+
+		region := newSlotRegion(width, height, numSlots, i, key, options)
+		err := fillSlot(outputImage, region, payload, rng, options.Strategy)
+		zeroBytes(payload)
+		key.destroy()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	options.Logger.Println("Concealed", len(slots), "messages in", numSlots, "slots")
+	return outputImage, nil
+}
+
+// slotPayload returns the bits a slot holds ahead of the random fill: its masked length and its encrypted
+// message, with the metadata in front of it
+func slotPayload(slot Slot, key *secret, options Options) ([]byte, error) {
+	var plaintext []byte
+	if slot.Metadata != nil {
+		prefix, err := slot.Metadata.encode()
+		if err != nil {
+			return nil, err
+		}
+		plaintext = prefix
+	}
+	plaintext = appendSensitive(plaintext, slot.Message)
+	defer zeroBytes(plaintext)
+
+	ciphertext, err := encrypt(plaintext, key, options.Random)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := make([]byte, slotLengthBits/8, slotLengthBits/8+len(ciphertext))
+	binary.BigEndian.PutUint32(payload, uint32(len(ciphertext))^slotLengthMask(key))
+	return append(payload, ciphertext...), nil
+}
+
+// fillSlot writes payload to the region of img a bit at a time, followed by random bits up to the end of the
+// region, and returns ErrCapacityExceeded if it doesn't fit
+func fillSlot(img *image.NRGBA, region *slotRegion, payload []byte, rng *rand.Rand, strategy Strategy) error {
+	written := 0
+	for {
+		pixel, channel, bit, ok := region.next()
+		if !ok {
+			break
+		}
+
+		value := rng.Intn(2)
+		if written < len(payload)*8 {
+			value = int(payload[written/8]>>uint(7-written%8)) & 1
+		}
+		written++
+
+		offset := slotPixelOffset(img, pixel)
+		img.Pix[offset+channel] = strategy.Embed(img.Pix[offset+channel], bit, value, rng)
+	}
+
+	if written < len(payload)*8 {
+		return ErrCapacityExceeded
+	}
+	return nil
+}
+
+// slotPixelOffset returns the offset in Pix of the pixel of img with index y*width+x
+func slotPixelOffset(img *image.NRGBA, pixel int) int {
+	bounds := img.Bounds()
+	return img.PixOffset(bounds.Min.X+pixel%bounds.Dx(), bounds.Min.Y+pixel/bounds.Dx())
+}
+
+// RevealSlot reveals the message in the slot of img, split into numSlots slots, that the passphrase opens, along
+// with its metadata. Every slot is tried, so the passphrase doesn't need to say which. It returns
+// ErrWrongPassphrase if none of them opens, and ErrExpired for a message that has expired unless
+// WithIgnoreExpiry is given.
+func RevealSlot(img image.Image, numSlots int, passphrase string, opts ...Option) ([]byte, *Metadata, error) {
+	options := makeOptions(opts)
+
+	if numSlots < 1 || numSlots > maxSlots {
+		return nil, nil, errors.New("an image has between 1 and 64 slots")
+	}
+	if passphrase == "" {
+		return nil, nil, ErrPassphraseRequired
+	}
+
+	key, err := newSecret(passphrase, options.Secure)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer key.destroy()
+
+	pixels, err := copyImage(options.Context, img, options.Progress)
+	if err != nil {
+		return nil, nil, err
+	}
+	width, height := pixels.Bounds().Dx(), pixels.Bounds().Dy()
+
+	for i := 0; i < numSlots; i++ {
+		region := newSlotRegion(width, height, numSlots, i, key, options)
+
+		lengthBytes, ok := readSlot(pixels, region, slotLengthBits/8, options.Strategy)
+		if !ok {
+			continue
+		}
+		length := int(binary.BigEndian.Uint32(lengthBytes) ^ slotLengthMask(key))
+
+		// A slot the passphrase doesn't open gives a random length, which is almost always too long
+		if length < encryptionOverhead || length > SlotCapacity(width, height, numSlots, opts...)+encryptionOverhead {
+			continue
+		}
+
+		ciphertext, ok := readSlot(pixels, region, length, options.Strategy)
+		if !ok {
+			continue
+		}
+
+		plaintext, err := decrypt(ciphertext, key)
+		if err != nil {
+			continue
+		}
+		defer zeroBytes(plaintext)
+
+		options.Logger.Println("Opened slot", i+1, "of", numSlots)
+		return splitMetadata(plaintext, options.IgnoreExpiry)
+	}
+
+	return nil, nil, ErrWrongPassphrase
+}
+
+// readSlot reads the next size bytes of a slot, or returns false if the slot ends first
+func readSlot(img *image.NRGBA, region *slotRegion, size int, strategy Strategy) ([]byte, bool) {
+	data := make([]byte, size)
+
+	for i := 0; i < size*8; i++ {
+		pixel, channel, bit, ok := region.next()
+		if !ok {
+			return nil, false
+		}
+
+		offset := slotPixelOffset(img, pixel)
+		data[i/8] |= uint8(strategy.Extract(img.Pix[offset+channel], bit) << uint(7-i%8))
+	}
+
+	return data, true
+}
@@ -0,0 +1,128 @@
+package stego
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// TestSlotRegionsDontSharePixels checks that the slots of an image between them hold every bit of every pixel
+// exactly once, so that no slot can overwrite another
+func TestSlotRegionsDontSharePixels(t *testing.T) {
+	width, height := 13, 11
+	options := makeOptions([]Option{WithBitsPerChannel(2), WithChannels(3)})
+
+	for _, numSlots := range []int{1, 2, 3, 7, 64} {
+		t.Run(fmt.Sprint(numSlots, " slots"), func(t *testing.T) {
+			seen := map[[3]int]bool{}
+
+			for i := 0; i < numSlots; i++ {
+				// The slots after the first one are left unused, like those without a message
+				var key *secret
+				if i == 0 {
+					var err error
+					if key, err = newSecret("passphrase", false); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				region := newSlotRegion(width, height, numSlots, i, key, options)
+				key.destroy()
+
+				for {
+					pixel, channel, bit, ok := region.next()
+					if !ok {
+						break
+					}
+
+					if pixel%numSlots != i {
+						t.Fatalf("slot %d holds pixel %d", i, pixel)
+					}
+
+					position := [3]int{pixel, channel, bit}
+					if seen[position] {
+						t.Fatalf("bit %d of channel %d of pixel %d is held twice", bit, channel, pixel)
+					}
+					seen[position] = true
+				}
+			}
+
+			if want := width * height * options.NumChannels * options.NumBitsPerChannel; len(seen) != want {
+				t.Errorf("slots hold %d bits, want %d", len(seen), want)
+			}
+		})
+	}
+}
+
+// TestRevealSlot conceals messages in some of the slots of an image, and checks that each passphrase only
+// reveals its own message
+func TestRevealSlot(t *testing.T) {
+	cover := noiseImage(64, 48, 9)
+	slots := []Slot{
+		{Passphrase: "first", Message: []byte("the first message")},
+		{Passphrase: "second", Message: []byte("the second message"), Metadata: &Metadata{Name: "second.txt"}},
+		{Passphrase: "third", Message: randomMessage(200, 10)},
+	}
+
+	img, err := ConcealSlots(cover, 5, slots, WithBitsPerChannel(2))
+	if err != nil {
+		t.Fatalf("conceal: %v", err)
+	}
+
+	for _, slot := range slots {
+		message, metadata, err := RevealSlot(img, 5, slot.Passphrase, WithBitsPerChannel(2))
+		if err != nil {
+			t.Fatalf("reveal %s: %v", slot.Passphrase, err)
+		}
+
+		if !bytes.Equal(message, slot.Message) {
+			t.Errorf("%s revealed %q, want %q", slot.Passphrase, message, slot.Message)
+		}
+
+		if slot.Metadata != nil && (metadata == nil || metadata.Name != slot.Metadata.Name) {
+			t.Errorf("%s revealed metadata %+v, want %+v", slot.Passphrase, metadata, slot.Metadata)
+		}
+	}
+
+	if _, _, err := RevealSlot(img, 5, "fourth", WithBitsPerChannel(2)); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("an unused passphrase returned %v, want %v", err, ErrWrongPassphrase)
+	}
+
+	if _, _, err := RevealSlot(img, 5, "", WithBitsPerChannel(2)); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("no passphrase returned %v, want %v", err, ErrPassphraseRequired)
+	}
+}
+
+// TestSlotCapacity fills every slot of an image whose slots have different numbers of pixels with as many
+// bytes as SlotCapacity allows, and checks that a byte more doesn't fit
+func TestSlotCapacity(t *testing.T) {
+	width, height, numSlots := 31, 17, 3
+	cover := noiseImage(width, height, 11)
+	capacity := SlotCapacity(width, height, numSlots)
+
+	var slots []Slot
+	for i := 0; i < numSlots; i++ {
+		slots = append(slots, Slot{Passphrase: fmt.Sprint("passphrase ", i), Message: randomMessage(capacity, int64(i))})
+	}
+
+	img, err := ConcealSlots(cover, numSlots, slots)
+	if err != nil {
+		t.Fatalf("conceal %d bytes in every slot: %v", capacity, err)
+	}
+
+	for _, slot := range slots {
+		message, _, err := RevealSlot(img, numSlots, slot.Passphrase)
+		if err != nil {
+			t.Fatalf("reveal %s: %v", slot.Passphrase, err)
+		}
+		if !bytes.Equal(message, slot.Message) {
+			t.Errorf("%s revealed a different message", slot.Passphrase)
+		}
+	}
+
+	slots[numSlots-1].Message = randomMessage(capacity+1, 12)
+	if _, err := ConcealSlots(cover, numSlots, slots); !errors.Is(err, ErrCapacityExceeded) {
+		t.Errorf("conceal %d bytes in the last slot returned %v, want %v", capacity+1, err, ErrCapacityExceeded)
+	}
+}
@@ -0,0 +1,104 @@
+package stego
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"image"
+	"io"
+	"time"
+)
+
+// Conceal hides message in the image at imagePath and saves the result as a PNG to outputPath
+func Conceal(imagePath string, message []byte, outputPath string, opts ...Option) error {
+	img, err := LoadImage(imagePath)
+
+	if err != nil {
+		return err
+	}
+
+	outputImage, err := ConcealImage(img, bytes.NewReader(message), opts...)
+	if err != nil {
+		return err
+	}
+
+	if err := SaveImage(outputPath, outputImage, opts...); err != nil {
+		return err
+	}
+
+	makeOptions(opts).Logger.Println("Encoded message into the image")
+
+	return nil
+}
+
+// Reveal extracts the message hidden in the image at imagePath
+func Reveal(imagePath string, opts ...Option) ([]byte, RevealResult, error) {
+	img, err := LoadImage(imagePath)
+
+	if err != nil {
+		return nil, RevealResult{}, err
+	}
+
+	var message bytes.Buffer
+
+	result, err := RevealImage(img, &message, opts...)
+	if err != nil {
+		return nil, result, err
+	}
+
+	return message.Bytes(), result, nil
+}
+
+// ConcealImage hides everything read from message in a copy of img and returns the copy. Nothing is read
+// from or written to the filesystem unless a key path is used.
+func ConcealImage(img image.Image, message io.Reader, opts ...Option) (*image.NRGBA, error) {
+	encoder, err := NewEncoder(img, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := copyPipelined(encoder, message); err != nil {
+		encoder.Close()
+		return nil, err
+	}
+
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return encoder.Image(), nil
+}
+
+// RevealImage extracts the message hidden in img, writes it to w and describes what was extracted
+func RevealImage(img image.Image, w io.Writer, opts ...Option) (RevealResult, error) {
+	start := time.Now()
+
+	decoder, err := NewDecoder(img, opts...)
+	if err != nil {
+		return RevealResult{}, err
+	}
+	defer decoder.Close()
+
+	// A writer that can grow, like the buffer of Reveal, is grown to fit the message up front rather than as
+	// the message is written to it
+	if growable, ok := w.(interface{ Grow(int) }); ok {
+		growable.Grow(decoder.EmbeddedSize())
+	}
+
+	checksum := sha256.New()
+	size, err := decoder.WriteTo(io.MultiWriter(w, checksum))
+
+	result := RevealResult{
+		Header:    decoder.Header(),
+		Encrypted: decoder.Encrypted(),
+		Size:      int(size),
+		Duration:  time.Since(start),
+		Verified:  decoder.Verified(),
+		Damage:    decoder.Damage(),
+	}
+	copy(result.Checksum[:], checksum.Sum(nil))
+
+	// The metadata has already been read by the first Read
+	result.Metadata, _ = decoder.Metadata()
+
+	return result, err
+}
@@ -0,0 +1,151 @@
+package stego
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// strategyIDSize is the number of bits used to store the strategy's header ID
+const strategyIDSize = 8
+
+// Strategy decides how the bits of a message are embedded into and extracted from channel values. Strategies
+// are selected by name when concealing, and by the ID stored in the header when revealing. A strategy can be
+// used by several calls at once, so it must not keep any state of its own.
+type Strategy interface {
+	// Name identifies the strategy on the command line
+	Name() string
+
+	// HeaderID identifies the strategy in the header and must fit in strategyIDSize bits
+	HeaderID() int
+
+	// Embed returns value with the bit at bitIndex changed to bit. rng is used by strategies that make random
+	// choices.
+	Embed(value uint8, bitIndex int, bit int, rng *rand.Rand) uint8
+
+	// Extract returns the bit at bitIndex of value
+	Extract(value uint8, bitIndex int) int
+
+	// Capacity returns the number of bits the strategy can hide in numPixels pixels
+	Capacity(numPixels int, numChannels int, numBitsPerChannel int) int
+}
+
+var (
+	strategiesLock sync.RWMutex
+	strategies     = map[string]Strategy{}
+)
+
+func init() {
+	RegisterStrategy(lsbStrategy{})
+	RegisterStrategy(lsbMatchingStrategy{})
+}
+
+// RegisterStrategy makes strategy available to Conceal and Reveal. Its name and header ID must not be used by
+// a strategy that is already registered.
+func RegisterStrategy(strategy Strategy) error {
+	strategiesLock.Lock()
+	defer strategiesLock.Unlock()
+
+	if strategy.HeaderID() < 0 || strategy.HeaderID() >= 1<<strategyIDSize {
+		return errors.New("strategy header ID does not fit in the header")
+	}
+
+	for _, registered := range strategies {
+		if registered.Name() == strategy.Name() || registered.HeaderID() == strategy.HeaderID() {
+			return errors.New("a strategy with the same name or header ID is already registered")
+		}
+	}
+
+	strategies[strategy.Name()] = strategy
+	return nil
+}
+
+// LookupStrategy returns the registered strategy called name
+func LookupStrategy(name string) (Strategy, bool) {
+	strategiesLock.RLock()
+	defer strategiesLock.RUnlock()
+
+	strategy, ok := strategies[name]
+	return strategy, ok
+}
+
+// Strategies returns every registered strategy, ordered by header ID
+func Strategies() []Strategy {
+	strategiesLock.RLock()
+	defer strategiesLock.RUnlock()
+
+	registered := make([]Strategy, 0, len(strategies))
+	for _, strategy := range strategies {
+		registered = append(registered, strategy)
+	}
+
+	sort.Slice(registered, func(i, j int) bool {
+		return registered[i].HeaderID() < registered[j].HeaderID()
+	})
+
+	return registered
+}
+
+// StrategyNames returns the names of every registered strategy, ordered by header ID
+func StrategyNames() []string {
+	var names []string
+	for _, strategy := range Strategies() {
+		names = append(names, strategy.Name())
+	}
+	return names
+}
+
+func strategyByHeaderID(id int) (Strategy, bool) {
+	for _, strategy := range Strategies() {
+		if strategy.HeaderID() == id {
+			return strategy, true
+		}
+	}
+	return nil, false
+}
+
+// lsbStrategy replaces the bits of each channel value with the bits of the message
+type lsbStrategy struct{}
+
+func (lsbStrategy) Name() string {
+	return "lsb"
+}
+
+func (lsbStrategy) HeaderID() int {
+	return 0
+}
+
+func (lsbStrategy) Embed(value uint8, bitIndex int, bit int, rng *rand.Rand) uint8 {
+	if bit == 0 {
+		return clearBitUint8(value, bitIndex)
+	}
+	return setBitUint8(value, bitIndex)
+}
+
+func (lsbStrategy) Extract(value uint8, bitIndex int) int {
+	return getBitUint8(value, bitIndex)
+}
+
+func (lsbStrategy) Capacity(numPixels int, numChannels int, numBitsPerChannel int) int {
+	return numBitsAvailable(numPixels, 1, numChannels, numBitsPerChannel)
+}
+
+// lsbMatchingStrategy randomly adds or subtracts 2^bitIndex from a channel value whose bit doesn't match the
+// message instead of overwriting the bit. This avoids the pairs of values that LSB replacement leaves in the
+// histogram, which is what simple steganalysis looks for.
+type lsbMatchingStrategy struct {
+	lsbStrategy
+}
+
+func (lsbMatchingStrategy) Name() string {
+	return "lsb-matching"
+}
+
+func (lsbMatchingStrategy) HeaderID() int {
+	return 1
+}
+
+func (lsbMatchingStrategy) Embed(value uint8, bitIndex int, bit int, rng *rand.Rand) uint8 {
+	return matchBitUint8(value, bitIndex, bit, rng)
+}
@@ -0,0 +1,835 @@
+package stego
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash"
+	"image"
+	"io"
+	"math/rand"
+	"time"
+)
+
+// Encoder conceals everything written to it in a copy of a cover image. The header can only be written once
+// the length of the message is known, so it is written by Close, after which the stego image is available
+// from Image.
+type Encoder struct {
+	options           Options
+	key               *secret
+	outputImage       *image.NRGBA
+	stepper           *ImageStepper
+	rng               *rand.Rand
+	plaintext         []byte
+	checksum          hash.Hash
+	numMessageBits    int
+	numBitsAvailable  int
+	numBitsForMessage int
+	closed            bool
+}
+
+// NewEncoder returns an Encoder that conceals a message in a copy of cover
+func NewEncoder(cover image.Image, opts ...Option) (*Encoder, error) {
+	options := makeOptions(opts)
+
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	if options.KeyPath != "" {
+		return nil, errors.New("PGP encryption not yet implemented")
+	}
+
+	width := cover.Bounds().Max.X
+	height := cover.Bounds().Max.Y
+
+	if width+height < 2 {
+		return nil, errors.New("image must have at least 2 pixels")
+	}
+
+	outputImage, err := copyImage(options.Context, cover, options.Progress)
+	if err != nil {
+		return nil, err
+	}
+
+	rng, err := newRand(options.Random)
+	if err != nil {
+		return nil, err
+	}
+
+	// The plan is made before the key is derived, so that a cover that can't be planned doesn't leave the key
+	// behind
+	plan, err := PlanConceal(width, height, 0, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := newSecret(options.Passphrase, options.Secure)
+	if err != nil {
+		return nil, err
+	}
+
+	self := &Encoder{
+		options:           options,
+		key:               key,
+		outputImage:       outputImage,
+		rng:               rng,
+		checksum:          sha256.New(),
+		numBitsAvailable:  options.Strategy.Capacity(width*height, options.NumChannels, options.NumBitsPerChannel),
+		numBitsForMessage: plan.CapacityBits,
+	}
+
+	options.Logger.Println("Width:", width, "Height:", height)
+	options.Logger.Println("Total bits in image:", numBitsAvailable(width, height, 4, 8))
+	options.Logger.Println("Total bits available for use:", self.numBitsAvailable)
+
+	// The header has a fixed size, so a plain message is written as it arrives, right after the space reserved
+	// for the header. An encrypted message is sealed as a whole and a compressed one compressed as a whole, so
+	// they are buffered until Close.
+	if !self.buffered() {
+		options.Progress.OnStart("concealing", -1)
+
+		self.stepper = self.makeStepper()
+	}
+
+	if options.Metadata != nil {
+		prefix, err := options.Metadata.encode()
+		if err != nil {
+			key.destroy()
+			return nil, err
+		}
+
+		if _, err := self.Write(prefix); err != nil {
+			key.destroy()
+			return nil, err
+		}
+	}
+
+	return self, nil
+}
+
+// buffered reports whether the message is held until Close, which is the case when it's encrypted or compressed
+func (self *Encoder) buffered() bool {
+	return self.key != nil || self.options.Codec != CodecNone
+}
+
+// Write conceals p in the image, or buffers it if the message is encrypted or compressed
+func (self *Encoder) Write(p []byte) (int, error) {
+	if self.closed {
+		return 0, errors.New("write to a closed encoder")
+	}
+
+	if self.buffered() {
+		// A compressed message only has to fit once it's been compressed, which Close checks
+		if self.options.Codec == CodecNone && (len(self.plaintext)+len(p)+checksumSize+encryptionOverhead)*8 > self.numBitsForMessage {
+			return 0, ErrCapacityExceeded
+		}
+
+		self.plaintext = appendSensitive(self.plaintext, p)
+		return len(p), nil
+	}
+
+	if self.numMessageBits+(len(p)+checksumSize)*8 > self.numBitsForMessage {
+		return 0, ErrCapacityExceeded
+	}
+	self.checksum.Write(p)
+
+	for i := 0; i < len(p); i += self.options.chunkSize() {
+		if err := self.options.Context.Err(); err != nil {
+			return i, err
+		}
+		self.options.Progress.OnProgress(self.numMessageBits / 8)
+
+		chunk := p[i:]
+		if len(chunk) > self.options.chunkSize() {
+			chunk = chunk[:self.options.chunkSize()]
+		}
+
+		if err := writeBytes(self.outputImage, self.stepper, self.options.Strategy, self.rng, chunk, self.options.Workers); err != nil {
+			return i, err
+		}
+		self.numMessageBits += len(chunk) * 8
+	}
+
+	self.options.Progress.OnProgress(self.numMessageBits / 8)
+
+	return len(p), nil
+}
+
+// Close writes the checksum, compresses, encrypts and writes a buffered message and then writes the header
+func (self *Encoder) Close() error {
+	if self.closed {
+		return nil
+	}
+
+	self.closed = true
+	defer self.key.destroy()
+	defer func() { zeroBytes(self.plaintext) }()
+
+	var messageBytes []byte
+
+	if !self.buffered() {
+		if err := writeBytes(self.outputImage, self.stepper, self.options.Strategy, self.rng, self.checksum.Sum(nil), 1); err != nil {
+			return err
+		}
+		self.numMessageBits += checksumSize * 8
+	} else {
+		if self.options.Codec != CodecNone {
+			compressed, err := compress(self.plaintext, self.options.Codec, self.options.CodecLevel)
+			if err != nil {
+				return err
+			}
+
+			self.options.Logger.Println("Compressed the message from", len(self.plaintext), "to", len(compressed), "bytes")
+			zeroBytes(self.plaintext)
+			self.plaintext = compressed
+		}
+
+		// The checksum covers the message as it's stored, so a compressed message is checked before it's
+		// decompressed
+		self.plaintext = appendChecksum(self.plaintext)
+		messageBytes = self.plaintext
+
+		if self.key != nil {
+			encrypted, err := encrypt(self.plaintext, self.key, self.options.Random)
+			if err != nil {
+				return err
+			}
+			messageBytes = encrypted
+		}
+		self.numMessageBits = len(messageBytes) * 8
+	}
+
+	if self.numMessageBits > self.numBitsForMessage {
+		return ErrCapacityExceeded
+	}
+
+	self.options.Logger.Println("Total bits to be written:", self.numMessageBits)
+
+	header := self.options.header(self.numMessageBits)
+
+	if header.Headerless {
+		*self.options.Headerless = header
+		self.options.Logger.Println("Left out the header, reveal with the params", header.Params())
+	} else if err := header.encode(self.outputImage, self.key, self.options.HideHeader); err != nil {
+		return err
+	} else if self.options.HideHeader {
+		self.options.Logger.Println("Encoded the hidden header")
+	} else {
+		self.options.Logger.Println("Encoded the header")
+	}
+
+	// Write a buffered message to the image
+	stepper := self.makeStepper()
+
+	if self.buffered() {
+		self.options.Progress.OnStart("concealing", len(messageBytes))
+	}
+
+	for i := 0; i < len(messageBytes); i += self.options.chunkSize() {
+		if err := self.options.Context.Err(); err != nil {
+			return err
+		}
+		self.options.Progress.OnProgress(i)
+
+		chunk := messageBytes[i:]
+		if len(chunk) > self.options.chunkSize() {
+			chunk = chunk[:self.options.chunkSize()]
+		}
+
+		if err := writeBytes(self.outputImage, stepper, self.options.Strategy, self.rng, chunk, self.options.Workers); err != nil {
+			return err
+		}
+	}
+
+	self.options.Progress.OnDone()
+	return nil
+}
+
+func (self *Encoder) makeStepper() *ImageStepper {
+	width := self.outputImage.Bounds().Max.X
+	height := self.outputImage.Bounds().Max.Y
+	return self.options.header(0).messageStepper(width, height, self.key, self.options.Traversal)
+}
+
+// Image returns the stego image. It is only complete once the encoder has been closed.
+func (self *Encoder) Image() *image.NRGBA {
+	return self.outputImage
+}
+
+// Decoder reads the message hidden in an image. A plain message is read from the image as it is requested, while
+// an encrypted or compressed message is read, decrypted and decompressed as a whole on the first call to Read or
+// Seek.
+// Every byte of an unencrypted message sits at a position that follows from its offset, so Seek jumps to any
+// offset without reading the bytes before it. Metadata in front of the message is read first, and offsets
+// start after it. The checksum at the end of the message is checked once the message has been read to the end.
+type Decoder struct {
+	options           Options
+	img               image.Image
+	key               *secret
+	header            Header
+	stepper           *ImageStepper
+	startBits         int
+	strategy          Strategy
+	numBytes          int
+	numBytesRemaining int
+	trailer           int
+	checksum          hash.Hash
+	hashed            int
+	verified          bool
+	damage            []string
+	plaintext         []byte
+	offset            int
+	decrypted         bool
+	metadata          *Metadata
+	metadataRead      bool
+	contentStart      int
+}
+
+// NewDecoder reads and authenticates the header of img and returns a Decoder for its message
+func NewDecoder(img image.Image, opts ...Option) (*Decoder, error) {
+	options := makeOptions(opts)
+
+	if options.Passphrase != "" && options.KeyPath != "" {
+		return nil, errors.New("passphrase and key-path cannot both be provided")
+	}
+
+	if options.KeyPath != "" {
+		return nil, errors.New("PGP encryption not yet implemented")
+	}
+
+	key, err := newSecret(options.Passphrase, options.Secure)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Format == FormatV1 {
+		decoder, err := newLegacyDecoder(img, key, options)
+		if err != nil {
+			key.destroy()
+		}
+		return decoder, err
+	}
+
+	header, err := readHeader(img, key, options)
+
+	// Only a passphrase can tell a message of the first format apart from noise, since its GCM tag is checked
+	if err != nil && key != nil && options.Format == FormatAuto && options.Params == nil {
+		if decoder, legacyErr := newLegacyDecoder(img, key, options); legacyErr == nil {
+			return decoder, nil
+		}
+	}
+
+	// A damaged header is used as it is when its fields still describe a message that fits
+	var damage []string
+	if err == ErrCorruptHeader && options.BestEffort && header.Strategy != nil &&
+		header.NumMessageBits <= numMessageBitsAvailable(img.Bounds().Max.X, img.Bounds().Max.Y, header.NumBitsPerChannel, header.NumChannels, header.Strategy) {
+		damage = append(damage, "the header doesn't match its tag, so the length of the message may be wrong")
+		err = nil
+	}
+
+	if err != nil {
+		key.destroy()
+		return nil, err
+	}
+
+	options.Logger.Println("Width:", img.Bounds().Max.X, "Height:", img.Bounds().Max.Y)
+	if header.FromBackup {
+		options.Logger.Println("The header is damaged, so it was read from a backup copy")
+	}
+	options.Logger.Println("Decoded number of bits to use per channel:", header.NumBitsPerChannel)
+	options.Logger.Println("Decoded number of channels:", header.NumChannels)
+	options.Logger.Println("Decoded strategy:", header.Strategy.Name())
+	options.Logger.Println("Decoded number of bits used to encode the message:", header.NumMessageBits)
+
+	stepper, numBits, err := findPayload(img, header, key, options.Traversal, options.Payload)
+	if err != nil {
+		key.destroy()
+		return nil, err
+	}
+
+	// The trailer of an encrypted message is sealed along with it, so it's only split off once decrypted
+	numBytes := numBits / 8
+	trailer := 0
+	if key == nil {
+		trailer = header.trailerSize()
+	}
+
+	if numBytes < trailer {
+		key.destroy()
+		return nil, ErrCorruptPayload
+	}
+
+	options.Progress.OnStart("revealing", numBytes-trailer)
+
+	return &Decoder{
+		options:           options,
+		img:               img,
+		key:               key,
+		header:            header,
+		stepper:           stepper,
+		startBits:         stepper.numBitsWritten,
+		strategy:          header.Strategy,
+		numBytes:          numBytes - trailer,
+		numBytesRemaining: numBytes - trailer,
+		trailer:           trailer,
+		checksum:          sha256.New(),
+		damage:            damage,
+	}, nil
+}
+
+// newLegacyDecoder returns a Decoder for a message of the first format, which is read and decrypted as a whole
+// right away. The first format holds a single payload.
+func newLegacyDecoder(img image.Image, key *secret, options Options) (*Decoder, error) {
+	if options.Payload > 0 {
+		return nil, ErrNotStegoImage
+	}
+
+	options.Progress.OnStart("revealing", -1)
+
+	header, plaintext, err := decodeLegacy(img, key)
+	if err != nil {
+		return nil, err
+	}
+
+	options.Progress.OnDone()
+	options.Logger.Println("Decoded a message of the first format")
+	options.Logger.Println("Decoded number of bits to use per channel:", header.NumBitsPerChannel)
+	options.Logger.Println("Decoded number of channels:", header.NumChannels)
+	options.Logger.Println("Decoded number of bits used to encode the message:", header.NumMessageBits)
+
+	return &Decoder{
+		options:   options,
+		img:       img,
+		key:       key,
+		header:    header,
+		strategy:  header.Strategy,
+		numBytes:  header.NumMessageBits / 8,
+		plaintext: plaintext,
+		decrypted: true,
+	}, nil
+}
+
+// Header returns the header decoded from the image
+func (self *Decoder) Header() Header {
+	return self.header
+}
+
+// EmbeddedSize returns the number of bytes embedded for the message, including the metadata, the checksum and
+// the overhead of the encryption
+func (self *Decoder) EmbeddedSize() int {
+	return self.numBytes + self.trailer
+}
+
+// Verified reports whether the message has been read to the end and matched the checksum stored with it.
+// Messages concealed before checksums were stored are never verified.
+func (self *Decoder) Verified() bool {
+	return self.verified
+}
+
+// Damage lists what was found to be wrong with a message read with WithBestEffort so far. Nothing in the image
+// tells where a message was damaged, so each entry covers the whole message.
+func (self *Decoder) Damage() []Damage {
+	var damage []Damage
+	for _, reason := range self.damage {
+		damage = append(damage, Damage{Start: 0, End: self.size() - self.contentStart, Reason: reason})
+	}
+	return damage
+}
+
+// damaged records reason as damage to the message with WithBestEffort, and otherwise returns ErrCorruptPayload
+func (self *Decoder) damaged(reason string) error {
+	if !self.options.BestEffort {
+		return ErrCorruptPayload
+	}
+
+	// The trailer is checked again each time the end of the message is read
+	for _, recorded := range self.damage {
+		if recorded == reason {
+			return nil
+		}
+	}
+
+	self.options.Logger.Println("Damage:", reason)
+	self.damage = append(self.damage, reason)
+	return nil
+}
+
+// Encrypted reports whether the message is encrypted, which is the case whenever it was revealed with a passphrase
+func (self *Decoder) Encrypted() bool {
+	return self.key != nil
+}
+
+// Metadata returns the metadata written in front of the message, or nil if there is none
+func (self *Decoder) Metadata() (*Metadata, error) {
+	if err := self.readMetadata(); err != nil {
+		return nil, err
+	}
+	return self.metadata, nil
+}
+
+// Read reads the next bytes of the message into p
+func (self *Decoder) Read(p []byte) (int, error) {
+	if err := self.readContent(); err != nil {
+		return 0, err
+	}
+	return self.read(p)
+}
+
+// WriteTo writes the rest of the message to w. A decrypted message is written to w straight from where it was
+// decrypted, while an unencrypted one is extracted a chunk at a time as the previous chunk is written.
+func (self *Decoder) WriteTo(w io.Writer) (int64, error) {
+	if err := self.readContent(); err != nil {
+		return 0, err
+	}
+
+	if !self.decrypted {
+		return copyPipelined(w, decoderReader{self})
+	}
+
+	n, err := w.Write(self.plaintext[self.offset:])
+	self.offset += n
+
+	if err == nil && self.offset < len(self.plaintext) {
+		err = io.ErrShortWrite
+	}
+	return int64(n), err
+}
+
+// decoderReader hides the WriteTo of a Decoder so that it can be read with Read alone
+type decoderReader struct {
+	decoder *Decoder
+}
+
+func (self decoderReader) Read(p []byte) (int, error) {
+	return self.decoder.Read(p)
+}
+
+// Seek sets the offset in the message of the next Read. Seeking backwards in an unencrypted message starts the
+// traversal over, which for a keyed traversal means generating the permutation again.
+func (self *Decoder) Seek(offset int64, whence int) (int64, error) {
+	if err := self.readMetadata(); err != nil {
+		return 0, err
+	}
+
+	size := int64(self.size() - self.contentStart)
+	current := int64(self.position() - self.contentStart)
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += current
+	case io.SeekEnd:
+		offset += size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if offset > size {
+		offset = size
+	}
+
+	if err := self.seek(self.contentStart + int(offset)); err != nil {
+		return 0, err
+	}
+
+	return offset, nil
+}
+
+// readContent reads the metadata in front of the message and returns ErrExpired if it says the message has
+// expired, unless expiry is ignored. Seeking doesn't reveal any of the message, so only reading checks it.
+func (self *Decoder) readContent() error {
+	if err := self.readMetadata(); err != nil {
+		return err
+	}
+
+	if self.metadata != nil && !self.options.IgnoreExpiry && self.metadata.Expired(time.Now()) {
+		return ErrExpired
+	}
+	return nil
+}
+
+// readMetadata reads the metadata in front of the message, if there is any, so that reading and seeking start
+// right after it
+func (self *Decoder) readMetadata() error {
+	if self.metadataRead {
+		return nil
+	}
+	self.metadataRead = true
+
+	if (self.key != nil || self.header.Codec != CodecNone) && !self.decrypted {
+		if err := self.load(); err != nil {
+			return err
+		}
+	}
+
+	prefix := make([]byte, len(metadataMagic)+4)
+	if self.size() < len(prefix) {
+		return nil
+	}
+
+	if err := self.readFull(prefix); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(prefix[:len(metadataMagic)], metadataMagic) {
+		return self.seek(0)
+	}
+
+	// Damaged metadata is revealed as part of the message with WithBestEffort
+	length := int(binary.BigEndian.Uint32(prefix[len(metadataMagic):]))
+	if length > maxMetadataSize || length > self.size()-len(prefix) {
+		if err := self.damaged("the metadata is damaged"); err != nil {
+			return err
+		}
+		return self.seek(0)
+	}
+
+	data := make([]byte, length)
+	if err := self.readFull(data); err != nil {
+		return err
+	}
+
+	metadata := &Metadata{}
+	err := json.Unmarshal(data, metadata)
+	if err == nil {
+		err = metadata.validateDecoded(self.size() - len(prefix) - length)
+	}
+	if err != nil {
+		if err := self.damaged("the metadata is damaged"); err != nil {
+			return err
+		}
+		return self.seek(0)
+	}
+
+	self.metadata = metadata
+	self.contentStart = len(prefix) + length
+	return nil
+}
+
+// size returns the size of the message including the metadata
+func (self *Decoder) size() int {
+	if self.decrypted {
+		return len(self.plaintext)
+	}
+	return self.numBytes
+}
+
+// position returns the offset of the next byte read from the message including the metadata
+func (self *Decoder) position() int {
+	if self.decrypted {
+		return self.offset
+	}
+	return self.numBytes - self.numBytesRemaining
+}
+
+// readFull reads exactly len(p) bytes of the message into p
+func (self *Decoder) readFull(p []byte) error {
+	for n := 0; n < len(p); {
+		read, err := self.read(p[n:])
+		n += read
+
+		if err != nil && n < len(p) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (self *Decoder) read(p []byte) (int, error) {
+	if self.decrypted {
+		n := copy(p, self.plaintext[self.offset:])
+		self.offset += n
+
+		if self.offset == len(self.plaintext) {
+			return n, io.EOF
+		}
+		return n, nil
+	}
+
+	if self.numBytesRemaining == 0 {
+		return 0, io.EOF
+	}
+
+	if len(p) > self.numBytesRemaining {
+		p = p[:self.numBytesRemaining]
+	}
+
+	n := 0
+
+	for n < len(p) {
+		if err := self.options.Context.Err(); err != nil {
+			return n, err
+		}
+		self.options.Progress.OnProgress(self.numBytes - self.numBytesRemaining)
+
+		chunk := p[n:]
+		if len(chunk) > self.options.chunkSize() {
+			chunk = chunk[:self.options.chunkSize()]
+		}
+
+		if err := readBytes(self.img, self.stepper, self.strategy, chunk, self.options.Workers); err != nil {
+			return n, err
+		}
+
+		// Only what follows on from the bytes hashed so far is hashed, so seeking doesn't break the checksum
+		position := self.numBytes - self.numBytesRemaining
+		if self.trailer > 0 && position <= self.hashed && position+len(chunk) > self.hashed {
+			self.checksum.Write(chunk[self.hashed-position:])
+			self.hashed = position + len(chunk)
+		}
+
+		n += len(chunk)
+		self.numBytesRemaining -= len(chunk)
+	}
+
+	if self.numBytesRemaining == 0 {
+		self.options.Progress.OnDone()
+
+		if err := self.verify(); err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// verify reads the trailer right after the message and checks it against the message, if the whole message has
+// been hashed
+func (self *Decoder) verify() error {
+	if self.trailer == 0 || self.verified || self.hashed < self.numBytes {
+		return nil
+	}
+
+	sum := make([]byte, self.trailer)
+	if err := readBytes(self.img, self.stepper, self.strategy, sum, 1); err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare(sum, self.checksum.Sum(nil)) == 0 {
+		return self.damaged("the message doesn't match its checksum")
+	}
+
+	self.verified = true
+	return nil
+}
+
+// seek moves to offset in the message including the metadata
+func (self *Decoder) seek(offset int) error {
+	if self.decrypted {
+		self.offset = offset
+		return nil
+	}
+
+	current := self.position()
+
+	if offset < current {
+		width := self.img.Bounds().Max.X
+		height := self.img.Bounds().Max.Y
+		self.stepper = self.header.messageStepper(width, height, self.key, self.options.Traversal)
+
+		if err := self.stepper.skipBits(self.startBits); err != nil {
+			return err
+		}
+		current = 0
+	}
+
+	if err := self.stepper.skipBits((offset - current) * 8); err != nil {
+		return err
+	}
+
+	self.numBytesRemaining = self.numBytes - offset
+	return nil
+}
+
+// Close wipes the key and any decrypted message that hasn't been read yet
+func (self *Decoder) Close() error {
+	zeroBytes(self.plaintext)
+	self.key.destroy()
+	return nil
+}
+
+// load reads the whole message from the image, and decrypts and decompresses it. The checksum of an unencrypted
+// message is checked as it's read, and that of an encrypted one once it's been decrypted.
+func (self *Decoder) load() error {
+	messageBytes := make([]byte, self.numBytesRemaining)
+
+	if err := self.readFull(messageBytes); err != nil {
+		zeroBytes(messageBytes)
+		return err
+	}
+
+	plaintext := messageBytes
+	if self.key != nil {
+		var err error
+		if plaintext, err = self.decrypt(messageBytes); err != nil {
+			zeroBytes(messageBytes)
+			return err
+		}
+	}
+
+	if self.header.Codec != CodecNone {
+		self.options.Logger.Println("Decompressing message")
+
+		decompressed, err := decompress(plaintext, self.header.Codec)
+		zeroBytes(messageBytes)
+		if err != nil {
+			if err = self.damaged("the message can't be decompressed past some point"); err != nil {
+				zeroBytes(decompressed)
+				return err
+			}
+		}
+		plaintext = decompressed
+	}
+
+	self.plaintext = plaintext
+	self.numBytesRemaining = 0
+	self.decrypted = true
+	self.key.destroy()
+	return nil
+}
+
+// decrypt decrypts messageBytes in place and splits the checksum off the plaintext
+func (self *Decoder) decrypt(messageBytes []byte) ([]byte, error) {
+	self.options.Logger.Println("Decrypting message")
+
+	// A failed decryption overwrites the ciphertext, so it's kept to be decrypted again without authentication
+	var ciphertext []byte
+	if self.options.BestEffort {
+		ciphertext = append([]byte(nil), messageBytes...)
+	}
+
+	// The message is decrypted where it was read, so the plaintext is never copied
+	plaintext, err := decrypt(messageBytes, self.key)
+	if err != nil && self.options.BestEffort {
+		copy(messageBytes, ciphertext)
+		if plaintext, err = decryptUnauthenticated(messageBytes, self.key); err == nil {
+			err = self.damaged("the message failed authentication, or the passphrase is wrong")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if self.header.trailerSize() > 0 {
+		message, err := splitChecksum(plaintext)
+		if err == nil {
+			self.verified = true
+		} else if err = self.damaged("the message doesn't match its checksum"); err != nil {
+			return nil, err
+		} else if len(plaintext) >= checksumSize {
+			message = plaintext[:len(plaintext)-checksumSize]
+		} else {
+			message = plaintext
+		}
+		plaintext = message
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,465 @@
+package stego
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"image"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// ConcealImage and RevealImage work on a whole decoded image, and concealing makes a copy of it on top. The
+// tiled functions instead decode, process and encode the image a band of rows at a time, so that covers of
+// hundreds of megapixels only take a band's worth of memory. Bands follow the rows of the image, so the
+// message is always laid out with the linear traversal.
+
+// tileSize is about the number of bytes of pixels the tiled functions hold in memory at once
+const tileSize = 1 << 22
+
+// bandHeight returns the number of rows in each band of a width by height image. The header is read and
+// written in one go, so the first band holds every pixel the header could take up.
+func bandHeight(width int, height int) int {
+	rows := tileSize / (4 * width)
+
+	// The header takes up the most pixels with a single bit of a single channel per pixel
+	if headerRows := (2+numHeaderBits)/width + 1; rows < headerRows {
+		rows = headerRows
+	}
+
+	if rows > height {
+		rows = height
+	}
+	return rows
+}
+
+// tiledImage reads the bands of a PNG into a single buffer, so that only one band is in memory at a time
+type tiledImage struct {
+	reader *pngRowReader
+	width  int
+	height int
+	rows   int
+	buffer []uint8
+}
+
+func newTiledImage(r io.Reader) (*tiledImage, error) {
+	reader, err := newPNGRowReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if reader.width*reader.height < 2 {
+		return nil, errors.New("image must have at least 2 pixels")
+	}
+
+	rows := bandHeight(reader.width, reader.height)
+
+	return &tiledImage{
+		reader: reader,
+		width:  reader.width,
+		height: reader.height,
+		rows:   rows,
+		buffer: make([]uint8, rows*4*reader.width),
+	}, nil
+}
+
+// readBand reads the rows from y0 onwards into a band whose pixels have the coordinates of the whole image
+func (self *tiledImage) readBand(y0 int) (*image.NRGBA, error) {
+	y1 := y0 + self.rows
+	if y1 > self.height {
+		y1 = self.height
+	}
+
+	stride := 4 * self.width
+	band := &image.NRGBA{Pix: self.buffer[:(y1-y0)*stride], Stride: stride, Rect: image.Rect(0, y0, self.width, y1)}
+
+	for y := y0; y < y1; y++ {
+		if err := self.reader.readRow(band.Pix[(y-y0)*stride : (y-y0+1)*stride]); err != nil {
+			return nil, err
+		}
+	}
+
+	return band, nil
+}
+
+// header returns the first band as an image with the bounds of the whole image, which is what the header is
+// read and written with. The header only touches pixels of the first band.
+func (self *tiledImage) header(band *image.NRGBA) *image.NRGBA {
+	return &image.NRGBA{Pix: band.Pix, Stride: band.Stride, Rect: image.Rect(0, 0, self.width, self.height)}
+}
+
+// CheckTiled returns ErrNotTileable unless the PNG read from r can be processed by ConcealTiled and RevealTiled.
+// Only the chunks in front of the image data are read.
+func CheckTiled(r io.Reader) error {
+	_, err := newPNGRowReader(r)
+	return err
+}
+
+// ConcealTiled conceals everything read from message in the PNG read from r and writes the stego image to w
+// as a PNG, a band of rows at a time. Only 8-bit non-interlaced PNGs are supported, and the message is always
+// laid out with the linear traversal, whatever WithTraversal says. The message itself is held in memory.
+func ConcealTiled(r io.Reader, w io.Writer, message io.Reader, opts ...Option) error {
+	options := makeOptions(opts)
+
+	if err := options.validate(); err != nil {
+		return err
+	}
+
+	if options.KeyPath != "" {
+		return errors.New("PGP encryption not yet implemented")
+	}
+
+	if options.Headerless != nil {
+		return errors.New("a headerless image can't be concealed in tiles")
+	}
+
+	tiles, err := newTiledImage(r)
+	if err != nil {
+		return err
+	}
+
+	// The random is read in the same order as ConcealImage reads it, so both give the same image
+	rng, err := newRand(options.Random)
+	if err != nil {
+		return err
+	}
+
+	key, err := newSecret(options.Passphrase, options.Secure)
+	if err != nil {
+		return err
+	}
+	defer key.destroy()
+
+	messageBytes, err := ioutil.ReadAll(message)
+	if err != nil {
+		return err
+	}
+	defer func() { zeroBytes(messageBytes) }()
+
+	if options.Metadata != nil {
+		prefix, err := options.Metadata.encode()
+		if err != nil {
+			return err
+		}
+		withPrefix := append(prefix, messageBytes...)
+		zeroBytes(messageBytes)
+		messageBytes = withPrefix
+	}
+
+	if options.Codec != CodecNone {
+		compressed, err := compress(messageBytes, options.Codec, options.CodecLevel)
+		if err != nil {
+			return err
+		}
+		zeroBytes(messageBytes)
+		messageBytes = compressed
+	}
+
+	messageBytes = appendChecksum(messageBytes)
+
+	if key != nil {
+		encrypted, err := encrypt(messageBytes, key, options.Random)
+		if err != nil {
+			return err
+		}
+		zeroBytes(messageBytes)
+		messageBytes = encrypted
+	}
+
+	width, height := tiles.width, tiles.height
+	numBits := len(messageBytes) * 8
+
+	if numBits > numMessageBitsAvailable(width, height, options.NumBitsPerChannel, options.NumChannels, options.Strategy) {
+		return ErrCapacityExceeded
+	}
+
+	header := Header{
+		Version:           headerVersion,
+		NumBitsPerChannel: options.NumBitsPerChannel,
+		NumChannels:       options.NumChannels,
+		Strategy:          options.Strategy,
+		NumMessageBits:    numBits,
+		Encryption:        encryptionOf(key),
+		Codec:             options.Codec,
+	}
+
+	writer, err := newPNGRowWriter(w, width, height, options.Compression)
+	if err != nil {
+		return err
+	}
+
+	options.Logger.Println("Width:", width, "Height:", height, "Rows per band:", tiles.rows)
+	options.Progress.OnStart("concealing", height)
+
+	stepper := makeMessageStepper(width, height, header.NumBitsPerChannel, header.NumChannels, key, 0, LinearTraversal())
+	bit := 0
+
+	for y0 := 0; y0 < height; y0 += tiles.rows {
+		if err := options.Context.Err(); err != nil {
+			return err
+		}
+
+		band, err := tiles.readBand(y0)
+		if err != nil {
+			return err
+		}
+
+		// The backup copies of the header are near the bottom of the image, so they're written to the bands that
+		// hold them
+		if y0 == 0 {
+			if err := header.encodePrimary(tiles.header(band), key, options.HideHeader); err != nil {
+				return err
+			}
+		}
+		header.encodeBackups(band, width, height, key, options.HideHeader)
+
+		for ; bit < numBits && stepper.y < band.Rect.Max.Y; bit++ {
+			if err := writeBits(band, stepper, header.Strategy, rng, dataBit(messageBytes, bit), 1); err != nil {
+				return err
+			}
+		}
+
+		for y := 0; y < band.Rect.Dy(); y++ {
+			if err := writer.writeRow(band.Pix[y*band.Stride : (y+1)*band.Stride]); err != nil {
+				return err
+			}
+		}
+
+		options.Progress.OnProgress(band.Rect.Max.Y)
+	}
+
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	options.Progress.OnDone()
+	options.Logger.Println("Encoded message into the image")
+	return nil
+}
+
+// RevealTiled writes the message hidden in the PNG read from r to w, reading the image a band of rows at a
+// time, and returns the metadata written in front of the message if there is any. It reveals what
+// ConcealTiled conceals, and any image concealed with the linear traversal. Only the bands up to the end of the
+// message are read. A plain message is written as it's read, while an encrypted or compressed one is held in
+// memory until it has been decrypted and decompressed. A message that doesn't match its checksum returns ErrCorruptPayload once it has
+// been written, and one that has expired returns ErrExpired before any of it is written.
+func RevealTiled(r io.Reader, w io.Writer, opts ...Option) (*Metadata, error) {
+	options := makeOptions(opts)
+
+	if options.Params != nil {
+		return nil, errors.New("a headerless image can't be revealed in tiles")
+	}
+
+	tiles, err := newTiledImage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := newSecret(options.Passphrase, options.Secure)
+	if err != nil {
+		return nil, err
+	}
+	defer key.destroy()
+
+	band, err := tiles.readBand(0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the first band has been read, so the header can't fall back to its backup copies
+	header, err := decodePrimaryHeader(tiles.header(band), key)
+	if err != nil {
+		return nil, err
+	}
+
+	width, height := tiles.width, tiles.height
+	numBits := header.NumMessageBits / 8 * 8
+
+	options.Logger.Println("Width:", width, "Height:", height, "Rows per band:", tiles.rows)
+	options.Progress.OnStart("revealing", numBits/8)
+
+	message := &metadataWriter{w: w, ignoreExpiry: options.IgnoreExpiry}
+	var buffered bytes.Buffer
+
+	// The checksum of a plain message is checked as it's written, and that of an encrypted or compressed one once
+	// it's all been read
+	var checksum *checksumWriter
+	var sink io.Writer = message
+	if key != nil || header.Codec != CodecNone {
+		sink = &buffered
+	} else if header.trailerSize() > 0 {
+		checksum = newChecksumWriter(message)
+		sink = checksum
+	}
+
+	stepper := makeMessageStepper(width, height, header.NumBitsPerChannel, header.NumChannels, key, 0, LinearTraversal())
+	chunk := make([]byte, 0, tileSize/8)
+	value := 0
+
+	for bit := 0; bit < numBits; {
+		for ; bit < numBits && stepper.y < band.Rect.Max.Y; bit++ {
+			extracted, err := readBits(band, stepper, header.Strategy, 1)
+			if err != nil {
+				return nil, err
+			}
+
+			value |= extracted << uint(bit%8)
+			if bit%8 == 7 {
+				chunk = append(chunk, uint8(value))
+				value = 0
+			}
+		}
+
+		if _, err := sink.Write(chunk); err != nil {
+			return nil, err
+		}
+		options.Progress.OnProgress(bit / 8)
+		chunk = chunk[:0]
+
+		if bit < numBits {
+			if err := options.Context.Err(); err != nil {
+				return nil, err
+			}
+
+			if band, err = tiles.readBand(band.Rect.Max.Y); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if key != nil || header.Codec != CodecNone {
+		plaintext := buffered.Bytes()
+		var err error
+
+		if key != nil {
+			options.Logger.Println("Decrypting message")
+			plaintext, err = decrypt(plaintext, key)
+		}
+		if err == nil && header.trailerSize() > 0 {
+			plaintext, err = splitChecksum(plaintext)
+		}
+		if err == nil && header.Codec != CodecNone {
+			options.Logger.Println("Decompressing message")
+			decompressed, decompressErr := decompress(plaintext, header.Codec)
+			defer zeroBytes(decompressed)
+			plaintext, err = decompressed, decompressErr
+		}
+		if err == nil {
+			_, err = message.Write(plaintext)
+		}
+
+		zeroBytes(buffered.Bytes())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if checksum != nil {
+		if err := checksum.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := message.Close(); err != nil {
+		return nil, err
+	}
+
+	options.Progress.OnDone()
+	return message.metadata, nil
+}
+
+// metadataWriter passes a message on to w without the metadata in front of it, which it keeps. Nothing is
+// passed on once the metadata says the message has expired, unless ignoreExpiry is set.
+type metadataWriter struct {
+	w            io.Writer
+	ignoreExpiry bool
+	prefix       []byte
+	done         bool
+	written      int
+	metadata     *Metadata
+}
+
+func (self *metadataWriter) Write(p []byte) (int, error) {
+	if self.done {
+		n, err := self.w.Write(p)
+		self.written += n
+		return n, err
+	}
+
+	self.prefix = append(self.prefix, p...)
+	prefixSize := len(metadataMagic) + 4
+
+	if len(self.prefix) < prefixSize {
+		return len(p), nil
+	}
+
+	if !bytes.Equal(self.prefix[:len(metadataMagic)], metadataMagic) {
+		return len(p), self.pass(self.prefix)
+	}
+
+	length := int(binary.BigEndian.Uint32(self.prefix[len(metadataMagic):prefixSize]))
+	if length > maxMetadataSize {
+		return 0, ErrCorruptPayload
+	}
+
+	if len(self.prefix) < prefixSize+length {
+		return len(p), nil
+	}
+
+	metadata := &Metadata{}
+	if err := json.Unmarshal(self.prefix[prefixSize:prefixSize+length], metadata); err != nil {
+		return 0, ErrCorruptPayload
+	}
+	self.metadata = metadata
+
+	if !self.ignoreExpiry && metadata.Expired(time.Now()) {
+		return 0, ErrExpired
+	}
+
+	return len(p), self.pass(self.prefix[prefixSize+length:])
+}
+
+// pass writes what's left of the prefix to w, after which everything is written to w as is
+func (self *metadataWriter) pass(rest []byte) error {
+	self.done = true
+	n, err := self.w.Write(rest)
+	self.written += n
+
+	zeroBytes(self.prefix)
+	self.prefix = nil
+	return err
+}
+
+// Close writes a message that is too short to have metadata in front of it, and checks that the entries of the
+// metadata add up to the message that was passed on
+func (self *metadataWriter) Close() error {
+	if self.done {
+		if self.metadata != nil {
+			return self.metadata.validateDecoded(self.written)
+		}
+		return nil
+	}
+
+	if len(self.prefix) >= len(metadataMagic) && bytes.Equal(self.prefix[:len(metadataMagic)], metadataMagic) {
+		return ErrCorruptPayload
+	}
+
+	return self.pass(self.prefix)
+}
+
+// splitMetadata returns the message in payload without the metadata in front of it, and the metadata if there
+// is any, failing with ErrExpired for an expired message unless ignoreExpiry is set
+func splitMetadata(payload []byte, ignoreExpiry bool) ([]byte, *Metadata, error) {
+	var message bytes.Buffer
+	writer := &metadataWriter{w: &message, ignoreExpiry: ignoreExpiry}
+	if _, err := writer.Write(payload); err != nil {
+		return nil, nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	return message.Bytes(), writer.metadata, nil
+}
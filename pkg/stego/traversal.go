@@ -0,0 +1,224 @@
+package stego
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand"
+)
+
+// Traversal decides the order in which the pixels holding the message are visited. Pixels are identified by
+// their index y*width+x.
+type Traversal interface {
+	// Next returns the index of the next pixel to visit and false once every pixel has been visited
+	Next() (int, bool)
+}
+
+// TraversalFactory creates a Traversal over the pixels of a width by height image. The pixels before first hold
+// the header, so the traversal must only visit pixels from first onwards, each of them exactly once. Revealing
+// a message requires the same TraversalFactory that concealed it. A factory can be called by several calls at
+// once, so every Traversal it returns must have its own state.
+type TraversalFactory func(width int, height int, first int) Traversal
+
+// traversalNames are the names of the traversals LookupTraversal knows
+var traversalNames = []string{"linear", "keyed", "block", "shuffled"}
+
+// LookupTraversal returns the traversal called name, one of TraversalNames. The keyed and shuffled traversals
+// are seeded with passphrase, and block visits 8x8 blocks.
+func LookupTraversal(name string, passphrase string) (TraversalFactory, bool) {
+	switch name {
+	case "linear":
+		return LinearTraversal(), true
+	case "keyed":
+		return KeyedTraversal([]byte(passphrase)), true
+	case "shuffled":
+		return ShuffledTraversal([]byte(passphrase)), true
+	case "block":
+		return BlockTraversal(8), true
+	default:
+		return nil, false
+	}
+}
+
+// TraversalNames returns the names of the traversals LookupTraversal knows
+func TraversalNames() []string {
+	return append([]string(nil), traversalNames...)
+}
+
+// LinearTraversal visits pixels row by row
+func LinearTraversal() TraversalFactory {
+	return func(width int, height int, first int) Traversal {
+		return &linearTraversal{next: first, end: width * height}
+	}
+}
+
+// KeyedTraversal visits pixels in a random order that can only be reproduced with seed, which spreads the
+// message over the whole image instead of packing it into its top rows. The order is a keyed Feistel
+// permutation of the pixel indices, so the traversal takes the same small amount of memory whatever the size
+// of the image.
+func KeyedTraversal(seed []byte) TraversalFactory {
+	mac := hmac.New(sha256.New, seed)
+	mac.Write([]byte("feistel traversal"))
+	sum := mac.Sum(nil)
+
+	var keys [feistelRounds]uint64
+	for i := range keys {
+		keys[i] = binary.BigEndian.Uint64(sum[i*8:])
+	}
+	zeroBytes(sum)
+
+	return func(width int, height int, first int) Traversal {
+		size := width*height - first
+
+		// The permutation is over numbers of an even number of bits, the fewest that can hold every index
+		halfBits := uint(1)
+		for uint64(1)<<(2*halfBits) < uint64(size) {
+			halfBits++
+		}
+
+		return &feistelTraversal{first: first, size: size, halfBits: halfBits, keys: keys}
+	}
+}
+
+// ShuffledTraversal visits pixels in the random order KeyedTraversal used before it became a Feistel
+// permutation. It shuffles a list of every pixel up front, so it needs memory in proportion to the image, and
+// is only kept to reveal messages concealed with that order.
+func ShuffledTraversal(seed []byte) TraversalFactory {
+	mac := hmac.New(sha256.New, seed)
+	mac.Write([]byte("traversal"))
+	sum := mac.Sum(nil)
+	source := int64(binary.BigEndian.Uint64(sum[:8]))
+	zeroBytes(sum)
+
+	return func(width int, height int, first int) Traversal {
+		rng := rand.New(rand.NewSource(source))
+		return &permutedTraversal{first: first, order: rng.Perm(width*height - first)}
+	}
+}
+
+// BlockTraversal visits the image in blockSize by blockSize blocks, row by row within each block and block
+// row by block row across the image
+func BlockTraversal(blockSize int) TraversalFactory {
+	return func(width int, height int, first int) Traversal {
+		return &blockTraversal{width: width, height: height, first: first, blockSize: blockSize}
+	}
+}
+
+type linearTraversal struct {
+	next int
+	end  int
+}
+
+func (self *linearTraversal) Next() (int, bool) {
+	if self.next >= self.end {
+		return 0, false
+	}
+
+	self.next++
+	return self.next - 1, true
+}
+
+type permutedTraversal struct {
+	first int
+	order []int
+	next  int
+}
+
+func (self *permutedTraversal) Next() (int, bool) {
+	if self.next >= len(self.order) {
+		return 0, false
+	}
+
+	self.next++
+	return self.first + self.order[self.next-1], true
+}
+
+// feistelRounds is the number of rounds of the Feistel network behind KeyedTraversal
+const feistelRounds = 4
+
+type feistelTraversal struct {
+	first    int
+	size     int
+	halfBits uint
+	keys     [feistelRounds]uint64
+	next     int
+}
+
+func (self *feistelTraversal) Next() (int, bool) {
+	if self.next >= self.size {
+		return 0, false
+	}
+
+	self.next++
+	return self.first + self.permute(self.next-1), true
+}
+
+// permute returns the pixel visited at position index. The Feistel network permutes every number of
+// 2*halfBits bits, so a number past the last pixel is permuted again, walking the cycle it's on until it lands
+// on a pixel. The cycle holds index itself, so the walk always ends.
+func (self *feistelTraversal) permute(index int) int {
+	value := uint64(index)
+
+	for {
+		value = self.encrypt(value)
+		if value < uint64(self.size) {
+			return int(value)
+		}
+	}
+}
+
+// encrypt runs value through the rounds of the Feistel network
+func (self *feistelTraversal) encrypt(value uint64) uint64 {
+	mask := uint64(1)<<self.halfBits - 1
+	left := value >> self.halfBits
+	right := value & mask
+
+	for _, key := range self.keys {
+		left, right = right, left^(mix64(right^key)&mask)
+	}
+
+	return left<<self.halfBits | right
+}
+
+// mix64 scrambles the bits of x, using the finalizer of SplitMix64
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+type blockTraversal struct {
+	width     int
+	height    int
+	first     int
+	blockSize int
+	block     int
+	offset    int
+}
+
+func (self *blockTraversal) Next() (int, bool) {
+	numBlocksX := (self.width + self.blockSize - 1) / self.blockSize
+	numBlocksY := (self.height + self.blockSize - 1) / self.blockSize
+
+	for ; self.block < numBlocksX*numBlocksY; self.block++ {
+		blockX := self.block % numBlocksX * self.blockSize
+		blockY := self.block / numBlocksX * self.blockSize
+
+		for self.offset < self.blockSize*self.blockSize {
+			x := blockX + self.offset%self.blockSize
+			y := blockY + self.offset/self.blockSize
+			self.offset++
+
+			if x < self.width && y < self.height && y*self.width+x >= self.first {
+				return y*self.width + x, true
+			}
+		}
+
+		self.offset = 0
+	}
+
+	return 0, false
+}
@@ -0,0 +1,89 @@
+package stego
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// TestTraversalsVisitEveryPixelOnce checks that each traversal visits every pixel from first onwards exactly
+// once, at sizes where a permutation over a power of two has to skip indices past the end
+func TestTraversalsVisitEveryPixelOnce(t *testing.T) {
+	factories := map[string]TraversalFactory{
+		"linear":   LinearTraversal(),
+		"keyed":    KeyedTraversal([]byte("key")),
+		"shuffled": ShuffledTraversal([]byte("key")),
+		"block":    BlockTraversal(8),
+	}
+
+	sizes := []struct{ width, height, first int }{
+		{1, 1, 0},
+		{2, 1, 0},
+		{1, 2, 1},
+		{3, 1, 0},
+		{5, 1, 0},
+		{7, 1, 2},
+		{13, 1, 0},
+		{17, 1, 0},
+		{3, 5, 0},
+		{6, 10, 7},
+		{31, 1, 0},
+		{97, 1, 0},
+		{11, 13, 50},
+		{9, 9, 80},
+		{8, 8, 0},
+		{100, 3, 1},
+		{127, 1, 0},
+		{257, 3, 0},
+		{1021, 1, 0},
+	}
+
+	for name, factory := range factories {
+		for _, size := range sizes {
+			t.Run(fmt.Sprintf("%s %dx%d from %d", name, size.width, size.height, size.first), func(t *testing.T) {
+				end := size.width * size.height
+				seen := make([]bool, end)
+				traversal := factory(size.width, size.height, size.first)
+
+				for count := 0; ; count++ {
+					index, ok := traversal.Next()
+					if !ok {
+						if count != end-size.first {
+							t.Fatalf("visited %d pixels, want %d", count, end-size.first)
+						}
+						break
+					}
+
+					if index < size.first || index >= end {
+						t.Fatalf("visited %d, outside [%d, %d)", index, size.first, end)
+					}
+
+					if seen[index] {
+						t.Fatalf("visited %d twice", index)
+					}
+					seen[index] = true
+				}
+			})
+		}
+	}
+}
+
+// TestKeyedTraversalOrder pins the order KeyedTraversal visits pixels in for a fixed key. Messages concealed
+// with the keyed traversal can only be revealed while the order stays the same.
+func TestKeyedTraversalOrder(t *testing.T) {
+	traversal := KeyedTraversal([]byte("key"))(13, 7, 5)
+
+	var order []int
+	for len(order) < 16 {
+		index, ok := traversal.Next()
+		if !ok {
+			break
+		}
+		order = append(order, index)
+	}
+
+	want := []int{85, 31, 86, 71, 44, 68, 89, 24, 50, 51, 83, 8, 7, 80, 30, 34}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+}
@@ -0,0 +1,245 @@
+package stego
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+)
+
+// pixelChannels returns the NRGBA channels of the pixel of img at x, y. NRGBA images and the opaque pixels of
+// RGBA images, which are what PNGs decode to, are read straight from their Pix without converting a color.
+func pixelChannels(img image.Image, x int, y int) [4]uint8 {
+	switch src := img.(type) {
+	case *image.NRGBA:
+		i := src.PixOffset(x, y)
+		return [4]uint8{src.Pix[i], src.Pix[i+1], src.Pix[i+2], src.Pix[i+3]}
+
+	case *image.RGBA:
+		i := src.PixOffset(x, y)
+		if src.Pix[i+3] == 0xff {
+			return [4]uint8{src.Pix[i], src.Pix[i+1], src.Pix[i+2], 0xff}
+		}
+	}
+
+	c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+	return [4]uint8{c.R, c.G, c.B, c.A}
+}
+
+func getPixel(img *image.NRGBA, x int, y int) []uint8 {
+	index := img.PixOffset(x, y)
+	return img.Pix[index : index+4]
+}
+
+// LoadImage decodes the image at path. Only PNG images are supported.
+func LoadImage(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := DecodeImage(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// DecodeImage decodes an image read from r. Only PNG images are supported.
+func DecodeImage(r io.Reader) (image.Image, error) {
+	img, _, err := image.Decode(r)
+	if err == image.ErrFormat {
+		return nil, ErrUnsupportedFormat
+	}
+	return img, err
+}
+
+// SaveImage encodes img as a PNG to path with EncodeImage
+func SaveImage(path string, img image.Image, opts ...Option) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := EncodeImage(file, img, opts...); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// EncodeImage encodes img as a PNG to w, compressed as hard as WithCompression says. The buffers of the encoder
+// are shared between calls, so encoding one image after another doesn't allocate them again each time.
+func EncodeImage(w io.Writer, img image.Image, opts ...Option) error {
+	encoder := png.Encoder{
+		CompressionLevel: makeOptions(opts).Compression,
+		BufferPool:       encoderBuffers,
+	}
+
+	return encoder.Encode(w, img)
+}
+
+// encoderBuffers holds the buffers of the PNG encoders that aren't in use
+var encoderBuffers = &bufferPool{}
+
+// bufferPool is a png.EncoderBufferPool that can be used from several goroutines at once
+type bufferPool struct {
+	pool sync.Pool
+}
+
+func (self *bufferPool) Get() *png.EncoderBuffer {
+	buffer, _ := self.pool.Get().(*png.EncoderBuffer)
+	return buffer
+}
+
+func (self *bufferPool) Put(buffer *png.EncoderBuffer) {
+	self.pool.Put(buffer)
+}
+
+// cancelCheckInterval is how many iterations long running loops go through before checking whether their
+// context has been cancelled
+const cancelCheckInterval = 4096
+
+// copyImage returns a copy of img as NRGBA. The pixels of the image types PNG decodes to are copied a row at a
+// time straight from their Pix, and the colors of any other image are converted one pixel at a time.
+func copyImage(ctx context.Context, img image.Image, progress Progress) (*image.NRGBA, error) {
+	bounds := img.Bounds()
+	outputImage := image.NewNRGBA(bounds)
+
+	var palette []color.NRGBA
+	if paletted, ok := img.(*image.Paletted); ok {
+		palette = make([]color.NRGBA, len(paletted.Palette))
+		for i, c := range paletted.Palette {
+			palette[i] = color.NRGBAModel.Convert(c).(color.NRGBA)
+		}
+	}
+
+	progress.OnStart("copying image", bounds.Dy())
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		row := outputImage.Pix[outputImage.PixOffset(bounds.Min.X, y):outputImage.PixOffset(bounds.Max.X, y)]
+
+		switch src := img.(type) {
+		case *image.NRGBA:
+			copy(row, src.Pix[src.PixOffset(bounds.Min.X, y):])
+
+		case *image.RGBA:
+			srcRow := src.Pix[src.PixOffset(bounds.Min.X, y):]
+			copy(row, srcRow)
+
+			// Only translucent pixels are premultiplied differently
+			for i := 0; i < len(row); i += 4 {
+				if row[i+3] != 0xff {
+					c := color.NRGBAModel.Convert(color.RGBA{R: row[i], G: row[i+1], B: row[i+2], A: row[i+3]}).(color.NRGBA)
+					row[i], row[i+1], row[i+2], row[i+3] = c.R, c.G, c.B, c.A
+				}
+			}
+
+		case *image.Gray:
+			srcRow := src.Pix[src.PixOffset(bounds.Min.X, y):]
+			for i := 0; i < len(row); i += 4 {
+				gray := srcRow[i/4]
+				row[i], row[i+1], row[i+2], row[i+3] = gray, gray, gray, 0xff
+			}
+
+		case *image.Paletted:
+			srcRow := src.Pix[src.PixOffset(bounds.Min.X, y):]
+			for i := 0; i < len(row); i += 4 {
+				c := color.NRGBA{}
+				if index := int(srcRow[i/4]); index < len(palette) {
+					c = palette[index]
+				}
+				row[i], row[i+1], row[i+2], row[i+3] = c.R, c.G, c.B, c.A
+			}
+
+		default:
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				outputImage.Set(x, y, img.At(x, y))
+			}
+		}
+
+		progress.OnProgress(y - bounds.Min.Y + 1)
+	}
+
+	progress.OnDone()
+	return outputImage, nil
+}
+
+func numBitsAvailable(width int, height int, channelSize int, numBitsToUsePerChannel int) int {
+	if width == 0 || height == 0 || numBitsToUsePerChannel < 1 {
+		return 0
+	}
+	return width * height * channelSize * numBitsToUsePerChannel
+}
+
+func getBit(num int, index int) int {
+	mask := 1 << index
+	if num&mask == 0 {
+		return 0
+	}
+	return 1
+}
+
+func setBit(num int, index int) int {
+	mask := 1 << index
+	return num | mask
+}
+
+func clearBit(num int, index int) int {
+	mask := ^(1 << index)
+	return num & mask
+}
+
+func getBitUint8(num uint8, index int) int {
+	mask := uint8(1 << index)
+	if num&mask == 0 {
+		return 0
+	}
+	return 1
+}
+
+func setBitUint8(num uint8, index int) uint8 {
+	mask := uint8(1 << index)
+	return num | mask
+}
+
+func clearBitUint8(num uint8, index int) uint8 {
+	mask := uint8(^(1 << index))
+	return num & mask
+}
+
+// matchBitUint8 changes the bit at index of num to bit by randomly adding or subtracting 2^index. Carries and
+// borrows only change the bits above index. Whether the bit matches and which way to go are both random, so
+// rather than branching on them, which the CPU would mispredict half the time, the step is worked out
+// arithmetically.
+func matchBitUint8(num uint8, index int, bit int, rng *rand.Rand) uint8 {
+	value := int(num)
+	step := 1 << uint(index)
+	change := (value>>uint(index) ^ bit) & 1
+
+	// Go up or down at random, unless that would leave the range of a channel value
+	direction := int(rng.Int63()&1)*2 - 1
+	if value-step < 0 {
+		direction = 1
+	}
+	if value+step > 255 {
+		direction = -1
+	}
+
+	return uint8(value + direction*step*change)
+}
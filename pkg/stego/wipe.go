@@ -0,0 +1,66 @@
+package stego
+
+import (
+	"image"
+	"io"
+)
+
+// WipeImage returns a copy of img with the low bits of its channels replaced by random bits, so that a message
+// hidden in them can't be recovered, whether it was hidden by Hide or by any other tool that embeds in those
+// bits. The number of bits and channels are set with WithBitsPerChannel and WithChannels. Each channel value
+// changes by less than 2^bits, so the image looks the same.
+func WipeImage(img image.Image, opts ...Option) (*image.NRGBA, error) {
+	options := makeOptions(opts)
+
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	outputImage, err := copyImage(options.Context, img, options.Progress)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := outputImage.Bounds()
+	mask := uint8(1<<uint(options.NumBitsPerChannel) - 1)
+	noise := make([]byte, bounds.Dx()*4)
+
+	options.Progress.OnStart("wiping", bounds.Dy())
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		if err := options.Context.Err(); err != nil {
+			return nil, err
+		}
+
+		if _, err := io.ReadFull(options.Random, noise); err != nil {
+			return nil, err
+		}
+
+		row := outputImage.Pix[outputImage.PixOffset(bounds.Min.X, y):][:len(noise)]
+		for i := range row {
+			if i%4 < options.NumChannels {
+				row[i] = row[i]&^mask | noise[i]&mask
+			}
+		}
+
+		options.Progress.OnProgress(y - bounds.Min.Y + 1)
+	}
+
+	options.Progress.OnDone()
+	return outputImage, nil
+}
+
+// Wipe wipes the image at imagePath with WipeImage and saves the result as a PNG to outputPath
+func Wipe(imagePath string, outputPath string, opts ...Option) error {
+	img, err := LoadImage(imagePath)
+	if err != nil {
+		return err
+	}
+
+	outputImage, err := WipeImage(img, opts...)
+	if err != nil {
+		return err
+	}
+
+	return SaveImage(outputPath, outputImage, opts...)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/analysis"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"os"
+	"text/tabwriter"
+)
+
+// channelQualityReport is what the analyze command reports for one channel with --json
+type channelQualityReport struct {
+	Name              string  `json:"name"`
+	NoiseSigma        float64 `json:"noise_sigma"`
+	LSBOnes           float64 `json:"lsb_ones"`
+	MonobitP          float64 `json:"monobit_p"`
+	RunsP             float64 `json:"runs_p"`
+	NeighborAgreement float64 `json:"neighbor_agreement"`
+}
+
+// qualityReport is what the analyze command reports with --json
+type qualityReport struct {
+	NoiseSigma float64                `json:"noise_sigma"`
+	Blockiness float64                `json:"blockiness"`
+	Channels   []channelQualityReport `json:"channels"`
+}
+
+// analyze prints the noise, least significant bit randomness and block artifacts of the image at imagePath,
+// which needs no cover
+func analyze(args *AnalyzeArgs) error {
+	img, err := stego.LoadImage(*args.imagePath)
+	if err != nil {
+		return err
+	}
+
+	quality := analysis.BlindQuality(img)
+
+	if *args.json {
+		report := qualityReport{NoiseSigma: quality.NoiseSigma, Blockiness: quality.Blockiness}
+		for _, channel := range quality.Channels {
+			report.Channels = append(report.Channels, channelQualityReport(channel))
+		}
+
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "CHANNEL\tNOISE SIGMA\tLSB ONES\tMONOBIT P\tRUNS P\tNEIGHBOR AGREEMENT")
+	for _, channel := range quality.Channels {
+		fmt.Fprintf(writer, "%s\t%.3f\t%.4f\t%.3g\t%.3g\t%.4f\n", channel.Name, channel.NoiseSigma, channel.LSBOnes,
+			channel.MonobitP, channel.RunsP, channel.NeighborAgreement)
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Noise sigma: %.3f\n", quality.NoiseSigma)
+	fmt.Printf("Blockiness: %.3f\n", quality.Blockiness)
+	return nil
+}
@@ -3,34 +3,398 @@ package main
 import (
 	"errors"
 	"github.com/akamensky/argparse"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"runtime"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type ConcealArgs struct {
 	imagePath         *string
+	covers            *string
+	threshold         *int
+	mirror            *bool
+	chain             *bool
+	slots             *int
+	slotSpecs         *[]string
+	recipients        *string
+	fingerprintKey    *string
+	strength          *int
 	passphrase        *string
 	publicKeyPath     *string
 	message           *string
+	files             *[]string
+	author            *string
+	comment           *string
+	timestamp         *bool
 	output            *string
 	numBitsPerChannel *int
 	encoding          *string
 	numChannels       *int
+	strategy          *string
+	profile           *string
+	traversal         *string
+	hideHeader        *bool
+	noHeader          *bool
+	selfCheck         *bool
+	audit             *bool
+	maxSuspicion      *float64
+	minPSNR           *float64
+	minSSIM           *float64
+	warnQuality       *bool
+	targetPSNR        *float64
+	targetSSIM        *float64
+	dryRun            *bool
+	appendPayload     *bool
+	tiled             *bool
+	maxMemory         *int
+	compression       *string
+	codec             *string
+	expires           *string
+	id                *bool
+	seed              *string
+	inPlace           *bool
+	backup            *bool
+	secure            *bool
+	workers           *int
+	progress          *string
+	quiet             *bool
 	verbose           *bool
+
+	// given holds the long names of the options given on the command line
+	given map[string]bool
 }
 
 type RevealArgs struct {
 	imagePath      *string
+	inputDir       *string
+	shards         *string
+	follow         *bool
+	slots          *int
+	outputDir      *string
+	workers        *int
+	tiled          *bool
+	maxMemory      *int
+	peek           *int
+	byteRange      *string
+	payload        *int
+	format         *string
+	bestEffort     *bool
+	params         *string
+	ignoreExpiry   *bool
+	list           *bool
+	extract        *[]string
 	passphrase     *string
 	privateKeyPath *string
+	traversal      *string
 	encoding       *string
+	secure         *bool
+	progress       *string
+	quiet          *bool
 	verbose        *bool
 }
 
+type InfoArgs struct {
+	imagePath  *string
+	passphrase *string
+	traversal  *string
+}
+
+type DetectArgs struct {
+	imagePath *string
+	curve     *int
+	useModel  *bool
+	modelPath *string
+}
+
+type AnalyzeArgs struct {
+	imagePath *string
+	json      *bool
+}
+
+type EstimateRateArgs struct {
+	imagePath *string
+	json      *bool
+}
+
+type EditArgs struct {
+	imagePath   *string
+	passphrase  *string
+	traversal   *string
+	payload     *int
+	comment     *string
+	fileName    *string
+	fileType    *string
+	output      *string
+	compression *string
+	backup      *bool
+}
+
+type MigrateArgs struct {
+	imagePath   *string
+	passphrase  *string
+	output      *string
+	compression *string
+	inPlace     *bool
+	backup      *bool
+}
+
+type VerifyArgs struct {
+	imagePath  *string
+	passphrase *string
+	traversal  *string
+	params     *string
+	deep       *bool
+}
+
+type CapacityArgs struct {
+	imagePath         *string
+	numBitsPerChannel *int
+	numChannels       *int
+	strategy          *string
+	passphrase        *string
+	file              *string
+	json              *bool
+}
+
+type WipeArgs struct {
+	imagePath   *string
+	output      *string
+	compression *string
+	inPlace     *bool
+	backup      *bool
+	numBits     *int
+	numChannels *int
+	progress    *string
+	quiet       *bool
+}
+
+type CompareArgs struct {
+	imagePath    *string
+	coverPath    *string
+	includeAlpha *bool
+	dct          *bool
+	montagePath  *string
+	amplify      *int
+	json         *bool
+}
+
+type TraceArgs struct {
+	imagePath  *string
+	recipients *string
+	key        *string
+	coverPath  *string
+	minScore   *float64
+	json       *bool
+}
+
+type PlanesArgs struct {
+	imagePath   *string
+	outDir      *string
+	numChannels *int
+	numBits     *int
+}
+
+type ScanArgs struct {
+	dir         *string
+	threshold   *float64
+	workers     *int
+	jobs        *int
+	maxFileSize *int
+	maxPixels   *int
+	verbose     *bool
+}
+
+type BenchArgs struct {
+	width  *int
+	height *int
+	rounds *int
+}
+
+type SelftestArgs struct {
+	verbose *bool
+}
+
+type ServeArgs struct {
+	address       *string
+	maxSize       *int
+	maxPixels     *int
+	maxConcurrent *int
+}
+
+type WatchArgs struct {
+	inDir             *string
+	outDir            *string
+	reveal            *bool
+	coverPath         *string
+	passphrase        *string
+	numBitsPerChannel *int
+	numChannels       *int
+	strategy          *string
+	traversal         *string
+	hideHeader        *bool
+	id                *bool
+	interval          *int
+}
+
 type GenerateArgs struct {
 	numBytes   *int
 	outputPath *string
 }
 
+// options adapts the parsed conceal arguments to Options
+func (self *ConcealArgs) options() []stego.Option {
+	strategy, _ := stego.LookupStrategy(*self.strategy)
+	codec, level, _ := parseCodec(*self.codec)
+
+	return []stego.Option{
+		stego.WithPassphrase(*self.passphrase),
+		stego.WithKeyPath(*self.publicKeyPath),
+		stego.WithBitsPerChannel(*self.numBitsPerChannel),
+		stego.WithChannels(*self.numChannels),
+		stego.WithStrategy(strategy),
+		stego.WithTraversal(makeTraversal(*self.traversal, *self.passphrase)),
+		stego.WithHiddenHeader(*self.hideHeader),
+		stego.WithSecureMode(*self.secure),
+		stego.WithWorkers(*self.workers),
+		stego.WithCompression(makeCompression(*self.compression)),
+		stego.WithCodec(codec, level),
+		stego.WithRandom(makeRandom(*self.seed)),
+		stego.WithLogger(makeLogger(*self.verbose)),
+		stego.WithProgress(makeProgress(*self.progress, *self.quiet)),
+	}
+}
+
+// options adapts the parsed reveal arguments to Options
+func (self *RevealArgs) options() []stego.Option {
+	return append([]stego.Option{
+		stego.WithPassphrase(*self.passphrase),
+		stego.WithKeyPath(*self.privateKeyPath),
+		stego.WithTraversal(makeTraversal(*self.traversal, *self.passphrase)),
+		stego.WithPayload(*self.payload),
+		stego.WithFormat(makeFormat(*self.format)),
+		stego.WithBestEffort(*self.bestEffort),
+		stego.WithIgnoreExpiry(*self.ignoreExpiry),
+		stego.WithSecureMode(*self.secure),
+		stego.WithWorkers(*self.workers),
+		stego.WithLogger(makeLogger(*self.verbose)),
+		stego.WithProgress(makeProgress(*self.progress, *self.quiet)),
+	}, paramsOptions(*self.params)...)
+}
+
+// options adapts the parsed watch arguments to Options. Files are processed without a progress bar.
+func (self *WatchArgs) options() []stego.Option {
+	strategy, _ := stego.LookupStrategy(*self.strategy)
+
+	return []stego.Option{
+		stego.WithPassphrase(*self.passphrase),
+		stego.WithBitsPerChannel(*self.numBitsPerChannel),
+		stego.WithChannels(*self.numChannels),
+		stego.WithStrategy(strategy),
+		stego.WithTraversal(makeTraversal(*self.traversal, *self.passphrase)),
+		stego.WithHiddenHeader(*self.hideHeader),
+	}
+}
+
+// traversalNames are the traversals that can be selected on the command line
+var traversalNames = stego.TraversalNames()
+
+// keyedTraversal reports whether the traversal called name is seeded with the passphrase. shuffled is the
+// order keyed traversals had before they became a Feistel permutation.
+func keyedTraversal(name string) bool {
+	return name == "keyed" || name == "shuffled"
+}
+
+// makeTraversal returns the traversal called name, which the command line only lets be one of traversalNames.
+// The keyed traversal is seeded with the passphrase.
+func makeTraversal(name string, passphrase string) stego.TraversalFactory {
+	traversal, ok := stego.LookupTraversal(name, passphrase)
+	if !ok {
+		return stego.LinearTraversal()
+	}
+	return traversal
+}
+
+// compressionNames are the PNG compression levels that can be selected on the command line
+var compressionNames = []string{"default", "none", "speed", "best"}
+
+// compressionHelp describes the compression levels for every command that writes an image
+const compressionHelp = "How hard the PNG that is written is compressed. speed writes large images several times " +
+	"faster and best makes them smaller to share"
+
+// makeCompression returns the PNG compression level called name
+func makeCompression(name string) png.CompressionLevel {
+	switch name {
+	case "none":
+		return png.NoCompression
+	case "speed":
+		return png.BestSpeed
+	case "best":
+		return png.BestCompression
+	default:
+		return png.DefaultCompression
+	}
+}
+
+// progressNames are the kinds of progress that can be selected on the command line
+var progressNames = []string{"auto", "bar", "json", "none"}
+
+// makeProgress returns the progress called name, which is drawn on stderr. auto draws a bar only when stderr
+// is a terminal, so redirected output isn't filled with redrawn bars, and quiet shows no progress at all.
+func makeProgress(name string, quiet bool) stego.Progress {
+	if quiet {
+		return nil
+	}
+
+	switch name {
+	case "bar":
+		return makeProgressBar(os.Stderr)
+	case "json":
+		return makeJSONProgress(os.Stderr)
+	case "none":
+		return nil
+	default:
+		if isTerminal(os.Stderr) {
+			return makeProgressBar(os.Stderr)
+		}
+		return nil
+	}
+}
+
+// makeRandom returns the random that every random choice is made from, which is crypto/rand unless a seed is given
+func makeRandom(seed string) io.Reader {
+	if seed == "" {
+		return nil
+	}
+	return stego.DeterministicRandom([]byte(seed))
+}
+
+// makeLogger returns the logger for the command line, which only prints when verbose is enabled
+func makeLogger(verbose bool) stego.Logger {
+	if verbose {
+		return log.New(os.Stdout, "", 0)
+	}
+	return log.New(ioutil.Discard, "", 0)
+}
+
+// track wraps validate so the long name of the option is added to given when it is on the command line.
+// argparse only validates the options it was given.
+func track(given map[string]bool, name string, validate func([]string) error) func([]string) error {
+	return func(args []string) error {
+		given[name] = true
+		if validate == nil {
+			return nil
+		}
+		return validate(args)
+	}
+}
+
 func nonEmptyStringValidator(args []string) error {
 	if args[0] == "" {
 		return errors.New("arguments cannot be an empty strings")
@@ -66,6 +430,111 @@ func numChannelsValidator(args []string) error {
 	return nil
 }
 
+// parseByteRange parses a range of message bytes written as start:end, where end is exclusive. Either bound can
+// be left out to mean the start or the end of the message, in which case end is -1.
+func parseByteRange(value string) (int, int, error) {
+	bounds := strings.SplitN(value, ":", 2)
+	if len(bounds) != 2 {
+		return 0, 0, errors.New("range must be written as start:end")
+	}
+
+	start, end := 0, -1
+	var err error
+
+	if bounds[0] != "" {
+		if start, err = strconv.Atoi(bounds[0]); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if bounds[1] != "" {
+		if end, err = strconv.Atoi(bounds[1]); err != nil {
+			return 0, 0, err
+		}
+		if end < start {
+			return 0, 0, errors.New("end of range cannot be before its start")
+		}
+	}
+
+	if start < 0 {
+		return 0, 0, errors.New("start of range cannot be negative")
+	}
+
+	return start, end, nil
+}
+
+func byteRangeValidator(args []string) error {
+	_, _, err := parseByteRange(args[0])
+	return err
+}
+
+// parseCodec parses the codec a message is compressed with, written as codec or codec:level
+func parseCodec(value string) (stego.Codec, int, error) {
+	parts := strings.SplitN(value, ":", 2)
+
+	codec, ok := stego.LookupCodec(parts[0])
+	if !ok {
+		return stego.CodecNone, 0, errors.New("codec must be one of: " + strings.Join(stego.CodecNames(), ", "))
+	}
+
+	level := 0
+	if len(parts) == 2 {
+		var err error
+		if level, err = strconv.Atoi(parts[1]); err != nil {
+			return stego.CodecNone, 0, err
+		}
+		if err := codec.ValidateLevel(level); err != nil {
+			return stego.CodecNone, 0, err
+		}
+	}
+
+	return codec, level, nil
+}
+
+func codecValidator(args []string) error {
+	_, _, err := parseCodec(args[0])
+	return err
+}
+
+// parseExpiry parses when a message expires, written as an RFC 3339 time, a date, which expires at the start of
+// that day in UTC, or a duration from now like 72h
+func parseExpiry(value string, now time.Time) (time.Time, error) {
+	if expires, err := time.Parse(time.RFC3339, value); err == nil {
+		return expires.UTC(), nil
+	}
+
+	if expires, err := time.Parse("2006-01-02", value); err == nil {
+		return expires, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return time.Time{}, errors.New("expiry must be an RFC 3339 time, a date like 2006-01-02 or a positive duration like 72h")
+	}
+
+	return now.Add(duration).UTC().Truncate(time.Second), nil
+}
+
+// paramsOptions returns the options that reveal a headerless image with params, if they're given
+func paramsOptions(params string) []stego.Option {
+	if params == "" {
+		return nil
+	}
+
+	header, _ := stego.ParseParams(params)
+	return []stego.Option{stego.WithParams(header)}
+}
+
+func paramsValidator(args []string) error {
+	_, err := stego.ParseParams(args[0])
+	return err
+}
+
+func expiryValidator(args []string) error {
+	_, err := parseExpiry(args[0], time.Now())
+	return err
+}
+
 func initGenerateCommand(parser *argparse.Parser) (*argparse.Command, *GenerateArgs) {
 	generateCommand := parser.NewCommand("generate", "Generate a pair of public and private key")
 	generateArgs := &GenerateArgs{}
@@ -85,17 +554,62 @@ func initGenerateCommand(parser *argparse.Parser) (*argparse.Command, *GenerateA
 	return generateCommand, generateArgs
 }
 
-func initConcealCommand(parser *argparse.Parser) (*argparse.Command, *ConcealArgs) {
-	concealArgs := &ConcealArgs{}
+func initConcealCommand(parser *argparse.Parser, config *Config) (*argparse.Command, *ConcealArgs) {
+	concealArgs := &ConcealArgs{given: map[string]bool{}}
 
 	concealCommand := parser.NewCommand("conceal", "Conceal a message in an image")
 
 	concealArgs.imagePath = concealCommand.String("i", "image-path", &argparse.Options{
-		Required: true,
+		Required: false,
 		Help:     "Path to image you want to conceal a message in",
 		Validate: nonEmptyStringValidator,
 	})
 
+	concealArgs.covers = concealCommand.String("", "covers", &argparse.Options{
+		Required: false,
+		Help: "Glob of images to split the message across instead of a single image, for a message too large " +
+			"for one. Each image holds a shard of it and is written to the output directory, or else to " +
+			"*filename*.out. Reveal them with shards",
+		Validate: nonEmptyStringValidator,
+	})
+
+	concealArgs.threshold = concealCommand.Int("", "threshold", &argparse.Options{
+		Required: false,
+		Default:  0,
+		Help: "Split the message across every one of the covers with Shamir's secret sharing instead, so that " +
+			"any this many of the images recover it and fewer give away nothing. Every cover must have room " +
+			"for the whole message. 0 shards it instead",
+	})
+
+	concealArgs.mirror = concealCommand.Flag("", "mirror", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help: "Conceal the whole message in every one of the covers instead of splitting it, so that reveal " +
+			"with shards can vote on every chunk and recover it even when some of the images were damaged",
+	})
+
+	concealArgs.chain = concealCommand.Flag("", "chain", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help: "Shard the message and have every image point to the image holding the next shard, by its " +
+			"checksum and name, so the images can be published one at a time and revealed from the first " +
+			"with follow",
+	})
+
+	concealArgs.slots = concealCommand.Int("", "slots", &argparse.Options{
+		Required: false,
+		Default:  0,
+		Help: "Split the image into this many slots, each holding a file given with slot that only its own " +
+			"passphrase reveals, and fill the rest with random bits so no passphrase shows whether the other " +
+			"slots are used. Reveal needs the same number of slots, bits and channels. 0 doesn't use slots",
+	})
+
+	concealArgs.slotSpecs = concealCommand.StringList("", "slot", &argparse.Options{
+		Required: false,
+		Help:     "File for a slot and the passphrase that reveals it, written as passphrase=path. Give it once per slot",
+		Validate: nonEmptyStringValidator,
+	})
+
 	concealArgs.passphrase = concealCommand.String("p", "passphrase", &argparse.Options{
 		Required: false,
 		Help:     "Passphrase to encrypt the message in the image",
@@ -104,16 +618,77 @@ func initConcealCommand(parser *argparse.Parser) (*argparse.Command, *ConcealArg
 
 	concealArgs.publicKeyPath = concealCommand.String("k", "key-path", &argparse.Options{
 		Required: false,
+		Default:  config.Path("conceal", "key-path", ""),
 		Help:     "Path to .pem file containing recipient's public key",
 		Validate: nonEmptyStringValidator,
 	})
 
 	concealArgs.message = concealCommand.String("m", "message", &argparse.Options{
-		Required: true,
+		Required: false,
 		Help:     "Message you want to conceal",
 		Validate: nonEmptyStringValidator,
 	})
 
+	concealArgs.recipients = concealCommand.String("", "recipients", &argparse.Options{
+		Required: false,
+		Help: "File with a recipient per line. Writes a copy of the stego image for every recipient, named after " +
+			"the output path with the recipient before its extension, with the recipient's fingerprint added so " +
+			"trace can tell whose copy leaked",
+		Validate: nonEmptyStringValidator,
+	})
+
+	concealArgs.fingerprintKey = concealCommand.String("", "fingerprint-key", &argparse.Options{
+		Required: false,
+		Help: "Key the fingerprints of the recipients are made with. Keep it from the recipients, since anyone " +
+			"with it can remove or forge a fingerprint",
+	})
+
+	concealArgs.strength = concealCommand.Int("", "fingerprint-strength", &argparse.Options{
+		Required: false,
+		Default:  stego.DefaultFingerprintStrength,
+		Help:     "How much the fingerprints change every pixel, from 1 to 16. Stronger ones survive more but show more",
+	})
+
+	concealArgs.files = concealCommand.StringList("f", "file", &argparse.Options{
+		Required: false,
+		Help: "File to conceal instead of a message. Its name and type are kept so reveal can restore it. " +
+			"Give it more than once to package several files together",
+		Validate: nonEmptyStringValidator,
+	})
+
+	concealArgs.author = concealCommand.String("", "author", &argparse.Options{
+		Required: false,
+		Help:     "Author to store with the message, which is encrypted along with it",
+		Validate: nonEmptyStringValidator,
+	})
+
+	concealArgs.comment = concealCommand.String("", "comment", &argparse.Options{
+		Required: false,
+		Help:     "Comment to store with the message, which is encrypted along with it",
+		Validate: nonEmptyStringValidator,
+	})
+
+	concealArgs.timestamp = concealCommand.Flag("", "timestamp", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "Store the time the message was concealed with it",
+	})
+
+	concealArgs.id = concealCommand.Flag("", "id", &argparse.Options{
+		Required: false,
+		Default:  config.Bool("conceal", "id", false),
+		Help: "Store a random ID with the message, which takes up about 140 bytes of the image. The ID is " +
+			"printed once the message is concealed, and info, verify and reveal show it so a revealed message " +
+			"can be matched with its records",
+	})
+
+	concealArgs.expires = concealCommand.String("", "expires", &argparse.Options{
+		Required: false,
+		Help: "When the message expires, as an RFC 3339 time, a date or a duration from now like 72h. Reveal " +
+			"refuses an expired message unless given --ignore-expiry. It is encrypted along with the message",
+		Validate: expiryValidator,
+	})
+
 	concealArgs.output = concealCommand.String("o", "output", &argparse.Options{
 		Required: false,
 		Help: "Output path for the image with a concealed message. " +
@@ -123,9 +698,9 @@ func initConcealCommand(parser *argparse.Parser) (*argparse.Command, *ConcealArg
 
 	concealArgs.numBitsPerChannel = concealCommand.Int("n", "num-bits", &argparse.Options{
 		Required: false,
-		Default:  1,
+		Default:  config.Int("conceal", "num-bits", 1),
 		Help:     "Number of bits to use per channel value",
-		Validate: byteIndexValidator,
+		Validate: track(concealArgs.given, "num-bits", byteIndexValidator),
 	})
 
 	concealArgs.encoding = concealCommand.Selector("e", "encoding", []string{"utf8"}, &argparse.Options{
@@ -136,53 +711,1087 @@ func initConcealCommand(parser *argparse.Parser) (*argparse.Command, *ConcealArg
 
 	concealArgs.numChannels = concealCommand.Int("c", "channels", &argparse.Options{
 		Required: false,
-		Default:  3,
+		Default:  config.Int("conceal", "channels", 3),
 		Help:     "Number of RGBA channels to use to encode data. 1 channel uses R, 2 channels use RG, 3 channels use RGB, and 4 channels use RGBA",
-		Validate: numChannelsValidator,
+		Validate: track(concealArgs.given, "channels", numChannelsValidator),
 	})
 
-	concealArgs.verbose = concealCommand.Flag("v", "verbose", &argparse.Options{
+	concealArgs.strategy = concealCommand.Selector("S", "strategy", stego.StrategyNames(), &argparse.Options{
+		Required: false,
+		Default:  config.Choice("conceal", "strategy", stego.StrategyNames(), "lsb"),
+		Help:     "Strategy used to embed the message. One of: " + strings.Join(stego.StrategyNames(), ", "),
+		Validate: track(concealArgs.given, "strategy", nil),
+	})
+
+	concealArgs.profile = concealCommand.Selector("", "profile", profileNames, &argparse.Options{
+		Required: false,
+		Default:  config.Choice("conceal", "profile", profileNames, "none"),
+		Help: "Set the strategy, bits and channels together. stealth uses lsb-matching with 1 bit of 3 channels " +
+			"and capacity uses lsb with 4 bits of 4 channels. Options given on the command line take precedence",
+	})
+
+	concealArgs.traversal = concealCommand.Selector("t", "traversal", traversalNames, &argparse.Options{
+		Required: false,
+		Default:  config.Choice("conceal", "traversal", traversalNames, "linear"),
+		Help: "Order in which pixels are visited. linear goes row by row, keyed uses a random order seeded with " +
+			"the passphrase, and block goes through the image in 8x8 blocks",
+	})
+
+	concealArgs.hideHeader = concealCommand.Flag("H", "hide-header", &argparse.Options{
+		Required: false,
+		Default:  config.Bool("conceal", "hide-header", false),
+		Help: "Mask the header with the passphrase so the image doesn't reveal that it holds a message. " +
+			"Requires a passphrase",
+	})
+
+	concealArgs.noHeader = concealCommand.Flag("", "no-header", &argparse.Options{
 		Required: false,
 		Default:  false,
-		Help:     "Enable verbose",
+		Help: "Leave the header out of the image and print the params reveal needs instead, which have to be " +
+			"shared separately and given to reveal with --params. Use a keyed traversal so the message doesn't " +
+			"start in the top left corner",
 	})
 
-	return concealCommand, concealArgs
-}
+	concealArgs.selfCheck = concealCommand.Flag("", "self-check", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help: "Run the chi-square attack on the stego image once it's written and print how likely it finds " +
+			"embedding, next to the same for the cover",
+	})
 
-func initRevealCommand(parser *argparse.Parser) (*argparse.Command, *RevealArgs) {
-	revealArgs := &RevealArgs{}
+	concealArgs.audit = concealCommand.Flag("", "audit", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help: "Run every detection test on the stego image once it's written and print a scorecard next to the " +
+			"cover's, failing if the suspicion is above max-suspicion. The image is kept either way",
+	})
 
-	revealCommand := parser.NewCommand("reveal", "Reveal a message in an image")
+	concealArgs.maxSuspicion = concealCommand.Float("", "max-suspicion", &argparse.Options{
+		Required: false,
+		Default:  config.Float("conceal", "max-suspicion", 0.5),
+		Help:     "Highest suspicion, from 0 to 1, the audit lets through",
+	})
 
-	revealArgs.imagePath = revealCommand.String("i", "image-path", &argparse.Options{
-		Required: true,
-		Help:     "Path to image with the message you want to reveal",
-		Validate: nonEmptyStringValidator,
+	concealArgs.minPSNR = concealCommand.Float("", "min-psnr", &argparse.Options{
+		Required: false,
+		Default:  config.Float("conceal", "min-psnr", 0),
+		Help: "Lowest PSNR in decibels the stego image may have against the cover. An image below it isn't " +
+			"written. 0 doesn't check",
 	})
 
-	revealArgs.passphrase = revealCommand.String("p", "passphrase", &argparse.Options{
+	concealArgs.minSSIM = concealCommand.Float("", "min-ssim", &argparse.Options{
 		Required: false,
-		Help:     "Passphrase to decrypt the message in the image",
-		Validate: nonEmptyStringValidator,
+		Default:  config.Float("conceal", "min-ssim", 0),
+		Help: "Lowest SSIM the stego image may have against the cover, from 0 to 1. An image below it isn't " +
+			"written. 0 doesn't check",
 	})
 
-	revealArgs.privateKeyPath = revealCommand.String("k", "key-path", &argparse.Options{
+	concealArgs.warnQuality = concealCommand.Flag("", "warn-quality", &argparse.Options{
 		Required: false,
-		Help:     "Path to .pem file containing your private key",
-		Validate: nonEmptyStringValidator,
+		Default:  false,
+		Help:     "Write a stego image below min-psnr or min-ssim anyway, with a warning",
 	})
-	revealArgs.encoding = revealCommand.Selector("e", "encoding", []string{"utf8"}, &argparse.Options{
+
+	concealArgs.targetPSNR = concealCommand.Float("", "target-psnr", &argparse.Options{
 		Required: false,
-		Default:  "utf8",
-		Help:     "Choose the encoding that was originally used to conceal your message",
+		Default:  0.0,
+		Help: "Try the strategies, bits per channel and channels not given, from the least to the most " +
+			"invasive, and keep the first that fits the message with at least this PSNR in decibels. 0 doesn't tune",
 	})
 
-	revealArgs.verbose = revealCommand.Flag("v", "verbose", &argparse.Options{
+	concealArgs.targetSSIM = concealCommand.Float("", "target-ssim", &argparse.Options{
+		Required: false,
+		Default:  0.0,
+		Help:     "Tune like target-psnr to keep at least this SSIM, from 0 to 1. 0 doesn't tune",
+	})
+
+	concealArgs.dryRun = concealCommand.Flag("d", "dry-run", &argparse.Options{
 		Required: false,
 		Default:  false,
-		Help:     "Enable verbose",
+		Help:     "Show how the message would be concealed and whether it fits without writing an image",
 	})
 
-	return revealCommand, revealArgs
+	concealArgs.workers = concealCommand.Int("j", "workers", &argparse.Options{
+		Required: false,
+		Default:  config.Int("conceal", "workers", runtime.NumCPU()),
+		Help:     "Number of goroutines the message is embedded with",
+	})
+
+	concealArgs.appendPayload = concealCommand.Flag("", "append", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help: "Add the message as another payload in the capacity left over by the payloads already in the " +
+			"image, without touching them. It uses the bits, channels and strategy of the image, and the same " +
+			"passphrase and traversal must be given",
+	})
+
+	concealArgs.tiled = concealCommand.Flag("", "tiled", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help: "Read and write the image a band of rows at a time instead of loading all of it, for covers too " +
+			"large to fit in memory. Only 8-bit non-interlaced PNGs are supported and the traversal must be linear",
+	})
+
+	concealArgs.maxMemory = concealCommand.Int("", "max-memory", &argparse.Options{
+		Required: false,
+		Default:  config.Int("conceal", "max-memory", 0),
+		Help: "Most bytes of memory to use, or 0 for no limit. A cover that would need more is concealed in tiles " +
+			"when it can be, and otherwise fails before any work is done",
+	})
+
+	concealArgs.compression = concealCommand.Selector("", "png-compression", compressionNames, &argparse.Options{
+		Required: false,
+		Default:  config.Choice("conceal", "png-compression", compressionNames, "default"),
+		Help:     compressionHelp,
+	})
+
+	concealArgs.codec = concealCommand.String("", "compress", &argparse.Options{
+		Required: false,
+		Default:  config.String("conceal", "compress", "none"),
+		Help: "Compress the message before concealing it so that more fits, written as codec or codec:level. " +
+			"One of: " + strings.Join(stego.CodecNames(), ", ") + ". deflate levels go from 1 for the fastest to 9 " +
+			"for the smallest",
+		Validate: codecValidator,
+	})
+
+	concealArgs.seed = concealCommand.String("", "seed", &argparse.Options{
+		Required: false,
+		Default:  "",
+		Help: "Make every random choice from seed instead of at random, so that the same message, cover and " +
+			"options always make the same image. Meant for tests, since anyone who knows the seed can tell the " +
+			"image holds a message",
+	})
+
+	concealArgs.inPlace = concealCommand.Flag("", "in-place", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "Replace the image with the stego image once it has been written successfully",
+	})
+
+	concealArgs.backup = concealCommand.Flag("", "backup", &argparse.Options{
+		Required: false,
+		Default:  config.Bool("conceal", "backup", false),
+		Help:     "Keep the original image as *filename*.bak when concealing in place",
+	})
+
+	concealArgs.secure = concealCommand.Flag("s", "secure", &argparse.Options{
+		Required: false,
+		Default:  config.Bool("conceal", "secure", false),
+		Help:     "Lock key material in memory so it is never swapped to disk",
+	})
+
+	concealArgs.progress = concealCommand.Selector("P", "progress", progressNames, &argparse.Options{
+		Required: false,
+		Default:  config.Choice("conceal", "progress", progressNames, "auto"),
+		Help: "How progress is shown on stderr. bar draws a progress bar, json writes a JSON object per line, " +
+			"none shows nothing and auto draws a bar only when stderr is a terminal",
+	})
+
+	concealArgs.quiet = concealCommand.Flag("q", "quiet", &argparse.Options{
+		Required: false,
+		Default:  config.Bool("conceal", "quiet", false),
+		Help:     "Don't show any progress",
+	})
+
+	concealArgs.verbose = concealCommand.Flag("v", "verbose", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "Enable verbose",
+	})
+
+	return concealCommand, concealArgs
+}
+
+func initRevealCommand(parser *argparse.Parser, config *Config) (*argparse.Command, *RevealArgs) {
+	revealArgs := &RevealArgs{}
+
+	revealCommand := parser.NewCommand("reveal", "Reveal a message in an image")
+
+	revealArgs.imagePath = revealCommand.String("i", "image-path", &argparse.Options{
+		Required: false,
+		Help:     "Path to image with the message you want to reveal",
+		Validate: nonEmptyStringValidator,
+	})
+
+	revealArgs.shards = revealCommand.String("", "shards", &argparse.Options{
+		Required: false,
+		Help:     "Glob of the images a message was split across with covers, in any order, to join it back",
+		Validate: nonEmptyStringValidator,
+	})
+
+	revealArgs.follow = revealCommand.Flag("", "follow", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help: "Follow the chain the image starts, made with conceal --chain, to the images holding the rest of " +
+			"the message and join it back. The next image is looked for by its name and checksum in the " +
+			"directory of the one before it",
+	})
+
+	revealArgs.slots = revealCommand.Int("", "slots", &argparse.Options{
+		Required: false,
+		Default:  0,
+		Help: "Number of slots the image was split into with conceal --slots, to reveal the slot the " +
+			"passphrase opens. 0 reveals an image without slots",
+	})
+
+	revealArgs.inputDir = revealCommand.String("I", "input-dir", &argparse.Options{
+		Required: false,
+		Help:     "Directory of images to reveal the messages of instead of a single image",
+		Validate: nonEmptyStringValidator,
+	})
+
+	revealArgs.outputDir = revealCommand.String("O", "output-dir", &argparse.Options{
+		Required: false,
+		Help: "Directory the message is written to instead of printing it, named after the file it was " +
+			"concealed from or else its image. With an input directory, the message of every image is written " +
+			"to a directory named after the image, along with a manifest.json of the results",
+		Validate: nonEmptyStringValidator,
+	})
+
+	revealArgs.workers = revealCommand.Int("j", "workers", &argparse.Options{
+		Required: false,
+		Default:  config.Int("reveal", "workers", runtime.NumCPU()),
+		Help: "Number of goroutines the message is extracted with, or the number of images of an input " +
+			"directory revealed at the same time",
+	})
+
+	revealArgs.tiled = revealCommand.Flag("", "tiled", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help: "Read the image a band of rows at a time instead of loading all of it, for images too large to fit " +
+			"in memory. Only 8-bit non-interlaced PNGs concealed with the linear traversal can be read this way, " +
+			"and only the first payload",
+	})
+
+	revealArgs.maxMemory = revealCommand.Int("", "max-memory", &argparse.Options{
+		Required: false,
+		Default:  config.Int("reveal", "max-memory", 0),
+		Help: "Most bytes of memory to use for the image, or 0 for no limit. An image that would need more is " +
+			"revealed in tiles when it can be, and otherwise fails before any work is done",
+	})
+
+	revealArgs.peek = revealCommand.Int("", "peek", &argparse.Options{
+		Required: false,
+		Default:  0,
+		Help:     "Only reveal the first this many bytes of the message",
+	})
+
+	revealArgs.byteRange = revealCommand.String("", "range", &argparse.Options{
+		Required: false,
+		Help: "Only reveal the bytes of the message in start:end, where end is exclusive and either bound can be " +
+			"left out. An unencrypted message is read from start without reading the bytes before it",
+		Validate: byteRangeValidator,
+	})
+
+	revealArgs.payload = revealCommand.Int("", "payload", &argparse.Options{
+		Required: false,
+		Default:  0,
+		Help:     "Which payload to reveal. 0 is the first message, and payloads added with conceal --append follow",
+	})
+
+	revealArgs.format = revealCommand.Selector("", "format", formatNames, &argparse.Options{
+		Required: false,
+		Default:  "auto",
+		Help: "Format of the image. v1 is the format of the first version of Hide and v2 the current one. " +
+			"auto reads v2, and falls back to v1 when the passphrase decrypts it",
+	})
+
+	revealArgs.bestEffort = revealCommand.Flag("", "best-effort", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help: "Reveal whatever can be recovered of a damaged message instead of failing, and report what may be " +
+			"wrong with it. A message that fails authentication is decrypted without it, so only the bits that " +
+			"were damaged come out wrong",
+	})
+
+	revealArgs.ignoreExpiry = revealCommand.Flag("", "ignore-expiry", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "Reveal a message that has expired, with a warning, instead of refusing it",
+	})
+
+	revealArgs.list = revealCommand.Flag("l", "list", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "List the files concealed in the image",
+	})
+
+	revealArgs.extract = revealCommand.StringList("x", "extract", &argparse.Options{
+		Required: false,
+		Help: "Only extract the file with this name to the output directory, or else the current directory. " +
+			"Give it more than once to extract several files",
+		Validate: nonEmptyStringValidator,
+	})
+
+	revealArgs.passphrase = revealCommand.String("p", "passphrase", &argparse.Options{
+		Required: false,
+		Help:     "Passphrase to decrypt the message in the image",
+		Validate: nonEmptyStringValidator,
+	})
+
+	revealArgs.privateKeyPath = revealCommand.String("k", "key-path", &argparse.Options{
+		Required: false,
+		Default:  config.Path("reveal", "key-path", ""),
+		Help:     "Path to .pem file containing your private key",
+		Validate: nonEmptyStringValidator,
+	})
+	revealArgs.traversal = revealCommand.Selector("t", "traversal", traversalNames, &argparse.Options{
+		Required: false,
+		Default:  config.Choice("reveal", "traversal", traversalNames, "linear"),
+		Help:     "Traversal that was originally used to conceal your message",
+	})
+
+	revealArgs.params = revealCommand.String("", "params", &argparse.Options{
+		Required: false,
+		Help:     "Params printed by conceal --no-header, which reveal a message concealed without a header",
+		Validate: paramsValidator,
+	})
+
+	revealArgs.encoding = revealCommand.Selector("e", "encoding", []string{"utf8"}, &argparse.Options{
+		Required: false,
+		Default:  "utf8",
+		Help:     "Choose the encoding that was originally used to conceal your message",
+	})
+
+	revealArgs.secure = revealCommand.Flag("s", "secure", &argparse.Options{
+		Required: false,
+		Default:  config.Bool("reveal", "secure", false),
+		Help:     "Lock key material in memory so it is never swapped to disk",
+	})
+
+	revealArgs.progress = revealCommand.Selector("P", "progress", progressNames, &argparse.Options{
+		Required: false,
+		Default:  config.Choice("reveal", "progress", progressNames, "auto"),
+		Help: "How progress is shown on stderr. bar draws a progress bar, json writes a JSON object per line, " +
+			"none shows nothing and auto draws a bar only when stderr is a terminal",
+	})
+
+	revealArgs.quiet = revealCommand.Flag("q", "quiet", &argparse.Options{
+		Required: false,
+		Default:  config.Bool("reveal", "quiet", false),
+		Help:     "Don't show any progress",
+	})
+
+	revealArgs.verbose = revealCommand.Flag("v", "verbose", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "Enable verbose",
+	})
+
+	return revealCommand, revealArgs
+}
+
+func initInfoCommand(parser *argparse.Parser) (*argparse.Command, *InfoArgs) {
+	infoArgs := &InfoArgs{}
+
+	infoCommand := parser.NewCommand("info", "Show the header of an image with a concealed message")
+
+	infoArgs.imagePath = infoCommand.String("i", "image-path", &argparse.Options{
+		Required: true,
+		Help:     "Path to image you want to inspect",
+		Validate: nonEmptyStringValidator,
+	})
+
+	infoArgs.passphrase = infoCommand.String("p", "passphrase", &argparse.Options{
+		Required: false,
+		Help: "Passphrase the message was concealed with. It authenticates the header, reads a hidden " +
+			"header, and checks that the message decrypts",
+		Validate: nonEmptyStringValidator,
+	})
+
+	infoArgs.traversal = infoCommand.Selector("t", "traversal", traversalNames, &argparse.Options{
+		Required: false,
+		Default:  "linear",
+		Help:     "Traversal that was originally used to conceal your message",
+	})
+
+	return infoCommand, infoArgs
+}
+
+func initDetectCommand(parser *argparse.Parser) (*argparse.Command, *DetectArgs) {
+	detectArgs := &DetectArgs{}
+
+	detectCommand := parser.NewCommand("detect", "Test whether an image looks like it holds a hidden message")
+
+	detectArgs.imagePath = detectCommand.String("i", "image-path", &argparse.Options{
+		Required: true,
+		Help:     "Path to image you want to test",
+		Validate: nonEmptyStringValidator,
+	})
+
+	detectArgs.curve = detectCommand.Int("", "curve", &argparse.Options{
+		Required: false,
+		Default:  0,
+		Help: "Also run the chi-square attack on growing runs of pixels from the top left corner and print the " +
+			"probability of embedding at this many points. A message concealed along the rows shows as " +
+			"probabilities close to 1 that drop where it ends",
+	})
+
+	detectArgs.useModel = detectCommand.Flag("", "use-model", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help: "Also run the bundled model and count it in the suspicion. It was only trained on synthetic " +
+			"images and can score a photograph holding a message lower than its cover, so don't trust it on " +
+			"real photographs",
+	})
+
+	detectArgs.modelPath = detectCommand.String("", "model", &argparse.Options{
+		Required: false,
+		Help: "Path to the weights of a model trained on images like the one tested, written as JSON, to run " +
+			"along with the tests and count in the suspicion",
+		Validate: nonEmptyStringValidator,
+	})
+
+	return detectCommand, detectArgs
+}
+
+func initAnalyzeCommand(parser *argparse.Parser) (*argparse.Command, *AnalyzeArgs) {
+	analyzeArgs := &AnalyzeArgs{}
+
+	analyzeCommand := parser.NewCommand("analyze",
+		"Measure the noise, least significant bit randomness and block artifacts of an image without its cover")
+
+	analyzeArgs.imagePath = analyzeCommand.String("i", "image-path", &argparse.Options{
+		Required: true,
+		Help:     "Path to image you want to analyze",
+		Validate: nonEmptyStringValidator,
+	})
+
+	analyzeArgs.json = analyzeCommand.Flag("", "json", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "Print the report as JSON",
+	})
+
+	return analyzeCommand, analyzeArgs
+}
+
+func initEstimateRateCommand(parser *argparse.Parser) (*argparse.Command, *EstimateRateArgs) {
+	estimateRateArgs := &EstimateRateArgs{}
+
+	estimateRateCommand := parser.NewCommand("estimate-rate",
+		"Estimate how many bits of hidden message each pixel of an image holds, without its cover")
+
+	estimateRateArgs.imagePath = estimateRateCommand.String("i", "image-path", &argparse.Options{
+		Required: true,
+		Help:     "Path to image you want to estimate the embedding rate of",
+		Validate: nonEmptyStringValidator,
+	})
+
+	estimateRateArgs.json = estimateRateCommand.Flag("", "json", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "Print the estimate as JSON",
+	})
+
+	return estimateRateCommand, estimateRateArgs
+}
+
+func initCompareCommand(parser *argparse.Parser) (*argparse.Command, *CompareArgs) {
+	compareArgs := &CompareArgs{}
+
+	compareCommand := parser.NewCommand("compare", "Measure how much a stego image differs from its cover")
+
+	compareArgs.imagePath = compareCommand.String("i", "image-path", &argparse.Options{
+		Required: true,
+		Help:     "Path to the stego image",
+		Validate: nonEmptyStringValidator,
+	})
+
+	compareArgs.coverPath = compareCommand.String("", "cover", &argparse.Options{
+		Required: true,
+		Help:     "Path to the cover the message was concealed in",
+		Validate: nonEmptyStringValidator,
+	})
+
+	compareArgs.includeAlpha = compareCommand.Flag("", "alpha", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "Compare the alpha channel as well, whose changes don't show in the colors",
+	})
+
+	compareArgs.dct = compareCommand.Flag("", "dct", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help: "Also compare the histograms of the 8x8 block DCT coefficients of the luminance, with the pairs of " +
+			"coefficients whose counts embedding evened out the most",
+	})
+
+	compareArgs.montagePath = compareCommand.String("", "montage", &argparse.Options{
+		Required: false,
+		Help: "Also write a PNG with the cover, the stego image, their amplified difference and a heatmap of the " +
+			"changes side by side, to look over or attach to a report",
+		Validate: nonEmptyStringValidator,
+	})
+
+	compareArgs.amplify = compareCommand.Int("", "amplify", &argparse.Options{
+		Required: false,
+		Default:  64,
+		Help:     "What the difference in the montage is multiplied by, so changes of a unit or two show",
+	})
+
+	compareArgs.json = compareCommand.Flag("", "json", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "Print the report as JSON, with the number of pixels modified and where, for scripts to check",
+	})
+
+	return compareCommand, compareArgs
+}
+
+func initTraceCommand(parser *argparse.Parser) (*argparse.Command, *TraceArgs) {
+	traceArgs := &TraceArgs{}
+
+	traceCommand := parser.NewCommand("trace", "Find which recipient's fingerprinted copy an image came from")
+
+	traceArgs.imagePath = traceCommand.String("i", "image-path", &argparse.Options{
+		Required: true,
+		Help:     "Path to the copy that leaked",
+		Validate: nonEmptyStringValidator,
+	})
+
+	traceArgs.recipients = traceCommand.String("", "recipients", &argparse.Options{
+		Required: true,
+		Help:     "File with a recipient per line, as given to conceal",
+		Validate: nonEmptyStringValidator,
+	})
+
+	traceArgs.key = traceCommand.String("k", "fingerprint-key", &argparse.Options{
+		Required: true,
+		Help:     "Key the fingerprints were made with",
+		Validate: nonEmptyStringValidator,
+	})
+
+	traceArgs.coverPath = traceCommand.String("", "cover", &argparse.Options{
+		Required: false,
+		Help: "Path to the cover the copies were made from, which makes tracing far more reliable. Without it, the " +
+			"fingerprint can be lost in the fine detail of small or noisy images",
+		Validate: nonEmptyStringValidator,
+	})
+
+	traceArgs.minScore = traceCommand.Float("", "min-score", &argparse.Options{
+		Required: false,
+		Default:  6.0,
+		Help:     "Lowest score a fingerprint counts as found with. Scores of images without it stay below 4",
+	})
+
+	traceArgs.json = traceCommand.Flag("", "json", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "Print the score of every recipient as JSON",
+	})
+
+	return traceCommand, traceArgs
+}
+
+func initPlanesCommand(parser *argparse.Parser) (*argparse.Command, *PlanesArgs) {
+	planesArgs := &PlanesArgs{}
+
+	planesCommand := parser.NewCommand("planes", "Write an image of every bit plane of every channel")
+
+	planesArgs.imagePath = planesCommand.String("i", "image-path", &argparse.Options{
+		Required: true,
+		Help:     "Path to image you want to inspect",
+		Validate: nonEmptyStringValidator,
+	})
+
+	planesArgs.outDir = planesCommand.String("o", "output", &argparse.Options{
+		Required: true,
+		Help:     "Directory the bit planes are written to, named after the channel and bit, such as R0.png",
+		Validate: nonEmptyStringValidator,
+	})
+
+	planesArgs.numChannels = planesCommand.Int("c", "channels", &argparse.Options{
+		Required: false,
+		Default:  4,
+		Help:     "Number of RGBA channels to write the bit planes of",
+		Validate: numChannelsValidator,
+	})
+
+	planesArgs.numBits = planesCommand.Int("n", "num-bits", &argparse.Options{
+		Required: false,
+		Default:  8,
+		Help:     "Number of bit planes to write per channel, starting from the least significant",
+		Validate: byteIndexValidator,
+	})
+
+	return planesCommand, planesArgs
+}
+
+func initEditCommand(parser *argparse.Parser) (*argparse.Command, *EditArgs) {
+	editArgs := &EditArgs{}
+
+	editCommand := parser.NewCommand("edit", "Change the metadata of a message without concealing it again")
+
+	editArgs.imagePath = editCommand.String("i", "image-path", &argparse.Options{
+		Required: true,
+		Help:     "Path to image whose metadata is edited",
+		Validate: nonEmptyStringValidator,
+	})
+
+	editArgs.passphrase = editCommand.String("p", "passphrase", &argparse.Options{
+		Required: false,
+		Help:     "Passphrase the message was concealed with",
+		Validate: nonEmptyStringValidator,
+	})
+
+	editArgs.traversal = editCommand.Selector("t", "traversal", traversalNames, &argparse.Options{
+		Required: false,
+		Default:  "linear",
+		Help:     "Traversal that was originally used to conceal your message",
+	})
+
+	editArgs.payload = editCommand.Int("", "payload", &argparse.Options{
+		Required: false,
+		Default:  0,
+		Help:     "Which payload to edit. 0 is the first message, and payloads added with conceal --append follow",
+	})
+
+	editArgs.comment = editCommand.String("", "comment", &argparse.Options{
+		Required: false,
+		Help:     "Comment to store with the message",
+		Validate: nonEmptyStringValidator,
+	})
+
+	editArgs.fileName = editCommand.String("", "filename", &argparse.Options{
+		Required: false,
+		Help:     "Name the message is restored under by reveal",
+		Validate: nonEmptyStringValidator,
+	})
+
+	editArgs.fileType = editCommand.String("", "type", &argparse.Options{
+		Required: false,
+		Help: "Media type of the message. If it isn't given, it is guessed from the extension of --filename " +
+			"and otherwise left as it was",
+		Validate: nonEmptyStringValidator,
+	})
+
+	editArgs.output = editCommand.String("o", "output", &argparse.Options{
+		Required: false,
+		Help:     "Output path for the edited image. If no output path is provided then the image is edited in place",
+		Validate: nonEmptyStringValidator,
+	})
+
+	editArgs.compression = editCommand.Selector("", "png-compression", compressionNames, &argparse.Options{
+		Required: false,
+		Default:  "default",
+		Help:     compressionHelp,
+	})
+
+	editArgs.backup = editCommand.Flag("", "backup", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "Keep the original image as *filename*.bak when editing in place",
+	})
+
+	return editCommand, editArgs
+}
+
+func initMigrateCommand(parser *argparse.Parser) (*argparse.Command, *MigrateArgs) {
+	migrateArgs := &MigrateArgs{}
+
+	migrateCommand := parser.NewCommand("migrate", "Conceal the message of an image of the first format again in the current format")
+
+	migrateArgs.imagePath = migrateCommand.String("i", "image-path", &argparse.Options{
+		Required: true,
+		Help:     "Path to image of the first format",
+		Validate: nonEmptyStringValidator,
+	})
+
+	migrateArgs.passphrase = migrateCommand.String("p", "passphrase", &argparse.Options{
+		Required: false,
+		Help:     "Passphrase the message was concealed with, which it is encrypted with again",
+		Validate: nonEmptyStringValidator,
+	})
+
+	migrateArgs.output = migrateCommand.String("o", "output", &argparse.Options{
+		Required: false,
+		Help: "Output path for the migrated image. " +
+			"If no output path is provided then the image will be named *filename*.migrated",
+		Validate: nonEmptyStringValidator,
+	})
+
+	migrateArgs.inPlace = migrateCommand.Flag("", "in-place", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "Replace the image with the migrated image once it has been written successfully",
+	})
+
+	migrateArgs.compression = migrateCommand.Selector("", "png-compression", compressionNames, &argparse.Options{
+		Required: false,
+		Default:  "default",
+		Help:     compressionHelp,
+	})
+
+	migrateArgs.backup = migrateCommand.Flag("", "backup", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "Keep the original image as *filename*.bak when migrating in place",
+	})
+
+	return migrateCommand, migrateArgs
+}
+
+func initVerifyCommand(parser *argparse.Parser) (*argparse.Command, *VerifyArgs) {
+	verifyArgs := &VerifyArgs{}
+
+	verifyCommand := parser.NewCommand("verify", "Check that every payload of an image can be recovered")
+
+	verifyArgs.imagePath = verifyCommand.String("i", "image-path", &argparse.Options{
+		Required: true,
+		Help:     "Path to image you want to verify",
+		Validate: nonEmptyStringValidator,
+	})
+
+	verifyArgs.passphrase = verifyCommand.String("p", "passphrase", &argparse.Options{
+		Required: false,
+		Help:     "Passphrase the payloads were concealed with",
+		Validate: nonEmptyStringValidator,
+	})
+
+	verifyArgs.traversal = verifyCommand.Selector("t", "traversal", traversalNames, &argparse.Options{
+		Required: false,
+		Default:  "linear",
+		Help:     "Traversal that was originally used to conceal your message",
+	})
+
+	verifyArgs.params = verifyCommand.String("", "params", &argparse.Options{
+		Required: false,
+		Help:     "Params printed by conceal --no-header, which verify a message concealed without a header",
+		Validate: paramsValidator,
+	})
+
+	verifyArgs.deep = verifyCommand.Flag("", "deep", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help: "Read every payload to the end without writing it anywhere, decrypting and authenticating " +
+			"encrypted payloads and checking files against their metadata. The ID of each payload is printed",
+	})
+
+	return verifyCommand, verifyArgs
+}
+
+func initCapacityCommand(parser *argparse.Parser) (*argparse.Command, *CapacityArgs) {
+	capacityArgs := &CapacityArgs{}
+
+	capacityCommand := parser.NewCommand("capacity", "Show how much an image can hold and whether a file fits")
+
+	capacityArgs.imagePath = capacityCommand.String("i", "image-path", &argparse.Options{
+		Required: true,
+		Help:     "Path to image you want to conceal a message in",
+		Validate: nonEmptyStringValidator,
+	})
+
+	capacityArgs.numBitsPerChannel = capacityCommand.Int("n", "num-bits", &argparse.Options{
+		Required: false,
+		Default:  1,
+		Help:     "Number of bits to use per channel value",
+		Validate: byteIndexValidator,
+	})
+
+	capacityArgs.numChannels = capacityCommand.Int("c", "channels", &argparse.Options{
+		Required: false,
+		Default:  3,
+		Help:     "Number of RGBA channels to use to encode data",
+		Validate: numChannelsValidator,
+	})
+
+	capacityArgs.strategy = capacityCommand.Selector("S", "strategy", stego.StrategyNames(), &argparse.Options{
+		Required: false,
+		Default:  "lsb",
+		Help:     "Strategy used to embed the message. One of: " + strings.Join(stego.StrategyNames(), ", "),
+	})
+
+	capacityArgs.passphrase = capacityCommand.String("p", "passphrase", &argparse.Options{
+		Required: false,
+		Help:     "Passphrase the message would be encrypted with, which adds the overhead of the encryption",
+		Validate: nonEmptyStringValidator,
+	})
+
+	capacityArgs.file = capacityCommand.String("f", "file", &argparse.Options{
+		Required: false,
+		Help:     "File to check against the capacity, along with the metadata conceal -f would add to it",
+		Validate: nonEmptyStringValidator,
+	})
+
+	capacityArgs.json = capacityCommand.Flag("", "json", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "Print the report as JSON",
+	})
+
+	return capacityCommand, capacityArgs
+}
+
+func initWipeCommand(parser *argparse.Parser) (*argparse.Command, *WipeArgs) {
+	wipeArgs := &WipeArgs{}
+
+	wipeCommand := parser.NewCommand("wipe", "Destroy any message hidden in the low bits of an image")
+
+	wipeArgs.imagePath = wipeCommand.String("i", "image-path", &argparse.Options{
+		Required: true,
+		Help:     "Path to image you want to wipe",
+		Validate: nonEmptyStringValidator,
+	})
+
+	wipeArgs.output = wipeCommand.String("o", "output", &argparse.Options{
+		Required: false,
+		Help: "Output path for the wiped image. " +
+			"If no output path is provided then the image will be named *filename*.wiped",
+		Validate: nonEmptyStringValidator,
+	})
+
+	wipeArgs.inPlace = wipeCommand.Flag("", "in-place", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "Replace the image with the wiped image once it has been written successfully",
+	})
+
+	wipeArgs.compression = wipeCommand.Selector("", "png-compression", compressionNames, &argparse.Options{
+		Required: false,
+		Default:  "default",
+		Help:     compressionHelp,
+	})
+
+	wipeArgs.backup = wipeCommand.Flag("", "backup", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "Keep the original image as *filename*.bak when wiping in place",
+	})
+
+	wipeArgs.numBits = wipeCommand.Int("n", "num-bits", &argparse.Options{
+		Required: false,
+		Default:  2,
+		Help:     "Number of bits per channel value to replace with random bits, starting from the least significant",
+		Validate: byteIndexValidator,
+	})
+
+	wipeArgs.numChannels = wipeCommand.Int("c", "channels", &argparse.Options{
+		Required: false,
+		Default:  3,
+		Help: "Number of RGBA channels to wipe. 3 leaves the alpha channel alone so an opaque image stays " +
+			"opaque, and 4 wipes it too",
+		Validate: numChannelsValidator,
+	})
+
+	wipeArgs.progress = wipeCommand.Selector("P", "progress", progressNames, &argparse.Options{
+		Required: false,
+		Default:  "auto",
+		Help: "How progress is shown on stderr. bar draws a progress bar, json writes a JSON object per line, " +
+			"none shows nothing and auto draws a bar only when stderr is a terminal",
+	})
+
+	wipeArgs.quiet = wipeCommand.Flag("q", "quiet", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "Don't show any progress",
+	})
+
+	return wipeCommand, wipeArgs
+}
+
+func initScanCommand(parser *argparse.Parser, config *Config) (*argparse.Command, *ScanArgs) {
+	scanArgs := &ScanArgs{}
+
+	scanCommand := parser.NewCommand("scan", "Report the images in a directory tree that hold a header or look suspicious")
+
+	scanArgs.dir = scanCommand.String("d", "dir", &argparse.Options{
+		Required: true,
+		Help:     "Directory to scan recursively",
+		Validate: nonEmptyStringValidator,
+	})
+
+	scanArgs.threshold = scanCommand.Float("T", "threshold", &argparse.Options{
+		Required: false,
+		Default:  config.Float("scan", "threshold", 0.5),
+		Help:     "Suspicion score from which an image without a header is reported",
+	})
+
+	scanArgs.workers = scanCommand.Int("j", "workers", &argparse.Options{
+		Required: false,
+		Default:  config.Int("scan", "workers", config.Int("scan", "jobs", runtime.NumCPU())),
+		Help:     "Number of images scanned at the same time",
+	})
+
+	scanArgs.jobs = scanCommand.Int("", "jobs", &argparse.Options{
+		Required: false,
+		Default:  0,
+		Help:     "Old name of workers, which it overrides when given",
+	})
+
+	scanArgs.maxFileSize = scanCommand.Int("m", "max-file-size", &argparse.Options{
+		Required: false,
+		Default:  config.Int("scan", "max-file-size", 64<<20),
+		Help:     "Files larger than this many bytes are skipped",
+	})
+
+	scanArgs.maxPixels = scanCommand.Int("P", "max-pixels", &argparse.Options{
+		Required: false,
+		Default:  config.Int("scan", "max-pixels", 64<<20),
+		Help:     "Images with more pixels than this are skipped without being decoded",
+	})
+
+	scanArgs.verbose = scanCommand.Flag("v", "verbose", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "Also list the files that were skipped",
+	})
+
+	return scanCommand, scanArgs
+}
+
+func initBenchCommand(parser *argparse.Parser) (*argparse.Command, *BenchArgs) {
+	benchArgs := &BenchArgs{}
+
+	benchCommand := parser.NewCommand("bench", "Measure the throughput of each strategy, encryption, copying the cover and PNG encoding")
+
+	benchArgs.width = benchCommand.Int("x", "width", &argparse.Options{
+		Required: false,
+		Default:  1024,
+		Help:     "Width of the generated cover image",
+	})
+
+	benchArgs.height = benchCommand.Int("y", "height", &argparse.Options{
+		Required: false,
+		Default:  1024,
+		Help:     "Height of the generated cover image",
+	})
+
+	benchArgs.rounds = benchCommand.Int("r", "rounds", &argparse.Options{
+		Required: false,
+		Default:  3,
+		Help:     "Number of times each benchmark is run. The fastest round is reported",
+	})
+
+	return benchCommand, benchArgs
+}
+
+func initSelftestCommand(parser *argparse.Parser) (*argparse.Command, *SelftestArgs) {
+	selftestArgs := &SelftestArgs{}
+
+	selftestCommand := parser.NewCommand("selftest", "Round-trip a payload through every strategy, encryption and traversal, and a header through the current format version")
+
+	selftestArgs.verbose = selftestCommand.Flag("v", "verbose", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "List the round trips that passed as well",
+	})
+
+	return selftestCommand, selftestArgs
+}
+
+func initServeCommand(parser *argparse.Parser, config *Config) (*argparse.Command, *ServeArgs) {
+	serveArgs := &ServeArgs{}
+
+	serveCommand := parser.NewCommand("serve", "Serve conceal, reveal and info over HTTP")
+
+	serveArgs.address = serveCommand.String("a", "address", &argparse.Options{
+		Required: false,
+		Default:  config.String("serve", "address", ":8080"),
+		Help:     "Address to listen on",
+		Validate: nonEmptyStringValidator,
+	})
+
+	serveArgs.maxSize = serveCommand.Int("m", "max-size", &argparse.Options{
+		Required: false,
+		Default:  config.Int("serve", "max-size", 32<<20),
+		Help:     "Maximum size of a request in bytes",
+	})
+
+	serveArgs.maxPixels = serveCommand.Int("", "max-pixels", &argparse.Options{
+		Required: false,
+		Default:  config.Int("serve", "max-pixels", 1<<25),
+		Help:     "Maximum number of pixels of an uploaded image, checked before the image is decoded",
+	})
+
+	serveArgs.maxConcurrent = serveCommand.Int("j", "max-concurrent", &argparse.Options{
+		Required: false,
+		Default:  config.Int("serve", "max-concurrent", runtime.NumCPU()),
+		Help:     "Maximum number of requests handled at the same time",
+	})
+
+	return serveCommand, serveArgs
+}
+
+func initWatchCommand(parser *argparse.Parser, config *Config) (*argparse.Command, *WatchArgs) {
+	watchArgs := &WatchArgs{}
+
+	watchCommand := parser.NewCommand("watch", "Conceal or reveal every file dropped into a directory")
+
+	watchArgs.inDir = watchCommand.String("i", "in", &argparse.Options{
+		Required: true,
+		Help:     "Directory to watch for new files",
+		Validate: nonEmptyStringValidator,
+	})
+
+	watchArgs.outDir = watchCommand.String("o", "out", &argparse.Options{
+		Required: true,
+		Help:     "Directory the results and their logs are written to",
+		Validate: nonEmptyStringValidator,
+	})
+
+	watchArgs.reveal = watchCommand.Flag("r", "reveal", &argparse.Options{
+		Required: false,
+		Default:  false,
+		Help:     "Reveal the message in every dropped image instead of concealing every dropped file in the cover",
+	})
+
+	watchArgs.coverPath = watchCommand.String("C", "cover", &argparse.Options{
+		Required: false,
+		Default:  config.Path("watch", "cover", ""),
+		Help:     "Path to the cover image dropped files are concealed in",
+		Validate: nonEmptyStringValidator,
+	})
+
+	watchArgs.passphrase = watchCommand.String("p", "passphrase", &argparse.Options{
+		Required: false,
+		Help:     "Passphrase to encrypt or decrypt the messages",
+		Validate: nonEmptyStringValidator,
+	})
+
+	watchArgs.numBitsPerChannel = watchCommand.Int("n", "num-bits", &argparse.Options{
+		Required: false,
+		Default:  config.Int("watch", "num-bits", 1),
+		Help:     "Number of bits to use per channel value",
+		Validate: byteIndexValidator,
+	})
+
+	watchArgs.numChannels = watchCommand.Int("c", "channels", &argparse.Options{
+		Required: false,
+		Default:  config.Int("watch", "channels", 3),
+		Help:     "Number of RGBA channels to use to encode data",
+		Validate: numChannelsValidator,
+	})
+
+	watchArgs.strategy = watchCommand.Selector("S", "strategy", stego.StrategyNames(), &argparse.Options{
+		Required: false,
+		Default:  config.Choice("watch", "strategy", stego.StrategyNames(), "lsb"),
+		Help:     "Strategy used to embed the messages. One of: " + strings.Join(stego.StrategyNames(), ", "),
+	})
+
+	watchArgs.traversal = watchCommand.Selector("t", "traversal", traversalNames, &argparse.Options{
+		Required: false,
+		Default:  config.Choice("watch", "traversal", traversalNames, "linear"),
+		Help:     "Order in which pixels are visited",
+	})
+
+	watchArgs.hideHeader = watchCommand.Flag("H", "hide-header", &argparse.Options{
+		Required: false,
+		Default:  config.Bool("watch", "hide-header", false),
+		Help:     "Mask the header with the passphrase. Requires a passphrase",
+	})
+
+	watchArgs.id = watchCommand.Flag("", "id", &argparse.Options{
+		Required: false,
+		Default:  config.Bool("watch", "id", false),
+		Help:     "Store a random ID with every message, like conceal --id",
+	})
+
+	watchArgs.interval = watchCommand.Int("I", "interval", &argparse.Options{
+		Required: false,
+		Default:  config.Int("watch", "interval", 2),
+		Help:     "Number of seconds between scans of the directory",
+	})
+
+	return watchCommand, watchArgs
 }
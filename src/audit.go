@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/analysis"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"os"
+	"text/tabwriter"
+)
+
+// errTooSuspicious is returned by conceal when the audit of the stego image finds it more suspicious than allowed
+var errTooSuspicious = errors.New("stego image is more suspicious than max-suspicion")
+
+// audit runs every detection test on the stego image just written and on its cover, and prints them side by
+// side as a scorecard. The cover is the backup when concealing in place, or left out without one. It returns
+// errTooSuspicious if the suspicion of the stego image is above maxSuspicion.
+func audit(coverPath string, stegoPath string, maxSuspicion float64) error {
+	img, err := stego.LoadImage(stegoPath)
+	if err != nil {
+		return err
+	}
+	report := analysis.Detect(img)
+
+	var coverReport *analysis.Report
+	if coverPath != "" {
+		cover, err := stego.LoadImage(coverPath)
+		if err != nil {
+			return err
+		}
+		detected := analysis.Detect(cover)
+		coverReport = &detected
+	}
+
+	fmt.Println("Audit:")
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if coverReport != nil {
+		fmt.Fprintln(writer, "TEST\tCOVER\tSTEGO")
+	} else {
+		fmt.Fprintln(writer, "TEST\tSTEGO")
+	}
+
+	row := func(name string, i int, score float64) {
+		if coverReport == nil {
+			fmt.Fprintf(writer, "%s\t%.3f\n", name, score)
+			return
+		}
+
+		coverScore := coverReport.Score
+		if i >= 0 {
+			coverScore = coverReport.Tests[i].Score
+		}
+		fmt.Fprintf(writer, "%s\t%.3f\t%.3f\n", name, coverScore, score)
+	}
+
+	for i, test := range report.Tests {
+		row(test.Name, i, test.Score)
+	}
+	row("suspicion", -1, report.Score)
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	if report.Score > maxSuspicion {
+		fmt.Printf("FAIL: suspicion %.3f is above %.3f\n", report.Score, maxSuspicion)
+		return errTooSuspicious
+	}
+
+	fmt.Printf("PASS: suspicion %.3f is at most %.3f\n", report.Score, maxSuspicion)
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/stego"
+)
+
+// tuneCandidate is one set of embedding parameters auto-tune tries
+type tuneCandidate struct {
+	strategy          string
+	numBitsPerChannel int
+	numChannels       int
+}
+
+// options returns the options that set the parameters of the candidate
+func (self tuneCandidate) options() []stego.Option {
+	strategy, _ := stego.LookupStrategy(self.strategy)
+	return []stego.Option{
+		stego.WithStrategy(strategy),
+		stego.WithBitsPerChannel(self.numBitsPerChannel),
+		stego.WithChannels(self.numChannels),
+	}
+}
+
+func (self tuneCandidate) String() string {
+	return fmt.Sprintf("%s, bits %d, channels %d", self.strategy, self.numBitsPerChannel, self.numChannels)
+}
+
+// tuneCandidates returns the parameters auto-tune tries for conceal, in the order they're likely to change the
+// cover the least: fewer bits per channel first, and for each more channels first, so the message is spread
+// over fewer pixels. Alpha is only used when the channels are given, since changes to it make an opaque image
+// see-through in places without PSNR noticing. Parameters given on the command line aren't tuned.
+func tuneCandidates(args *ConcealArgs) []tuneCandidate {
+	strategies := stego.StrategyNames()
+	if args.given["strategy"] {
+		strategies = []string{*args.strategy}
+	}
+
+	bits := []int{1, 2, 3, 4, 5, 6, 7, 8}
+	if args.given["num-bits"] {
+		bits = []int{*args.numBitsPerChannel}
+	}
+
+	channels := []int{3, 2, 1}
+	if args.given["channels"] {
+		channels = []int{*args.numChannels}
+	}
+
+	var candidates []tuneCandidate
+	for _, numBits := range bits {
+		for _, numChannels := range channels {
+			for _, strategy := range strategies {
+				candidates = append(candidates, tuneCandidate{strategy, numBits, numChannels})
+			}
+		}
+	}
+
+	return candidates
+}
+
+// autoTune conceals the message with the first of candidates that both fits it and keeps the stego image's PSNR
+// and SSIM against the cover at coverPath at least targetPSNR and targetSSIM, calling conceal with the options
+// of each. Only the image of the candidate chosen is left at outputPath.
+func autoTune(coverPath string, outputPath string, targetPSNR float64, targetSSIM float64,
+	candidates []tuneCandidate, logger stego.Logger, conceal func(path string, opts []stego.Option) error) error {
+
+	cover, err := stego.LoadImage(coverPath)
+	if err != nil {
+		return err
+	}
+
+	fits := false
+	for _, candidate := range candidates {
+		var psnr, ssim float64
+
+		err := writeThroughTemp(outputPath, func(path string) error {
+			return conceal(path, candidate.options())
+		}, func(path string) error {
+			comparison, err := measureQuality(cover, path)
+			if err != nil {
+				return err
+			}
+
+			psnr, ssim = comparison.PSNR, comparison.SSIM
+			if !meetsQuality(comparison, targetPSNR, targetSSIM) {
+				return errQualityTooLow
+			}
+			return nil
+		})
+
+		switch {
+		case err == nil:
+			fmt.Printf("Auto-tune: %s, PSNR %s, SSIM %.6f\n", candidate, formatPSNR(psnr), ssim)
+			return nil
+		case errors.Is(err, stego.ErrCapacityExceeded):
+			logger.Println("Auto-tune:", candidate, "doesn't fit the message")
+		case errors.Is(err, errQualityTooLow):
+			fits = true
+			logger.Println(fmt.Sprintf("Auto-tune: %s gives PSNR %s, SSIM %.6f", candidate, formatPSNR(psnr), ssim))
+		default:
+			return err
+		}
+	}
+
+	if !fits {
+		return stego.ErrCapacityExceeded
+	}
+	return fmt.Errorf("no embedding parameters reach the target quality: %w", errQualityTooLow)
+}
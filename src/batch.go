@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// manifestEntry records what happened to a single image of a batch
+type manifestEntry struct {
+	Input  string         `json:"input"`
+	Output string         `json:"output,omitempty"`
+	Files  []string       `json:"files,omitempty"`
+	Size   int            `json:"size,omitempty"`
+	SHA256 string         `json:"sha256,omitempty"`
+	Damage []stego.Damage `json:"damage,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// manifest is written next to the payloads revealed from a directory
+type manifest struct {
+	Succeeded int             `json:"succeeded"`
+	Failed    int             `json:"failed"`
+	Files     []manifestEntry `json:"files"`
+}
+
+// manifestName is the name of the manifest in the output directory
+const manifestName = "manifest.json"
+
+// revealDir reveals the message in every image of the input directory, writes each to a directory of its own in
+// the output directory named after its image, and writes a manifest of the results. Images are revealed
+// by a pool of workers, and an image that fails doesn't stop the others.
+func revealDir(args *RevealArgs) error {
+	entries, err := ioutil.ReadDir(*args.inputDir)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*args.outputDir, 0755); err != nil {
+		return err
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			paths = append(paths, filepath.Join(*args.inputDir, entry.Name()))
+		}
+	}
+
+	// Each image is revealed by a single worker and without progress of its own, since the images themselves
+	// are spread over the workers and the batch reports how many of them are done
+	opts := append(args.options(), stego.WithWorkers(1), stego.WithProgress(nil))
+	progress := makeProgress(*args.progress, *args.quiet)
+
+	result := manifest{Files: make([]manifestEntry, len(paths))}
+	indices := make(chan int)
+	done := make(chan int)
+
+	var workers sync.WaitGroup
+	for i := 0; i < *args.workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for index := range indices {
+				result.Files[index] = revealToFile(paths[index], *args.outputDir, opts)
+				done <- index
+			}
+		}()
+	}
+
+	go func() {
+		for index := range paths {
+			indices <- index
+		}
+		close(indices)
+		workers.Wait()
+		close(done)
+	}()
+
+	if progress != nil {
+		progress.OnStart("revealing images", len(paths))
+	}
+	numDone := 0
+
+	for index := range done {
+		manifestEntry := result.Files[index]
+
+		if manifestEntry.Error != "" {
+			result.Failed++
+			fmt.Printf("%s: %s\n", manifestEntry.Input, manifestEntry.Error)
+		} else {
+			result.Succeeded++
+			fmt.Printf("%s -> %s\n", manifestEntry.Input, manifestEntry.Output)
+		}
+
+		numDone++
+		if progress != nil {
+			progress.OnProgress(numDone)
+		}
+	}
+
+	if progress != nil {
+		progress.OnDone()
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(*args.outputDir, manifestName), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	fmt.Println("Revealed:", result.Succeeded, "Failed:", result.Failed)
+	return nil
+}
+
+// revealToFile reveals the message in the image at path and writes it to a directory of outputDir named after
+// the image, so that images with the same name but another extension don't overwrite each other. The files are
+// restored under the names their metadata records, or else under the name of the image without its extension.
+func revealToFile(path string, outputDir string, opts []stego.Option) manifestEntry {
+	entry := manifestEntry{Input: path}
+
+	message, result, err := stego.Reveal(path, opts...)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+	defer zeroBytes(message)
+
+	dirName := filepath.Base(path)
+	if dirName == manifestName {
+		dirName += ".payload"
+	}
+	dir := filepath.Join(outputDir, dirName)
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	files, err := writeMessage(dir, result.Metadata, message, name)
+	entry.Files = files
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+
+	entry.Output = dir
+	entry.Size = result.Size
+	entry.SHA256 = fmt.Sprintf("%x", result.Checksum)
+	entry.Damage = result.Damage
+	return entry
+}
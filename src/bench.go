@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// benchCase is a single row of the benchmark table. prepare, if set, is run once before the timed rounds.
+type benchCase struct {
+	name    string
+	prepare func(cover *image.NRGBA) error
+	run     func(cover *image.NRGBA) (int, error)
+}
+
+func bench(args *BenchArgs) error {
+	if *args.width <= 0 || *args.height <= 0 {
+		return errors.New("width and height must be positive")
+	}
+
+	if *args.rounds <= 0 {
+		return errors.New("number of rounds must be positive")
+	}
+
+	cover := makeNoiseImage(*args.width, *args.height)
+
+	var cases []benchCase
+	for _, strategy := range stego.Strategies() {
+		opts := []stego.Option{stego.WithStrategy(strategy)}
+		cases = append(cases,
+			benchCase{name: "conceal " + strategy.Name(), run: benchConceal(opts)},
+			benchReveal("reveal "+strategy.Name(), opts),
+		)
+	}
+
+	encrypted := []stego.Option{stego.WithPassphrase("benchmark")}
+	cases = append(cases,
+		benchCase{name: "conceal encrypted", run: benchConceal(encrypted)},
+		benchReveal("reveal encrypted", encrypted),
+		benchCase{name: "copy nrgba cover", run: benchCopy(false)},
+		benchCase{name: "copy rgba cover", run: benchCopy(true)},
+		benchCase{name: "png encode", run: benchPNGEncode},
+	)
+
+	fmt.Printf("Image: %dx%d, best of %d rounds\n", *args.width, *args.height, *args.rounds)
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "\tBytes\tTime\tMB/s\t")
+
+	for _, benchCase := range cases {
+		if benchCase.prepare != nil {
+			if err := benchCase.prepare(cover); err != nil {
+				return fmt.Errorf("%s: %v", benchCase.name, err)
+			}
+		}
+
+		var best time.Duration
+		var numBytes int
+
+		for i := 0; i < *args.rounds; i++ {
+			start := time.Now()
+			n, err := benchCase.run(cover)
+			if err != nil {
+				return fmt.Errorf("%s: %v", benchCase.name, err)
+			}
+
+			if elapsed := time.Since(start); i == 0 || elapsed < best {
+				best = elapsed
+			}
+			numBytes = n
+		}
+
+		throughput := float64(numBytes) / 1e6 / best.Seconds()
+		fmt.Fprintf(table, "%s\t%d\t%s\t%.2f\t\n", benchCase.name, numBytes, best.Round(time.Microsecond), throughput)
+	}
+
+	return table.Flush()
+}
+
+// benchConceal returns a benchmark that conceals the largest message that fits
+func benchConceal(opts []stego.Option) func(*image.NRGBA) (int, error) {
+	return func(cover *image.NRGBA) (int, error) {
+		message, err := makeBenchMessage(cover, opts)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = stego.ConcealImage(cover, bytes.NewReader(message), opts...)
+		return len(message), err
+	}
+}
+
+// benchReveal returns a benchmark that reveals the largest message that fits. The message is concealed while
+// preparing, so only revealing is timed.
+func benchReveal(name string, opts []stego.Option) benchCase {
+	var stegoImage *image.NRGBA
+	var size int
+
+	return benchCase{
+		name: name,
+		prepare: func(cover *image.NRGBA) error {
+			message, err := makeBenchMessage(cover, opts)
+			if err != nil {
+				return err
+			}
+
+			size = len(message)
+			stegoImage, err = stego.ConcealImage(cover, bytes.NewReader(message), opts...)
+			return err
+		},
+		run: func(*image.NRGBA) (int, error) {
+			_, err := stego.RevealImage(stegoImage, ioutil.Discard, opts...)
+			return size, err
+		},
+	}
+}
+
+// benchCopy returns a benchmark of copying the cover before anything is concealed in it, which is most of
+// what concealing an empty message does. PNGs without an alpha channel decode to RGBA, so rgba converts the
+// cover to RGBA first.
+func benchCopy(rgba bool) func(*image.NRGBA) (int, error) {
+	return func(cover *image.NRGBA) (int, error) {
+		var img image.Image = cover
+		if rgba {
+			img = &image.RGBA{Pix: cover.Pix, Stride: cover.Stride, Rect: cover.Rect}
+		}
+
+		_, err := stego.ConcealImage(img, bytes.NewReader(nil))
+		return len(cover.Pix), err
+	}
+}
+
+func benchPNGEncode(cover *image.NRGBA) (int, error) {
+	return len(cover.Pix), png.Encode(ioutil.Discard, cover)
+}
+
+// makeBenchMessage returns random bytes that fill the capacity of cover
+func makeBenchMessage(cover *image.NRGBA, opts []stego.Option) ([]byte, error) {
+	bounds := cover.Bounds()
+	plan, err := stego.PlanConceal(bounds.Dx(), bounds.Dy(), 0, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	message := make([]byte, plan.MaxMessageBytes)
+	rand.Read(message)
+	return message, nil
+}
+
+// makeNoiseImage returns an opaque image of random pixels
+func makeNoiseImage(width int, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	rand.Read(img.Pix)
+
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+
+	return img
+}
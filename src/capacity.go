@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"image"
+	"io/ioutil"
+	"os"
+)
+
+// capacityReport is what the capacity command reports with --json
+type capacityReport struct {
+	Width           int    `json:"width"`
+	Height          int    `json:"height"`
+	Strategy        string `json:"strategy"`
+	BitsPerChannel  int    `json:"bits_per_channel"`
+	Channels        int    `json:"channels"`
+	Encrypted       bool   `json:"encrypted"`
+	HeaderPixels    int    `json:"header_pixels"`
+	CapacityBytes   int    `json:"capacity_bytes"`
+	OverheadBytes   int    `json:"overhead_bytes"`
+	MaxMessageBytes int    `json:"max_message_bytes"`
+	File            string `json:"file,omitempty"`
+	MessageBytes    int    `json:"message_bytes,omitempty"`
+	Fits            *bool  `json:"fits,omitempty"`
+	Margin          *int   `json:"margin,omitempty"`
+}
+
+// capacity reports how much the image can hold with the given options and, given a file, whether it fits along
+// with every overhead it would be concealed with
+func capacity(args *CapacityArgs) error {
+	file, err := os.Open(*args.imagePath)
+	if err != nil {
+		return err
+	}
+
+	config, _, err := image.DecodeConfig(file)
+	file.Close()
+	if err == image.ErrFormat {
+		return stego.ErrUnsupportedFormat
+	} else if err != nil {
+		return err
+	}
+
+	strategy, _ := stego.LookupStrategy(*args.strategy)
+	opts := []stego.Option{
+		stego.WithPassphrase(*args.passphrase),
+		stego.WithBitsPerChannel(*args.numBitsPerChannel),
+		stego.WithChannels(*args.numChannels),
+		stego.WithStrategy(strategy),
+	}
+
+	messageSize := 0
+
+	if *args.file != "" {
+		content, err := ioutil.ReadFile(*args.file)
+		if err != nil {
+			return err
+		}
+		defer zeroBytes(content)
+
+		messageSize = len(content)
+		opts = append(opts, stego.WithMetadata(fileMetadata(*args.file, content)))
+	}
+
+	plan, err := stego.PlanConceal(config.Width, config.Height, messageSize, opts...)
+	if err != nil {
+		return err
+	}
+
+	report := capacityReport{
+		Width:           config.Width,
+		Height:          config.Height,
+		Strategy:        *args.strategy,
+		BitsPerChannel:  *args.numBitsPerChannel,
+		Channels:        *args.numChannels,
+		Encrypted:       *args.passphrase != "",
+		HeaderPixels:    plan.HeaderPixels,
+		CapacityBytes:   plan.CapacityBits / 8,
+		OverheadBytes:   plan.OverheadBytes,
+		MaxMessageBytes: plan.MaxMessageBytes,
+	}
+
+	if *args.file != "" {
+		fits, margin := plan.Fits(), plan.Margin()
+		report.File = *args.file
+		report.MessageBytes = plan.MessageBytes
+		report.Fits = &fits
+		report.Margin = &margin
+	}
+
+	if *args.json {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		fmt.Println("Image:", report.Width, "x", report.Height)
+		fmt.Println("Strategy:", report.Strategy)
+		fmt.Println("Bits per channel:", report.BitsPerChannel)
+		fmt.Println("Channels:", report.Channels)
+		fmt.Println("Encrypted:", report.Encrypted)
+		fmt.Println("Header:", report.HeaderPixels, "pixels")
+		fmt.Println("Capacity:", report.CapacityBytes, "bytes")
+		fmt.Println("Overhead:", report.OverheadBytes, "bytes")
+		fmt.Println("Maximum message size:", report.MaxMessageBytes, "bytes")
+
+		if report.Fits != nil {
+			fmt.Println("File:", report.File, "is", report.MessageBytes, "bytes")
+			fmt.Println("Margin:", *report.Margin, "bytes")
+		}
+	}
+
+	if report.Fits != nil && !*report.Fits {
+		return stego.ErrCapacityExceeded
+	}
+
+	return nil
+}
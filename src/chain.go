@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// concealChain conceals the shards of a chain from the last to the first, so that every image can point to the
+// one holding the next shard by its checksum. The cover of each shard is that of the same index.
+func concealChain(args *ConcealArgs, covers []string, outputPaths []string, parts [][]byte, shards []stego.Shard,
+	metadata stego.Metadata, opts []stego.Option) error {
+
+	var next *stego.Link
+	for i := len(parts) - 1; i >= 0; i-- {
+		metadata.Shard = &shards[i]
+		metadata.Next = next
+		if err := writeShard(args, covers[i], outputPaths[i], parts[i], metadata, opts); err != nil {
+			return fmt.Errorf("shard %d of %d: %w", i+1, len(parts), err)
+		}
+
+		link, err := linkTo(outputPaths[i])
+		if err != nil {
+			return err
+		}
+		next = &link
+	}
+
+	for i, part := range parts {
+		fmt.Printf("Wrote %s (link %d of %d, %d bytes)\n", outputPaths[i], i+1, len(parts), len(part))
+	}
+
+	fmt.Println("Set:", shards[0].Set)
+	fmt.Println("Start:", outputPaths[0])
+	if len(parts) < len(covers) {
+		fmt.Println("Unused covers:", len(covers)-len(parts))
+	}
+	if metadata.ID != "" {
+		fmt.Println("ID:", metadata.ID)
+	}
+	return nil
+}
+
+// linkTo returns a link to the image at path, with its name as the hint
+func linkTo(path string) (stego.Link, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return stego.Link{}, err
+	}
+	defer file.Close()
+
+	return stego.NewLink(file, filepath.Base(path))
+}
+
+// revealChain reveals the shards of the chain the image starts, following the link of every shard to the image
+// holding the next, and joins them back into the message
+func revealChain(args *RevealArgs) error {
+	var shards []stego.Shard
+	var parts [][]byte
+	defer func() {
+		for _, part := range parts {
+			zeroBytes(part)
+		}
+	}()
+
+	logger := makeLogger(*args.verbose)
+	var metadata *stego.Metadata
+
+	for path := *args.imagePath; ; {
+		message, result, err := stego.Reveal(path, args.options()...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		if result.Metadata == nil || result.Metadata.Shard == nil {
+			zeroBytes(message)
+			return fmt.Errorf("%s doesn't hold a shard of a chain", path)
+		}
+
+		shards = append(shards, *result.Metadata.Shard)
+		parts = append(parts, message)
+		metadata = result.Metadata
+		logger.Println("Followed:", path)
+
+		if metadata.Next == nil {
+			break
+		}
+
+		// A chain can't have more links than shards, so one that does loops back on itself
+		if len(shards) >= metadata.Shard.Count {
+			return stego.ErrCorruptPayload
+		}
+
+		if path, err = findLink(filepath.Dir(path), *metadata.Next); err != nil {
+			return err
+		}
+	}
+
+	return joinShards(args, shards, parts, metadata)
+}
+
+// findLink returns the path of the image link points to in dir, trying the name it hints at before every other
+// file in dir
+func findLink(dir string, link stego.Link) (string, error) {
+	if link.Hint != "" {
+		path := filepath.Join(dir, filepath.Base(link.Hint))
+		if matchesLink(path, link) {
+			return path, nil
+		}
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.Mode().IsRegular() && matchesLink(path, link) {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("the next image of the chain, %s, isn't in %s: %w", link.Hint, dir, stego.ErrMissingShards)
+}
+
+// matchesLink reports whether the file at path is the image link points to
+func matchesLink(path string, link stego.Link) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	matches, err := link.Matches(file)
+	return err == nil && matches
+}
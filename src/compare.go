@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/analysis"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"math"
+	"os"
+	"text/tabwriter"
+)
+
+// channelReport is how much one channel changed in the report the compare command prints with --json
+type channelReport struct {
+	Name              string   `json:"name"`
+	MSE               float64  `json:"mse"`
+	PSNR              *float64 `json:"psnr"`
+	WPSNR             *float64 `json:"wpsnr"`
+	KLDivergence      float64  `json:"kl_divergence"`
+	ChiSquareDistance float64  `json:"chi_square_distance"`
+	ModifiedValues    int      `json:"modified_values"`
+	MaxDifference     int      `json:"max_difference"`
+	MeanDifference    float64  `json:"mean_difference"`
+}
+
+// compareReport is what the compare command reports with --json. PSNR and WPSNR are null for an image that
+// didn't change, since JSON has no infinity, and Changes is null when no pixel was modified.
+type compareReport struct {
+	MSE               float64         `json:"mse"`
+	PSNR              *float64        `json:"psnr"`
+	WPSNR             *float64        `json:"wpsnr"`
+	SSIM              float64         `json:"ssim"`
+	KLDivergence      float64         `json:"kl_divergence"`
+	ChiSquareDistance float64         `json:"chi_square_distance"`
+	NumPixels         int             `json:"pixels"`
+	ModifiedPixels    int             `json:"modified_pixels"`
+	ModifiedFraction  float64         `json:"modified_fraction"`
+	ModifiedValues    int             `json:"modified_values"`
+	MaxDifference     int             `json:"max_difference"`
+	MeanDifference    float64         `json:"mean_difference"`
+	Changes           *changesReport  `json:"changes"`
+	Channels          []channelReport `json:"channels"`
+	DCT               *dctReport      `json:"dct,omitempty"`
+}
+
+// dctReport is the DCT coefficient histogram comparison compare reports with --dct and --json
+type dctReport struct {
+	Coefficients      int             `json:"coefficients"`
+	CoverP            float64         `json:"cover_p"`
+	StegoP            float64         `json:"stego_p"`
+	CoverImbalance    float64         `json:"cover_imbalance"`
+	StegoImbalance    float64         `json:"stego_imbalance"`
+	ChiSquareDistance float64         `json:"chi_square_distance"`
+	Pairs             []dctPairReport `json:"pairs"`
+}
+
+// dctPairReport is how often a pair of DCT coefficients occurs in the cover and stego image
+type dctPairReport struct {
+	Low            int     `json:"low"`
+	CoverCounts    [2]int  `json:"cover_counts"`
+	StegoCounts    [2]int  `json:"stego_counts"`
+	CoverImbalance float64 `json:"cover_imbalance"`
+	StegoImbalance float64 `json:"stego_imbalance"`
+}
+
+// numDCTPairsShown is the number of pairs of DCT coefficients whose imbalance dropped the most compare prints
+const numDCTPairsShown = 10
+
+// changesReport is the bounding box of the modified pixels, with Max exclusive like image.Rectangle
+type changesReport struct {
+	MinX int `json:"min_x"`
+	MinY int `json:"min_y"`
+	MaxX int `json:"max_x"`
+	MaxY int `json:"max_y"`
+}
+
+// compare prints how much the pixels and histograms of the image at imagePath differ from those of its cover,
+// over all the channels and for each of them
+func compare(args *CompareArgs) error {
+	cover, err := stego.LoadImage(*args.coverPath)
+	if err != nil {
+		return err
+	}
+
+	img, err := stego.LoadImage(*args.imagePath)
+	if err != nil {
+		return err
+	}
+
+	comparison, err := analysis.Compare(cover, img, *args.includeAlpha)
+	if err != nil {
+		return err
+	}
+
+	if *args.amplify < 1 {
+		return usageError{errors.New("amplify must be at least 1")}
+	}
+
+	if *args.montagePath != "" {
+		montage, err := analysis.Montage(cover, img, *args.amplify)
+		if err != nil {
+			return err
+		}
+		if err := stego.SaveImage(*args.montagePath, montage); err != nil {
+			return err
+		}
+	}
+
+	var dct *analysis.DCTComparison
+	if *args.dct {
+		dctComparison, err := analysis.CompareDCT(cover, img)
+		if err != nil {
+			return err
+		}
+		dct = &dctComparison
+	}
+
+	if *args.json {
+		report := makeCompareReport(comparison)
+		if dct != nil {
+			report.DCT = &dctReport{
+				Coefficients:      dct.Coefficients,
+				CoverP:            dct.CoverP,
+				StegoP:            dct.StegoP,
+				CoverImbalance:    dct.CoverImbalance,
+				StegoImbalance:    dct.StegoImbalance,
+				ChiSquareDistance: dct.ChiSquareDistance,
+				Pairs:             []dctPairReport{},
+			}
+			for _, pair := range dct.Pairs {
+				report.DCT.Pairs = append(report.DCT.Pairs, dctPairReport(pair))
+			}
+		}
+
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer,
+		"CHANNEL\tMSE\tPSNR\tWPSNR\tKL DIVERGENCE\tCHI-SQUARE DISTANCE\tMODIFIED\tMAX DIFF\tMEAN DIFF")
+	for _, distortion := range comparison.Channels {
+		fmt.Fprintf(writer, "%s\t%.4f\t%s\t%s\t%.3g\t%.3g\t%d\t%d\t%.4f\n", distortion.Name, distortion.MSE,
+			formatPSNR(distortion.PSNR), formatPSNR(distortion.WPSNR), distortion.KLDivergence,
+			distortion.ChiSquareDistance, distortion.ModifiedValues, distortion.MaxDifference, distortion.MeanDifference)
+	}
+	fmt.Fprintf(writer, "all\t%.4f\t%s\t%s\t%.3g\t%.3g\t%d\t%d\t%.4f\n", comparison.MSE, formatPSNR(comparison.PSNR),
+		formatPSNR(comparison.WPSNR), comparison.KLDivergence, comparison.ChiSquareDistance, comparison.ModifiedValues,
+		comparison.MaxDifference, comparison.MeanDifference)
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("SSIM: %.6f\n", comparison.SSIM)
+	fmt.Printf("Modified pixels: %d of %d (%.2f%%)\n", comparison.ModifiedPixels, comparison.NumPixels,
+		100*modifiedFraction(comparison))
+	if comparison.ModifiedPixels > 0 {
+		changes := comparison.Changes
+		fmt.Printf("Changes: %dx%d at (%d, %d)\n", changes.Dx(), changes.Dy(), changes.Min.X, changes.Min.Y)
+	}
+
+	if dct != nil {
+		return printDCTComparison(*dct)
+	}
+	return nil
+}
+
+// printDCTComparison prints how the DCT coefficient histograms of the cover and stego image compare, with the
+// pairs of coefficients whose imbalance dropped the most, which is what the chi-square attack picks up on
+func printDCTComparison(dct analysis.DCTComparison) error {
+	fmt.Println()
+	fmt.Println("DCT coefficients:", dct.Coefficients)
+	fmt.Printf("Chi-square attack: cover %.3f, stego %.3f\n", dct.CoverP, dct.StegoP)
+	fmt.Printf("Pair imbalance: cover %.4f, stego %.4f\n", dct.CoverImbalance, dct.StegoImbalance)
+	fmt.Printf("Histogram chi-square distance: %.3g\n", dct.ChiSquareDistance)
+
+	if len(dct.Pairs) == 0 {
+		return nil
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "PAIR\tCOVER\tSTEGO\tCOVER IMBALANCE\tSTEGO IMBALANCE")
+	for i, pair := range dct.Pairs {
+		if i == numDCTPairsShown {
+			break
+		}
+		fmt.Fprintf(writer, "%d,%d\t%d/%d\t%d/%d\t%.4f\t%.4f\n", pair.Low, pair.Low+1, pair.CoverCounts[0],
+			pair.CoverCounts[1], pair.StegoCounts[0], pair.StegoCounts[1], pair.CoverImbalance, pair.StegoImbalance)
+	}
+	return writer.Flush()
+}
+
+// makeCompareReport returns comparison as the report compare prints with --json
+func makeCompareReport(comparison analysis.Comparison) compareReport {
+	report := compareReport{
+		MSE:               comparison.MSE,
+		PSNR:              finitePSNR(comparison.PSNR),
+		WPSNR:             finitePSNR(comparison.WPSNR),
+		SSIM:              comparison.SSIM,
+		KLDivergence:      comparison.KLDivergence,
+		ChiSquareDistance: comparison.ChiSquareDistance,
+		NumPixels:         comparison.NumPixels,
+		ModifiedPixels:    comparison.ModifiedPixels,
+		ModifiedFraction:  modifiedFraction(comparison),
+		ModifiedValues:    comparison.ModifiedValues,
+		MaxDifference:     comparison.MaxDifference,
+		MeanDifference:    comparison.MeanDifference,
+		Channels:          []channelReport{},
+	}
+
+	if comparison.ModifiedPixels > 0 {
+		changes := comparison.Changes
+		report.Changes = &changesReport{changes.Min.X, changes.Min.Y, changes.Max.X, changes.Max.Y}
+	}
+
+	for _, distortion := range comparison.Channels {
+		report.Channels = append(report.Channels, channelReport{
+			Name:              distortion.Name,
+			MSE:               distortion.MSE,
+			PSNR:              finitePSNR(distortion.PSNR),
+			WPSNR:             finitePSNR(distortion.WPSNR),
+			KLDivergence:      distortion.KLDivergence,
+			ChiSquareDistance: distortion.ChiSquareDistance,
+			ModifiedValues:    distortion.ModifiedValues,
+			MaxDifference:     distortion.MaxDifference,
+			MeanDifference:    distortion.MeanDifference,
+		})
+	}
+
+	return report
+}
+
+// modifiedFraction returns the fraction of the pixels of the compared images that were modified
+func modifiedFraction(comparison analysis.Comparison) float64 {
+	if comparison.NumPixels == 0 {
+		return 0
+	}
+	return float64(comparison.ModifiedPixels) / float64(comparison.NumPixels)
+}
+
+// finitePSNR returns psnr, or nil when it's infinite because nothing changed
+func finitePSNR(psnr float64) *float64 {
+	if math.IsInf(psnr, 1) {
+		return nil
+	}
+	return &psnr
+}
+
+// formatPSNR formats a PSNR in decibels, which is infinite for a channel that didn't change
+func formatPSNR(psnr float64) string {
+	if math.IsInf(psnr, 1) {
+		return "identical"
+	}
+	return fmt.Sprintf("%.2f dB", psnr)
+}
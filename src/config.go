@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Config holds the defaults loaded from the configuration file. The file is a small subset of YAML: keys at
+// the top level apply to every command, and keys indented under a command name only apply to that command.
+// Keys are the long names of flags, and flags given on the command line override the file.
+//
+//	num-bits: 2
+//	conceal:
+//	  strategy: lsb-matching
+//	scan:
+//	  workers: 4
+type Config struct {
+	path     string
+	global   map[string]string
+	commands map[string]map[string]string
+	err      error
+}
+
+// configPath returns the path of the configuration file, which is hide/config.yaml under $XDG_CONFIG_HOME or
+// else ~/.config on every platform. The HIDE_CONFIG environment variable moves it elsewhere.
+func configPath() string {
+	if path := os.Getenv("HIDE_CONFIG"); path != "" {
+		return path
+	}
+
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, "hide", "config.yaml")
+}
+
+// loadConfig reads the configuration file at path. A missing file is the same as an empty one.
+func loadConfig(path string) (*Config, error) {
+	self := &Config{path: path, global: map[string]string{}, commands: map[string]map[string]string{}}
+
+	if path == "" {
+		return self, nil
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return self, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var command map[string]string
+	scanner := bufio.NewScanner(file)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := stripComment(scanner.Text())
+
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		indented := line[0] == ' ' || line[0] == '\t'
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected key: value", path, lineNumber)
+		}
+
+		key := strings.TrimSpace(parts[0])
+		value, err := unquote(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNumber, err)
+		}
+
+		switch {
+		case indented && command == nil:
+			return nil, fmt.Errorf("%s:%d: indented key outside of a command", path, lineNumber)
+		case indented:
+			command[key] = value
+		case value == "":
+			command = map[string]string{}
+			self.commands[key] = command
+		default:
+			command = nil
+			self.global[key] = value
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return self, nil
+}
+
+// stripComment removes the comment from line. Like in YAML, a # only starts a comment at the start of the line
+// or after whitespace, and never inside a value that starts with a quote.
+func stripComment(line string) string {
+	var quote, previous byte
+
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && previous == ':':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+
+		if c := line[i]; c != ' ' && c != '\t' {
+			previous = c
+		}
+	}
+
+	return line
+}
+
+// unquote removes the pair of quotes around value, if it starts with one. A value that starts with a quote must
+// end with the same quote.
+func unquote(value string) (string, error) {
+	if value == "" || (value[0] != '"' && value[0] != '\'') {
+		return value, nil
+	}
+
+	if len(value) < 2 || value[len(value)-1] != value[0] {
+		return "", fmt.Errorf("unterminated quote in %s", value)
+	}
+	return value[1 : len(value)-1], nil
+}
+
+// lookup returns the value of key for command, preferring the command's own section
+func (self *Config) lookup(command string, key string) (string, bool) {
+	if value, ok := self.commands[command][key]; ok {
+		return value, true
+	}
+	value, ok := self.global[key]
+	return value, ok
+}
+
+// String returns the value of key for command, or def if it isn't set
+func (self *Config) String(command string, key string, def string) string {
+	if value, ok := self.lookup(command, key); ok {
+		return value
+	}
+	return def
+}
+
+// Path returns the value of key for command with a leading ~ expanded to the home directory, or def if it
+// isn't set
+func (self *Config) Path(command string, key string, def string) string {
+	if value, ok := self.lookup(command, key); ok {
+		return expandHome(value)
+	}
+	return def
+}
+
+// Choice returns the value of key for command if it is one of choices, or def if it isn't set
+func (self *Config) Choice(command string, key string, choices []string, def string) string {
+	value := self.String(command, key, def)
+	for _, choice := range choices {
+		if value == choice {
+			return value
+		}
+	}
+
+	self.fail(command, key, fmt.Errorf("must be one of: %s", strings.Join(choices, ", ")))
+	return def
+}
+
+// Int returns the value of key for command, or def if it isn't set
+func (self *Config) Int(command string, key string, def int) int {
+	value, ok := self.lookup(command, key)
+	if !ok {
+		return def
+	}
+
+	num, err := strconv.Atoi(value)
+	if err != nil {
+		self.fail(command, key, err)
+		return def
+	}
+	return num
+}
+
+// Float returns the value of key for command, or def if it isn't set
+func (self *Config) Float(command string, key string, def float64) float64 {
+	value, ok := self.lookup(command, key)
+	if !ok {
+		return def
+	}
+
+	num, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		self.fail(command, key, err)
+		return def
+	}
+	return num
+}
+
+// Bool returns the value of key for command, or def if it isn't set
+func (self *Config) Bool(command string, key string, def bool) bool {
+	value, ok := self.lookup(command, key)
+	if !ok {
+		return def
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		self.fail(command, key, err)
+		return def
+	}
+	return b
+}
+
+// Err returns the first value that couldn't be used
+func (self *Config) Err() error {
+	return self.err
+}
+
+func (self *Config) fail(command string, key string, err error) {
+	if self.err == nil {
+		self.err = fmt.Errorf("%s: %s.%s: %v", self.path, command, key, err)
+	}
+}
+
+// expandHome replaces a leading ~ in a path with the home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+// errNotFiles is returned when files are listed or extracted from a message that wasn't concealed from files
+var errNotFiles = errors.New("the message was not concealed from files")
+
+// packFiles reads the files at paths and returns them as a single message along with the metadata that
+// describes it. A single file is concealed as is, while several files follow each other and are listed as
+// entries of the metadata.
+func packFiles(paths []string) ([]byte, stego.Metadata, error) {
+	if len(paths) == 1 {
+		content, err := ioutil.ReadFile(paths[0])
+		if err != nil {
+			return nil, stego.Metadata{}, err
+		}
+		return content, fileMetadata(paths[0], content), nil
+	}
+
+	var message []byte
+	metadata := stego.Metadata{}
+	names := map[string]bool{}
+
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			zeroBytes(message)
+			return nil, stego.Metadata{}, err
+		}
+
+		file := fileMetadata(path, content)
+		if names[file.Name] {
+			zeroBytes(message)
+			zeroBytes(content)
+			return nil, stego.Metadata{}, fmt.Errorf("more than one file is named %s", file.Name)
+		}
+		names[file.Name] = true
+
+		metadata.Entries = append(metadata.Entries, stego.Entry{
+			Name:     file.Name,
+			Type:     file.Type,
+			Size:     len(content),
+			Mode:     file.Mode,
+			Modified: file.Modified,
+		})
+		message = append(message, content...)
+		zeroBytes(content)
+	}
+
+	return message, metadata, nil
+}
+
+// entries returns the files described by metadata. A message concealed from a single file has a single entry
+// that spans the whole message.
+func entries(metadata *stego.Metadata, size int) []stego.Entry {
+	if len(metadata.Entries) > 0 {
+		return metadata.Entries
+	}
+	return []stego.Entry{{
+		Name:     metadata.Name,
+		Type:     metadata.Type,
+		Size:     size,
+		Mode:     metadata.Mode,
+		Modified: metadata.Modified,
+	}}
+}
+
+// restoreAttributes gives the file at path the permissions and modification time recorded in entry, if they
+// were. Only the permission bits are restored, so a revealed file is never made setuid.
+func restoreAttributes(path string, entry stego.Entry) error {
+	if entry.Mode != 0 {
+		if err := os.Chmod(path, os.FileMode(entry.Mode).Perm()); err != nil {
+			return err
+		}
+	}
+
+	if entry.Modified != nil {
+		if err := os.Chtimes(path, *entry.Modified, *entry.Modified); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeFiles writes every file packaged in message to dir and returns the paths it wrote
+func writeFiles(dir string, metadata *stego.Metadata, message []byte, fallback string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	offset := 0
+
+	for _, entry := range entries(metadata, len(message)) {
+		if entry.Size > len(message)-offset {
+			return paths, stego.ErrCorruptPayload
+		}
+
+		path := filepath.Join(dir, entry.FileName(fallback))
+		if err := ioutil.WriteFile(path, message[offset:offset+entry.Size], 0600); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+		if err := restoreAttributes(path, entry); err != nil {
+			return paths, err
+		}
+		offset += entry.Size
+	}
+
+	return paths, nil
+}
+
+// listFiles lists the files concealed in the image at imagePath. Only the metadata is read from an unencrypted
+// message.
+func listFiles(imagePath string, opts []stego.Option) error {
+	decoder, err := openDecoder(imagePath, opts)
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+
+	metadata, err := decoder.Metadata()
+	if err != nil {
+		return err
+	}
+	if metadata == nil {
+		return errNotFiles
+	}
+
+	size, err := decoder.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAME\tSIZE\tTYPE\tMODE\tMODIFIED")
+
+	for _, entry := range entries(metadata, int(size)) {
+		mode, modified := "-", "-"
+		if entry.Mode != 0 {
+			mode = os.FileMode(entry.Mode).Perm().String()
+		}
+		if entry.Modified != nil {
+			modified = entry.Modified.Format(time.RFC3339)
+		}
+		fmt.Fprintf(writer, "%s\t%d\t%s\t%s\t%s\n", entry.Name, entry.Size, entry.Type, mode, modified)
+	}
+
+	return writer.Flush()
+}
+
+// extractFiles writes the files called names from the image at imagePath to dir. Each file of an unencrypted
+// message is read without reading the files in front of it.
+func extractFiles(imagePath string, names []string, dir string, opts []stego.Option) error {
+	decoder, err := openDecoder(imagePath, opts)
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+
+	metadata, err := decoder.Metadata()
+	if err != nil {
+		return err
+	}
+	if metadata == nil {
+		return errNotFiles
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		entry, offset, ok := metadata.Lookup(name)
+		if len(metadata.Entries) == 0 && name == metadata.Name {
+			entry, offset, ok = entries(metadata, -1)[0], 0, true
+		}
+		if !ok {
+			return fmt.Errorf("no file named %s", name)
+		}
+
+		if _, err := decoder.Seek(int64(offset), io.SeekStart); err != nil {
+			return err
+		}
+
+		var content []byte
+		if entry.Size < 0 {
+			content, err = ioutil.ReadAll(decoder)
+		} else {
+			content = make([]byte, entry.Size)
+			_, err = io.ReadFull(decoder, content)
+			if err == io.ErrUnexpectedEOF {
+				err = stego.ErrCorruptPayload
+			}
+		}
+
+		if err == nil {
+			path := filepath.Join(dir, entry.FileName(name))
+			if err = ioutil.WriteFile(path, content, 0600); err == nil {
+				err = restoreAttributes(path, entry)
+			}
+			if err == nil {
+				fmt.Println("Wrote", path)
+			}
+		}
+
+		zeroBytes(content)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// openDecoder loads the image at imagePath and returns a Decoder for its message
+func openDecoder(imagePath string, opts []stego.Option) (*stego.Decoder, error) {
+	img, err := stego.LoadImage(imagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return stego.NewDecoder(img, opts...)
+}
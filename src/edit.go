@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"mime"
+	"path/filepath"
+)
+
+// edit changes the comment, file name or type stored with the message of an image. The message itself isn't
+// concealed again, so an image that's full can still be edited as long as the metadata fits in its old space.
+func edit(args *EditArgs) error {
+	if *args.comment == "" && *args.fileName == "" && *args.fileType == "" {
+		return usageError{errors.New("nothing to edit, give a comment, file name or type")}
+	}
+
+	if *args.backup && *args.output != "" {
+		return usageError{errors.New("backup requires editing in place")}
+	}
+
+	if keyedTraversal(*args.traversal) && *args.passphrase == "" {
+		return errors.New("keyed traversal requires a passphrase")
+	}
+
+	img, err := stego.LoadImage(*args.imagePath)
+	if err != nil {
+		return err
+	}
+
+	change := func(metadata *stego.Metadata) error {
+		if len(metadata.Entries) > 0 && (*args.fileName != "" || *args.fileType != "") {
+			return errors.New("the message holds several files, so only its comment can be edited")
+		}
+
+		if *args.comment != "" {
+			metadata.Comment = *args.comment
+		}
+
+		if *args.fileName != "" {
+			metadata.Name = filepath.Base(*args.fileName)
+			if fileType := mime.TypeByExtension(filepath.Ext(*args.fileName)); fileType != "" {
+				metadata.Type = fileType
+			}
+		}
+
+		if *args.fileType != "" {
+			metadata.Type = *args.fileType
+		}
+
+		return nil
+	}
+
+	outputImage, err := stego.EditMetadata(img, change,
+		stego.WithPassphrase(*args.passphrase),
+		stego.WithTraversal(makeTraversal(*args.traversal, *args.passphrase)),
+		stego.WithPayload(*args.payload),
+	)
+	if err != nil {
+		return err
+	}
+
+	write := func(outputPath string) error {
+		return stego.SaveImage(outputPath, outputImage, stego.WithCompression(makeCompression(*args.compression)))
+	}
+
+	if *args.output == "" {
+		err = concealInPlace(*args.imagePath, *args.backup, write)
+	} else {
+		err = write(*args.output)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Edited the metadata of payload", *args.payload)
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/akamensky/argparse"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"os"
+)
+
+// Exit codes of the command line, one per class of failure
+const (
+	exitOK                 = 0
+	exitFailure            = 1
+	exitUsage              = 2
+	exitCapacityExceeded   = 3
+	exitWrongPassphrase    = 4
+	exitNotStegoImage      = 5
+	exitCorruptPayload     = 6
+	exitUnsupportedFormat  = 7
+	exitIO                 = 8
+	exitCorruptHeader      = 9
+	exitUnsupportedVersion = 10
+	exitExpired            = 11
+	exitQuality            = 12
+	exitSuspicious         = 13
+	exitShards             = 14
+	exitUntraced           = 15
+)
+
+// errorFormats are the formats errors can be reported in
+var errorFormats = []string{"text", "json"}
+
+// usageError is an error in the arguments rather than in running a command
+type usageError struct {
+	err error
+}
+
+func (self usageError) Error() string {
+	return self.err.Error()
+}
+
+// classifyError returns the exit code and name of the class of err
+func classifyError(err error) (int, string) {
+	var usage usageError
+	var pathErr *os.PathError
+
+	switch {
+	case errors.As(err, &usage):
+		return exitUsage, "usage"
+	case errors.Is(err, stego.ErrCapacityExceeded):
+		return exitCapacityExceeded, "capacity_exceeded"
+	case errors.Is(err, stego.ErrWrongPassphrase):
+		return exitWrongPassphrase, "wrong_passphrase"
+	case errors.Is(err, stego.ErrPassphraseRequired):
+		return exitWrongPassphrase, "passphrase_required"
+	case errors.Is(err, stego.ErrPrivateKeyRequired):
+		return exitWrongPassphrase, "private_key_required"
+	case errors.Is(err, stego.ErrNotEncrypted):
+		return exitWrongPassphrase, "not_encrypted"
+	case errors.Is(err, stego.ErrNotStegoImage):
+		return exitNotStegoImage, "not_stego_image"
+	case errors.Is(err, stego.ErrCorruptPayload):
+		return exitCorruptPayload, "corrupt_payload"
+	case errors.Is(err, stego.ErrCorruptHeader):
+		return exitCorruptHeader, "corrupt_header"
+	case errors.Is(err, stego.ErrUnsupportedVersion):
+		return exitUnsupportedVersion, "unsupported_version"
+	case errors.Is(err, stego.ErrUnsupportedFormat):
+		return exitUnsupportedFormat, "unsupported_format"
+	case errors.Is(err, stego.ErrExpired):
+		return exitExpired, "expired"
+	case errors.Is(err, errQualityTooLow):
+		return exitQuality, "quality"
+	case errors.Is(err, errTooSuspicious):
+		return exitSuspicious, "suspicious"
+	case errors.Is(err, stego.ErrMissingShards):
+		return exitShards, "missing_shards"
+	case errors.Is(err, stego.ErrTooFewShares):
+		return exitShards, "too_few_shares"
+	case errors.Is(err, stego.ErrMixedShards):
+		return exitShards, "mixed_shards"
+	case errors.Is(err, errUntraced):
+		return exitUntraced, "untraced"
+	case errors.As(err, &pathErr):
+		return exitIO, "io"
+	default:
+		return exitFailure, "failure"
+	}
+}
+
+// reportError prints err in format and returns the exit code for it. Text errors are printed with the usage of
+// the command, and JSON errors are printed to stderr as an object with the message, class and exit code.
+func reportError(parser *argparse.Parser, err error, format string) int {
+	code, class := classifyError(err)
+
+	if format == "json" {
+		json.NewEncoder(os.Stderr).Encode(map[string]interface{}{
+			"error": err.Error(),
+			"class": class,
+			"code":  code,
+		})
+	} else {
+		fmt.Println(parser.Usage(err))
+	}
+
+	return code
+}
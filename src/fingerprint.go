@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// errUntraced is returned by trace when no recipient's fingerprint scores at least min-score
+var errUntraced = errors.New("no recipient's fingerprint was found in the image")
+
+// traceReport is what trace prints with --json
+type traceReport struct {
+	Traced  []string                 `json:"traced"`
+	Matches []stego.FingerprintMatch `json:"matches"`
+}
+
+// readRecipients returns the recipients listed in the file at path, one per line, skipping blank lines and
+// comments starting with #. Recipients name the copies made for them, so they can't hold a path separator.
+func readRecipients(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var recipients []string
+	seen := map[string]bool{}
+	for _, line := range strings.Split(string(data), "\n") {
+		recipient := strings.TrimSpace(line)
+		if recipient == "" || strings.HasPrefix(recipient, "#") {
+			continue
+		}
+		if strings.ContainsAny(recipient, `/\`) || recipient == "." || recipient == ".." {
+			return nil, usageError{fmt.Errorf("recipient %q can't be used in a file name", recipient)}
+		}
+		if seen[recipient] {
+			return nil, usageError{fmt.Errorf("recipient %q is listed twice", recipient)}
+		}
+		seen[recipient] = true
+		recipients = append(recipients, recipient)
+	}
+
+	if len(recipients) == 0 {
+		return nil, usageError{fmt.Errorf("%s lists no recipients", path)}
+	}
+	return recipients, nil
+}
+
+// recipientPath returns the path of the copy of outputPath made for recipient, with the recipient before the
+// extension
+func recipientPath(outputPath string, recipient string) string {
+	ext := filepath.Ext(outputPath)
+	return strings.TrimSuffix(outputPath, ext) + "." + recipient + ext
+}
+
+// concealFingerprinted conceals message in a copy of the cover for every recipient, with the recipient's
+// fingerprint added to the cover first
+func concealFingerprinted(args *ConcealArgs, message []byte, metadata *stego.Metadata, opts []stego.Option) error {
+	if *args.fingerprintKey == "" {
+		return usageError{errors.New("recipients requires a fingerprint key")}
+	}
+
+	recipients, err := readRecipients(*args.recipients)
+	if err != nil {
+		return err
+	}
+
+	if metadata != nil {
+		opts = append(opts, stego.WithMetadata(*metadata))
+	}
+
+	cover, err := stego.LoadImage(*args.imagePath)
+	if err != nil {
+		return err
+	}
+
+	for _, recipient := range recipients {
+		recipient := recipient
+		write := func(outputPath string) error {
+			img, err := stego.Fingerprint(cover, *args.fingerprintKey, recipient, *args.strength, opts...)
+			if err != nil {
+				return err
+			}
+
+			img, err = stego.ConcealImage(img, bytes.NewReader(message), opts...)
+			if err != nil {
+				return err
+			}
+			return stego.SaveImage(outputPath, img, opts...)
+		}
+		if *args.minPSNR > 0 || *args.minSSIM > 0 {
+			write = checkQuality(*args.imagePath, *args.minPSNR, *args.minSSIM, *args.warnQuality, write)
+		}
+
+		outputPath := recipientPath(*args.output, recipient)
+		if err := write(outputPath); err != nil {
+			return fmt.Errorf("%s: %w", recipient, err)
+		}
+		fmt.Printf("Wrote %s (%s)\n", outputPath, recipient)
+	}
+
+	if metadata != nil && metadata.ID != "" {
+		fmt.Println("ID:", metadata.ID)
+	}
+	return nil
+}
+
+// trace scores the fingerprint of every recipient in the image and prints those found, returning errUntraced
+// when there are none
+func trace(args *TraceArgs) error {
+	recipients, err := readRecipients(*args.recipients)
+	if err != nil {
+		return err
+	}
+
+	img, err := stego.LoadImage(*args.imagePath)
+	if err != nil {
+		return err
+	}
+
+	var cover image.Image
+	if *args.coverPath != "" {
+		if cover, err = stego.LoadImage(*args.coverPath); err != nil {
+			return err
+		}
+	}
+
+	matches, err := stego.TraceFingerprint(img, cover, *args.key, recipients)
+	if err != nil {
+		return err
+	}
+
+	// Copies combined by several recipients can carry more than one fingerprint
+	traced := []string{}
+	for _, match := range matches {
+		if match.Score >= *args.minScore {
+			traced = append(traced, match.Recipient)
+		}
+	}
+
+	if *args.json {
+		data, err := json.MarshalIndent(traceReport{Traced: traced, Matches: matches}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "RECIPIENT\tSCORE")
+		for _, match := range matches {
+			fmt.Fprintf(writer, "%s\t%.2f\n", match.Recipient, match.Score)
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		if len(traced) > 0 {
+			fmt.Println("Traced to:", strings.Join(traced, ", "))
+		}
+	}
+
+	if len(traced) == 0 {
+		return errUntraced
+	}
+	return nil
+}
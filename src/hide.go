@@ -1,320 +1,966 @@
 package main
 
 import (
+	cryptorand "crypto/rand"
 	"errors"
 	"fmt"
 	"github.com/akamensky/argparse"
+	"github.com/andresmejia3/hide/pkg/analysis"
+	"github.com/andresmejia3/hide/pkg/stego"
 	"image"
-	"image/png"
-	_ "image/png"
-	"math"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 )
 
 //TODO: Make png/Encode more dynamic to work with other encoding types
 //TODO: Make encoding a thing
 
 func main() {
+	config, err := loadConfig(configPath())
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(exitUsage)
+	}
+
 	parser := argparse.NewParser("HIDE", "Hide messages in images")
-	generateCommand, generateArgs := initGenerateCommand(parser)
-	concealCommand, concealArgs := initConcealCommand(parser)
-	revealCommand, revealArgs := initRevealCommand(parser)
+	errorFormat := parser.Selector("", "error-format", errorFormats, &argparse.Options{
+		Required: false,
+		Default:  config.Choice("", "error-format", errorFormats, "text"),
+		Help:     "Format errors are reported in. json writes an object with the message, class and exit code to stderr",
+	})
 
-	if err := parser.Parse(os.Args); err != nil {
-		fmt.Println(parser.Usage(err))
+	generateCommand, generateArgs := initGenerateCommand(parser)
+	concealCommand, concealArgs := initConcealCommand(parser, config)
+	revealCommand, revealArgs := initRevealCommand(parser, config)
+	infoCommand, infoArgs := initInfoCommand(parser)
+	detectCommand, detectArgs := initDetectCommand(parser)
+	scanCommand, scanArgs := initScanCommand(parser, config)
+	benchCommand, benchArgs := initBenchCommand(parser)
+	selftestCommand, selftestArgs := initSelftestCommand(parser)
+	estimateRateCommand, estimateRateArgs := initEstimateRateCommand(parser)
+	analyzeCommand, analyzeArgs := initAnalyzeCommand(parser)
+	compareCommand, compareArgs := initCompareCommand(parser)
+	traceCommand, traceArgs := initTraceCommand(parser)
+	planesCommand, planesArgs := initPlanesCommand(parser)
+	wipeCommand, wipeArgs := initWipeCommand(parser)
+	capacityCommand, capacityArgs := initCapacityCommand(parser)
+	verifyCommand, verifyArgs := initVerifyCommand(parser)
+	migrateCommand, migrateArgs := initMigrateCommand(parser)
+	editCommand, editArgs := initEditCommand(parser)
+	serveCommand, serveArgs := initServeCommand(parser, config)
+	watchCommand, watchArgs := initWatchCommand(parser, config)
+
+	if err := config.Err(); err != nil {
+		fmt.Println(err)
+		os.Exit(exitUsage)
+	}
 
-	} else if (*concealArgs.passphrase != "" && *concealArgs.publicKeyPath != "") ||
-		(*revealArgs.passphrase != "" && *revealArgs.privateKeyPath != "") {
-		fmt.Println(parser.Usage("passphrase and key-path cannot both be provided"))
+	if err = parser.Parse(os.Args); err != nil {
+		err = usageError{err}
 
 	} else if generateCommand.Happened() {
 		fmt.Println(generateArgs)
 
 	} else if concealCommand.Happened() {
 
-		if *concealArgs.output == "" {
+		if *concealArgs.output == "" && !*concealArgs.inPlace && *concealArgs.covers == "" {
 			*concealArgs.output = fmt.Sprintf("%s.out", *concealArgs.imagePath)
 		}
 
-		if err := conceal(concealArgs); err != nil {
-			fmt.Println(parser.Usage(err))
-		}
+		err = conceal(concealArgs)
+
+	} else if revealCommand.Happened() {
+
+		err = reveal(revealArgs)
+
+	} else if infoCommand.Happened() {
+
+		err = info(infoArgs)
+
+	} else if detectCommand.Happened() {
+
+		err = detect(detectArgs)
+
+	} else if estimateRateCommand.Happened() {
+
+		err = estimateRate(estimateRateArgs)
+
+	} else if analyzeCommand.Happened() {
+
+		err = analyze(analyzeArgs)
+
+	} else if compareCommand.Happened() {
+
+		err = compare(compareArgs)
+
+	} else if traceCommand.Happened() {
+
+		err = trace(traceArgs)
+
+	} else if planesCommand.Happened() {
+
+		err = planes(planesArgs)
+
+	} else if editCommand.Happened() {
+
+		err = edit(editArgs)
+
+	} else if migrateCommand.Happened() {
+
+		err = migrate(migrateArgs)
+
+	} else if verifyCommand.Happened() {
+
+		err = verify(verifyArgs)
+
+	} else if capacityCommand.Happened() {
+
+		err = capacity(capacityArgs)
+
+	} else if wipeCommand.Happened() {
+
+		err = wipe(wipeArgs)
+
+	} else if scanCommand.Happened() {
+
+		err = scan(scanArgs)
+
+	} else if benchCommand.Happened() {
+
+		err = bench(benchArgs)
+
+	} else if selftestCommand.Happened() {
+
+		err = selftest(selftestArgs)
 
-	} else if revealCommand.Happened() && reveal(revealArgs) != nil {
-		fmt.Println(parser.Usage(err))
+	} else if serveCommand.Happened() {
 
+		err = serve(serveArgs)
+
+	} else if watchCommand.Happened() {
+
+		err = watch(watchArgs)
+
+	}
+
+	if err != nil {
+		os.Exit(reportError(parser, err, *errorFormat))
 	}
 }
 
 func conceal(args *ConcealArgs) error {
-	img, err := loadImage(*args.imagePath)
+	if keyedTraversal(*args.traversal) && *args.passphrase == "" {
+		return errors.New("keyed traversal requires a passphrase")
+	}
 
-	if err != nil {
-		return err
+	if (*args.imagePath == "") == (*args.covers == "") {
+		return usageError{errors.New("either an image path or covers are required")}
+	}
+
+	if *args.inPlace && *args.output != "" {
+		return usageError{errors.New("an output path cannot be given with in-place")}
 	}
 
-	width := img.Bounds().Max.X
-	height := img.Bounds().Max.Y
+	if *args.backup && !*args.inPlace {
+		return usageError{errors.New("backup requires in-place")}
+	}
 
-	messageBytes := []byte(*args.message)
+	if *args.workers <= 0 {
+		return usageError{errors.New("number of workers must be positive")}
+	}
+
+	if *args.slots != 0 {
+		return concealSlots(args)
+	}
 
-	if *args.passphrase != "" {
-		messageBytes = encrypt(messageBytes, *args.passphrase)
+	if (*args.message == "") == (len(*args.files) == 0) {
+		return usageError{errors.New("either a message or files are required")}
 	}
 
-	if *args.publicKeyPath != "" {
-		return errors.New("PGP encryption not yet implemented")
+	if *args.noHeader && (*args.appendPayload || *args.tiled || *args.hideHeader) {
+		return usageError{errors.New("no-header cannot be used with append, tiled or hide-header")}
 	}
 
-	totalBitsToBeWritten := len(messageBytes) * 8
-	stepper := makeImageStepper(*args.numBitsPerChannel, width, height, *args.numChannels, totalBitsToBeWritten)
-	outputImage := copyImage(img)
-	totalBitsInImage := numBitsAvailable(width, height, 4, 8)
-	pixels := outputImage.Pix
+	if *args.minPSNR < 0 || *args.minSSIM < 0 || *args.minSSIM > 1 {
+		return usageError{errors.New("min-psnr cannot be negative and min-ssim must be between 0 and 1")}
+	}
 
-	// numBitsToEncodeNumMessageBits tells us how many bits to read from the image so we can decode the bits required
-	// for the hidden message. We let numBitsToEncodeNumMessageBits be equal to the number of bits required to encode
-	// the total number of bits in the image since the number of bits to encode a message cannot exceed the number
-	// of bits to encode the number of bits in the entire image. This provides a fixed number of bits for each image
-	// that can be calculated when concealing and revealing a message from an image.
-	numBitsToEncodeNumMessageBits := int(math.Floor(math.Log2(float64(totalBitsInImage))))
-	totalBitsAvailable := numBitsAvailable(width, height, *args.numChannels, *args.numBitsPerChannel)
+	if *args.maxSuspicion < 0 || *args.maxSuspicion > 1 {
+		return usageError{errors.New("max-suspicion must be between 0 and 1")}
+	}
 
-	if *args.verbose {
-		fmt.Println("Width:", width, "Height:", height)
-		fmt.Println("Total bits in image:", totalBitsInImage)
-		fmt.Println("Total bits available for use:", totalBitsAvailable)
-		fmt.Println("Total bits to be written:", totalBitsToBeWritten)
+	if *args.targetPSNR < 0 || *args.targetSSIM < 0 || *args.targetSSIM > 1 {
+		return usageError{errors.New("target-psnr cannot be negative and target-ssim must be between 0 and 1")}
 	}
 
-	if width+height < 2 {
-		return errors.New("image must have at least 2 pixels")
+	tune := *args.targetPSNR > 0 || *args.targetSSIM > 0
+	if tune && (*args.appendPayload || *args.tiled || *args.dryRun) {
+		return usageError{errors.New("target-psnr and target-ssim cannot be used with append, tiled or dry-run")}
 	}
 
-	if totalBitsAvailable < totalBitsToBeWritten+numBitsToEncodeNumMessageBits {
-		return errors.New("image is not large enough to hide a message")
+	args.applyProfile()
+	opts := args.options()
+
+	// The params of a headerless image are only known once its message has been concealed
+	var params stego.Header
+	if *args.noHeader {
+		opts = append(opts, stego.WithHeaderless(&params))
 	}
 
-	// Encode how many bits are used per channel
-	// Since we only need to encode the numbers 1 to 8, we can use take least significant bit
-	// from each of the first pixel's RGBA channels and use them to represent 1 to 8 since
-	// 2^4 can represent numbers from 0 to 15
+	message := []byte(*args.message)
+	var metadata *stego.Metadata
 
-	for i := 0; i < 4; i++ {
-		if getBit(*args.numBitsPerChannel, i) == 0 {
-			pixels[i] = clearBitUint8(pixels[i], 0)
-		} else {
-			pixels[i] = setBitUint8(pixels[i], 0)
+	if len(*args.files) > 0 {
+		content, fileMetadata, err := packFiles(*args.files)
+		if err != nil {
+			return err
 		}
+		message = content
+		metadata = &fileMetadata
 	}
+	defer zeroBytes(message)
 
-	if *args.verbose {
-		fmt.Println("Encoded number of bits per channel into the first pixel")
+	if *args.author != "" || *args.comment != "" || *args.timestamp || *args.expires != "" || *args.id {
+		if metadata == nil {
+			metadata = &stego.Metadata{}
+		}
+
+		if *args.id {
+			id, err := newID(*args.seed)
+			if err != nil {
+				return err
+			}
+			metadata.ID = id
+		}
+		metadata.Author = *args.author
+		metadata.Comment = *args.comment
+
+		if *args.timestamp {
+			created := time.Now().UTC().Truncate(time.Second)
+			metadata.Created = &created
+		}
+
+		if *args.expires != "" {
+			expires, err := parseExpiry(*args.expires, time.Now())
+			if err != nil {
+				return usageError{err}
+			}
+			metadata.Expires = &expires
+		}
 	}
 
-	stepper.skipPixel()
+	if *args.recipients != "" {
+		if *args.covers != "" || *args.inPlace || *args.appendPayload || *args.tiled || *args.noHeader ||
+			*args.dryRun || tune || *args.selfCheck || *args.audit {
+			return usageError{errors.New("recipients cannot be used with covers, in-place, append, tiled, " +
+				"no-header, dry-run, target-psnr, target-ssim, self-check or audit")}
+		}
+		return concealFingerprinted(args, message, metadata, opts)
+	}
 
-	// Encode how many channels the encoding will use in the second pixel. Since we can only
-	// have 1 to 4 channels as options, we can use the same technique as encoding the number
-	// of bits used per channel (The block of code above)
+	if *args.covers != "" {
+		if *args.inPlace || *args.appendPayload || *args.tiled || *args.noHeader || *args.dryRun || tune ||
+			*args.selfCheck || *args.audit {
+			return usageError{errors.New("covers cannot be used with in-place, append, tiled, no-header, dry-run, " +
+				"target-psnr, target-ssim, self-check or audit")}
+		}
+		return concealShards(args, message, metadata, opts)
+	}
+
+	if metadata != nil {
+		opts = append(opts, stego.WithMetadata(*metadata))
+	}
 
-	for i := 4; i < 8; i++ {
-		if getBit(*args.numChannels, i-4) == 0 {
-			pixels[i] = clearBitUint8(pixels[i], 0)
-		} else {
-			pixels[i] = setBitUint8(pixels[i], 0)
+	// A compressed message is planned with the size it's compressed to
+	planSize := len(message)
+	if codec, level, _ := parseCodec(*args.codec); *args.dryRun && codec != stego.CodecNone {
+		size, err := stego.CompressedSize(message, codec, level)
+		if err != nil {
+			return err
 		}
+		fmt.Println("Compressed size:", size, "bytes")
+		planSize = size
 	}
 
-	if *args.verbose {
-		fmt.Println("Encoded number of channels into the second pixel")
+	if *args.dryRun && *args.appendPayload {
+		return planAppend(*args.imagePath, planSize, opts)
 	}
 
-	stepper.skipPixel()
+	if *args.dryRun {
+		fmt.Println("Profile:", *args.profile)
+		fmt.Println("Strategy:", *args.strategy)
+		fmt.Println("Bits per channel:", *args.numBitsPerChannel)
+		fmt.Println("Channels:", *args.numChannels)
+		return planConceal(*args.imagePath, planSize, opts)
+	}
 
-	// Encode number of bits that will be written to the image
-	for i := 0; i < numBitsToEncodeNumMessageBits; i++ {
-		pixel := getPixel(outputImage, stepper.x, stepper.y)
-		channels := colorToChannels(img.At(stepper.x, stepper.y))
-		channelValue := channels[stepper.channel]
+	write := func(outputPath string) error {
+		return stego.Conceal(*args.imagePath, message, outputPath, opts...)
+	}
 
-		if getBit(totalBitsToBeWritten, i) == 0 {
-			pixel[stepper.channel] = clearBitUint8(channelValue, stepper.bitIndexOffset)
-		} else {
-			pixel[stepper.channel] = setBitUint8(channelValue, stepper.bitIndexOffset)
+	if *args.maxMemory > 0 && !*args.tiled {
+		config, err := imageConfig(*args.imagePath)
+		if err != nil {
+			return err
 		}
 
-		if err := stepper.step(); err != nil {
+		whole, tiled := concealMemory(config, len(message), *args.traversal, *args.passphrase != "")
+		canTile := *args.traversal == "linear" && !*args.appendPayload && !*args.noHeader
+
+		if *args.tiled, err = fitMemory("concealing", whole, tiled, *args.maxMemory, canTile, *args.imagePath); err != nil {
 			return err
 		}
+		if *args.tiled {
+			makeLogger(*args.verbose).Println("Concealing in tiles to keep within max-memory")
+		}
 	}
 
-	if *args.verbose {
-		fmt.Println("Encoded the number of bits that will be written")
-	}
+	if *args.tiled {
+		if *args.appendPayload {
+			return usageError{errors.New("tiled cannot be used with append")}
+		}
+		if *args.traversal != "linear" {
+			return usageError{errors.New("tiled requires the linear traversal")}
+		}
 
-	// Write encrypted message to the image
-	for _, encryptedByte := range messageBytes {
-		for i := 0; i < 8; i++ {
-			channels := colorToChannels(img.At(stepper.x, stepper.y))
-			channelValue := channels[stepper.channel]
-			pixel := getPixel(outputImage, stepper.x, stepper.y)
+		write = func(outputPath string) error {
+			return concealTiled(*args.imagePath, message, outputPath, opts)
+		}
+	}
 
-			if bit := getBitUint8(encryptedByte, i); bit == 0 {
-				pixel[stepper.channel] = clearBitUint8(channelValue, stepper.bitIndexOffset)
-			} else {
-				pixel[stepper.channel] = setBitUint8(channelValue, stepper.bitIndexOffset)
+	if *args.appendPayload {
+		write = func(outputPath string) error {
+			index, err := stego.Append(*args.imagePath, message, outputPath, opts...)
+			if err == nil {
+				fmt.Println("Appended payload", index)
 			}
+			return err
+		}
+	}
 
-			if err := stepper.step(); err != nil {
-				return err
-			}
+	if tune {
+		write = func(outputPath string) error {
+			return autoTune(*args.imagePath, outputPath, *args.targetPSNR, *args.targetSSIM, tuneCandidates(args),
+				makeLogger(*args.verbose), func(path string, tuned []stego.Option) error {
+					return stego.Conceal(*args.imagePath, message, path, append(opts, tuned...)...)
+				})
+		}
+	}
+
+	if *args.minPSNR > 0 || *args.minSSIM > 0 {
+		write = checkQuality(*args.imagePath, *args.minPSNR, *args.minSSIM, *args.warnQuality, write)
+	}
 
+	var err error
+	if *args.inPlace {
+		err = concealInPlace(*args.imagePath, *args.backup, write)
+	} else {
+		err = write(*args.output)
+	}
+
+	if err == nil && metadata != nil && metadata.ID != "" {
+		fmt.Println("ID:", metadata.ID)
+	}
+	if err == nil && *args.noHeader {
+		fmt.Println("Params:", params.Params())
+	}
+	if err == nil && *args.selfCheck {
+		err = selfCheck(*args.imagePath, *args.output, *args.inPlace)
+	}
+	if err == nil && *args.audit {
+		err = auditConceal(args)
+	}
+	return err
+}
+
+// auditConceal runs audit on the stego image conceal just wrote
+func auditConceal(args *ConcealArgs) error {
+	coverPath, stegoPath := *args.imagePath, *args.output
+	if *args.inPlace {
+		coverPath, stegoPath = "", *args.imagePath
+		if *args.backup {
+			coverPath = *args.imagePath + ".bak"
 		}
 	}
 
-	file, err := os.Create(*args.output)
-	if err != nil {
-		return err
+	return audit(coverPath, stegoPath, *args.maxSuspicion)
+}
+
+// selfCheck runs the chi-square attack on the stego image just written and on its cover, unless the cover was
+// replaced by it, and prints how likely each looks to hold a message
+func selfCheck(coverPath string, outputPath string, inPlace bool) error {
+	stegoPath := outputPath
+	if inPlace {
+		stegoPath = coverPath
 	}
 
-	err = png.Encode(file, outputImage)
+	img, err := stego.LoadImage(stegoPath)
 	if err != nil {
 		return err
 	}
+	fmt.Printf("Self-check: chi-square finds embedding with probability %.3f", chiSquareProbability(img))
 
-	if *args.verbose {
-		fmt.Println("Encoded message into the image")
+	if !inPlace {
+		cover, err := stego.LoadImage(coverPath)
+		if err != nil {
+			fmt.Println()
+			return err
+		}
+		fmt.Printf(" (cover: %.3f)", chiSquareProbability(cover))
 	}
 
+	fmt.Println()
 	return nil
 }
 
+// chiSquareProbability returns the probability the chi-square attack gives of img holding a message, which is
+// the only point of a curve over the whole image
+func chiSquareProbability(img image.Image) float64 {
+	curve := analysis.ChiSquareCurve(img, 1)
+	if len(curve) == 0 {
+		return 0
+	}
+	return curve[0].Probability
+}
+
+// newID returns the ID stored with a concealed message, which is made from seed when one is given so that the
+// same seed makes the same image
+func newID(seed string) (string, error) {
+	if seed == "" {
+		return stego.NewID(cryptorand.Reader)
+	}
+	return stego.NewID(stego.DeterministicRandom([]byte("id " + seed)))
+}
+
+// fileMetadata describes the file at path so that reveal can restore it. The type is guessed from the
+// extension, or from the content if the extension is unknown. The permissions and modification time are left
+// out if the file can't be stat'd.
+func fileMetadata(path string, content []byte) stego.Metadata {
+	fileType := mime.TypeByExtension(filepath.Ext(path))
+	if fileType == "" {
+		fileType = http.DetectContentType(content)
+	}
+
+	metadata := stego.Metadata{Name: filepath.Base(path), Type: fileType}
+
+	if info, err := os.Stat(path); err == nil {
+		modified := info.ModTime().UTC().Truncate(time.Second)
+		metadata.Mode = uint32(info.Mode().Perm())
+		metadata.Modified = &modified
+	}
+
+	return metadata
+}
+
+// printMetadata prints the ID, author, creation time, comment and expiry stored with a message to logger,
+// leaving out those that weren't given
+func printMetadata(logger stego.Logger, metadata *stego.Metadata) {
+	if metadata.ID != "" {
+		logger.Println("ID:", metadata.ID)
+	}
+	if metadata.Author != "" {
+		logger.Println("Author:", metadata.Author)
+	}
+	if metadata.Created != nil {
+		logger.Println("Created:", metadata.Created.Format(time.RFC3339))
+	}
+	if metadata.Comment != "" {
+		logger.Println("Comment:", metadata.Comment)
+	}
+	if metadata.Expires != nil && metadata.Expired(time.Now()) {
+		logger.Println("Expires:", metadata.Expires.Format(time.RFC3339), "(expired)")
+	} else if metadata.Expires != nil {
+		logger.Println("Expires:", metadata.Expires.Format(time.RFC3339))
+	}
+}
+
+// warnExpired warns on stderr when a message that was revealed with ignore-expiry has expired
+func warnExpired(metadata *stego.Metadata) {
+	if metadata != nil && metadata.Expired(time.Now()) {
+		fmt.Fprintln(os.Stderr, "Warning: the message expired on", metadata.Expires.Format(time.RFC3339))
+	}
+}
+
 func reveal(args *RevealArgs) error {
-	img, err := loadImage(*args.imagePath)
+	if keyedTraversal(*args.traversal) && *args.passphrase == "" {
+		return errors.New("keyed traversal requires a passphrase")
+	}
 
-	if err != nil {
-		return err
+	given := 0
+	for _, source := range []string{*args.imagePath, *args.inputDir, *args.shards} {
+		if source != "" {
+			given++
+		}
+	}
+	if given != 1 {
+		return usageError{errors.New("either an image path, an input directory or shards is required")}
+	}
+
+	if *args.workers <= 0 {
+		return usageError{errors.New("number of workers must be positive")}
+	}
+
+	if *args.follow && *args.imagePath == "" {
+		return usageError{errors.New("follow requires an image path")}
+	}
+
+	if *args.inputDir != "" {
+		if *args.outputDir == "" {
+			return usageError{errors.New("an output directory is required with an input directory")}
+		}
+		return revealDir(args)
+	}
+
+	if *args.shards != "" {
+		return revealShards(args)
+	}
+
+	if *args.follow {
+		return revealChain(args)
+	}
+
+	if *args.slots != 0 {
+		return revealSlot(args)
+	}
+
+	if *args.peek < 0 {
+		return usageError{errors.New("number of bytes to peek cannot be negative")}
+	}
+
+	if *args.payload < 0 {
+		return usageError{errors.New("payload index cannot be negative")}
+	}
+
+	if *args.maxMemory > 0 && !*args.tiled {
+		config, err := imageConfig(*args.imagePath)
+		if err != nil {
+			return err
+		}
+
+		whole, tiled := revealMemory(config, *args.traversal)
+		canTile := *args.traversal == "linear" && *args.payload == 0 && *args.peek == 0 && *args.byteRange == "" &&
+			!*args.list && len(*args.extract) == 0 && *args.params == ""
+
+		if *args.tiled, err = fitMemory("revealing", whole, tiled, *args.maxMemory, canTile, *args.imagePath); err != nil {
+			return err
+		}
+		if *args.tiled {
+			makeLogger(*args.verbose).Println("Revealing in tiles to keep within max-memory")
+		}
+	}
+
+	if *args.list {
+		return listFiles(*args.imagePath, args.options())
 	}
 
-	var channels []uint8
-	width := img.Bounds().Max.X
-	height := img.Bounds().Max.Y
-	numBitsToUsePerChannel := 0
-	numChannels := 0
-	numMessageBits := 0
+	if len(*args.extract) > 0 {
+		dir := *args.outputDir
+		if dir == "" {
+			dir = "."
+		}
+		return extractFiles(*args.imagePath, *args.extract, dir, args.options())
+	}
+
+	if *args.tiled {
+		if *args.traversal != "linear" {
+			return usageError{errors.New("tiled requires the linear traversal")}
+		}
+		if *args.payload != 0 || *args.peek > 0 || *args.byteRange != "" || *args.bestEffort || *args.params != "" {
+			return usageError{errors.New("tiled cannot be used with payload, peek, range, best-effort or params")}
+		}
+		return revealTiled(*args.imagePath, *args.outputDir, *args.verbose, args.options())
+	}
 
-	// Extract numBitsToUsePerChannel from the least significant bits of the 4 channels in the first pixel
-	channels = colorToChannels(img.At(0, 0))
+	if *args.peek > 0 && *args.byteRange != "" {
+		return usageError{errors.New("peek and range cannot both be given")}
+	}
 
-	for i := 0; i < 4; i++ {
-		channelValue := channels[i]
+	if *args.peek > 0 {
+		return revealRange(*args.imagePath, 0, *args.peek, args.options())
+	}
 
-		if getBitUint8(channelValue, 0) == 0 {
-			numBitsToUsePerChannel = clearBit(numBitsToUsePerChannel, i)
-		} else {
-			numBitsToUsePerChannel = setBit(numBitsToUsePerChannel, i)
+	if *args.byteRange != "" {
+		start, end, err := parseByteRange(*args.byteRange)
+		if err != nil {
+			return usageError{err}
 		}
+		return revealRange(*args.imagePath, start, end, args.options())
 	}
 
-	if *args.verbose {
-		fmt.Println("Width:", width, "Height:", height)
-		fmt.Println("Decoded number of bits to use per channel from first pixel:", numBitsToUsePerChannel)
+	message, result, err := stego.Reveal(*args.imagePath, args.options()...)
+	if err != nil {
+		return err
 	}
+	defer zeroBytes(message)
 
-	// Extract numChannels from the least significant bits of the 4 channels in the second pixel
-	// Since we're guaranteed to have at least two pixels (Because conceal() requires and exports
-	// an image with at least 2 pixels, we need to make sure two grab the correct second pixel at
-	// point (0, 1) or (1, 0)
+	name := strings.TrimSuffix(filepath.Base(*args.imagePath), filepath.Ext(*args.imagePath))
 
-	if (image.Point{X: 1, Y: 0}.In(img.Bounds())) {
-		channels = colorToChannels(img.At(1, 0))
+	if err := outputMessage(*args.outputDir, result.Metadata, message, name); err != nil {
+		return err
+	}
+
+	logger := makeLogger(*args.verbose)
+	if result.Metadata != nil {
+		if result.Metadata.Name != "" {
+			logger.Println("Name:", result.Metadata.Name)
+			logger.Println("Type:", result.Metadata.Type)
+		}
+		printMetadata(logger, result.Metadata)
+	}
+	logger.Println("Strategy:", result.Strategy())
+	logger.Println("Encrypted:", result.Encrypted)
+	logger.Println("Size:", result.Size, "bytes")
+	logger.Println("SHA-256:", fmt.Sprintf("%x", result.Checksum))
+	if result.Verified {
+		logger.Println("Payload intact: yes, it matches the checksum stored with it")
 	} else {
-		channels = colorToChannels(img.At(0, 1))
+		logger.Println("Payload intact: unknown, the image predates stored checksums")
 	}
+	logger.Println("Duration:", result.Duration)
 
-	for i := 0; i < 4; i++ {
-		channelValue := channels[i]
+	printDamage(result.Damage)
+	warnExpired(result.Metadata)
+	return nil
+}
 
-		if getBitUint8(channelValue, 0) == 0 {
-			numChannels = clearBit(numChannels, i)
-		} else {
-			numChannels = setBit(numChannels, i)
+// outputMessage writes a revealed message to outputDir with writeMessage, or prints it without an output directory
+func outputMessage(outputDir string, metadata *stego.Metadata, message []byte, name string) error {
+	if outputDir != "" {
+		paths, err := writeMessage(outputDir, metadata, message, name)
+		for _, path := range paths {
+			fmt.Println("Wrote", path)
 		}
+		return err
+
+	} else if metadata != nil && len(metadata.Entries) > 0 {
+		return usageError{errors.New("the message holds several files, give an output directory or use list or extract")}
 	}
 
-	if *args.verbose {
-		fmt.Println("Decoded number of channels from second pixel:", numChannels)
+	fmt.Printf("Message: %s\n", message)
+	return nil
+}
+
+// writeMessage writes a revealed message to dir, as the files its metadata describes or else under name, and
+// returns the paths it wrote
+func writeMessage(dir string, metadata *stego.Metadata, message []byte, name string) ([]string, error) {
+	if metadata != nil {
+		return writeFiles(dir, metadata, message, name)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, message, 0600); err != nil {
+		return nil, err
+	}
+
+	return []string{path}, nil
+}
+
+// printDamage prints the damage report of a message revealed with best-effort to stderr, so it's kept apart from
+// a message printed to stdout
+func printDamage(damage []stego.Damage) {
+	if len(damage) == 0 {
+		return
 	}
 
-	stepper := makeImageStepper(numBitsToUsePerChannel, width, height, numChannels, 0)
-	stepper.skipPixel()
-	stepper.skipPixel()
+	fmt.Fprintln(os.Stderr, "Damage report:")
+	for _, entry := range damage {
+		fmt.Fprintf(os.Stderr, "  bytes %d up to %d: %s\n", entry.Start, entry.End, entry.Reason)
+	}
+}
 
-	// See func conceal for a description of numBitsToEncodeNumMessageBits
-	totalBitsInImage := numBitsAvailable(width, height, 4, 8)
-	numBitsToEncodeNumMessageBits := int(math.Floor(math.Log2(float64(totalBitsInImage))))
+// revealRange reveals only the bytes of the message from start up to end, or up to the end of the message if end
+// is -1. Only those bytes of an unencrypted message are read, but an encrypted message is sealed as a whole, so
+// all of it is still decrypted and authenticated.
+func revealRange(imagePath string, start int, end int, opts []stego.Option) error {
+	decoder, err := openDecoder(imagePath, opts)
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
 
-	for i := 0; i < numBitsToEncodeNumMessageBits; i++ {
-		channels := colorToChannels(img.At(stepper.x, stepper.y))
-		channelValue := channels[stepper.channel]
+	if _, err := decoder.Seek(int64(start), io.SeekStart); err != nil {
+		return err
+	}
 
-		if getBitUint8(channelValue, stepper.bitIndexOffset) == 0 {
-			numMessageBits = clearBit(numMessageBits, i)
-		} else {
-			numMessageBits = setBit(numMessageBits, i)
+	var message []byte
+	if end == -1 {
+		message, err = ioutil.ReadAll(decoder)
+	} else {
+		message = make([]byte, end-start)
+		var read int
+		read, err = io.ReadFull(decoder, message)
+		message = message[:read]
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			err = nil
 		}
+	}
+	defer zeroBytes(message)
 
-		if err := stepper.step(); err != nil {
-			return err
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Message: %s\n", message)
+	return nil
+}
+
+func planConceal(imagePath string, messageSize int, opts []stego.Option) error {
+	img, err := stego.LoadImage(imagePath)
+	if err != nil {
+		return err
+	}
+
+	plan, err := stego.PlanConceal(img.Bounds().Max.X, img.Bounds().Max.Y, messageSize, opts...)
+	if err != nil {
+		return err
+	}
+
+	return printPlan(plan)
+}
+
+// planAppend shows how a message would be appended to the payloads already in the image at imagePath
+func planAppend(imagePath string, messageSize int, opts []stego.Option) error {
+	img, err := stego.LoadImage(imagePath)
+	if err != nil {
+		return err
+	}
+
+	plan, err := stego.PlanAppend(img, messageSize, opts...)
+	if err != nil {
+		return err
+	}
+
+	return printPlan(plan)
+}
+
+// printPlan prints plan and returns ErrCapacityExceeded if the message doesn't fit
+func printPlan(plan stego.Plan) error {
+	fmt.Println("Header:", plan.HeaderPixels, "pixels")
+	fmt.Println("Capacity:", plan.CapacityBits/8, "bytes")
+	fmt.Println("Overhead:", plan.OverheadBytes, "bytes")
+	fmt.Println("Maximum message size:", plan.MaxMessageBytes, "bytes")
+	fmt.Println("Message size:", plan.MessageBytes, "bytes")
+	fmt.Println("Embedded size:", plan.EmbeddedBytes, "bytes")
+	fmt.Println("Margin:", plan.Margin(), "bytes")
+
+	if !plan.Fits() {
+		return stego.ErrCapacityExceeded
+	}
+
+	return nil
+}
+
+func info(args *InfoArgs) error {
+	img, err := stego.LoadImage(*args.imagePath)
+	if err != nil {
+		return err
+	}
+
+	// An expired message is still described, along with when it expired
+	opts := []stego.Option{
+		stego.WithPassphrase(*args.passphrase),
+		stego.WithTraversal(makeTraversal(*args.traversal, *args.passphrase)),
+		stego.WithIgnoreExpiry(true),
+	}
+
+	header, err := stego.DecodeHeader(img, opts...)
+
+	if err == stego.ErrUnsupportedVersion {
+		fmt.Printf("Format version: %d (this release reads up to %d)\n", header.Version, stego.HeaderVersion)
+	}
+
+	// Without the strategy the rest of the header couldn't be read
+	if header.Strategy == nil {
+		return err
+	}
+
+	fmt.Println("Format version:", header.Version)
+	fmt.Println("Bits per channel:", header.NumBitsPerChannel)
+	fmt.Println("Channels:", header.NumChannels)
+	fmt.Println("Strategy:", header.Strategy.Name())
+	fmt.Println("Message size:", header.NumMessageBits/8, "bytes")
+	fmt.Println("Encryption:", encryptionName(header))
+	fmt.Println("Compression:", header.Codec)
+
+	switch err {
+	case stego.ErrCorruptHeader, stego.ErrPassphraseRequired, stego.ErrPrivateKeyRequired, stego.ErrNotEncrypted:
+		fmt.Println("Authenticated: no,", err)
+		return nil
+	}
+
+	if err != nil && *args.passphrase != "" {
+		fmt.Println("Authenticated: no, the passphrase is wrong or the image doesn't hold a message")
+		return nil
+	} else if err != nil {
+		fmt.Println("Authenticated: no, the image is protected with a passphrase or doesn't hold a message")
+		return nil
+	}
+	fmt.Println("Authenticated: yes")
+	if header.FromBackup {
+		fmt.Println("Header: damaged, read from a backup copy")
+	}
+
+	// The message is read to the end so that its size is known and an encrypted message is authenticated
+	decoder, err := stego.NewDecoder(img, opts...)
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+
+	size, err := io.Copy(ioutil.Discard, decoder)
+
+	if decoder.Encrypted() && err != nil {
+		fmt.Println("Decrypted: no,", err)
+		return nil
+	} else if err != nil {
+		return err
+	} else if decoder.Encrypted() {
+		fmt.Println("Decrypted: yes")
+	}
+
+	fmt.Println("Payload size:", size, "bytes")
+
+	if metadata, _ := decoder.Metadata(); metadata != nil {
+		printMetadata(makeLogger(true), metadata)
+
+		// A message that only carries an author, comment or time isn't a file
+		if metadata.Name != "" || len(metadata.Entries) > 0 {
+			for _, entry := range entries(metadata, int(size)) {
+				fmt.Println("File:", entry.Name, entry.Size, "bytes", entry.Type)
+			}
 		}
 	}
 
-	if *args.verbose {
-		fmt.Println("Decoded number of bits used to encode the message:", numMessageBits)
+	return nil
+}
+
+func detect(args *DetectArgs) error {
+	img, err := stego.LoadImage(*args.imagePath)
+	if err != nil {
+		return err
 	}
 
-	// Read encoded and possibly encrypted message from the image and write it to messageBytes
-	messageBytes := make([]byte, numMessageBits/8)
-	numBitsRead := 0
-	byteIndex := 0
+	if *args.curve < 0 {
+		return usageError{errors.New("number of curve points cannot be negative")}
+	}
 
-	for i := 0; i < numMessageBits; i++ {
-		channels := colorToChannels(img.At(stepper.x, stepper.y))
-		channelValue := channels[stepper.channel]
+	var model *analysis.Model
+	if *args.modelPath != "" {
+		if model, err = loadModel(*args.modelPath); err != nil {
+			return err
+		}
+	} else if *args.useModel {
+		model = analysis.DefaultModel()
+	}
+
+	report := analysis.DetectWithModel(img, model)
 
-		if getBitUint8(channelValue, stepper.bitIndexOffset) == 0 {
-			messageBytes[byteIndex] = clearBitUint8(messageBytes[byteIndex], numBitsRead)
-		} else {
-			messageBytes[byteIndex] = setBitUint8(messageBytes[byteIndex], numBitsRead)
+	fmt.Printf("Suspicion: %.3f\n", report.Score)
+	for _, test := range report.Tests {
+		fmt.Printf("%s: %.3f\n", test.Name, test.Score)
+
+		names := make([]string, 0, len(test.Details))
+		for name := range test.Details {
+			names = append(names, name)
 		}
+		sort.Strings(names)
 
-		if numBitsRead++; numBitsRead == 8 {
-			numBitsRead = 0
-			byteIndex++
+		for _, name := range names {
+			fmt.Printf("  %s: %.4g\n", name, test.Details[name])
 		}
+	}
 
-		if err := stepper.step(); err != nil {
-			return err
+	if *args.curve > 0 {
+		fmt.Println("chi-square curve:")
+		for _, point := range analysis.ChiSquareCurve(img, *args.curve) {
+			fmt.Printf("  %5.1f%%: %.3f\n", point.Fraction*100, point.Probability)
 		}
 	}
 
-	if *args.verbose && (*args.passphrase != "" || *args.privateKeyPath != "") {
-		fmt.Println("Decrypting message")
+	return nil
+}
+
+// loadModel reads the model weights at path for detect
+func loadModel(path string) (*analysis.Model, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
+	defer file.Close()
 
-	var message string
+	return analysis.LoadModel(file)
+}
 
-	if *args.passphrase != "" {
-		message = string(decrypt(messageBytes, *args.passphrase))
+func planes(args *PlanesArgs) error {
+	img, err := stego.LoadImage(*args.imagePath)
+	if err != nil {
+		return err
+	}
 
-	} else if *args.privateKeyPath != "" {
-		return errors.New("PGP encryption not yet implemented")
+	if err := os.MkdirAll(*args.outDir, 0755); err != nil {
+		return err
+	}
 
-	} else {
-		message = string(messageBytes)
+	channelNames := []string{"R", "G", "B", "A"}
+
+	for c := 0; c < *args.numChannels; c++ {
+		for bit := uint(0); bit < uint(*args.numBits); bit++ {
+			path := filepath.Join(*args.outDir, fmt.Sprintf("%s%d.png", channelNames[c], bit))
+			if err := stego.SaveImage(path, analysis.BitPlane(img, c, bit)); err != nil {
+				return err
+			}
+		}
 	}
 
-	fmt.Println("Message:", message)
+	fmt.Println("Wrote", *args.numChannels**args.numBits, "bit planes to", *args.outDir)
 	return nil
 }
+
+func wipe(args *WipeArgs) error {
+	if *args.inPlace && *args.output != "" {
+		return usageError{errors.New("an output path cannot be given with in-place")}
+	}
+
+	if *args.backup && !*args.inPlace {
+		return usageError{errors.New("backup requires in-place")}
+	}
+
+	opts := []stego.Option{
+		stego.WithBitsPerChannel(*args.numBits),
+		stego.WithChannels(*args.numChannels),
+		stego.WithCompression(makeCompression(*args.compression)),
+		stego.WithProgress(makeProgress(*args.progress, *args.quiet)),
+	}
+
+	write := func(outputPath string) error {
+		return stego.Wipe(*args.imagePath, outputPath, opts...)
+	}
+
+	if *args.inPlace {
+		return concealInPlace(*args.imagePath, *args.backup, write)
+	}
+
+	if *args.output == "" {
+		*args.output = fmt.Sprintf("%s.wiped", *args.imagePath)
+	}
+
+	return write(*args.output)
+}
+
+// zeroBytes overwrites every byte of b with 0
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// concealInPlace replaces the cover at imagePath with the stego image that write writes to the path it's given.
+// The stego image is written to a temporary file next to the cover first and only renamed over it once it has
+// been written, so a failure never leaves a partially written cover. With backup, the original cover is kept as
+// imagePath.bak.
+func concealInPlace(imagePath string, backup bool, write func(outputPath string) error) error {
+	info, err := os.Stat(imagePath)
+	if err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(imagePath), "."+filepath.Base(imagePath)+".*")
+	if err != nil {
+		return err
+	}
+	tempPath := temp.Name()
+	temp.Close()
+	defer os.Remove(tempPath)
+
+	if err := write(tempPath); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tempPath, info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	if backup {
+		if err := copyFile(imagePath, imagePath+".bak", info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(tempPath, imagePath)
+}
+
+// copyFile copies the file at src to dst, replacing dst if it exists
+func copyFile(src string, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
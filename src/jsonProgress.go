@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// JSONProgress is the Progress used by the command line for wrappers that show progress themselves. It writes
+// one JSON object per line for the start of each phase, every percent of progress and the end of each phase.
+type JSONProgress struct {
+	out     *json.Encoder
+	phase   string
+	total   int
+	done    int
+	percent int
+	start   time.Time
+}
+
+// progressEvent is a single line written by JSONProgress. Total is -1 when it isn't known, and ETA is the
+// estimated number of seconds left, or -1 when it can't be estimated yet.
+type progressEvent struct {
+	Event string  `json:"event"`
+	Phase string  `json:"phase"`
+	Done  int     `json:"done"`
+	Total int     `json:"total"`
+	ETA   float64 `json:"eta"`
+}
+
+func makeJSONProgress(out io.Writer) *JSONProgress {
+	return &JSONProgress{out: json.NewEncoder(out)}
+}
+
+func (self *JSONProgress) OnStart(phase string, total int) {
+	self.phase = phase
+	self.total = total
+	self.done = 0
+	self.percent = 0
+	self.start = time.Now()
+	self.emit("start", 0)
+}
+
+func (self *JSONProgress) OnProgress(done int) {
+	self.done = done
+
+	if self.total > 0 {
+		// Only emit an event when another percent is done
+		percent := 100 * done / self.total
+		if percent == self.percent {
+			return
+		}
+		self.percent = percent
+	}
+
+	self.emit("progress", done)
+}
+
+func (self *JSONProgress) OnDone() {
+	if self.total >= 0 {
+		self.done = self.total
+	}
+	self.emit("done", self.done)
+}
+
+func (self *JSONProgress) emit(event string, done int) {
+	eta := -1.0
+	if event == "done" {
+		eta = 0
+	} else if self.total > 0 && done > 0 {
+		elapsed := time.Since(self.start).Seconds()
+		eta = elapsed * float64(self.total-done) / float64(done)
+	}
+
+	self.out.Encode(progressEvent{Event: event, Phase: self.phase, Done: done, Total: self.total, ETA: eta})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"image"
+	"image/color"
+	"os"
+	"strconv"
+)
+
+// The estimates below only count what grows with the image and the message: the decoded image, the copy
+// conceal writes to, the permutation of the shuffled traversal and the buffers of the message. Everything else
+// is covered by baseMemory.
+
+// baseMemory is about how much memory the runtime, the PNG encoder and the other fixed buffers take up
+const baseMemory = 16 << 20
+
+// bandMemory is about how much memory the band of rows processed in tiles takes up
+const bandMemory = 8 << 20
+
+// decodedSize returns about how many bytes the image described by config takes up once decoded
+func decodedSize(config image.Config) int {
+	bytesPerPixel := 4
+
+	switch config.ColorModel {
+	case color.GrayModel, color.AlphaModel:
+		bytesPerPixel = 1
+	case color.Gray16Model, color.Alpha16Model:
+		bytesPerPixel = 2
+	case color.RGBA64Model, color.NRGBA64Model:
+		bytesPerPixel = 8
+	default:
+		if _, ok := config.ColorModel.(color.Palette); ok {
+			bytesPerPixel = 1
+		}
+	}
+
+	return config.Width * config.Height * bytesPerPixel
+}
+
+// traversalSize returns how many bytes the traversal called name takes up over a width by height image. Only
+// the shuffled traversal keeps a list of the pixels.
+func traversalSize(name string, width int, height int) int {
+	if name == "shuffled" {
+		return width * height * strconv.IntSize / 8
+	}
+	return 0
+}
+
+// concealMemory returns about how many bytes concealing a message of messageSize bytes in the cover described
+// by config takes, and how many it takes in tiles. An encrypted message is held as plaintext and ciphertext.
+func concealMemory(config image.Config, messageSize int, traversal string, encrypted bool) (int, int) {
+	messageMemory := messageSize
+	if encrypted {
+		messageMemory += 2 * messageSize
+	}
+
+	whole := baseMemory + decodedSize(config) + 4*config.Width*config.Height +
+		traversalSize(traversal, config.Width, config.Height) + messageMemory
+	tiled := baseMemory + bandMemory + messageMemory
+
+	return whole, tiled
+}
+
+// revealMemory returns about how many bytes revealing the image described by config takes, and how many it
+// takes in tiles, leaving out the message, whose size isn't known until the header has been read
+func revealMemory(config image.Config, traversal string) (int, int) {
+	whole := baseMemory + decodedSize(config) + traversalSize(traversal, config.Width, config.Height)
+	return whole, baseMemory + bandMemory
+}
+
+// imageConfig decodes the dimensions and color model of the image at path without decoding its pixels
+func imageConfig(path string) (image.Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err == image.ErrFormat {
+		return image.Config{}, stego.ErrUnsupportedFormat
+	}
+	return config, err
+}
+
+// checkTiled returns stego.ErrNotTileable unless the image at path can be processed in tiles
+func checkTiled(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return stego.CheckTiled(file)
+}
+
+// fitMemory decides how a job that needs about whole bytes of memory, or tiled bytes in tiles, keeps within
+// limit, which is unlimited if it's 0. It returns true if the job must be processed in tiles to fit, and an
+// error if it can't fit at all. canTile is false when the options of the job need the whole image.
+func fitMemory(operation string, whole int, tiled int, limit int, canTile bool, imagePath string) (bool, error) {
+	if limit <= 0 || whole <= limit {
+		return false, nil
+	}
+
+	reason := "its options need the whole image in memory"
+
+	if canTile {
+		if err := checkTiled(imagePath); err != nil {
+			reason = err.Error()
+		} else if tiled > limit {
+			reason = "even processing it in tiles needs about " + formatMemory(tiled)
+		} else {
+			return true, nil
+		}
+	}
+
+	return false, fmt.Errorf("%s needs about %s of memory but max-memory allows %s, and %s",
+		operation, formatMemory(whole), formatMemory(limit), reason)
+}
+
+// formatMemory formats a number of bytes in MB rounded up, or in bytes when it's less than 1 MB, so that a small
+// limit isn't shown as 0 MB
+func formatMemory(numBytes int) string {
+	if numBytes < 1<<20 {
+		return fmt.Sprintf("%d bytes", numBytes)
+	}
+	return fmt.Sprintf("%d MB", (numBytes+1<<20-1)>>20)
+}
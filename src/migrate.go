@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"io/ioutil"
+)
+
+// formatNames are the formats reveal can be told an image is in
+var formatNames = []string{"auto", "v1", "v2"}
+
+// makeFormat returns the format called name
+func makeFormat(name string) int {
+	switch name {
+	case "v1":
+		return stego.FormatV1
+	case "v2":
+		return stego.FormatV2
+	default:
+		return stego.FormatAuto
+	}
+}
+
+// migrate reveals the message of an image in the first format and conceals it again in the current format, in
+// the same image and with the same bits per channel, channels and passphrase
+func migrate(args *MigrateArgs) error {
+	if *args.inPlace && *args.output != "" {
+		return usageError{errors.New("an output path cannot be given with in-place")}
+	}
+
+	if *args.backup && !*args.inPlace {
+		return usageError{errors.New("backup requires in-place")}
+	}
+
+	img, err := stego.LoadImage(*args.imagePath)
+	if err != nil {
+		return err
+	}
+
+	decoder, err := stego.NewDecoder(img, stego.WithPassphrase(*args.passphrase), stego.WithFormat(stego.FormatV1))
+	if err != nil {
+		return err
+	}
+
+	message, err := ioutil.ReadAll(decoder)
+	header := decoder.Header()
+	decoder.Close()
+	defer zeroBytes(message)
+
+	if err != nil {
+		return err
+	}
+
+	opts := []stego.Option{
+		stego.WithPassphrase(*args.passphrase),
+		stego.WithBitsPerChannel(header.NumBitsPerChannel),
+		stego.WithChannels(header.NumChannels),
+	}
+
+	write := func(outputPath string) error {
+		outputImage, err := stego.ConcealImage(img, bytes.NewReader(message), opts...)
+		if err != nil {
+			return err
+		}
+		return stego.SaveImage(outputPath, outputImage, stego.WithCompression(makeCompression(*args.compression)))
+	}
+
+	if *args.inPlace {
+		err = concealInPlace(*args.imagePath, *args.backup, write)
+	} else {
+		if *args.output == "" {
+			*args.output = fmt.Sprintf("%s.migrated", *args.imagePath)
+		}
+		err = write(*args.output)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Migrated", len(message), "bytes with", header.NumBitsPerChannel, "bits of", header.NumChannels, "channels")
+	return nil
+}
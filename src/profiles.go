@@ -0,0 +1,38 @@
+package main
+
+// profile sets the options that decide how a message is embedded together
+type profile struct {
+	strategy          string
+	numBitsPerChannel int
+	numChannels       int
+}
+
+// profiles are the profiles that can be selected on the command line. stealth changes as little of the cover
+// as possible and avoids the statistical traces of replacing bits, and capacity fits the largest message.
+var profiles = map[string]profile{
+	"stealth":  {strategy: "lsb-matching", numBitsPerChannel: 1, numChannels: 3},
+	"capacity": {strategy: "lsb", numBitsPerChannel: 4, numChannels: 4},
+}
+
+// profileNames are the names of the profiles, with none leaving the options as they are
+var profileNames = []string{"none", "stealth", "capacity"}
+
+// applyProfile replaces the options set by the selected profile, unless they were given on the command line
+func (self *ConcealArgs) applyProfile() {
+	profile, ok := profiles[*self.profile]
+	if !ok {
+		return
+	}
+
+	if !self.given["strategy"] {
+		*self.strategy = profile.strategy
+	}
+
+	if !self.given["num-bits"] {
+		*self.numBitsPerChannel = profile.numBitsPerChannel
+	}
+
+	if !self.given["channels"] {
+		*self.numChannels = profile.numChannels
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// progressBarWidth is the number of characters the bar itself takes up
+const progressBarWidth = 30
+
+// ProgressBar is the Progress used by the command line, which draws a bar for each phase on a terminal
+type ProgressBar struct {
+	out     io.Writer
+	phase   string
+	total   int
+	percent int
+}
+
+func makeProgressBar(out io.Writer) *ProgressBar {
+	return &ProgressBar{out: out}
+}
+
+func (self *ProgressBar) OnStart(phase string, total int) {
+	self.phase = phase
+	self.total = total
+	self.percent = -1
+	self.OnProgress(0)
+}
+
+func (self *ProgressBar) OnProgress(done int) {
+	if self.total < 0 {
+		fmt.Fprintf(self.out, "\r%s %d bytes", self.phase, done)
+		return
+	}
+
+	filled := progressBarWidth
+	percent := 100
+
+	if self.total > 0 {
+		filled = progressBarWidth * done / self.total
+		percent = 100 * done / self.total
+	}
+
+	// Only redraw when the bar would change
+	if percent == self.percent {
+		return
+	}
+	self.percent = percent
+
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled)
+	fmt.Fprintf(self.out, "\r%s [%s] %3d%%", self.phase, bar, percent)
+}
+
+func (self *ProgressBar) OnDone() {
+	if self.total >= 0 {
+		self.OnProgress(self.total)
+	}
+	fmt.Fprintln(self.out)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/analysis"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// errQualityTooLow is returned by conceal when the stego image is below min-psnr or min-ssim
+var errQualityTooLow = errors.New("stego image is below the required quality")
+
+// checkQuality returns write wrapped to only leave the stego image at the output path once its PSNR and SSIM
+// against the cover at coverPath are at least minPSNR and minSSIM, where 0 skips the check. An image that fails
+// leaves whatever was at the output path as it was. With warnOnly, it's kept anyway and a warning is printed.
+func checkQuality(coverPath string, minPSNR float64, minSSIM float64, warnOnly bool,
+	write func(outputPath string) error) func(outputPath string) error {
+
+	return func(outputPath string) error {
+		cover, err := stego.LoadImage(coverPath)
+		if err != nil {
+			return err
+		}
+
+		return writeThroughTemp(outputPath, write, func(stegoPath string) error {
+			comparison, err := measureQuality(cover, stegoPath)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Quality: PSNR %s, SSIM %.6f\n", formatPSNR(comparison.PSNR), comparison.SSIM)
+
+			if meetsQuality(comparison, minPSNR, minSSIM) {
+				return nil
+			}
+			if !warnOnly {
+				return errQualityTooLow
+			}
+			fmt.Fprintln(os.Stderr, "Warning:", errQualityTooLow)
+			return nil
+		})
+	}
+}
+
+// writeThroughTemp calls write with a temporary file next to outputPath, then check with it, and only renames it
+// over outputPath once both succeed, so that an image that fails leaves whatever was at outputPath as it was
+func writeThroughTemp(outputPath string, write func(path string) error, check func(path string) error) error {
+	temp, err := ioutil.TempFile(filepath.Dir(outputPath), "."+filepath.Base(outputPath)+".*")
+	if err != nil {
+		return err
+	}
+	tempPath := temp.Name()
+	temp.Close()
+	defer os.Remove(tempPath)
+
+	if err := write(tempPath); err != nil {
+		return err
+	}
+
+	// The temporary file is only readable by its owner, unlike the image written straight to outputPath
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(outputPath); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if err := os.Chmod(tempPath, perm); err != nil {
+		return err
+	}
+
+	if err := check(tempPath); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, outputPath)
+}
+
+// measureQuality compares the stego image at stegoPath with its cover
+func measureQuality(cover image.Image, stegoPath string) (analysis.Comparison, error) {
+	img, err := stego.LoadImage(stegoPath)
+	if err != nil {
+		return analysis.Comparison{}, err
+	}
+
+	return analysis.Compare(cover, img, false)
+}
+
+// meetsQuality reports whether the PSNR and SSIM of comparison are at least minPSNR and minSSIM, where 0 skips
+// the check
+func meetsQuality(comparison analysis.Comparison, minPSNR float64, minSSIM float64) bool {
+	return (minPSNR <= 0 || comparison.PSNR >= minPSNR) && (minSSIM <= 0 || comparison.SSIM >= minSSIM)
+}
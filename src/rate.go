@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/analysis"
+	"github.com/andresmejia3/hide/pkg/stego"
+)
+
+// rateReport is what the estimate-rate command reports with --json
+type rateReport struct {
+	BitsPerPixel     float64 `json:"bits_per_pixel"`
+	Low              float64 `json:"low"`
+	High             float64 `json:"high"`
+	Confidence       float64 `json:"confidence"`
+	SamplePairs      float64 `json:"sample_pairs"`
+	Sequential       float64 `json:"sequential"`
+	Pixels           int     `json:"pixels"`
+	EstimatedBytes   int     `json:"estimated_bytes"`
+	EstimatedMaximum int     `json:"estimated_max_bytes"`
+}
+
+// estimateRate prints how many bits of message each pixel of the image at imagePath holds by the blind tests,
+// and roughly how large a message that makes
+func estimateRate(args *EstimateRateArgs) error {
+	img, err := stego.LoadImage(*args.imagePath)
+	if err != nil {
+		return err
+	}
+
+	estimate := analysis.EstimateRate(img)
+	numPixels := img.Bounds().Dx() * img.Bounds().Dy()
+
+	report := rateReport{
+		BitsPerPixel:     estimate.BitsPerPixel,
+		Low:              estimate.Low,
+		High:             estimate.High,
+		Confidence:       estimate.Confidence,
+		SamplePairs:      estimate.SamplePairs,
+		Sequential:       estimate.Sequential,
+		Pixels:           numPixels,
+		EstimatedBytes:   int(estimate.BitsPerPixel * float64(numPixels) / 8),
+		EstimatedMaximum: int(estimate.High * float64(numPixels) / 8),
+	}
+
+	if *args.json {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("Rate: %.4f bits per pixel (%.0f%% interval %.4f to %.4f)\n", report.BitsPerPixel,
+		report.Confidence*100, report.Low, report.High)
+	fmt.Printf("  sample pairs: %.4f\n", report.SamplePairs)
+	if report.Sequential > 0 {
+		fmt.Printf("  along the rows: %.4f\n", report.Sequential)
+	} else {
+		fmt.Println("  along the rows: none found")
+	}
+	fmt.Printf("Message: about %d bytes, at most %d\n", report.EstimatedBytes, report.EstimatedMaximum)
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/analysis"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"image"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// scanResult is what was found in a single file
+type scanResult struct {
+	path      string
+	header    string
+	suspicion float64
+	err       error
+}
+
+func scan(args *ScanArgs) error {
+	if *args.jobs != 0 {
+		*args.workers = *args.jobs
+	}
+
+	if *args.workers <= 0 {
+		return errors.New("number of workers must be positive")
+	}
+
+	paths := make(chan string)
+	results := make(chan scanResult)
+
+	var workers sync.WaitGroup
+	for i := 0; i < *args.workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for path := range paths {
+				results <- scanFile(path, args)
+			}
+		}()
+	}
+
+	walkErr := make(chan error, 1)
+	go func() {
+		walkErr <- filepath.Walk(*args.dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() {
+				paths <- path
+			}
+			return nil
+		})
+		close(paths)
+		workers.Wait()
+		close(results)
+	}()
+
+	numScanned, numReported := 0, 0
+	for result := range results {
+		numScanned++
+
+		if result.err != nil {
+			if *args.verbose {
+				fmt.Printf("%s: skipped, %v\n", result.path, result.err)
+			}
+			continue
+		}
+
+		if result.header == "no" && result.suspicion < *args.threshold {
+			continue
+		}
+
+		numReported++
+		fmt.Printf("%s: header %s, suspicion %.3f\n", result.path, result.header, result.suspicion)
+	}
+
+	fmt.Println("Scanned:", numScanned, "files")
+	fmt.Println("Reported:", numReported, "files")
+
+	return <-walkErr
+}
+
+// scanFile parses the header of the image at path and runs the blind tests on it. Files that aren't images in
+// a supported format, or are larger than the limits, are skipped without being decoded.
+func scanFile(path string, args *ScanArgs) scanResult {
+	result := scanResult{path: path}
+
+	file, err := os.Open(path)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	if info.Size() > int64(*args.maxFileSize) {
+		result.err = fmt.Errorf("larger than %d bytes", *args.maxFileSize)
+		return result
+	}
+
+	config, format, err := image.DecodeConfig(file)
+	if err != nil {
+		result.err = stego.ErrUnsupportedFormat
+		return result
+	}
+
+	if config.Width*config.Height > *args.maxPixels {
+		result.err = fmt.Errorf("%s with more than %d pixels", format, *args.maxPixels)
+		return result
+	}
+
+	if _, err := file.Seek(0, 0); err != nil {
+		result.err = err
+		return result
+	}
+
+	img, err := stego.DecodeImage(file)
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	header, err := stego.DecodeHeader(img)
+	switch {
+	case err == nil:
+		result.header = "yes"
+	case header.Strategy != nil:
+		// The header was readable but couldn't be authenticated, which is what a passphrase protected header
+		// looks like
+		result.header = "maybe"
+	default:
+		result.header = "no"
+	}
+
+	result.suspicion = analysis.Detect(img).Score
+	return result
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"image"
+	"io/ioutil"
+	"math/rand"
+)
+
+// selftestPassphrase is the passphrase used for the encrypted round trips
+const selftestPassphrase = "selftest"
+
+// selftestCase is a combination of options a payload is round-tripped through
+type selftestCase struct {
+	name      string
+	opts      []stego.Option
+	encrypted bool
+}
+
+func selftest(args *SelftestArgs) error {
+	cover := makeNoiseImage(64, 64)
+
+	payload := make([]byte, 256)
+	rand.Read(payload)
+
+	numFailed := 0
+	for _, testCase := range makeSelftestCases() {
+		err := selftestRoundTrip(cover, payload, testCase)
+
+		if err != nil {
+			numFailed++
+			fmt.Printf("FAIL %s: %v\n", testCase.name, err)
+		} else if *args.verbose {
+			fmt.Printf("PASS %s\n", testCase.name)
+		}
+	}
+
+	if err := selftestHeaderless(cover, payload); err != nil {
+		numFailed++
+		fmt.Printf("FAIL headerless: %v\n", err)
+	} else if *args.verbose {
+		fmt.Println("PASS headerless")
+	}
+
+	for version := stego.HeaderVersion; version <= stego.HeaderVersion+1; version++ {
+		err := selftestHeaderVersion(version)
+
+		if err != nil {
+			numFailed++
+			fmt.Printf("FAIL header version %d: %v\n", version, err)
+		} else if *args.verbose {
+			fmt.Printf("PASS header version %d\n", version)
+		}
+	}
+
+	if numFailed > 0 {
+		return fmt.Errorf("%d round trips failed", numFailed)
+	}
+
+	fmt.Println("All round trips passed")
+	return nil
+}
+
+// makeSelftestCases returns every combination of strategy, encryption and traversal
+func makeSelftestCases() []selftestCase {
+	var cases []selftestCase
+
+	for _, strategy := range stego.Strategies() {
+		for _, traversal := range traversalNames {
+			for _, crypto := range []string{"plain", "encrypted", "hidden header"} {
+				if keyedTraversal(traversal) && crypto == "plain" {
+					continue
+				}
+
+				opts := []stego.Option{
+					stego.WithStrategy(strategy),
+					stego.WithBitsPerChannel(2),
+					stego.WithTraversal(makeTraversal(traversal, selftestPassphrase)),
+				}
+
+				if crypto != "plain" {
+					opts = append(opts, stego.WithPassphrase(selftestPassphrase))
+				}
+
+				if crypto == "hidden header" {
+					opts = append(opts, stego.WithHiddenHeader(true))
+				}
+
+				cases = append(cases, selftestCase{
+					name:      fmt.Sprintf("%s, %s traversal, %s", strategy.Name(), traversal, crypto),
+					opts:      opts,
+					encrypted: crypto != "plain",
+				})
+			}
+		}
+	}
+
+	return cases
+}
+
+// selftestRoundTrip conceals payload in cover and checks that revealing it returns the same bytes. An encrypted
+// payload must also fail to reveal with the wrong passphrase, and concealing the payload twice from the same
+// seed must make the same image.
+func selftestRoundTrip(cover image.Image, payload []byte, testCase selftestCase) error {
+	opts := testCase.opts
+
+	stegoImage, err := stego.ConcealImage(cover, bytes.NewReader(payload), opts...)
+	if err != nil {
+		return fmt.Errorf("conceal: %v", err)
+	}
+
+	var revealed bytes.Buffer
+	if _, err := stego.RevealImage(stegoImage, &revealed, opts...); err != nil {
+		return fmt.Errorf("reveal: %v", err)
+	}
+
+	if !bytes.Equal(revealed.Bytes(), payload) {
+		return errors.New("revealed payload differs from the concealed payload")
+	}
+
+	if testCase.encrypted {
+		wrongPassphrase := append(opts[:len(opts):len(opts)], stego.WithPassphrase("wrong "+selftestPassphrase))
+		if _, err := stego.RevealImage(stegoImage, ioutil.Discard, wrongPassphrase...); err == nil {
+			return errors.New("reveal with the wrong passphrase succeeded")
+		}
+	}
+
+	var seeded [2]*image.NRGBA
+	for i := range seeded {
+		seededOpts := append(opts[:len(opts):len(opts)], stego.WithRandom(stego.DeterministicRandom([]byte("selftest"))))
+		if seeded[i], err = stego.ConcealImage(cover, bytes.NewReader(payload), seededOpts...); err != nil {
+			return fmt.Errorf("seeded conceal: %v", err)
+		}
+	}
+
+	if !bytes.Equal(seeded[0].Pix, seeded[1].Pix) {
+		return errors.New("concealing from the same seed made different images")
+	}
+
+	return nil
+}
+
+// selftestHeaderless conceals payload in cover without a header and checks that it's revealed with the params
+// printed for it, and only with them
+func selftestHeaderless(cover image.Image, payload []byte) error {
+	opts := []stego.Option{
+		stego.WithPassphrase(selftestPassphrase),
+		stego.WithTraversal(makeTraversal("shuffled", selftestPassphrase)),
+	}
+
+	var params stego.Header
+	stegoImage, err := stego.ConcealImage(cover, bytes.NewReader(payload), append(opts, stego.WithHeaderless(&params))...)
+	if err != nil {
+		return fmt.Errorf("conceal: %v", err)
+	}
+
+	if _, err := stego.RevealImage(stegoImage, ioutil.Discard, opts...); err == nil {
+		return errors.New("reveal without the params succeeded")
+	}
+
+	parsed, err := stego.ParseParams(params.Params())
+	if err != nil {
+		return fmt.Errorf("parse params: %v", err)
+	}
+
+	var revealed bytes.Buffer
+	if _, err := stego.RevealImage(stegoImage, &revealed, append(opts, stego.WithParams(parsed))...); err != nil {
+		return fmt.Errorf("reveal: %v", err)
+	}
+
+	if !bytes.Equal(revealed.Bytes(), payload) {
+		return errors.New("revealed payload differs from the concealed payload")
+	}
+
+	return nil
+}
+
+// selftestHeaderVersion writes a header of version and checks that it's read back as it was written. A header of
+// HeaderVersion must be read, and one of the version after it must fail with ErrUnsupportedVersion.
+func selftestHeaderVersion(version int) error {
+	img := makeNoiseImage(64, 64)
+	header := stego.Header{
+		Version:           version,
+		NumBitsPerChannel: 2,
+		NumChannels:       3,
+		Strategy:          stego.Strategies()[0],
+		NumMessageBits:    800,
+	}
+
+	if err := header.Encode(img); err != nil {
+		return fmt.Errorf("encode: %v", err)
+	}
+
+	decoded, err := stego.DecodeHeader(img)
+	if version > stego.HeaderVersion {
+		if err != stego.ErrUnsupportedVersion {
+			return fmt.Errorf("decode returned %v instead of %v", err, stego.ErrUnsupportedVersion)
+		}
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("decode: %v", err)
+	}
+
+	if decoded.Version != header.Version || decoded.NumBitsPerChannel != header.NumBitsPerChannel ||
+		decoded.NumChannels != header.NumChannels || decoded.Strategy.Name() != header.Strategy.Name() ||
+		decoded.NumMessageBits != header.NumMessageBits {
+		return errors.New("decoded header differs from the encoded header")
+	}
+
+	return nil
+}
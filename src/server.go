@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"image"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timeouts of the HTTP server, so that a slow or idle client can't hold a connection forever. Writing allows the
+// most time since it also covers concealing or revealing the image.
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = time.Minute
+	writeTimeout      = 5 * time.Minute
+	idleTimeout       = 2 * time.Minute
+)
+
+var errTooManyPixels = errors.New("image has more pixels than max-pixels")
+
+// badRequest marks an error as the fault of the request rather than of the server, so that it's reported with
+// 400 instead of 500
+type badRequest struct {
+	error
+}
+
+func (self badRequest) Unwrap() error {
+	return self.error
+}
+
+// server exposes conceal, reveal and info over HTTP. Every request is handled in memory and at most
+// maxConcurrent requests are processed at a time.
+type server struct {
+	maxBytes  int64
+	maxPixels int
+	slots     chan struct{}
+	logger    *log.Logger
+}
+
+func serve(args *ServeArgs) error {
+	if *args.maxSize <= 0 {
+		return errors.New("maximum request size must be positive")
+	}
+
+	if *args.maxConcurrent <= 0 {
+		return errors.New("maximum number of concurrent requests must be positive")
+	}
+
+	if *args.maxPixels <= 0 {
+		return errors.New("maximum number of pixels must be positive")
+	}
+
+	self := &server{
+		maxBytes:  int64(*args.maxSize),
+		maxPixels: *args.maxPixels,
+		slots:     make(chan struct{}, *args.maxConcurrent),
+		logger:    log.New(os.Stdout, "", log.LstdFlags),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/conceal", self.handle(http.MethodPost, self.conceal))
+	mux.HandleFunc("/reveal", self.handle(http.MethodPost, self.reveal))
+	mux.HandleFunc("/info", self.handle(http.MethodGet, self.info))
+
+	httpServer := &http.Server{
+		Addr:              *args.address,
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+
+	self.logger.Println("Listening on", *args.address)
+	return httpServer.ListenAndServe()
+}
+
+// decodeImage decodes an uploaded image, checking the size it claims first. The size of a request is limited
+// but a small compressed image can still claim to be huge, so an image over maxPixels is rejected before any of
+// it is decoded.
+func (self *server) decodeImage(r io.Reader) (image.Image, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, badRequest{err}
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err == image.ErrFormat {
+		return nil, stego.ErrUnsupportedFormat
+	} else if err != nil {
+		return nil, badRequest{err}
+	}
+
+	if config.Width <= 0 || config.Height <= 0 || config.Width > self.maxPixels/config.Height {
+		return nil, errTooManyPixels
+	}
+
+	img, err := stego.DecodeImage(bytes.NewReader(data))
+	if err != nil && err != stego.ErrUnsupportedFormat {
+		return nil, badRequest{err}
+	}
+	return img, err
+}
+
+// handle wraps a handler so it only accepts method, waits for a free slot and limits the size of the request
+func (self *server) handle(method string, handler func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		select {
+		case self.slots <- struct{}{}:
+			defer func() { <-self.slots }()
+		case <-r.Context().Done():
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, self.maxBytes)
+
+		if err := handler(w, r); err != nil {
+			self.logger.Println(r.Method, r.URL.Path, err)
+			http.Error(w, err.Error(), statusCode(err))
+			return
+		}
+
+		self.logger.Println(r.Method, r.URL.Path, "ok")
+	}
+}
+
+// conceal expects a multipart form with a cover file, a payload file or message field, and the same options
+// as the conceal command. It responds with the stego image as a PNG.
+func (self *server) conceal(w http.ResponseWriter, r *http.Request) error {
+	if err := r.ParseMultipartForm(self.maxBytes); err != nil {
+		return badRequest{err}
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	cover, _, err := r.FormFile("cover")
+	if err != nil {
+		return badRequest{errors.New("cover is required")}
+	}
+	defer cover.Close()
+
+	img, err := self.decodeImage(cover)
+	if err != nil {
+		return err
+	}
+
+	var payload io.Reader
+	if file, _, err := r.FormFile("payload"); err == nil {
+		defer file.Close()
+		payload = file
+	} else if message := r.FormValue("message"); message != "" {
+		payload = strings.NewReader(message)
+	} else {
+		return badRequest{errors.New("payload or message is required")}
+	}
+
+	opts, err := formOptions(r)
+	if err != nil {
+		return badRequest{err}
+	}
+
+	outputImage, err := stego.ConcealImage(img, payload, opts...)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	return stego.EncodeImage(w, outputImage)
+}
+
+// reveal expects a multipart form with an image file, the passphrase and the traversal. It responds with the
+// revealed message.
+func (self *server) reveal(w http.ResponseWriter, r *http.Request) error {
+	if err := r.ParseMultipartForm(self.maxBytes); err != nil {
+		return badRequest{err}
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		return badRequest{errors.New("image is required")}
+	}
+	defer file.Close()
+
+	img, err := self.decodeImage(file)
+	if err != nil {
+		return err
+	}
+
+	opts, err := formOptions(r)
+	if err != nil {
+		return badRequest{err}
+	}
+
+	decoder, err := stego.NewDecoder(img, opts...)
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+
+	// Read the whole message first so an error can still be reported with a status code
+	message, err := ioutil.ReadAll(decoder)
+	defer zeroBytes(message)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, err = w.Write(message)
+	return err
+}
+
+// info expects the image as the request body and an optional passphrase in the X-Passphrase header, which
+// unlike a query parameter doesn't end up in access logs. It responds with the header as JSON.
+func (self *server) info(w http.ResponseWriter, r *http.Request) error {
+	img, err := self.decodeImage(r.Body)
+	if err != nil {
+		return err
+	}
+
+	header, err := stego.DecodeHeader(img, stego.WithPassphrase(r.Header.Get("X-Passphrase")))
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"version":        header.Version,
+		"bitsPerChannel": header.NumBitsPerChannel,
+		"channels":       header.NumChannels,
+		"strategy":       header.Strategy.Name(),
+		"messageSize":    header.NumMessageBits / 8,
+		"encryption":     header.Encryption.String(),
+		"compression":    header.Codec.String(),
+	})
+}
+
+// formOptions adapts the form fields of a request to Options, using the same names and defaults as the
+// command line
+func formOptions(r *http.Request) ([]stego.Option, error) {
+	passphrase := r.FormValue("passphrase")
+	opts := []stego.Option{
+		stego.WithContext(r.Context()),
+		stego.WithPassphrase(passphrase),
+		stego.WithHiddenHeader(r.FormValue("hide-header") == "true"),
+	}
+
+	if value := r.FormValue("traversal"); value != "" {
+		traversal, ok := stego.LookupTraversal(value, passphrase)
+		if !ok {
+			return nil, fmt.Errorf("unknown traversal %q", value)
+		}
+		opts = append(opts, stego.WithTraversal(traversal))
+	}
+
+	if keyedTraversal(r.FormValue("traversal")) && passphrase == "" {
+		return nil, errors.New("keyed traversal requires a passphrase")
+	}
+
+	if r.FormValue("hide-header") == "true" && passphrase == "" {
+		return nil, errors.New("hide-header requires a passphrase")
+	}
+
+	if value := r.FormValue("num-bits"); value != "" {
+		num, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("num-bits: %v", err)
+		}
+		if num < 1 || num > 8 {
+			return nil, errors.New("num-bits must be between 1 and 8")
+		}
+		opts = append(opts, stego.WithBitsPerChannel(num))
+	}
+
+	if value := r.FormValue("channels"); value != "" {
+		num, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("channels: %v", err)
+		}
+		if num < 1 || num > 4 {
+			return nil, errors.New("channels must be between 1 and 4")
+		}
+		opts = append(opts, stego.WithChannels(num))
+	}
+
+	if value := r.FormValue("strategy"); value != "" {
+		strategy, ok := stego.LookupStrategy(value)
+		if !ok {
+			return nil, fmt.Errorf("unknown strategy %q", value)
+		}
+		opts = append(opts, stego.WithStrategy(strategy))
+	}
+
+	if value := r.FormValue("compress"); value != "" {
+		codec, level, err := parseCodec(value)
+		if err != nil {
+			return nil, fmt.Errorf("compress: %v", err)
+		}
+		opts = append(opts, stego.WithCodec(codec, level))
+	}
+
+	return opts, nil
+}
+
+// statusCode maps an error to the HTTP status it is reported with. An error that isn't known to be the fault of
+// the request is the fault of the server.
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, stego.ErrCapacityExceeded), errors.Is(err, stego.ErrNotStegoImage),
+		errors.Is(err, stego.ErrCorruptPayload), errors.Is(err, stego.ErrCorruptHeader),
+		errors.Is(err, stego.ErrUnsupportedVersion):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, stego.ErrWrongPassphrase), errors.Is(err, stego.ErrPassphraseRequired),
+		errors.Is(err, stego.ErrPrivateKeyRequired), errors.Is(err, stego.ErrNotEncrypted):
+		return http.StatusForbidden
+	case errors.Is(err, errTooManyPixels):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, stego.ErrUnsupportedFormat):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, stego.ErrExpired):
+		return http.StatusGone
+	case errors.As(err, &badRequest{}):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
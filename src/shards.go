@@ -0,0 +1,440 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// concealShards splits message across the images matching the covers glob, filling as many of them as it takes
+// in the order of their names, and conceals each shard along with metadata saying where it goes. With a
+// threshold it's split into shares with concealShares instead, and with mirror it's copied to every cover with
+// concealMirrors. Every stego image is written to the output directory under the name of its cover, or else
+// next to its cover.
+func concealShards(args *ConcealArgs, message []byte, metadata *stego.Metadata, opts []stego.Option) error {
+	covers, outputPaths, err := shardCovers(args)
+	if err != nil {
+		return err
+	}
+
+	seed := *args.seed
+	if seed != "" {
+		seed = "shards " + seed
+	}
+	set, err := newID(seed)
+	if err != nil {
+		return err
+	}
+
+	if *args.threshold != 0 && *args.mirror || *args.chain && (*args.threshold != 0 || *args.mirror) {
+		return usageError{errors.New("only one of threshold, mirror and chain can be given")}
+	}
+
+	if *args.threshold != 0 {
+		return concealShares(args, covers, outputPaths, set, message, metadata, opts)
+	}
+
+	if *args.mirror {
+		return concealMirrors(args, covers, outputPaths, set, message, metadata, opts)
+	}
+
+	shardMetadata := stego.Metadata{}
+	if metadata != nil {
+		shardMetadata = *metadata
+	}
+
+	// Every cover is planned with the metadata of the last shard there could be, which is as large as that of
+	// any shard of the fewer there will be
+	shards := stego.NewShards(set, len(covers), message)
+	shardMetadata.Shard = &shards[len(shards)-1]
+
+	// Every shard of a chain but the last also points to the next image, by a checksum and a name at most as
+	// long as the longest of their names
+	if *args.chain {
+		hint := ""
+		for _, outputPath := range outputPaths {
+			if len(filepath.Base(outputPath)) > len(hint) {
+				hint = filepath.Base(outputPath)
+			}
+		}
+		shardMetadata.Next = &stego.Link{SHA256: strings.Repeat("0", 64), Hint: hint}
+	}
+
+	capacities := make([]int, len(covers))
+	total := 0
+	for i, cover := range covers {
+		plan, err := planShard(cover, 0, shardMetadata, opts)
+		if err != nil {
+			return err
+		}
+		capacities[i] = plan.MaxMessageBytes
+		total += plan.MaxMessageBytes
+	}
+
+	parts, err := stego.SplitShards(message, capacities)
+	if err != nil {
+		return fmt.Errorf("the covers hold %d bytes of the %d of the message: %w", total, len(message), err)
+	}
+
+	shards = stego.NewShards(set, len(parts), message)
+	if *args.chain {
+		return concealChain(args, covers, outputPaths, parts, shards, shardMetadata, opts)
+	}
+
+	for i, part := range parts {
+		shardMetadata.Shard = &shards[i]
+		if err := writeShard(args, covers[i], outputPaths[i], part, shardMetadata, opts); err != nil {
+			return fmt.Errorf("shard %d of %d: %w", i+1, len(parts), err)
+		}
+
+		fmt.Printf("Wrote %s (shard %d of %d, %d bytes)\n", outputPaths[i], i+1, len(parts), len(part))
+	}
+
+	fmt.Println("Set:", set)
+	if len(parts) < len(covers) {
+		fmt.Println("Unused covers:", len(covers)-len(parts))
+	}
+	if metadata != nil && metadata.ID != "" {
+		fmt.Println("ID:", metadata.ID)
+	}
+	return nil
+}
+
+// concealShares splits message and its metadata into a share for every cover with Shamir's secret sharing, so
+// that any threshold of the stego images recover it, and conceals each share with metadata that only says which
+// share it is. Every cover must have room for a whole share, which is as large as the message.
+func concealShares(args *ConcealArgs, covers []string, outputPaths []string, set string, message []byte,
+	metadata *stego.Metadata, opts []stego.Option) error {
+
+	if *args.threshold < 1 || *args.threshold > len(covers) {
+		return usageError{fmt.Errorf("threshold must be between 1 and the %d covers", len(covers))}
+	}
+
+	shares, contents, err := stego.SplitSecret(set, message, metadata, *args.threshold, len(covers), opts...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, content := range contents {
+			zeroBytes(content)
+		}
+	}()
+
+	// Every cover is checked before any image is written, so that a cover that is too small doesn't leave a set
+	// with too few shares behind
+	for i, cover := range covers {
+		plan, err := planShard(cover, len(contents[i]), stego.Metadata{Share: &shares[i]}, opts)
+		if err != nil {
+			return err
+		}
+		if !plan.Fits() {
+			return fmt.Errorf("%s holds %d bytes of the %d of a share: %w", cover, plan.MaxMessageBytes,
+				len(contents[i]), stego.ErrCapacityExceeded)
+		}
+	}
+
+	for i, content := range contents {
+		if err := writeShard(args, covers[i], outputPaths[i], content, stego.Metadata{Share: &shares[i]}, opts); err != nil {
+			return fmt.Errorf("share %d of %d: %w", i+1, len(contents), err)
+		}
+
+		fmt.Printf("Wrote %s (share %d of %d, %d needed)\n", outputPaths[i], i+1, len(contents), *args.threshold)
+	}
+
+	fmt.Println("Set:", set)
+	if metadata != nil && metadata.ID != "" {
+		fmt.Println("ID:", metadata.ID)
+	}
+	return nil
+}
+
+// concealMirrors conceals the whole message in every cover, with metadata saying which set of copies it's one of
+func concealMirrors(args *ConcealArgs, covers []string, outputPaths []string, set string, message []byte,
+	metadata *stego.Metadata, opts []stego.Option) error {
+
+	mirror := stego.NewMirror(set, len(covers), message)
+	mirrorMetadata := stego.Metadata{}
+	if metadata != nil {
+		mirrorMetadata = *metadata
+	}
+	mirrorMetadata.Mirror = &mirror
+
+	// Every cover is checked before any image is written, like the covers of shares
+	for _, cover := range covers {
+		plan, err := planShard(cover, len(message), mirrorMetadata, opts)
+		if err != nil {
+			return err
+		}
+		if !plan.Fits() {
+			return fmt.Errorf("%s holds %d bytes of the %d of the message: %w", cover, plan.MaxMessageBytes,
+				len(message), stego.ErrCapacityExceeded)
+		}
+	}
+
+	for i, cover := range covers {
+		if err := writeShard(args, cover, outputPaths[i], message, mirrorMetadata, opts); err != nil {
+			return fmt.Errorf("copy %d of %d: %w", i+1, len(covers), err)
+		}
+
+		fmt.Printf("Wrote %s (copy %d of %d)\n", outputPaths[i], i+1, len(covers))
+	}
+
+	fmt.Println("Set:", set)
+	if metadata != nil && metadata.ID != "" {
+		fmt.Println("ID:", metadata.ID)
+	}
+	return nil
+}
+
+// shardCovers returns the covers matching the covers glob in the order of their names, along with the path each
+// stego image is written to
+func shardCovers(args *ConcealArgs) ([]string, []string, error) {
+	covers, err := filepath.Glob(*args.covers)
+	if err != nil {
+		return nil, nil, usageError{err}
+	}
+	if len(covers) == 0 {
+		return nil, nil, usageError{errors.New("no images match covers")}
+	}
+
+	outputPaths := make([]string, len(covers))
+	for i, cover := range covers {
+		outputPaths[i] = cover + ".out"
+		if *args.output != "" {
+			outputPaths[i] = filepath.Join(*args.output, strings.TrimSuffix(filepath.Base(cover), filepath.Ext(cover))+".png")
+		}
+		if sameFile(cover, outputPaths[i]) {
+			return nil, nil, usageError{fmt.Errorf("%s would be written over its cover, give another output directory",
+				cover)}
+		}
+	}
+
+	if *args.output != "" {
+		if err := os.MkdirAll(*args.output, 0755); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return covers, outputPaths, nil
+}
+
+// planShard plans concealing size bytes with metadata in cover
+func planShard(cover string, size int, metadata stego.Metadata, opts []stego.Option) (stego.Plan, error) {
+	config, err := imageConfig(cover)
+	if err != nil {
+		return stego.Plan{}, fmt.Errorf("%s: %w", cover, err)
+	}
+
+	return stego.PlanConceal(config.Width, config.Height, size, append(opts, stego.WithMetadata(metadata))...)
+}
+
+// writeShard conceals part with metadata in cover and writes the stego image to outputPath, checking its quality
+// when conceal was asked to
+func writeShard(args *ConcealArgs, cover string, outputPath string, part []byte, metadata stego.Metadata,
+	opts []stego.Option) error {
+
+	shardOpts := append(opts, stego.WithMetadata(metadata))
+	write := func(path string) error {
+		return stego.Conceal(cover, part, path, shardOpts...)
+	}
+	if *args.minPSNR > 0 || *args.minSSIM > 0 {
+		write = checkQuality(cover, *args.minPSNR, *args.minSSIM, *args.warnQuality, write)
+	}
+
+	return write(outputPath)
+}
+
+// sameFile reports whether the paths name the same file, going by their absolute paths
+func sameFile(a string, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// revealShards reveals the shards, shares or copies in the images matching the shards glob, which can be in any
+// order, and joins them back into the message they were split from. Images that can't be revealed are skipped
+// when the others are copies of a mirrored message.
+func revealShards(args *RevealArgs) error {
+	paths, err := filepath.Glob(*args.shards)
+	if err != nil {
+		return usageError{err}
+	}
+	if len(paths) == 0 {
+		return usageError{errors.New("no images match shards")}
+	}
+
+	var shards []stego.Shard
+	var shares []stego.Share
+	var mirrors []stego.Mirror
+	var failed []error
+	parts := make([][]byte, 0, len(paths))
+	defer func() {
+		for _, part := range parts {
+			zeroBytes(part)
+		}
+	}()
+
+	var metadata *stego.Metadata
+	for _, path := range paths {
+		message, result, err := stego.Reveal(path, args.options()...)
+
+		// A damaged image may still hold a copy of a mirrored message that's good enough to vote with
+		if errors.Is(err, stego.ErrCorruptPayload) || errors.Is(err, stego.ErrCorruptHeader) {
+			var damagedErr error
+			message, result, damagedErr = stego.Reveal(path, append(args.options(), stego.WithBestEffort(true))...)
+			if damagedErr == nil && (result.Metadata == nil || result.Metadata.Mirror == nil) {
+				zeroBytes(message)
+				damagedErr = err
+			}
+			err = damagedErr
+		}
+		if err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+
+		switch {
+		case result.Metadata != nil && result.Metadata.Shard != nil:
+			shards = append(shards, *result.Metadata.Shard)
+		case result.Metadata != nil && result.Metadata.Share != nil:
+			shares = append(shares, *result.Metadata.Share)
+		case result.Metadata != nil && result.Metadata.Mirror != nil:
+			mirrors = append(mirrors, *result.Metadata.Mirror)
+		default:
+			zeroBytes(message)
+			return fmt.Errorf("%s doesn't hold a shard, share or copy of a message", path)
+		}
+
+		parts = append(parts, message)
+		metadata = result.Metadata
+	}
+
+	// Only copies of a mirrored message can do without some of the images
+	if len(failed) > 0 && len(mirrors) == 0 {
+		return failed[0]
+	}
+	for _, err := range failed {
+		fmt.Fprintln(os.Stderr, "Warning: skipped", err)
+	}
+
+	kinds := 0
+	for _, count := range []int{len(shards), len(shares), len(mirrors)} {
+		if count > 0 {
+			kinds++
+		}
+	}
+	if kinds > 1 {
+		return stego.ErrMixedShards
+	}
+
+	if len(shares) > 0 {
+		return joinShares(args, shares, parts)
+	}
+
+	if len(mirrors) > 0 {
+		return voteMirrors(args, mirrors, parts, metadata)
+	}
+
+	return joinShards(args, shards, parts, metadata)
+}
+
+// joinShards joins shards made with conceal --covers back into the message and writes or prints it like reveal.
+// metadata is that of one of the shards.
+func joinShards(args *RevealArgs, shards []stego.Shard, parts [][]byte, metadata *stego.Metadata) error {
+	message, err := stego.JoinShards(shards, parts)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(message)
+
+	// The rest of the metadata describes the whole message, and is the same in every shard
+	shard := metadata.Shard
+	metadata.Shard, metadata.Next = nil, nil
+	if err := metadata.Validate(len(message)); err != nil {
+		return err
+	}
+
+	if err := outputMessage(*args.outputDir, metadata, message, "message"); err != nil {
+		return err
+	}
+
+	logger := makeLogger(*args.verbose)
+	if metadata.Name != "" {
+		logger.Println("Name:", metadata.Name)
+		logger.Println("Type:", metadata.Type)
+	}
+	printMetadata(logger, metadata)
+	logger.Println("Set:", shard.Set)
+	logger.Println("Shards:", shard.Count)
+	logger.Println("Size:", shard.Size, "bytes")
+	logger.Println("SHA-256:", shard.SHA256)
+
+	warnExpired(metadata)
+	return nil
+}
+
+// joinShares recovers the message from shares made with conceal --threshold and their contents
+func joinShares(args *RevealArgs, shares []stego.Share, contents [][]byte) error {
+	message, metadata, err := stego.CombineShares(shares, contents, args.options()...)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(message)
+
+	if err := outputMessage(*args.outputDir, metadata, message, "message"); err != nil {
+		return err
+	}
+
+	logger := makeLogger(*args.verbose)
+	if metadata != nil {
+		if metadata.Name != "" {
+			logger.Println("Name:", metadata.Name)
+			logger.Println("Type:", metadata.Type)
+		}
+		printMetadata(logger, metadata)
+	}
+	logger.Println("Set:", shares[0].Set)
+	logger.Println("Shares:", len(shares), "of", shares[0].Count, "given,", shares[0].Threshold, "needed")
+	logger.Println("Size:", len(message), "bytes")
+
+	warnExpired(metadata)
+	return nil
+}
+
+// voteMirrors recovers a mirrored message from its copies by voting on every chunk of it, and writes or prints
+// it like reveal. metadata is that of one of the copies.
+func voteMirrors(args *RevealArgs, mirrors []stego.Mirror, copies [][]byte, metadata *stego.Metadata) error {
+	message, vote, err := stego.VoteMirrors(mirrors, copies)
+	logger := makeLogger(*args.verbose)
+	logger.Println("Copies:", vote.Copies, "of", mirrors[0].Copies)
+	logger.Println("Chunks repaired:", vote.Repaired, "of", vote.Chunks)
+	if vote.Unresolved > 0 {
+		fmt.Fprintln(os.Stderr, "Warning: the copies had no majority for", vote.Unresolved, "of", vote.Chunks, "chunks")
+	}
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(message)
+
+	// The rest of the metadata describes the message, and is the same in every copy that isn't damaged
+	set := metadata.Mirror.Set
+	metadata.Mirror = nil
+
+	if err := outputMessage(*args.outputDir, metadata, message, "message"); err != nil {
+		return err
+	}
+
+	if metadata.Name != "" {
+		logger.Println("Name:", metadata.Name)
+		logger.Println("Type:", metadata.Type)
+	}
+	printMetadata(logger, metadata)
+	logger.Println("Set:", set)
+	logger.Println("Size:", len(message), "bytes")
+
+	warnExpired(metadata)
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// concealSlots conceals the file of every slot given in its own slot of the image, revealed with the passphrase
+// given with it
+func concealSlots(args *ConcealArgs) error {
+	if *args.slots < 1 || len(*args.slotSpecs) == 0 || len(*args.slotSpecs) > *args.slots {
+		return usageError{errors.New("slots must be positive, and given at least as many times as slot")}
+	}
+
+	if *args.covers != "" || *args.message != "" || len(*args.files) > 0 || *args.passphrase != "" ||
+		*args.publicKeyPath != "" || *args.appendPayload || *args.tiled || *args.noHeader || *args.hideHeader ||
+		*args.dryRun || *args.selfCheck || *args.audit || *args.targetPSNR > 0 || *args.targetSSIM > 0 {
+		return usageError{errors.New("slots cannot be used with covers, message, file, passphrase, public-key, " +
+			"append, tiled, no-header, hide-header, dry-run, self-check, audit, target-psnr or target-ssim")}
+	}
+
+	slots := make([]stego.Slot, 0, len(*args.slotSpecs))
+	defer func() {
+		for _, slot := range slots {
+			zeroBytes(slot.Message)
+		}
+	}()
+
+	for _, spec := range *args.slotSpecs {
+		i := strings.LastIndex(spec, "=")
+		if i <= 0 || i == len(spec)-1 {
+			return usageError{fmt.Errorf("slot %q isn't written as passphrase=path", spec)}
+		}
+		path := spec[i+1:]
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		metadata := fileMetadata(path, content)
+		slots = append(slots, stego.Slot{Passphrase: spec[:i], Message: content, Metadata: &metadata})
+	}
+
+	args.applyProfile()
+	opts := args.options()
+
+	write := func(outputPath string) error {
+		cover, err := stego.LoadImage(*args.imagePath)
+		if err != nil {
+			return err
+		}
+
+		img, err := stego.ConcealSlots(cover, *args.slots, slots, opts...)
+		if err != nil {
+			return err
+		}
+		return stego.SaveImage(outputPath, img, opts...)
+	}
+	if *args.minPSNR > 0 || *args.minSSIM > 0 {
+		write = checkQuality(*args.imagePath, *args.minPSNR, *args.minSSIM, *args.warnQuality, write)
+	}
+
+	if *args.inPlace {
+		return concealInPlace(*args.imagePath, *args.backup, write)
+	}
+	return write(*args.output)
+}
+
+// revealSlot reveals the file in the slot of the image the passphrase opens
+func revealSlot(args *RevealArgs) error {
+	if *args.imagePath == "" {
+		return usageError{errors.New("slots requires an image path")}
+	}
+
+	img, err := stego.LoadImage(*args.imagePath)
+	if err != nil {
+		return err
+	}
+
+	message, metadata, err := stego.RevealSlot(img, *args.slots, *args.passphrase, args.options()...)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(message)
+
+	name := strings.TrimSuffix(filepath.Base(*args.imagePath), filepath.Ext(*args.imagePath))
+	if err := outputMessage(*args.outputDir, metadata, message, name); err != nil {
+		return err
+	}
+
+	logger := makeLogger(*args.verbose)
+	if metadata != nil {
+		if metadata.Name != "" {
+			logger.Println("Name:", metadata.Name)
+			logger.Println("Type:", metadata.Type)
+		}
+		printMetadata(logger, metadata)
+		warnExpired(metadata)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+package main
+
+import "os"
+
+// isTerminal reports whether file is attached to a terminal rather than redirected to a file or pipe
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// concealTiled conceals message in the PNG at imagePath a band of rows at a time and writes the stego image to
+// outputPath
+func concealTiled(imagePath string, message []byte, outputPath string, opts []stego.Option) error {
+	input, err := os.Open(imagePath)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	output, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(output)
+
+	if err := stego.ConcealTiled(bufio.NewReader(input), writer, bytes.NewReader(message), opts...); err != nil {
+		output.Close()
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		output.Close()
+		return err
+	}
+
+	return output.Close()
+}
+
+// revealTiled reveals the message in the PNG at imagePath a band of rows at a time. With an output directory
+// the message is written to a temporary file there and renamed after the file it was concealed from once it
+// has been revealed, otherwise it's printed as it's revealed.
+func revealTiled(imagePath string, outputDir string, verbose bool, opts []stego.Option) error {
+	input, err := os.Open(imagePath)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	if outputDir == "" {
+		writer := bufio.NewWriter(os.Stdout)
+		fmt.Fprint(writer, "Message: ")
+
+		metadata, err := stego.RevealTiled(bufio.NewReader(input), writer, opts...)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(writer)
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+
+		printTiledMetadata(metadata, verbose)
+		return nil
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(outputDir, ".reveal.*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	writer := bufio.NewWriter(temp)
+
+	metadata, err := stego.RevealTiled(bufio.NewReader(input), writer, opts...)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(imagePath), filepath.Ext(imagePath))
+	if metadata != nil {
+		if len(metadata.Entries) > 0 {
+			return errors.New("the message holds several files, which tiled can't extract")
+		}
+		name = metadata.FileName(name)
+	}
+
+	path := filepath.Join(outputDir, name)
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return err
+	}
+	if metadata != nil {
+		if err := restoreAttributes(path, entries(metadata, 0)[0]); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Wrote", path)
+	printTiledMetadata(metadata, verbose)
+	return nil
+}
+
+// printTiledMetadata prints the metadata stored with a message revealed by revealTiled when verbose, and warns
+// when the message has expired
+func printTiledMetadata(metadata *stego.Metadata, verbose bool) {
+	if metadata == nil {
+		return
+	}
+
+	warnExpired(metadata)
+	logger := makeLogger(verbose)
+	if metadata.Name != "" {
+		logger.Println("Name:", metadata.Name)
+		logger.Println("Type:", metadata.Type)
+	}
+	printMetadata(logger, metadata)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"io"
+)
+
+// verify checks that every payload of an image can be found. With deep, every payload is also read to the end,
+// so an encrypted payload is decrypted and authenticated and its metadata is checked against its content,
+// without writing it anywhere.
+func verify(args *VerifyArgs) error {
+	img, err := stego.LoadImage(*args.imagePath)
+	if err != nil {
+		return err
+	}
+
+	// An expired payload is still checked, since it's only revealing it that expiry refuses
+	opts := []stego.Option{
+		stego.WithPassphrase(*args.passphrase),
+		stego.WithTraversal(makeTraversal(*args.traversal, *args.passphrase)),
+		stego.WithIgnoreExpiry(true),
+	}
+	opts = append(opts, paramsOptions(*args.params)...)
+
+	index := 0
+
+	for ; ; index++ {
+		decoder, err := stego.NewDecoder(img, append(opts, stego.WithPayload(index))...)
+		if err == stego.ErrNotStegoImage && index > 0 {
+			break
+		} else if err != nil {
+			return fmt.Errorf("payload %d: %w", index, err)
+		}
+
+		if *args.deep {
+			err = verifyPayload(decoder, index)
+		} else {
+			fmt.Printf("Payload %d: %d bytes embedded, encryption %s\n", index, decoder.EmbeddedSize(), encryptionName(decoder.Header()))
+		}
+
+		decoder.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Verified", index, "payloads")
+	return nil
+}
+
+// encryptionName describes how the message of an image with header is encrypted
+func encryptionName(header stego.Header) string {
+	if header.Version == stego.FormatV1 {
+		return "not recorded"
+	}
+	return header.Encryption.String()
+}
+
+// verifyPayload reads the payload of decoder to the end and checks its metadata against it. The ID stored with
+// the payload is printed along with it.
+func verifyPayload(decoder *stego.Decoder, index int) error {
+	checksum := sha256.New()
+
+	size, err := io.Copy(checksum, decoder)
+	if err != nil {
+		return fmt.Errorf("payload %d: %w", index, err)
+	}
+
+	metadata, _ := decoder.Metadata()
+	if metadata != nil && len(metadata.Entries) > 0 {
+		total := 0
+		for _, entry := range metadata.Entries {
+			total += entry.Size
+		}
+
+		if int64(total) != size {
+			return fmt.Errorf("payload %d: %w, its files add up to %d bytes but it holds %d", index, stego.ErrCorruptPayload, total, size)
+		}
+	}
+
+	fmt.Printf("Payload %d: %d bytes, SHA-256 %x", index, size, checksum.Sum(nil))
+	if decoder.Encrypted() {
+		fmt.Print(", decrypted")
+	}
+	if decoder.Header().Codec != stego.CodecNone {
+		fmt.Print(", decompressed")
+	}
+	if decoder.Verified() {
+		fmt.Print(", checksum verified")
+	}
+	if metadata != nil && metadata.ID != "" {
+		fmt.Print(", ID ", metadata.ID)
+	}
+	fmt.Println()
+
+	return nil
+}
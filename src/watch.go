@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"image"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// watchedFile is what a file in the watched directory looked like when it was last seen. A file is only
+// processed once it stopped changing between two scans, so files that are still being written are skipped.
+type watchedFile struct {
+	size      int64
+	modTime   time.Time
+	processed bool
+}
+
+func watch(args *WatchArgs) error {
+	if keyedTraversal(*args.traversal) && *args.passphrase == "" {
+		return errors.New("keyed traversal requires a passphrase")
+	}
+
+	if !*args.reveal && *args.coverPath == "" {
+		return errors.New("a cover image is required to conceal files")
+	}
+
+	if *args.interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+
+	if err := os.MkdirAll(*args.outDir, 0755); err != nil {
+		return err
+	}
+
+	var cover image.Image
+	if !*args.reveal {
+		img, err := stego.LoadImage(*args.coverPath)
+		if err != nil {
+			return err
+		}
+		cover = img
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	go func() {
+		select {
+		case <-interrupt:
+			stop()
+		case <-ctx.Done():
+		}
+	}()
+
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+	logger.Println("Watching", *args.inDir)
+
+	files := map[string]*watchedFile{}
+	ticker := time.NewTicker(time.Duration(*args.interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if err := scanWatchedDir(ctx, args, cover, files, logger); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// scanWatchedDir processes every file in the watched directory that is new or changed and has stopped changing
+func scanWatchedDir(ctx context.Context, args *WatchArgs, cover image.Image, files map[string]*watchedFile, logger *log.Logger) error {
+	entries, err := ioutil.ReadDir(*args.inDir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		seen, ok := files[entry.Name()]
+		if !ok || seen.size != entry.Size() || !seen.modTime.Equal(entry.ModTime()) {
+			files[entry.Name()] = &watchedFile{size: entry.Size(), modTime: entry.ModTime()}
+			continue
+		}
+
+		if seen.processed {
+			continue
+		}
+		seen.processed = true
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		start := time.Now()
+		outputPath, err := processWatchedFile(ctx, args, cover, entry.Name())
+		if err != nil {
+			logger.Println(entry.Name(), "failed:", err)
+		} else {
+			logger.Println(entry.Name(), "->", outputPath)
+		}
+
+		if err := writeWatchLog(args, entry.Name(), outputPath, time.Since(start), err); err != nil {
+			logger.Println(entry.Name(), "failed to write log:", err)
+		}
+	}
+
+	return nil
+}
+
+// processWatchedFile conceals the file in the cover image or reveals the message in it, depending on the mode,
+// and returns the path of the output
+func processWatchedFile(ctx context.Context, args *WatchArgs, cover image.Image, name string) (string, error) {
+	inputPath := filepath.Join(*args.inDir, name)
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	opts := append(args.options(), stego.WithContext(ctx))
+
+	if *args.reveal {
+		message, result, err := stego.Reveal(inputPath, opts...)
+		if err != nil {
+			return "", err
+		}
+		defer zeroBytes(message)
+
+		if result.Metadata != nil {
+			base = result.Metadata.FileName(base)
+		}
+
+		outputPath := filepath.Join(*args.outDir, base)
+		if err := ioutil.WriteFile(outputPath, message, 0600); err != nil {
+			return "", err
+		}
+		if result.Metadata != nil && len(result.Metadata.Entries) == 0 {
+			return outputPath, restoreAttributes(outputPath, entries(result.Metadata, 0)[0])
+		}
+		return outputPath, nil
+	}
+
+	message, err := ioutil.ReadFile(inputPath)
+	if err != nil {
+		return "", err
+	}
+	defer zeroBytes(message)
+
+	metadata := fileMetadata(inputPath, message)
+	if *args.id {
+		if metadata.ID, err = newID(""); err != nil {
+			return "", err
+		}
+	}
+	opts = append(opts, stego.WithMetadata(metadata))
+
+	outputImage, err := stego.ConcealImage(cover, bytes.NewReader(message), opts...)
+	if err != nil {
+		return "", err
+	}
+
+	outputPath := filepath.Join(*args.outDir, base+".png")
+	return outputPath, stego.SaveImage(outputPath, outputImage)
+}
+
+// writeWatchLog writes the result of processing a file to a log next to its output
+func writeWatchLog(args *WatchArgs, name string, outputPath string, duration time.Duration, err error) error {
+	result := "ok"
+	if err != nil {
+		result = err.Error()
+	}
+
+	entry := fmt.Sprintf("Input: %s\nOutput: %s\nResult: %s\nDuration: %s\n",
+		filepath.Join(*args.inDir, name), outputPath, result, duration)
+
+	return ioutil.WriteFile(filepath.Join(*args.outDir, name+".log"), []byte(entry), 0644)
+}
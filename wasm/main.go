@@ -0,0 +1,156 @@
+//go:build js && wasm
+// +build js,wasm
+
+// Command wasm exposes conceal and reveal to JavaScript so a page can hide and reveal messages entirely in the
+// browser. Images and messages are passed as Uint8Arrays and every function returns an object holding either
+// data or an error.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/andresmejia3/hide/pkg/stego"
+	"image"
+	"image/png"
+	"syscall/js"
+)
+
+func main() {
+	js.Global().Set("hideConceal", js.FuncOf(conceal))
+	js.Global().Set("hideReveal", js.FuncOf(reveal))
+
+	// Keep the functions available for as long as the page is open
+	select {}
+}
+
+// conceal is called as hideConceal(cover, message, options) and returns the stego image as PNG bytes
+func conceal(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return failure("hideConceal expects a cover image and a message")
+	}
+
+	img, err := decodeImage(args[0])
+	if err != nil {
+		return failure(err.Error())
+	}
+
+	message := toBytes(args[1])
+	opts, err := makeOptions(optionsArg(args, 2))
+	if err != nil {
+		return failure(err.Error())
+	}
+
+	outputImage, err := stego.ConcealImage(img, bytes.NewReader(message), opts...)
+	if err != nil {
+		return failure(err.Error())
+	}
+
+	var output bytes.Buffer
+	if err := png.Encode(&output, outputImage); err != nil {
+		return failure(err.Error())
+	}
+
+	return success(output.Bytes())
+}
+
+// reveal is called as hideReveal(image, options) and returns the revealed message
+func reveal(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return failure("hideReveal expects an image")
+	}
+
+	img, err := decodeImage(args[0])
+	if err != nil {
+		return failure(err.Error())
+	}
+
+	opts, err := makeOptions(optionsArg(args, 1))
+	if err != nil {
+		return failure(err.Error())
+	}
+
+	var message bytes.Buffer
+	if _, err := stego.RevealImage(img, &message, opts...); err != nil {
+		return failure(err.Error())
+	}
+
+	return success(message.Bytes())
+}
+
+// makeOptions adapts a JavaScript options object to Options. Every property is optional, but an unknown
+// strategy or traversal is an error rather than silently replaced by the default.
+func makeOptions(options js.Value) ([]stego.Option, error) {
+	var opts []stego.Option
+
+	if options.IsUndefined() || options.IsNull() {
+		return opts, nil
+	}
+
+	passphrase := ""
+	if value := options.Get("passphrase"); value.Type() == js.TypeString {
+		passphrase = value.String()
+		opts = append(opts, stego.WithPassphrase(passphrase))
+	}
+
+	if value := options.Get("bitsPerChannel"); value.Type() == js.TypeNumber {
+		opts = append(opts, stego.WithBitsPerChannel(value.Int()))
+	}
+
+	if value := options.Get("channels"); value.Type() == js.TypeNumber {
+		opts = append(opts, stego.WithChannels(value.Int()))
+	}
+
+	if value := options.Get("strategy"); value.Type() == js.TypeString {
+		strategy, ok := stego.LookupStrategy(value.String())
+		if !ok {
+			return nil, fmt.Errorf("unknown strategy %q", value.String())
+		}
+		opts = append(opts, stego.WithStrategy(strategy))
+	}
+
+	if value := options.Get("traversal"); value.Type() == js.TypeString {
+		traversal, ok := stego.LookupTraversal(value.String(), passphrase)
+		if !ok {
+			return nil, fmt.Errorf("unknown traversal %q", value.String())
+		}
+		opts = append(opts, stego.WithTraversal(traversal))
+	}
+
+	if value := options.Get("hideHeader"); value.Type() == js.TypeBoolean {
+		opts = append(opts, stego.WithHiddenHeader(value.Bool()))
+	}
+
+	return opts, nil
+}
+
+func optionsArg(args []js.Value, index int) js.Value {
+	if index < len(args) {
+		return args[index]
+	}
+	return js.Undefined()
+}
+
+func decodeImage(value js.Value) (image.Image, error) {
+	return stego.DecodeImage(bytes.NewReader(toBytes(value)))
+}
+
+// toBytes copies a Uint8Array, or the UTF-8 encoding of a string, into Go memory
+func toBytes(value js.Value) []byte {
+	if value.Type() == js.TypeString {
+		return []byte(value.String())
+	}
+
+	b := make([]byte, value.Get("length").Int())
+	js.CopyBytesToGo(b, value)
+	return b
+}
+
+func success(data []byte) interface{} {
+	array := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(array, data)
+	return map[string]interface{}{"data": array}
+}
+
+func failure(message string) interface{} {
+	return map[string]interface{}{"error": message}
+}